@@ -0,0 +1,63 @@
+// Command server runs the project endpoint behind a standard net/http server,
+// for trying the service locally against DynamoDB Local:
+//
+//	go run ./cmd/server -addr :8080 -endpoint http://localhost:8000
+//
+// The AWS credentials and region are read from the environment as usual,
+// though DynamoDB Local accepts any.
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"net/http"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+
+	"telemetry/utils"
+)
+
+// projectHandler queries the readings of the project in the path on GET,
+// and writes the readings in the body on POST, through the same ingest path as the Lambda.
+func projectHandler(
+	request *utils.Request,
+) (events.APIGatewayProxyResponse, error) {
+	client := utils.Client()
+
+	switch request.Method {
+	case "GET":
+		params, err := utils.ParseQueryParams(request)
+		if err != nil {
+			return utils.BadRequestResponse(err.Error())
+		}
+		if device := request.QueryStringParameters["device"]; device != "" {
+			params.DeviceId = device
+		}
+		return utils.QueryResponse(request.Context(), client, request, params)
+	case "POST":
+		return utils.PostResponse(request.Context(), client, request)
+	}
+	return utils.MethodNotAllowedResponse()
+}
+
+func main() {
+	addr := flag.String("addr", ":8080", "address to listen on")
+	endpoint := flag.String("endpoint", "http://localhost:8000", "DynamoDB endpoint, such as DynamoDB Local")
+	flag.Parse()
+
+	cfg, err := config.LoadDefaultConfig(context.TODO())
+	if err != nil {
+		log.Fatalf("Failed to load configuration, %v", err)
+	}
+	utils.SetClient(dynamodb.NewFromConfig(cfg, func(options *dynamodb.Options) {
+		options.EndpointResolver = dynamodb.EndpointResolverFromURL(*endpoint)
+	}))
+
+	mux := http.NewServeMux()
+	mux.Handle("/projects/", utils.HTTPHandler(utils.Recover(projectHandler), "/projects/{ProjectId}"))
+	log.Printf("Listening on %s, with DynamoDB at %s", *addr, *endpoint)
+	log.Fatal(http.ListenAndServe(*addr, mux))
+}
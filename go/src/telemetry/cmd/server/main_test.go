@@ -0,0 +1,114 @@
+package main
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"telemetry/utils"
+	"telemetry/utils/dynamotest"
+)
+
+func TestProjectHandler(t *testing.T) {
+	tests := []struct {
+		name       string
+		method     string
+		target     string
+		body       string
+		setup      func(server *dynamotest.Server)
+		wantStatus int
+		wantHeader map[string]string
+		check      func(t *testing.T, server *dynamotest.Server, body string)
+	}{
+		{
+			name:   "get of a device",
+			method: "GET",
+			target: "/projects/sensors?device=d1",
+			setup: func(server *dynamotest.Server) {
+				server.Respond("Query", `{"Count": 1, "ScannedCount": 1, "Items": [{
+					"ProjectId#DeviceId": {"S": "sensors#d1"},
+					"DeviceId": {"S": "d1"},
+					"EpochTime": {"N": "1600000000"},
+					"Temperature": {"N": "21.5"}
+				}]}`)
+			},
+			wantStatus: 200,
+			check: func(t *testing.T, server *dynamotest.Server, body string) {
+				queries := server.Calls("Query")
+				if len(queries) != 1 {
+					t.Fatalf("made %d queries, want 1", len(queries))
+				}
+				values := queries[0].Input["ExpressionAttributeValues"].(map[string]interface{})
+				if key := values[":primaryValue"].(map[string]interface{})["S"]; key != "sensors#d1" {
+					t.Errorf("partition key = %v, want sensors#d1", key)
+				}
+				if !strings.Contains(body, "21.5") {
+					t.Errorf("body = %s, want the device's reading", body)
+				}
+			},
+		},
+		{
+			name:       "get with a malformed limit",
+			method:     "GET",
+			target:     "/projects/sensors?limit=many",
+			wantStatus: 400,
+		},
+		{
+			name:       "post writes the reading",
+			method:     "POST",
+			target:     "/projects/sensors",
+			body:       `{"DeviceId": "d1", "EpochTime": 1600000000, "Temperature": 21.5}`,
+			wantStatus: 200,
+			wantHeader: map[string]string{"Location": "/projects/sensors/devices/d1?at=1600000000"},
+			check: func(t *testing.T, server *dynamotest.Server, body string) {
+				if puts := server.Calls("PutItem"); len(puts) != 1 {
+					t.Errorf("made %d puts, want 1", len(puts))
+				}
+			},
+		},
+		{
+			name:       "post of a malformed body",
+			method:     "POST",
+			target:     "/projects/sensors",
+			body:       `{`,
+			wantStatus: 400,
+		},
+		{
+			name:       "other methods",
+			method:     "DELETE",
+			target:     "/projects/sensors",
+			wantStatus: 405,
+		},
+		{
+			name:       "path off the route",
+			method:     "GET",
+			target:     "/projects/sensors/d1",
+			wantStatus: 404,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := dynamotest.NewServer(t)
+			utils.SetClient(server.Client())
+			if test.setup != nil {
+				test.setup(server)
+			}
+			r := httptest.NewRequest(test.method, test.target, strings.NewReader(test.body))
+			r.Header.Set("Content-Type", "application/json")
+			recorder := httptest.NewRecorder()
+
+			utils.HTTPHandler(utils.Recover(projectHandler), "/projects/{ProjectId}").ServeHTTP(recorder, r)
+			if recorder.Code != test.wantStatus {
+				t.Fatalf("status = %d, want %d, body %s", recorder.Code, test.wantStatus, recorder.Body)
+			}
+			for name, want := range test.wantHeader {
+				if got := recorder.Header().Get(name); got != want {
+					t.Errorf("header %s = %q, want %q", name, got, want)
+				}
+			}
+			if test.check != nil {
+				test.check(t, server, recorder.Body.String())
+			}
+		})
+	}
+}
@@ -2,4 +2,22 @@ package constants
 
 const (
 	TABLE_NAME = "TelemetryOld"
+
+	// Global secondary indexes, both sorted by EpochTime.
+	PROJECT_INDEX  = "ProjectId-EpochTime-index"
+	LOCATION_INDEX = "ProjectIdLocationId-EpochTime-index"
+
+	// Local secondary index of each device's readings, sorted by SequenceNum.
+	SEQUENCE_INDEX = "ProjectIdDeviceId-SequenceNum-index"
+
+	METRICS_NAMESPACE = "Thermonitor/Telemetry"
+
+	// Idempotency keys are remembered for a day by default.
+	IDEMPOTENCY_TTL = 24 * 60 * 60
+
+	// DynamoDB rejects items larger than 400KB, including attribute names.
+	MAX_ITEM_SIZE = 400 * 1024
+
+	// API Gateway rejects responses larger than 10MB, so the items of a response stop short of it.
+	RESPONSE_SIZE_BUDGET = 9 * 1024 * 1024
 )
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go/aws"
+
+	"telemetry/utils"
+)
+
+// defaultRetentionDays is how long readings stay in DynamoDB when ARCHIVE_RETENTION_DAYS is unset.
+const defaultRetentionDays = 90
+
+// archiveConfig is read from the environment on each run.
+type archiveConfig struct {
+	// Projects whose readings are archived, from the comma-separated ARCHIVE_PROJECTS.
+	Projects []string
+	// RetentionDays is the age in days after which readings are archived, from ARCHIVE_RETENTION_DAYS.
+	RetentionDays int
+	// Bucket and Prefix locate the archives in S3, from ARCHIVE_BUCKET and ARCHIVE_PREFIX.
+	Bucket string
+	Prefix string
+	// DryRun logs what would be archived without writing to S3 or deleting anything,
+	// from ARCHIVE_DRY_RUN.
+	DryRun bool
+}
+
+func loadConfig() (archiveConfig, error) {
+	cfg := archiveConfig{
+		RetentionDays: defaultRetentionDays,
+		Bucket:        os.Getenv("ARCHIVE_BUCKET"),
+		Prefix:        os.Getenv("ARCHIVE_PREFIX"),
+	}
+	for _, project := range strings.Split(os.Getenv("ARCHIVE_PROJECTS"), ",") {
+		if project = strings.TrimSpace(project); project != "" {
+			cfg.Projects = append(cfg.Projects, project)
+		}
+	}
+	if days, ok := os.LookupEnv("ARCHIVE_RETENTION_DAYS"); ok {
+		parsed, err := strconv.Atoi(days)
+		if err != nil || parsed < 1 {
+			return cfg, fmt.Errorf("ARCHIVE_RETENTION_DAYS must be a whole number of at least 1, got %q", days)
+		}
+		cfg.RetentionDays = parsed
+	}
+	if dryRun, ok := os.LookupEnv("ARCHIVE_DRY_RUN"); ok {
+		parsed, err := utils.ParseBoolParam(dryRun)
+		if err != nil {
+			return cfg, fmt.Errorf("ARCHIVE_DRY_RUN: %v", err)
+		}
+		cfg.DryRun = parsed
+	}
+	if cfg.Bucket == "" && !cfg.DryRun {
+		return cfg, errors.New("ARCHIVE_BUCKET must be set")
+	}
+	return cfg, nil
+}
+
+// archiver holds the clients an archive run uses.
+type archiver struct {
+	dynamo *dynamodb.Client
+	s3     utils.S3PutObjectAPI
+}
+
+// archiveProject exports a project's readings older than the cutoff to S3 a page at a time,
+// one object per date in each page, and deletes each page from the table once every one of its
+// objects has been written. Only a page is ever held in memory. After each page, a checkpoint
+// records where archiving reached, so that a run that stops part way, such as by timing out,
+// is resumed by the next without revisiting readings the project's index may still return
+// after they were deleted.
+func (a archiver) archiveProject(
+	ctx context.Context,
+	cfg archiveConfig,
+	project string,
+	cutoff float64,
+	run time.Time,
+) error {
+	tenant := utils.ProjectTenant(project)
+	input, err := utils.BuildQueryInput(utils.QueryParams{
+		TenantId:       tenant,
+		ProjectId:      project,
+		End:            &cutoff,
+		IncludeDeleted: true,
+	})
+	if err != nil {
+		return err
+	}
+	if input.ExclusiveStartKey, err = utils.LoadArchiveCheckpoint(ctx, a.dynamo, tenant, project); err != nil {
+		return fmt.Errorf("failed to load checkpoint, %v", err)
+	}
+
+	var archived int
+	var pageErr error
+	page := 0
+	_, err = utils.PaginateQuery(ctx, a.dynamo, input, func(output *dynamodb.QueryOutput) bool {
+		page++
+		if pageErr = a.archivePage(ctx, cfg, project, output.Items, run, page); pageErr != nil {
+			return true
+		}
+		archived += len(output.Items)
+		if cfg.DryRun {
+			return false
+		}
+		pageErr = utils.SaveArchiveCheckpoint(ctx, a.dynamo, tenant, project, output.LastEvaluatedKey)
+		return pageErr != nil
+	})
+	if err == nil {
+		err = pageErr
+	}
+	if !cfg.DryRun {
+		log.Printf("Deleted %d archived readings of project %s", archived, project)
+	}
+	return err
+}
+
+// archivePage writes one page of a project's readings to S3, one object per date,
+// and deletes them from the table once every object has been written.
+func (a archiver) archivePage(
+	ctx context.Context,
+	cfg archiveConfig,
+	project string,
+	items []map[string]types.AttributeValue,
+	run time.Time,
+	page int,
+) error {
+	groups := utils.GroupByDate(items)
+	if cfg.DryRun {
+		for _, date := range utils.SortedDates(groups) {
+			log.Printf(
+				"Dry run: would archive %d readings of project %s to s3://%s/%s",
+				len(groups[date]), project, cfg.Bucket, utils.ArchiveKey(cfg.Prefix, project, date, run, page),
+			)
+		}
+		return nil
+	}
+
+	for _, date := range utils.SortedDates(groups) {
+		body, err := utils.EncodeNDJSON(groups[date])
+		if err != nil {
+			return err
+		}
+		key := utils.ArchiveKey(cfg.Prefix, project, date, run, page)
+		_, err = a.s3.PutObject(ctx, &s3.PutObjectInput{
+			Bucket:      aws.String(cfg.Bucket),
+			Key:         aws.String(key),
+			Body:        bytes.NewReader(body),
+			ContentType: aws.String("application/x-ndjson"),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to write s3://%s/%s, %v", cfg.Bucket, key, err)
+		}
+		log.Printf("Archived %d readings of project %s to s3://%s/%s", len(groups[date]), project, cfg.Bucket, key)
+	}
+
+	// Only readings that were written to S3 are deleted.
+	for _, group := range groups {
+		if err := utils.DeleteItems(ctx, a.dynamo, group); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// archiveHandler is an AWS Lambda function run on a schedule.
+// It moves readings older than the retention period out of DynamoDB and into S3,
+// as newline-delimited JSON partitioned by project and date.
+func archiveHandler(ctx context.Context, event events.CloudWatchEvent) error {
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	awsConfig, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to load configuration, %v", err)
+	}
+	a := archiver{dynamo: utils.Client(), s3: s3.NewFromConfig(awsConfig)}
+
+	run := utils.Now()
+	cutoff := float64(run.AddDate(0, 0, -cfg.RetentionDays).Unix())
+
+	// Every project is attempted, even after one fails, and the failures reported together.
+	var failed []string
+	for _, project := range cfg.Projects {
+		if err := a.archiveProject(ctx, cfg, project, cutoff, run); err != nil {
+			log.Printf("Failed to archive project %s, %v", project, err)
+			failed = append(failed, project)
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("failed to archive projects %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+func main() {
+	lambda.Start(archiveHandler)
+}
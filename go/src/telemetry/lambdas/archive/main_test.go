@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go/aws"
+
+	"telemetry/utils/dynamotest"
+)
+
+// fakeBucket records the objects put into it, failing every put when err is set.
+type fakeBucket struct {
+	err     error
+	objects map[string]string
+}
+
+func (bucket *fakeBucket) PutObject(
+	ctx context.Context,
+	params *s3.PutObjectInput,
+	optFns ...func(*s3.Options),
+) (*s3.PutObjectOutput, error) {
+	if bucket.err != nil {
+		return nil, bucket.err
+	}
+	body, _ := io.ReadAll(params.Body)
+	if bucket.objects == nil {
+		bucket.objects = make(map[string]string)
+	}
+	bucket.objects[aws.StringValue(params.Key)] = string(body)
+	return &s3.PutObjectOutput{}, nil
+}
+
+func TestLoadConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		want    archiveConfig
+		wantErr bool
+	}{
+		{
+			name: "defaults",
+			env:  map[string]string{"ARCHIVE_BUCKET": "b"},
+			want: archiveConfig{RetentionDays: defaultRetentionDays, Bucket: "b"},
+		},
+		{
+			name: "projects and retention",
+			env: map[string]string{
+				"ARCHIVE_BUCKET":         "b",
+				"ARCHIVE_PREFIX":         "archive",
+				"ARCHIVE_PROJECTS":       " sensors, ,dogs",
+				"ARCHIVE_RETENTION_DAYS": "30",
+			},
+			want: archiveConfig{Projects: []string{"sensors", "dogs"}, RetentionDays: 30, Bucket: "b", Prefix: "archive"},
+		},
+		{
+			name: "dry run without a bucket",
+			env:  map[string]string{"ARCHIVE_DRY_RUN": "true"},
+			want: archiveConfig{RetentionDays: defaultRetentionDays, DryRun: true},
+		},
+		{name: "no bucket", wantErr: true},
+		{name: "zero retention", env: map[string]string{"ARCHIVE_BUCKET": "b", "ARCHIVE_RETENTION_DAYS": "0"}, wantErr: true},
+		{name: "malformed dry run", env: map[string]string{"ARCHIVE_BUCKET": "b", "ARCHIVE_DRY_RUN": "maybe"}, wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			for _, name := range []string{"ARCHIVE_BUCKET", "ARCHIVE_PREFIX", "ARCHIVE_PROJECTS"} {
+				t.Setenv(name, test.env[name])
+			}
+			for _, name := range []string{"ARCHIVE_RETENTION_DAYS", "ARCHIVE_DRY_RUN"} {
+				if value, ok := test.env[name]; ok {
+					t.Setenv(name, value)
+				}
+			}
+
+			got, err := loadConfig()
+			if (err != nil) != test.wantErr {
+				t.Fatalf("loadConfig() error = %v, wantErr %v", err, test.wantErr)
+			}
+			if !test.wantErr && !reflect.DeepEqual(got, test.want) {
+				t.Errorf("loadConfig() = %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestArchiveProject(t *testing.T) {
+	// Readings from two dates, 2020-09-12 and 2020-09-13.
+	const page = `{"Count": 2, "Items": [
+		{"ProjectId#DeviceId": {"S": "sensors#d1"}, "EpochTime": {"N": "1599955199"}},
+		{"ProjectId#DeviceId": {"S": "sensors#d1"}, "EpochTime": {"N": "1600000000"}}
+	]}`
+	run := time.Unix(1600000000, 0)
+	tests := []struct {
+		name           string
+		dryRun         bool
+		bucketErr      error
+		wantErr        bool
+		wantObjects    []string
+		wantDeletes    int
+		wantCheckpoint bool
+	}{
+		{
+			name: "archived and deleted",
+			wantObjects: []string{
+				"archive/ProjectId=sensors/date=2020-09-12/1600000000-1.ndjson",
+				"archive/ProjectId=sensors/date=2020-09-13/1600000000-1.ndjson",
+			},
+			wantDeletes:    2,
+			wantCheckpoint: true,
+		},
+		{
+			name:   "dry run",
+			dryRun: true,
+		},
+		{
+			name:      "failed upload keeps the readings",
+			bucketErr: errors.New("access denied"),
+			wantErr:   true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := dynamotest.NewServer(t)
+			server.Respond("Query", page)
+			bucket := &fakeBucket{err: test.bucketErr}
+			a := archiver{dynamo: server.Client(), s3: bucket}
+			cfg := archiveConfig{Bucket: "b", Prefix: "archive", DryRun: test.dryRun}
+
+			err := a.archiveProject(context.Background(), cfg, "sensors", 1600000000, run)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("archiveProject() error = %v, wantErr %v", err, test.wantErr)
+			}
+			var objects []string
+			for key, body := range bucket.objects {
+				objects = append(objects, key)
+				if strings.Count(body, "\n") != 1 {
+					t.Errorf("object %s = %q, want one reading", key, body)
+				}
+			}
+			if len(objects) != len(test.wantObjects) {
+				t.Errorf("wrote %v, want %v", objects, test.wantObjects)
+			}
+			for _, key := range test.wantObjects {
+				if _, ok := bucket.objects[key]; !ok {
+					t.Errorf("wrote %v, want %s", objects, key)
+				}
+			}
+			// Each date's readings are deleted once they're written.
+			if deletes := server.Calls("BatchWriteItem"); len(deletes) != test.wantDeletes {
+				t.Errorf("made %d batch deletes, want %d", len(deletes), test.wantDeletes)
+			}
+			// With no more pages, the finished run clears its checkpoint.
+			if cleared := len(server.Calls("DeleteItem")) == 1; cleared != test.wantCheckpoint {
+				t.Errorf("checkpoint cleared = %v, want %v", cleared, test.wantCheckpoint)
+			}
+		})
+	}
+}
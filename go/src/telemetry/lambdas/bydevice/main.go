@@ -1,8 +1,15 @@
 package main
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 
 	"telemetry/utils"
 )
@@ -12,34 +19,182 @@ import (
 // It uses path parameters and optional query string parameters to retrieve data
 // from DynamoDB for a particular project and device.
 func deviceEndpointHandler(
-	request events.APIGatewayProxyRequest,
+	request *utils.Request,
 ) (events.APIGatewayProxyResponse, error) {
-	client := utils.InitClient()
+	client := utils.Client()
 
-	// This handler only handles GET requests.
-	if request.HTTPMethod == "GET" {
-		// The primary key is a composite key of the ProjectId and DeviceId
-		primaryValue := utils.CreateCompositeKey(&request, "ProjectId", "DeviceId")
+	// This handler handles GET, PATCH, and DELETE requests.
+	if request.Method == "GET" {
+		// The query string parameters ('single', 'start', 'end', 'after', 'limit',
+		// 'stride', 'consistent') are shared by all of the GET endpoints.
+		// Device queries run against the base table, so they can also be strongly consistent.
+		params, err := utils.ParseQueryParams(request)
+		if err != nil {
+			return utils.BadRequestResponse(err.Error())
+		}
+		params.DeviceId = request.PathParameters["DeviceId"]
 
-		input := utils.CreateQueryInput("ProjectId#DeviceId", primaryValue)
+		// The 'at' query string parameter, as in the Location of a newly written reading,
+		// fetches the device's reading at exactly that EpochTime.
+		if atStr, atOk := request.QueryStringParameters["at"]; atOk {
+			at, err := strconv.ParseFloat(atStr, 64)
+			if err != nil {
+				return utils.BadRequestResponse(fmt.Sprintf("at must be a number, got %q", atStr))
+			}
+			if params.Start != nil || params.End != nil || params.After != nil {
+				return utils.BadRequestResponse("at cannot be combined with start, end, or after")
+			}
+			params.Start, params.End = &at, &at
+		}
 
-		// If the 'single' query string parameter exists and is truthy, fetch a single value only.
-		// This value is the most recent device data or the most recent in the chosen time frame,
-		// if supplied with the 'start' and/or 'end' query parameters.
-		single := utils.EvaluateSingleParam(&request, input)
+		return utils.QueryResponse(request.Context(), client, request, params)
+	}
 
-		// The 'start' and 'end' query string parameters
-		// set the inclusive time range for queried data.
-		// Both are optional, and one can be supplied without the other.
-		utils.EvaluateStartEndParams(&request, input)
+	// DELETE requests soft-delete the device's reading at the 'epochTime' query string parameter.
+	// The reading is kept for auditing, but no longer returned by queries.
+	if request.Method == "DELETE" {
+		if err := request.CheckAuthorizedProject(); err != nil {
+			return utils.ForbiddenResponse(err.Error())
+		}
+		if isRangeDelete(request) {
+			return handleRangeDelete(request, client)
+		}
+		epochTime, err := epochTimeParam(request)
+		if err != nil {
+			return utils.BadRequestResponse(err.Error())
+		}
 
-		items := utils.GetData(client, input, single)
+		found, err := utils.SoftDeleteReading(
+			request.Context(),
+			client,
+			request.TenantId,
+			request.PathParameters["ProjectId"],
+			request.PathParameters["DeviceId"],
+			epochTime,
+		)
+		if err != nil {
+			log.Printf("Failed to delete reading, %v", err)
+			return utils.InternalErrorResponse("Failed to delete reading")
+		}
+		if !found {
+			return utils.NotFoundResponse("No reading at that epochTime")
+		}
+		return utils.DeleteSuccessResponse()
+	}
 
-		return utils.GetSuccessResponse(items)
+	// PATCH requests update only the fields in the body of the device's reading at the
+	// 'epochTime' query string parameter, leaving its other fields intact.
+	if request.Method == "PATCH" {
+		if err := request.CheckAuthorizedProject(); err != nil {
+			return utils.ForbiddenResponse(err.Error())
+		}
+		epochTime, err := epochTimeParam(request)
+		if err != nil {
+			return utils.BadRequestResponse(err.Error())
+		}
+		body, err := utils.DecodeRequestBody(request)
+		if errors.Is(err, utils.ErrBodyTooLarge) {
+			return utils.PayloadTooLargeResponse(err.Error())
+		}
+		if err != nil {
+			return utils.BadRequestResponse(err.Error())
+		}
+		var fields map[string]interface{}
+		if err := json.Unmarshal(body, &fields); err != nil || fields == nil {
+			return utils.BadRequestResponse("Patch must be a JSON object")
+		}
+		// Patched fields are held to the same rules as POSTed readings, though NaN and infinite
+		// numbers are always rejected, since dropping them would silently skip part of the patch.
+		project := request.PathParameters["ProjectId"]
+		if err := utils.HandleNonFiniteNumbers(fields, false); err != nil {
+			return utils.BadRequestResponse(err.Error())
+		}
+		if err := utils.NormalizeFields(fields, project); err != nil {
+			var semanticErr *utils.SemanticError
+			if errors.As(err, &semanticErr) {
+				return utils.UnprocessableEntityResponse(semanticErr.Error(), semanticErr.Violations)
+			}
+			return utils.BadRequestResponse(err.Error())
+		}
+		// Aliases are applied first, so that a key field can't be patched under another name.
+		if err := utils.ValidatePatch(fields); err != nil {
+			return utils.BadRequestResponse(err.Error())
+		}
+
+		found, err := utils.PatchReading(
+			request.Context(),
+			client,
+			request.TenantId,
+			project,
+			request.PathParameters["DeviceId"],
+			epochTime,
+			fields,
+		)
+		if err != nil {
+			log.Printf("Failed to update reading, %v", err)
+			return utils.InternalErrorResponse("Failed to update reading")
+		}
+		if !found {
+			return utils.NotFoundResponse("No reading at that epochTime")
+		}
+		return utils.UpdateSuccessResponse()
 	}
 	return utils.MethodNotAllowedResponse()
 }
 
+// isRangeDelete reports whether a DELETE request names a range of readings, with the 'start'
+// or 'end' query string parameters, rather than a single one.
+func isRangeDelete(request *utils.Request) bool {
+	_, startOk := request.QueryStringParameters["start"]
+	_, endOk := request.QueryStringParameters["end"]
+	return startOk || endOk
+}
+
+// handleRangeDelete permanently deletes the device's readings from the 'start' to the 'end'
+// query string parameters, inclusive, as when a sensor was miscalibrated for a known window.
+// Both are required, and only administrators may delete a range.
+func handleRangeDelete(
+	request *utils.Request,
+	client *dynamodb.Client,
+) (events.APIGatewayProxyResponse, error) {
+	if !request.IsAdmin() {
+		return utils.ForbiddenResponse("Deleting a range of readings requires the admin token")
+	}
+	params, err := utils.ParseQueryParams(request)
+	if err != nil {
+		return utils.BadRequestResponse(err.Error())
+	}
+	if params.Start == nil || params.End == nil {
+		return utils.BadRequestResponse("Deleting a range of readings requires both start and end")
+	}
+
+	deleted, err := utils.DeleteRange(
+		request.Context(),
+		client,
+		request.TenantId,
+		request.PathParameters["ProjectId"],
+		request.PathParameters["DeviceId"],
+		params.Start,
+		params.End,
+	)
+	if err != nil {
+		log.Printf("Failed to delete readings after deleting %d, %v", deleted, err)
+		return utils.StorageErrorResponse(err, "Failed to delete readings")
+	}
+	return utils.JSONResponse(map[string]int{"deleted": deleted})
+}
+
+// epochTimeParam parses the required 'epochTime' query string parameter,
+// which identifies a single reading of the device.
+func epochTimeParam(request *utils.Request) (float64, error) {
+	epochTimeStr := request.QueryStringParameters["epochTime"]
+	epochTime, err := strconv.ParseFloat(epochTimeStr, 64)
+	if err != nil {
+		return 0, fmt.Errorf("epochTime must be a number, got %q", epochTimeStr)
+	}
+	return epochTime, nil
+}
+
 func main() {
-	lambda.Start(deviceEndpointHandler)
+	lambda.Start(utils.Adapt(utils.Recover(utils.WithMetrics(deviceEndpointHandler))))
 }
@@ -0,0 +1,321 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"telemetry/utils"
+	"telemetry/utils/dynamotest"
+)
+
+func TestDeviceEndpointHandler(t *testing.T) {
+	admin := map[string]interface{}{"projectId": "*"}
+	tests := []struct {
+		name       string
+		request    utils.Request
+		setup      func(server *dynamotest.Server)
+		wantStatus int
+		check      func(t *testing.T, server *dynamotest.Server, body string)
+	}{
+		{
+			name:       "get queries the device",
+			request:    utils.Request{Method: "GET"},
+			wantStatus: 200,
+			check: func(t *testing.T, server *dynamotest.Server, body string) {
+				queries := server.Calls("Query")
+				if len(queries) != 1 || queries[0].Input["IndexName"] != nil {
+					t.Errorf("queries = %v, want one of the base table", queries)
+				}
+			},
+		},
+		{
+			name:       "consistent get",
+			request:    utils.Request{Method: "GET", QueryStringParameters: map[string]string{"consistent": "true"}},
+			wantStatus: 200,
+			check: func(t *testing.T, server *dynamotest.Server, body string) {
+				queries := server.Calls("Query")
+				if len(queries) != 1 || queries[0].Input["ConsistentRead"] != true {
+					t.Errorf("queries = %v, want one consistent read", queries)
+				}
+			},
+		},
+		{
+			name:       "get of a single item with another boolean form",
+			request:    utils.Request{Method: "GET", QueryStringParameters: map[string]string{"single": "On"}},
+			wantStatus: 200,
+			check: func(t *testing.T, server *dynamotest.Server, body string) {
+				queries := server.Calls("Query")
+				if len(queries) != 1 || queries[0].Input["Limit"] != 1.0 {
+					t.Errorf("queries = %v, want one of a single item", queries)
+				}
+			},
+		},
+		{
+			name: "get excluding a sentinel",
+			request: utils.Request{
+				Method:                "GET",
+				QueryStringParameters: map[string]string{"excludeSentinel": "Temperature:-999"},
+			},
+			wantStatus: 200,
+			check: func(t *testing.T, server *dynamotest.Server, body string) {
+				queries := server.Calls("Query")
+				if len(queries) != 1 {
+					t.Fatalf("made %d queries, want 1", len(queries))
+				}
+				filter, _ := queries[0].Input["FilterExpression"].(string)
+				if !strings.Contains(filter, "#sentinel0 <> :sentinel0") {
+					t.Errorf("FilterExpression = %q, want the sentinel left out", filter)
+				}
+			},
+		},
+		{
+			name:       "get excluding a malformed sentinel",
+			request:    utils.Request{Method: "GET", QueryStringParameters: map[string]string{"excludeSentinel": "-999"}},
+			wantStatus: 400,
+		},
+		{
+			name:       "get with a malformed boolean",
+			request:    utils.Request{Method: "GET", QueryStringParameters: map[string]string{"single": "maybe"}},
+			wantStatus: 400,
+			check: func(t *testing.T, server *dynamotest.Server, body string) {
+				if !strings.Contains(body, "single must be true/false") {
+					t.Errorf("body = %s, want the accepted forms", body)
+				}
+			},
+		},
+		{
+			name: "get of a window without its shared bound",
+			request: utils.Request{
+				Method:                "GET",
+				QueryStringParameters: map[string]string{"start": "5", "end": "9", "endInclusive": "false"},
+			},
+			wantStatus: 200,
+			check: func(t *testing.T, server *dynamotest.Server, body string) {
+				queries := server.Calls("Query")
+				if len(queries) != 1 || !strings.Contains(queries[0].Input["FilterExpression"].(string), "<> :end") {
+					t.Errorf("queries = %v, want readings at the end filtered out", queries)
+				}
+			},
+		},
+		{
+			name:       "get with an exclusive start but no start",
+			request:    utils.Request{Method: "GET", QueryStringParameters: map[string]string{"startInclusive": "false"}},
+			wantStatus: 400,
+		},
+		{
+			name:       "get accepting only XML",
+			request:    utils.Request{Method: "GET", Headers: map[string]string{"Accept": "application/xml"}},
+			wantStatus: 406,
+			check: func(t *testing.T, server *dynamotest.Server, body string) {
+				if queries := server.Calls("Query"); len(queries) != 0 {
+					t.Errorf("made %d queries, want none", len(queries))
+				}
+			},
+		},
+		{
+			name:       "get of a sequence range",
+			request:    utils.Request{Method: "GET", QueryStringParameters: map[string]string{"seqStart": "3", "seqEnd": "7"}},
+			wantStatus: 200,
+			check: func(t *testing.T, server *dynamotest.Server, body string) {
+				queries := server.Calls("Query")
+				if len(queries) != 1 || queries[0].Input["IndexName"] != "ProjectIdDeviceId-SequenceNum-index" {
+					t.Errorf("queries = %v, want one of the sequence index", queries)
+				}
+			},
+		},
+		{
+			name: "get of a sequence range with a time range",
+			request: utils.Request{
+				Method:                "GET",
+				QueryStringParameters: map[string]string{"seqStart": "3", "start": "1"},
+			},
+			wantStatus: 400,
+		},
+		{
+			name:       "get at an EpochTime",
+			request:    utils.Request{Method: "GET", QueryStringParameters: map[string]string{"at": "1600000000"}},
+			wantStatus: 200,
+		},
+		{
+			name:       "get at a malformed EpochTime",
+			request:    utils.Request{Method: "GET", QueryStringParameters: map[string]string{"at": "soon"}},
+			wantStatus: 400,
+		},
+		{
+			name: "get at an EpochTime within a range",
+			request: utils.Request{
+				Method:                "GET",
+				QueryStringParameters: map[string]string{"at": "1600000000", "start": "1"},
+			},
+			wantStatus: 400,
+		},
+		{
+			name: "delete soft-deletes the reading",
+			request: utils.Request{
+				Method:                "DELETE",
+				QueryStringParameters: map[string]string{"epochTime": "1600000000"},
+			},
+			wantStatus: 200,
+			check: func(t *testing.T, server *dynamotest.Server, body string) {
+				if updates := server.Calls("UpdateItem"); len(updates) != 1 {
+					t.Errorf("made %d updates, want 1", len(updates))
+				}
+			},
+		},
+		{
+			name: "delete of a missing reading",
+			request: utils.Request{
+				Method:                "DELETE",
+				QueryStringParameters: map[string]string{"epochTime": "1600000000"},
+			},
+			setup: func(server *dynamotest.Server) {
+				server.Fail("UpdateItem", "ConditionalCheckFailedException")
+			},
+			wantStatus: 404,
+		},
+		{
+			name: "delete of another project",
+			request: utils.Request{
+				Method:                "DELETE",
+				QueryStringParameters: map[string]string{"epochTime": "1600000000"},
+				Authorizer:            map[string]interface{}{"projectId": "dogs"},
+			},
+			wantStatus: 403,
+			check: func(t *testing.T, server *dynamotest.Server, body string) {
+				if updates := server.Calls("UpdateItem"); len(updates) != 0 {
+					t.Errorf("made %d updates, want none", len(updates))
+				}
+			},
+		},
+		{
+			name:       "delete without an epochTime",
+			request:    utils.Request{Method: "DELETE"},
+			wantStatus: 400,
+		},
+		{
+			name: "delete of a range requires the admin token",
+			request: utils.Request{
+				Method:                "DELETE",
+				QueryStringParameters: map[string]string{"start": "1", "end": "2"},
+			},
+			wantStatus: 403,
+		},
+		{
+			name: "delete of a range requires both ends",
+			request: utils.Request{
+				Method:                "DELETE",
+				QueryStringParameters: map[string]string{"start": "1"},
+				Authorizer:            admin,
+			},
+			wantStatus: 400,
+		},
+		{
+			name: "delete of a range",
+			request: utils.Request{
+				Method:                "DELETE",
+				QueryStringParameters: map[string]string{"start": "1", "end": "2"},
+				Authorizer:            admin,
+			},
+			setup: func(server *dynamotest.Server) {
+				server.Respond("Query", `{"Count": 1, "Items": [{
+					"ProjectId#DeviceId": {"S": "sensors#d1"},
+					"EpochTime": {"N": "1"}
+				}]}`)
+			},
+			wantStatus: 200,
+			check: func(t *testing.T, server *dynamotest.Server, body string) {
+				if !strings.Contains(body, `"deleted":1`) {
+					t.Errorf("body = %s, want one deleted", body)
+				}
+				if writes := server.Calls("BatchWriteItem"); len(writes) != 1 {
+					t.Errorf("made %d batch writes, want 1", len(writes))
+				}
+			},
+		},
+		{
+			name: "patch updates the fields",
+			request: utils.Request{
+				Method:                "PATCH",
+				QueryStringParameters: map[string]string{"epochTime": "1600000000"},
+				Body:                  `{"Temperature": 22}`,
+			},
+			wantStatus: 200,
+			check: func(t *testing.T, server *dynamotest.Server, body string) {
+				updates := server.Calls("UpdateItem")
+				if len(updates) != 1 {
+					t.Fatalf("made %d updates, want 1", len(updates))
+				}
+				if expression, _ := updates[0].Input["UpdateExpression"].(string); !strings.HasPrefix(expression, "SET") {
+					t.Errorf("UpdateExpression = %q, want a SET", expression)
+				}
+			},
+		},
+		{
+			name: "patch of a missing reading",
+			request: utils.Request{
+				Method:                "PATCH",
+				QueryStringParameters: map[string]string{"epochTime": "1600000000"},
+				Body:                  `{"Temperature": 22}`,
+			},
+			setup: func(server *dynamotest.Server) {
+				server.Fail("UpdateItem", "ConditionalCheckFailedException")
+			},
+			wantStatus: 404,
+		},
+		{
+			name: "patch of a key field",
+			request: utils.Request{
+				Method:                "PATCH",
+				QueryStringParameters: map[string]string{"epochTime": "1600000000"},
+				Body:                  `{"DeviceId": "d2"}`,
+			},
+			wantStatus: 400,
+		},
+		{
+			name: "patch of null",
+			request: utils.Request{
+				Method:                "PATCH",
+				QueryStringParameters: map[string]string{"epochTime": "1600000000"},
+				Body:                  `null`,
+			},
+			wantStatus: 400,
+		},
+		{
+			name: "patch of another project",
+			request: utils.Request{
+				Method:                "PATCH",
+				QueryStringParameters: map[string]string{"epochTime": "1600000000"},
+				Authorizer:            map[string]interface{}{"projectId": "dogs"},
+				Body:                  `{"Temperature": 22}`,
+			},
+			wantStatus: 403,
+		},
+		{
+			name:       "other methods",
+			request:    utils.Request{Method: "POST"},
+			wantStatus: 405,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := dynamotest.NewServer(t)
+			utils.SetClient(server.Client())
+			if test.setup != nil {
+				test.setup(server)
+			}
+			request := test.request
+			request.PathParameters = map[string]string{"ProjectId": "sensors", "DeviceId": "d1"}
+
+			response, err := deviceEndpointHandler(&request)
+			if err != nil {
+				t.Fatalf("deviceEndpointHandler() error = %v", err)
+			}
+			if response.StatusCode != test.wantStatus {
+				t.Fatalf("status = %d, want %d, body %s", response.StatusCode, test.wantStatus, response.Body)
+			}
+			if test.check != nil {
+				test.check(t, server, response.Body)
+			}
+		})
+	}
+}
@@ -3,7 +3,6 @@ package main
 import (
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
-	"github.com/aws/aws-sdk-go/aws"
 
 	"telemetry/utils"
 )
@@ -13,35 +12,26 @@ import (
 // It uses path parameters and optional query string parameters to retrieve data
 // from DynamoDB for a particular project and location.
 func locationEndpointHandler(
-	request events.APIGatewayProxyRequest,
+	request *utils.Request,
 ) (events.APIGatewayProxyResponse, error) {
-	client := utils.InitClient()
+	client := utils.Client()
 
 	// This handler only handles GET requests.
-	if request.HTTPMethod == "GET" {
-		// The primary key is a composite key of the ProjectId and LocationId
-		primaryValue := utils.CreateCompositeKey(&request, "ProjectId", "LocationId")
-
-		input := utils.CreateQueryInput("ProjectId#LocationId", primaryValue)
-		input.IndexName = aws.String("ProjectIdLocationId-EpochTime-index")
-
-		// If the 'single' query string parameter exists and is truthy, fetch a single value only.
-		// This value is the most recent or the most recent in the chosen time frame,
-		// if supplied with the 'start' and/or 'end' query parameters.
-		single := utils.EvaluateSingleParam(&request, input)
-
-		// The 'start' and 'end' query string parameters
-		// set the inclusive time range for queried data.
-		// Both are optional, and one can be supplied without the other.
-		utils.EvaluateStartEndParams(&request, input)
-
-		items := utils.GetData(client, input, single)
-
-		return utils.GetSuccessResponse(items)
+	if request.Method == "GET" {
+		// Location queries use the ProjectIdLocationId-EpochTime-index, so readings from every
+		// device at the location come back ordered by EpochTime, in the direction set by 'order'.
+		// The index can't serve consistent reads, so a truthy 'consistent' parameter is rejected.
+		params, err := utils.ParseQueryParams(request)
+		if err != nil {
+			return utils.BadRequestResponse(err.Error())
+		}
+		params.LocationId = request.PathParameters["LocationId"]
+
+		return utils.QueryResponse(request.Context(), client, request, params)
 	}
 	return utils.MethodNotAllowedResponse()
 }
 
 func main() {
-	lambda.Start(locationEndpointHandler)
+	lambda.Start(utils.Adapt(utils.Recover(utils.WithMetrics(locationEndpointHandler))))
 }
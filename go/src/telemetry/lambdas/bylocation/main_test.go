@@ -0,0 +1,81 @@
+package main
+
+import (
+	"testing"
+
+	"telemetry/utils"
+	"telemetry/utils/dynamotest"
+)
+
+func TestLocationEndpointHandler(t *testing.T) {
+	tests := []struct {
+		name        string
+		request     utils.Request
+		wantStatus  int
+		wantQuery   bool
+		wantForward bool
+	}{
+		{
+			name:        "get queries the location index",
+			request:     utils.Request{Method: "GET"},
+			wantStatus:  200,
+			wantQuery:   true,
+			wantForward: true,
+		},
+		{
+			name:       "get in descending order",
+			request:    utils.Request{Method: "GET", QueryStringParameters: map[string]string{"order": "desc"}},
+			wantStatus: 200,
+			wantQuery:  true,
+		},
+		{
+			name:       "get in an unknown order",
+			request:    utils.Request{Method: "GET", QueryStringParameters: map[string]string{"order": "up"}},
+			wantStatus: 400,
+		},
+		{
+			name:       "get of a consistent read",
+			request:    utils.Request{Method: "GET", QueryStringParameters: map[string]string{"consistent": "true"}},
+			wantStatus: 400,
+		},
+		{
+			name:       "get of a malformed limit",
+			request:    utils.Request{Method: "GET", QueryStringParameters: map[string]string{"limit": "many"}},
+			wantStatus: 400,
+		},
+		{
+			name:       "other methods",
+			request:    utils.Request{Method: "POST"},
+			wantStatus: 405,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := dynamotest.NewServer(t)
+			utils.SetClient(server.Client())
+			request := test.request
+			request.PathParameters = map[string]string{"ProjectId": "sensors", "LocationId": "roof"}
+
+			response, err := locationEndpointHandler(&request)
+			if err != nil {
+				t.Fatalf("locationEndpointHandler() error = %v", err)
+			}
+			if response.StatusCode != test.wantStatus {
+				t.Fatalf("status = %d, want %d, body %s", response.StatusCode, test.wantStatus, response.Body)
+			}
+			queries := server.Calls("Query")
+			if !test.wantQuery {
+				if len(queries) != 0 {
+					t.Errorf("made %d queries, want none", len(queries))
+				}
+				return
+			}
+			if len(queries) != 1 || queries[0].Input["IndexName"] != "ProjectIdLocationId-EpochTime-index" {
+				t.Fatalf("queries = %v, want one of the location index", queries)
+			}
+			if forward := queries[0].Input["ScanIndexForward"]; forward != test.wantForward {
+				t.Errorf("ScanIndexForward = %v, want %v", forward, test.wantForward)
+			}
+		})
+	}
+}
@@ -1,123 +1,174 @@
 package main
 
 import (
-	"context"
 	"encoding/json"
-	"fmt"
 	"log"
+	"strings"
 
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
-	"github.com/aws/aws-sdk-go/aws"
 
-	"telemetry/constants"
 	"telemetry/utils"
 )
 
-func decodePostData(request *events.APIGatewayProxyRequest) map[string]interface{} {
-	itemBytes := []byte(request.Body)
-	var itemMap map[string]interface{}
-
-	if err := json.Unmarshal(itemBytes, &itemMap); err != nil {
-		log.Fatalln("Could not decode data")
-	}
-	if _, epochTimeOk := itemMap["EpochTime"]; !epochTimeOk {
-		log.Fatalln("EpochTime is required")
-	}
-	if _, deviceIDOk := itemMap["DeviceId"]; !deviceIDOk {
-		log.Fatalln("DeviceId is required")
+func handleGet(
+	request *utils.Request,
+	client *dynamodb.Client,
+) (events.APIGatewayProxyResponse, error) {
+	// For GET requests, the handler fetches project data from
+	// AWS DynamoDB according to a single path parameter and optional query string parameters.
+	// Project queries use the ProjectId-EpochTime-index, which can't serve consistent reads,
+	// so a truthy 'consistent' query string parameter is rejected.
+	params, err := utils.ParseQueryParams(request)
+	if err != nil {
+		return utils.BadRequestResponse(err.Error())
 	}
-	return itemMap
-}
 
-func augmentPostData(itemMap map[string]interface{}, request *events.APIGatewayProxyRequest) {
-	itemMap["ProjectId"] = request.PathParameters["ProjectId"]
-	itemMap["ProjectId#DeviceId"] = fmt.Sprintf("%s#%s",
-		itemMap["ProjectId"],
-		itemMap["DeviceId"],
-	)
-	if locationID, locationIDOk := itemMap["LocationId"]; locationIDOk {
-		itemMap["ProjectId#LocationId"] = fmt.Sprintf("%s#%s",
-			itemMap["ProjectId"],
-			locationID,
-		)
+	// When the 'device' query string parameter names a device, the query skips the index
+	// and reads the base table by its ProjectId#DeviceId key instead. This avoids the index's
+	// extra cost and eventual consistency, and allows 'consistent' reads.
+	if device, deviceOk := request.QueryStringParameters["device"]; deviceOk && device != "" {
+		params.DeviceId = device
 	}
-}
 
-func createTableInput(item map[string]types.AttributeValue) *dynamodb.PutItemInput {
-	input := &dynamodb.PutItemInput{
-		TableName: aws.String(constants.TABLE_NAME),
-		Item:      item,
+	if _, devicesOk := request.QueryStringParameters["devices"]; devicesOk {
+		return handleMultiDeviceGet(request, client, params)
 	}
-	return input
+	return utils.QueryResponse(request.Context(), client, request, params)
 }
 
-func tryPutItem(client *dynamodb.Client, input *dynamodb.PutItemInput) {
-	_, err := utils.PutTableItem(context.TODO(), client, input)
-	if err != nil {
-		log.Fatalf("Failed to add to table, %v", err)
-	}
+// multiDeviceResult is the body returned for a query of several devices.
+// Errors lists, by DeviceId, the devices whose readings could not be retrieved.
+type multiDeviceResult struct {
+	Items  []map[string]types.AttributeValue `json:"items"`
+	Errors map[string]string                 `json:"errors,omitempty"`
 }
 
-func handleGet(
-	request *events.APIGatewayProxyRequest,
+// handleMultiDeviceGet returns the readings of every device named in the comma-separated
+// 'devices' query string parameter over the same time window, merged into one series.
+// A truthy 'tagDevice' query string parameter tags each reading with the device it was queried by.
+func handleMultiDeviceGet(
+	request *utils.Request,
 	client *dynamodb.Client,
+	params utils.QueryParams,
 ) (events.APIGatewayProxyResponse, error) {
-	// For GET requests, the handler fetches project data from
-	// AWS DynamoDB according to a single path parameter and optional query string parameters.
-	primaryValue := request.PathParameters["ProjectId"]
-
-	input := utils.CreateQueryInput("ProjectId", primaryValue)
-	input.IndexName = aws.String("ProjectId-EpochTime-index")
-
-	// If the 'single' query string parameter exists and is truthy, fetch a single value only.
-	// This value is the most recent project data or the most recent in the chosen time frame,
-	// if supplied with the 'start' and/or 'end' query parameters.
-	single := utils.EvaluateSingleParam(request, input)
-
-	utils.EvaluateStartEndParams(request, input)
+	var devices []string
+	for _, device := range strings.Split(request.QueryStringParameters["devices"], ",") {
+		if device = strings.TrimSpace(device); device != "" {
+			devices = append(devices, device)
+		}
+	}
+	if len(devices) == 0 {
+		return utils.BadRequestResponse("devices must name at least one device")
+	}
+	if err := request.CheckIndexAccess(params.Index); err != nil {
+		return utils.ForbiddenResponse(err.Error())
+	}
+	if params.DeviceId != "" {
+		return utils.BadRequestResponse("devices cannot be combined with device")
+	}
+	if params.Paginate || params.Cursor != "" {
+		return utils.BadRequestResponse("devices cannot be combined with paginate or cursor")
+	}
+	tag := false
+	if value, tagOk := request.QueryStringParameters["tagDevice"]; tagOk {
+		var err error
+		if tag, err = utils.ParseBoolParam(value); err != nil {
+			return utils.BadRequestResponse("tagDevice: " + err.Error())
+		}
+	}
 
-	items := utils.GetData(client, input, single)
+	params.Single = false
+	if err := params.Validate(); err != nil {
+		return utils.BadRequestResponse(err.Error())
+	}
+	// Queries without a time range default to the configured recent window.
+	utils.ApplyDefaultWindow(&params)
+	utils.ClampTimeRange(&params)
+
+	items, errs := utils.QueryMultiple(request.Context(), client, devices, params, tag)
+	if len(errs) == len(devices) {
+		for device, err := range errs {
+			log.Printf("Query of device %s failed, %v", device, err)
+		}
+		return utils.InternalErrorResponse("Failed to query table")
+	}
 
-	return utils.GetSuccessResponse(items)
+	items = utils.CleanItems(items)
+	utils.RedactFields(items, utils.RequestRedactions(request))
+	result := multiDeviceResult{Items: items}
+	if len(errs) > 0 {
+		result.Errors = make(map[string]string, len(errs))
+		for device, err := range errs {
+			log.Printf("Query of device %s failed, %v", device, err)
+			result.Errors[device] = "Failed to query table"
+		}
+	}
+	if result.Items == nil {
+		result.Items = []map[string]types.AttributeValue{}
+	}
+	return utils.JSONResponse(result)
 }
 
 func handlePost(
-	request *events.APIGatewayProxyRequest,
+	request *utils.Request,
 	client *dynamodb.Client,
 ) (events.APIGatewayProxyResponse, error) {
 	// For POST requests, the handler puts new data into the same DynamoDB table according to the
-	// same path parameter and the fields included in the POST body. In addition to the ProjectId
-	// gathered from the path, the EpochTime and DeviceId fields are also required in the POST body.
-	itemMap := decodePostData(request)
-
-	augmentPostData(itemMap, request)
-
-	item := utils.MapToAttributeValues(itemMap)
-
-	input := createTableInput(item)
+	// same path parameter and the fields included in the POST body, through the shared ingest path.
+	return utils.PostResponse(request.Context(), client, request)
+}
 
-	tryPutItem(client, input)
+// handleHeartbeat records that the device named by the body's DeviceId is alive,
+// for devices that have no new reading to report.
+func handleHeartbeat(
+	request *utils.Request,
+	client *dynamodb.Client,
+) (events.APIGatewayProxyResponse, error) {
+	if err := request.CheckAuthorizedProject(); err != nil {
+		return utils.ForbiddenResponse(err.Error())
+	}
+	var body struct {
+		DeviceId string
+	}
+	bodyBytes, err := utils.DecodeRequestBody(request)
+	if err != nil {
+		return utils.BadRequestResponse(err.Error())
+	}
+	if err := json.Unmarshal(bodyBytes, &body); err != nil || body.DeviceId == "" {
+		return utils.BadRequestResponse("Heartbeat must have a DeviceId")
+	}
 
-	return utils.PostSuccessResponse()
+	project := request.PathParameters["ProjectId"]
+	lastSeen, err := utils.RecordHeartbeat(request.Context(), client, request.TenantId, project, body.DeviceId)
+	if err != nil {
+		log.Printf("Failed to record heartbeat, %v", err)
+		return utils.InternalErrorResponse("Failed to record heartbeat")
+	}
+	return utils.JSONResponse(map[string]interface{}{
+		"DeviceId": body.DeviceId,
+		"LastSeen": lastSeen.Unix(),
+	})
 }
 
 // projectEndpointHandler is an AWS Lambda function that is called by AWS API Gateway.
 func projectEndpointHandler(
-	request events.APIGatewayProxyRequest,
+	request *utils.Request,
 ) (events.APIGatewayProxyResponse, error) {
 
-	client := utils.InitClient()
-	if request.HTTPMethod == "GET" {
-		return handleGet(&request, client)
-	} else if request.HTTPMethod == "POST" {
-		return handlePost(&request, client)
+	client := utils.Client()
+	if request.Method == "GET" {
+		return handleGet(request, client)
+	} else if request.Method == "POST" && request.QueryStringParameters["op"] == "heartbeat" {
+		return handleHeartbeat(request, client)
+	} else if request.Method == "POST" {
+		return handlePost(request, client)
 	}
 	return utils.MethodNotAllowedResponse()
 }
 
 func main() {
-	lambda.Start(projectEndpointHandler)
+	lambda.Start(utils.Adapt(utils.Recover(utils.WithMetrics(projectEndpointHandler))))
 }
@@ -0,0 +1,726 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"reflect"
+	"strings"
+	"testing"
+
+	"telemetry/utils"
+	"telemetry/utils/dynamotest"
+)
+
+const reading = `{"DeviceId": "d1", "EpochTime": 1600000000, "Temperature": 21.5}`
+
+func TestProjectEndpointHandler(t *testing.T) {
+	tests := []struct {
+		name       string
+		env        map[string]string
+		request    utils.Request
+		setup      func(server *dynamotest.Server)
+		wantStatus int
+		wantHeader map[string]string
+		check      func(t *testing.T, server *dynamotest.Server, body string)
+	}{
+		{
+			name:       "get queries the project index",
+			request:    utils.Request{Method: "GET"},
+			setup:      respondWithReading,
+			wantStatus: 200,
+			check: func(t *testing.T, server *dynamotest.Server, body string) {
+				queries := server.Calls("Query")
+				if len(queries) != 1 || queries[0].Input["IndexName"] != "ProjectId-EpochTime-index" {
+					t.Errorf("queries = %v, want one of the project index", queries)
+				}
+				if !strings.Contains(body, `"Temperature":{"Value":"21.5"}`) {
+					t.Errorf("body = %s, want the reading", body)
+				}
+			},
+		},
+		{
+			name:       "get by device reads the base table",
+			request:    utils.Request{Method: "GET", QueryStringParameters: map[string]string{"device": "d1"}},
+			setup:      respondWithReading,
+			wantStatus: 200,
+			check: func(t *testing.T, server *dynamotest.Server, body string) {
+				queries := server.Calls("Query")
+				if len(queries) != 1 || queries[0].Input["IndexName"] != nil {
+					t.Fatalf("queries = %v, want one of the base table", queries)
+				}
+				if key := primaryValue(queries[0]); key != "sensors#d1" {
+					t.Errorf("partition key = %v, want sensors#d1", key)
+				}
+			},
+		},
+		{
+			name:       "get after a time polls for newer readings",
+			request:    utils.Request{Method: "GET", QueryStringParameters: map[string]string{"after": "1600000000"}},
+			wantStatus: 200,
+			check: func(t *testing.T, server *dynamotest.Server, body string) {
+				queries := server.Calls("Query")
+				if len(queries) != 1 {
+					t.Fatalf("made %d queries, want 1", len(queries))
+				}
+				condition, _ := queries[0].Input["KeyConditionExpression"].(string)
+				if !strings.HasSuffix(condition, "> :after") {
+					t.Errorf("KeyConditionExpression = %q, want an exclusive lower bound", condition)
+				}
+			},
+		},
+		{
+			name:       "get without a time range reads the default window",
+			env:        map[string]string{"DEFAULT_WINDOW_SECONDS": "3600"},
+			request:    utils.Request{Method: "GET"},
+			wantStatus: 200,
+			check: func(t *testing.T, server *dynamotest.Server, body string) {
+				queries := server.Calls("Query")
+				if len(queries) != 1 {
+					t.Fatalf("made %d queries, want 1", len(queries))
+				}
+				condition, _ := queries[0].Input["KeyConditionExpression"].(string)
+				if !strings.HasSuffix(condition, ">= :start") {
+					t.Errorf("KeyConditionExpression = %q, want a lower bound", condition)
+				}
+			},
+		},
+		{
+			name: "get after a time within a range",
+			request: utils.Request{
+				Method:                "GET",
+				QueryStringParameters: map[string]string{"after": "1600000000", "end": "1600000100"},
+			},
+			wantStatus: 400,
+		},
+		{
+			name: "get of an index requires the admin token",
+			request: utils.Request{
+				Method:                "GET",
+				QueryStringParameters: map[string]string{"index": "x", "keyName": "k", "keyValue": "v"},
+				Authorizer:            map[string]interface{}{"projectId": "sensors"},
+			},
+			wantStatus: 403,
+		},
+		{
+			name:       "get of no devices",
+			request:    utils.Request{Method: "GET", QueryStringParameters: map[string]string{"devices": " , "}},
+			wantStatus: 400,
+		},
+		{
+			name:       "get of several devices merges them",
+			request:    utils.Request{Method: "GET", QueryStringParameters: map[string]string{"devices": "d1,d2"}},
+			setup:      func(server *dynamotest.Server) { respondWithReading(server); respondWithReading(server) },
+			wantStatus: 200,
+			check: func(t *testing.T, server *dynamotest.Server, body string) {
+				if queries := server.Calls("Query"); len(queries) != 2 {
+					t.Errorf("made %d queries, want 2", len(queries))
+				}
+			},
+		},
+		{
+			name: "get of several devices tagged with their device",
+			request: utils.Request{
+				Method:                "GET",
+				QueryStringParameters: map[string]string{"devices": "d1", "tagDevice": "true"},
+			},
+			setup:      respondWithReading,
+			wantStatus: 200,
+			check: func(t *testing.T, server *dynamotest.Server, body string) {
+				if !strings.Contains(body, `"SourceDevice":{"Value":"d1"}`) {
+					t.Errorf("body = %s, want readings tagged with their device", body)
+				}
+			},
+		},
+		{
+			name: "get of several devices with a malformed tagDevice",
+			request: utils.Request{
+				Method:                "GET",
+				QueryStringParameters: map[string]string{"devices": "d1", "tagDevice": "maybe"},
+			},
+			wantStatus: 400,
+		},
+		{
+			name: "get of several devices and a device",
+			request: utils.Request{
+				Method:                "GET",
+				QueryStringParameters: map[string]string{"devices": "d1,d2", "device": "d3"},
+			},
+			wantStatus: 400,
+		},
+		{
+			name: "get of several devices paginated",
+			request: utils.Request{
+				Method:                "GET",
+				QueryStringParameters: map[string]string{"devices": "d1,d2", "paginate": "true"},
+			},
+			wantStatus: 400,
+		},
+		{
+			name:    "get of several devices with one failed",
+			request: utils.Request{Method: "GET", QueryStringParameters: map[string]string{"devices": "d1,d2"}},
+			setup: func(server *dynamotest.Server) {
+				server.Fail("Query", "InternalServerError")
+				respondWithReading(server)
+			},
+			wantStatus: 200,
+			check: func(t *testing.T, server *dynamotest.Server, body string) {
+				if !strings.Contains(body, `"errors":{"d`) || !strings.Contains(body, `"Failed to query table"`) {
+					t.Errorf("body = %s, want the failed device listed in errors", body)
+				}
+			},
+		},
+		{
+			name:    "get of several devices with all failed",
+			request: utils.Request{Method: "GET", QueryStringParameters: map[string]string{"devices": "d1,d2"}},
+			setup: func(server *dynamotest.Server) {
+				server.Fail("Query", "InternalServerError")
+				server.Fail("Query", "InternalServerError")
+			},
+			wantStatus: 500,
+		},
+		{
+			name:       "post writes the reading",
+			request:    postRequest(reading),
+			wantStatus: 200,
+			check: func(t *testing.T, server *dynamotest.Server, body string) {
+				puts := server.Calls("PutItem")
+				if len(puts) != 1 {
+					t.Fatalf("made %d puts, want 1", len(puts))
+				}
+				item := puts[0].Input["Item"].(map[string]interface{})
+				key := item["ProjectId#DeviceId"].(map[string]interface{})["S"]
+				if key != "sensors#d1" {
+					t.Errorf("partition key = %v, want sensors#d1", key)
+				}
+			},
+		},
+		{
+			name: "post of another content type",
+			request: utils.Request{
+				Method:         "POST",
+				PathParameters: map[string]string{"ProjectId": "sensors"},
+				Headers:        map[string]string{"Content-Type": "text/plain"},
+				Body:           reading,
+			},
+			wantStatus: 415,
+			check: func(t *testing.T, server *dynamotest.Server, body string) {
+				if puts := server.Calls("PutItem"); len(puts) != 0 {
+					t.Errorf("made %d puts, want none", len(puts))
+				}
+			},
+		},
+		{
+			name: "post declaring a charset",
+			request: utils.Request{
+				Method:         "POST",
+				PathParameters: map[string]string{"ProjectId": "sensors"},
+				Headers:        map[string]string{"content-type": "application/json; charset=utf-8"},
+				Body:           reading,
+			},
+			wantStatus: 200,
+		},
+		{
+			name: "post without a Content-Type from older devices",
+			request: utils.Request{
+				Method:         "POST",
+				PathParameters: map[string]string{"ProjectId": "sensors"},
+				Body:           reading,
+			},
+			wantStatus: 200,
+		},
+		{
+			name:       "post of malformed JSON",
+			request:    postRequest(`{"DeviceId": `),
+			wantStatus: 400,
+		},
+		{
+			name:       "post without a DeviceId",
+			request:    postRequest(`{"EpochTime": 1600000000}`),
+			wantStatus: 400,
+		},
+		{
+			name: "post with the device's status",
+			request: func() utils.Request {
+				request := postRequest(reading)
+				request.QueryStringParameters = map[string]string{"withStatus": "true"}
+				return request
+			}(),
+			wantStatus: 200,
+			check: func(t *testing.T, server *dynamotest.Server, body string) {
+				transactions := server.Calls("TransactWriteItems")
+				if len(transactions) != 1 || len(server.Calls("PutItem")) != 0 {
+					t.Fatalf("made %d transactions and %d puts, want one transaction",
+						len(transactions), len(server.Calls("PutItem")))
+				}
+				if items := transactions[0].Input["TransactItems"].([]interface{}); len(items) != 2 {
+					t.Errorf("transaction = %v, want the reading and the device's status", items)
+				}
+			},
+		},
+		{
+			name: "post with a cancelled status transaction",
+			request: func() utils.Request {
+				request := postRequest(reading)
+				request.QueryStringParameters = map[string]string{"withStatus": "true"}
+				return request
+			}(),
+			setup: func(server *dynamotest.Server) {
+				server.Fail("TransactWriteItems", "TransactionCanceledException")
+			},
+			wantStatus: 500,
+		},
+		{
+			name:       "post of a failed write",
+			request:    postRequest(reading),
+			setup:      func(server *dynamotest.Server) { server.Fail("PutItem", "InternalServerError") },
+			wantStatus: 500,
+		},
+		{
+			name:       "post of a batch reports rejected items",
+			request:    postRequest(`[` + reading + `, {"EpochTime": 1}]`),
+			wantStatus: 200,
+			check: func(t *testing.T, server *dynamotest.Server, body string) {
+				if !strings.Contains(body, `"written":1`) || !strings.Contains(body, `"index":1`) {
+					t.Errorf("body = %s, want one written and item 1 rejected", body)
+				}
+			},
+		},
+		{
+			name: "heartbeat records the device as seen",
+			request: utils.Request{
+				Method:                "POST",
+				PathParameters:        map[string]string{"ProjectId": "sensors"},
+				QueryStringParameters: map[string]string{"op": "heartbeat"},
+				Body:                  `{"DeviceId": "d1"}`,
+			},
+			wantStatus: 200,
+			check: func(t *testing.T, server *dynamotest.Server, body string) {
+				if updates := server.Calls("UpdateItem"); len(updates) != 1 {
+					t.Errorf("made %d updates, want 1", len(updates))
+				}
+			},
+		},
+		{
+			name: "heartbeat without a DeviceId",
+			request: utils.Request{
+				Method:                "POST",
+				PathParameters:        map[string]string{"ProjectId": "sensors"},
+				QueryStringParameters: map[string]string{"op": "heartbeat"},
+				Body:                  `{}`,
+			},
+			wantStatus: 400,
+		},
+		{
+			name:       "post coerced to the project's field types",
+			env:        map[string]string{"FIELD_TYPES_sensors": "Temperature:number"},
+			request:    postRequest(`{"DeviceId": "d1", "EpochTime": 1600000000, "Temperature": "21.5"}`),
+			wantStatus: 200,
+			check: func(t *testing.T, server *dynamotest.Server, body string) {
+				puts := server.Calls("PutItem")
+				if len(puts) != 1 {
+					t.Fatalf("made %d puts, want 1", len(puts))
+				}
+				item := puts[0].Input["Item"].(map[string]interface{})
+				if _, ok := item["Temperature"].(map[string]interface{})["N"]; !ok {
+					t.Errorf("Temperature = %v, want a number", item["Temperature"])
+				}
+			},
+		},
+		{
+			name: "post of a gzipped body",
+			request: utils.Request{
+				Method:          "POST",
+				PathParameters:  map[string]string{"ProjectId": "sensors"},
+				Headers:         map[string]string{"Content-Type": "application/json", "Content-Encoding": "gzip"},
+				Body:            gzipBase64(reading),
+				IsBase64Encoded: true,
+			},
+			wantStatus: 200,
+			check: func(t *testing.T, server *dynamotest.Server, body string) {
+				if puts := server.Calls("PutItem"); len(puts) != 1 {
+					t.Errorf("made %d puts, want 1", len(puts))
+				}
+			},
+		},
+		{
+			name: "post of an unsupported encoding",
+			request: utils.Request{
+				Method:         "POST",
+				PathParameters: map[string]string{"ProjectId": "sensors"},
+				Headers:        map[string]string{"Content-Type": "application/json", "Content-Encoding": "br"},
+				Body:           reading,
+			},
+			wantStatus: 400,
+		},
+		{
+			name: "post for a tenant",
+			env:  map[string]string{"TENANT_ISOLATION": "true"},
+			request: utils.Request{
+				Method:         "POST",
+				PathParameters: map[string]string{"ProjectId": "sensors"},
+				Headers:        map[string]string{"Content-Type": "application/json"},
+				Authorizer:     map[string]interface{}{"projectId": "sensors", "tenantId": "acme"},
+				TenantId:       "acme",
+				Body:           reading,
+			},
+			wantStatus: 200,
+			check: func(t *testing.T, server *dynamotest.Server, body string) {
+				puts := server.Calls("PutItem")
+				if len(puts) != 1 {
+					t.Fatalf("made %d puts, want 1", len(puts))
+				}
+				item := puts[0].Input["Item"].(map[string]interface{})
+				if key := item["ProjectId#DeviceId"]; !reflect.DeepEqual(key, map[string]interface{}{"S": "acme#sensors#d1"}) {
+					t.Errorf("partition key = %v, want the tenant's", key)
+				}
+			},
+		},
+		{
+			name:       "post with a numeric DeviceId",
+			request:    postRequest(`{"DeviceId": 42, "EpochTime": 1600000000}`),
+			wantStatus: 200,
+			check: func(t *testing.T, server *dynamotest.Server, body string) {
+				puts := server.Calls("PutItem")
+				if len(puts) != 1 {
+					t.Fatalf("made %d puts, want 1", len(puts))
+				}
+				item := puts[0].Input["Item"].(map[string]interface{})
+				if key := item["ProjectId#DeviceId"]; !reflect.DeepEqual(key, map[string]interface{}{"S": "sensors#42"}) {
+					t.Errorf("partition key = %v, want sensors#42", key)
+				}
+			},
+		},
+		{
+			name:       "post with too many attributes",
+			env:        map[string]string{"MAX_ATTRIBUTES": "3"},
+			request:    postRequest(`{"DeviceId": "d1", "EpochTime": 1600000000, "Temperature": 21.5, "Humidity": 40}`),
+			wantStatus: 400,
+			check: func(t *testing.T, server *dynamotest.Server, body string) {
+				if !strings.Contains(body, "more than the limit of 3") {
+					t.Errorf("body = %s, want the attribute limit", body)
+				}
+				if puts := server.Calls("PutItem"); len(puts) != 0 {
+					t.Errorf("made %d puts, want none", len(puts))
+				}
+			},
+		},
+		{
+			name:       "post within the attribute limit",
+			env:        map[string]string{"MAX_ATTRIBUTES": "3"},
+			request:    postRequest(reading),
+			wantStatus: 200,
+		},
+		{
+			name:       "post with too many nested attributes",
+			env:        map[string]string{"MAX_NESTED_ATTRIBUTES": "2"},
+			request:    postRequest(`{"DeviceId": "d1", "EpochTime": 1600000000, "Samples": [1, 2, 3]}`),
+			wantStatus: 400,
+		},
+		{
+			name:       "post with coordinates in range",
+			env:        map[string]string{"GEO_FIELDS": "Position"},
+			request:    postRequest(`{"DeviceId": "d1", "EpochTime": 1600000000, "Position": {"lat": 45.5, "lon": -122.7}}`),
+			wantStatus: 200,
+		},
+		{
+			name:       "post with coordinates out of range",
+			env:        map[string]string{"GEO_FIELDS": "Position"},
+			request:    postRequest(`{"DeviceId": "d1", "EpochTime": 1600000000, "Position": {"lat": 91, "lon": 0}}`),
+			wantStatus: 400,
+			check: func(t *testing.T, server *dynamotest.Server, body string) {
+				if puts := server.Calls("PutItem"); len(puts) != 0 {
+					t.Errorf("made %d puts, want none", len(puts))
+				}
+			},
+		},
+		{
+			name:       "post breaking the project's field types",
+			env:        map[string]string{"FIELD_TYPES_sensors": "Temperature:number"},
+			request:    postRequest(`{"DeviceId": "d1", "EpochTime": 1600000000, "Temperature": "warm"}`),
+			wantStatus: 400,
+		},
+		{
+			name: "post to another project",
+			request: utils.Request{
+				Method:         "POST",
+				PathParameters: map[string]string{"ProjectId": "sensors"},
+				Authorizer:     map[string]interface{}{"projectId": "dogs"},
+				Body:           reading,
+			},
+			wantStatus: 403,
+		},
+		{
+			name:       "post of a spoofed partition key",
+			request:    postRequest(`{"DeviceId": "d1", "EpochTime": 1600000000, "ProjectId#DeviceId": "dogs#d9"}`),
+			wantStatus: 200,
+			check: func(t *testing.T, server *dynamotest.Server, body string) {
+				puts := server.Calls("PutItem")
+				if len(puts) != 1 {
+					t.Fatalf("made %d puts, want 1", len(puts))
+				}
+				item := puts[0].Input["Item"].(map[string]interface{})
+				key := item["ProjectId#DeviceId"].(map[string]interface{})["S"]
+				if key != "sensors#d1" {
+					t.Errorf("partition key = %v, want the server's sensors#d1", key)
+				}
+			},
+		},
+		{
+			name:       "post of server-managed fields when they're rejected",
+			env:        map[string]string{"SERVER_FIELDS_MODE": "reject"},
+			request:    postRequest(`{"DeviceId": "d1", "EpochTime": 1600000000, "ExpiresAt": 1}`),
+			wantStatus: 400,
+			check: func(t *testing.T, server *dynamotest.Server, body string) {
+				if !strings.Contains(body, "ExpiresAt") {
+					t.Errorf("body = %s, want the rejected field named", body)
+				}
+			},
+		},
+		{
+			name:       "post answered with the reading's location",
+			request:    postRequest(reading),
+			wantStatus: 200,
+			wantHeader: map[string]string{"Location": "/projects/sensors/devices/d1?at=1600000000"},
+		},
+		{
+			name:       "post answered as created",
+			env:        map[string]string{"CREATED_STATUS_ON_POST": "true"},
+			request:    postRequest(reading),
+			wantStatus: 201,
+			wantHeader: map[string]string{
+				"Location":     "/projects/sensors/devices/d1?at=1600000000",
+				"Content-Type": "application/json",
+			},
+			check: func(t *testing.T, server *dynamotest.Server, body string) {
+				if body != `{"ProjectId":"sensors","DeviceId":"d1","EpochTime":1600000000}` {
+					t.Errorf("body = %s, want the reading's key", body)
+				}
+			},
+		},
+		{
+			name:       "post of a semantically invalid reading",
+			env:        map[string]string{"SEMANTIC_RULES_sensors": `{"ranges": {"Temperature": {"max": 20}}}`},
+			request:    postRequest(reading),
+			wantStatus: 422,
+			check: func(t *testing.T, server *dynamotest.Server, body string) {
+				if !strings.Contains(body, `"violations":["Temperature 21.5 is greater than the maximum of 20"]`) {
+					t.Errorf("body = %s, want the violation listed", body)
+				}
+				if puts := server.Calls("PutItem"); len(puts) != 0 {
+					t.Errorf("made %d puts, want the reading rejected", len(puts))
+				}
+			},
+		},
+		{
+			name:       "post of a semantically valid reading",
+			env:        map[string]string{"SEMANTIC_RULES_sensors": `{"ranges": {"Temperature": {"max": 30}}}`},
+			request:    postRequest(reading),
+			wantStatus: 200,
+		},
+		{
+			name:    "get throttled",
+			request: utils.Request{Method: "GET"},
+			setup: func(server *dynamotest.Server) {
+				server.Fail("Query", "ProvisionedThroughputExceededException")
+			},
+			wantStatus: 503,
+			wantHeader: map[string]string{"Retry-After": "2"},
+		},
+		{
+			name:    "get of a backfilling index",
+			request: utils.Request{Method: "GET"},
+			setup: func(server *dynamotest.Server) {
+				server.FailWithMessage("Query", "ValidationException", "Cannot read from backfilling global secondary index")
+			},
+			wantStatus: 503,
+			wantHeader: map[string]string{"Retry-After": "60"},
+		},
+		{
+			name:    "post over the rate limit",
+			env:     map[string]string{"RATE_LIMIT_sensors": "1"},
+			request: postRequest(reading),
+			setup: func(server *dynamotest.Server) {
+				server.Fail("UpdateItem", "ConditionalCheckFailedException")
+			},
+			wantStatus: 429,
+			wantHeader: map[string]string{"Access-Control-Expose-Headers": "Retry-After"},
+			check: func(t *testing.T, server *dynamotest.Server, body string) {
+				if puts := server.Calls("PutItem"); len(puts) != 0 {
+					t.Errorf("made %d puts, want none", len(puts))
+				}
+			},
+		},
+		{
+			name: "post retrying a write doesn't count against the rate limit",
+			env:  map[string]string{"RATE_LIMIT_sensors": "1"},
+			request: utils.Request{
+				Method:         "POST",
+				PathParameters: map[string]string{"ProjectId": "sensors"},
+				Headers:        map[string]string{"Idempotency-Key": "retry"},
+				Body:           reading,
+			},
+			setup: func(server *dynamotest.Server) {
+				server.Respond("GetItem", `{"Item": {"ProjectId#DeviceId": {"S": "idempotency#sensors#retry"}}}`)
+			},
+			wantStatus: 200,
+			check: func(t *testing.T, server *dynamotest.Server, body string) {
+				if updates := server.Calls("UpdateItem"); len(updates) != 0 {
+					t.Errorf("made %d rate limit updates, want none", len(updates))
+				}
+				if transactions := server.Calls("TransactWriteItems"); len(transactions) != 0 {
+					t.Errorf("made %d transactions, want none", len(transactions))
+				}
+			},
+		},
+		{
+			name:    "post to a full item collection",
+			request: postRequest(reading),
+			setup: func(server *dynamotest.Server) {
+				server.Fail("PutItem", "ItemCollectionSizeLimitExceededException")
+			},
+			wantStatus: 507,
+			check: func(t *testing.T, server *dynamotest.Server, body string) {
+				if !strings.Contains(body, "ITEM_COLLECTION_FULL") || !strings.Contains(body, `sensors#d1`) {
+					t.Errorf("body = %s, want the full partition named", body)
+				}
+			},
+		},
+		{
+			name:    "post of a batch to a full item collection",
+			request: postRequest(`[` + reading + `]`),
+			setup: func(server *dynamotest.Server) {
+				server.Fail("PutItem", "ItemCollectionSizeLimitExceededException")
+			},
+			wantStatus: 400,
+			check: func(t *testing.T, server *dynamotest.Server, body string) {
+				if !strings.Contains(body, "has reached its size limit") {
+					t.Errorf("body = %s, want the item rejected for the full partition", body)
+				}
+			},
+		},
+		{
+			name:       "post of a fractional sequence",
+			request:    postRequest(`{"DeviceId": "d1", "EpochTime": 1600000000, "SequenceNum": 4.5}`),
+			wantStatus: 400,
+			check: func(t *testing.T, server *dynamotest.Server, body string) {
+				if calls := len(server.Calls("UpdateItem")) + len(server.Calls("PutItem")); calls != 0 {
+					t.Errorf("made %d writes, want none", calls)
+				}
+			},
+		},
+		{
+			name:       "post of a newer sequence",
+			request:    postRequest(`{"DeviceId": "d1", "EpochTime": 1600000000, "SequenceNum": 4}`),
+			wantStatus: 200,
+			check: func(t *testing.T, server *dynamotest.Server, body string) {
+				if updates, puts := server.Calls("UpdateItem"), server.Calls("PutItem"); len(updates) != 1 || len(puts) != 1 {
+					t.Errorf("made %d updates and %d puts, want 1 of each", len(updates), len(puts))
+				}
+			},
+		},
+		{
+			name: "post retrying a sequenced write replays its success",
+			request: utils.Request{
+				Method:         "POST",
+				PathParameters: map[string]string{"ProjectId": "sensors"},
+				Headers:        map[string]string{"Idempotency-Key": "retry"},
+				Body:           `{"DeviceId": "d1", "EpochTime": 1600000000, "SequenceNum": 4}`,
+			},
+			setup: func(server *dynamotest.Server) {
+				server.Respond("GetItem", `{"Item": {"ProjectId#DeviceId": {"S": "idempotency#sensors#retry"}}}`)
+			},
+			wantStatus: 200,
+			check: func(t *testing.T, server *dynamotest.Server, body string) {
+				if calls := len(server.Calls("UpdateItem")) + len(server.Calls("PutItem")); calls != 0 {
+					t.Errorf("made %d writes, want none", calls)
+				}
+			},
+		},
+		{
+			name:    "post of a stale sequence",
+			request: postRequest(`{"DeviceId": "d1", "EpochTime": 1600000000, "SequenceNum": 4}`),
+			setup: func(server *dynamotest.Server) {
+				server.Fail("UpdateItem", "ConditionalCheckFailedException")
+			},
+			wantStatus: 409,
+		},
+		{
+			name:       "other methods",
+			request:    utils.Request{Method: "PUT"},
+			wantStatus: 405,
+			check: func(t *testing.T, server *dynamotest.Server, body string) {
+				if !strings.Contains(body, `"code":"METHOD_NOT_ALLOWED"`) {
+					t.Errorf("body = %s, want the METHOD_NOT_ALLOWED code", body)
+				}
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			for name, value := range test.env {
+				t.Setenv(name, value)
+			}
+			server := dynamotest.NewServer(t)
+			utils.SetClient(server.Client())
+			if test.setup != nil {
+				test.setup(server)
+			}
+			request := test.request
+			if request.PathParameters == nil {
+				request.PathParameters = map[string]string{"ProjectId": "sensors"}
+			}
+
+			response, err := projectEndpointHandler(&request)
+			if err != nil {
+				t.Fatalf("projectEndpointHandler() error = %v", err)
+			}
+			if response.StatusCode != test.wantStatus {
+				t.Fatalf("status = %d, want %d, body %s", response.StatusCode, test.wantStatus, response.Body)
+			}
+			for name, want := range test.wantHeader {
+				if got := response.Headers[name]; got != want {
+					t.Errorf("%s = %q, want %q", name, got, want)
+				}
+			}
+			if test.check != nil {
+				test.check(t, server, response.Body)
+			}
+		})
+	}
+}
+
+// gzipBase64 compresses a body, and encodes it as API Gateway passes binary bodies through.
+func gzipBase64(body string) string {
+	var buffer bytes.Buffer
+	writer := gzip.NewWriter(&buffer)
+	writer.Write([]byte(body))
+	writer.Close()
+	return base64.StdEncoding.EncodeToString(buffer.Bytes())
+}
+
+func postRequest(body string) utils.Request {
+	return utils.Request{
+		Method:         "POST",
+		PathParameters: map[string]string{"ProjectId": "sensors"},
+		Headers:        map[string]string{"Content-Type": "application/json"},
+		Body:           body,
+	}
+}
+
+func respondWithReading(server *dynamotest.Server) {
+	server.Respond("Query", `{"Count": 1, "ScannedCount": 1, "Items": [{
+		"ProjectId#DeviceId": {"S": "sensors#d1"},
+		"ProjectId": {"S": "sensors"},
+		"DeviceId": {"S": "d1"},
+		"EpochTime": {"N": "1600000000"},
+		"Temperature": {"N": "21.5"}
+	}]}`)
+}
+
+// primaryValue returns the partition key value a recorded query was keyed on.
+func primaryValue(call dynamotest.Call) interface{} {
+	values, _ := call.Input["ExpressionAttributeValues"].(map[string]interface{})
+	value, _ := values[":primaryValue"].(map[string]interface{})
+	return value["S"]
+}
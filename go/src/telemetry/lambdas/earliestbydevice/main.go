@@ -0,0 +1,58 @@
+package main
+
+import (
+	"log"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+
+	"telemetry/utils"
+)
+
+// earliestByDeviceHandler is an AWS Lambda function
+// that parses the URL used to access the API Gateway.
+// It retrieves the oldest reading of each device in a project, telling onboarding and audit
+// tooling when each device came online, as an object keyed by DeviceId.
+func earliestByDeviceHandler(
+	request *utils.Request,
+) (events.APIGatewayProxyResponse, error) {
+	client := utils.Client()
+
+	// This handler only handles GET requests.
+	if request.Method == "GET" {
+		// The project's readings are read from the ProjectId-EpochTime-index,
+		// optionally bounded by the 'start' and 'end' query string parameters.
+		params, err := utils.ParseQueryParams(request)
+		if err != nil {
+			return utils.BadRequestResponse(err.Error())
+		}
+		if err := request.CheckIndexAccess(params.Index); err != nil {
+			return utils.ForbiddenResponse(err.Error())
+		}
+		// Every reading in the window is needed to find each device's earliest,
+		// which are read oldest first.
+		params.Single = false
+		params.Limit = 0
+		params.Recent = 0
+		params.Stride = 0
+		params.Descending = false
+		if err := params.Validate(); err != nil {
+			return utils.BadRequestResponse(err.Error())
+		}
+
+		items, err := utils.QueryItems(request.Context(), client, params)
+		if err != nil {
+			log.Printf("Query failed, %v", err)
+			return utils.StorageErrorResponse(err, "Failed to query table")
+		}
+
+		earliest := utils.CleanKeyedItems(utils.EarliestPerDevice(items))
+		utils.RedactKeyedFields(earliest, utils.RequestRedactions(request))
+		return utils.JSONResponse(earliest)
+	}
+	return utils.MethodNotAllowedResponse()
+}
+
+func main() {
+	lambda.Start(utils.Adapt(utils.Recover(utils.WithMetrics(earliestByDeviceHandler))))
+}
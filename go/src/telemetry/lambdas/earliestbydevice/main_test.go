@@ -0,0 +1,140 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"telemetry/utils"
+	"telemetry/utils/dynamotest"
+)
+
+func TestEarliestByDeviceHandler(t *testing.T) {
+	tests := []struct {
+		name       string
+		env        map[string]string
+		request    utils.Request
+		setup      func(server *dynamotest.Server)
+		wantStatus int
+		wantBody   []string
+		avoidBody  []string
+	}{
+		{
+			name:       "earliest reading of each device",
+			request:    utils.Request{Method: "GET"},
+			wantStatus: 200,
+			wantBody:   []string{`"d1":{`, `"d2":{`, `"EpochTime":{"Value":"1"}`, `"EpochTime":{"Value":"4"}`},
+			avoidBody:  []string{`"EpochTime":{"Value":"2"}`},
+		},
+		{
+			name:       "composite keys dropped",
+			request:    utils.Request{Method: "GET"},
+			wantStatus: 200,
+			wantBody:   []string{`"d1":{`},
+			avoidBody:  []string{"#"},
+		},
+		{
+			name:       "sensitive fields shown",
+			env:        map[string]string{"REDACT_FIELDS_sensors": "Latitude"},
+			request:    utils.Request{Method: "GET"},
+			wantStatus: 200,
+			wantBody:   []string{`"Latitude":{"Value":"52.1"}`},
+		},
+		{
+			name: "sensitive fields redacted",
+			env:  map[string]string{"REDACT_FIELDS_sensors": "Latitude"},
+			request: utils.Request{
+				Method:     "GET",
+				Authorizer: map[string]interface{}{"privilege": utils.RestrictedPrivilege},
+			},
+			wantStatus: 200,
+			wantBody:   []string{`"d1":{`},
+			avoidBody:  []string{"Latitude"},
+		},
+		{
+			name: "single, limit, and order ignored",
+			request: utils.Request{
+				Method:                "GET",
+				QueryStringParameters: map[string]string{"single": "true", "limit": "1", "order": "desc"},
+			},
+			wantStatus: 200,
+			wantBody:   []string{`"d1":{`, `"d2":{`},
+		},
+		{
+			name:       "recent ignored",
+			request:    utils.Request{Method: "GET", QueryStringParameters: map[string]string{"recent": "1"}},
+			wantStatus: 200,
+			wantBody:   []string{`"d1":{`, `"d2":{`},
+		},
+		{
+			name:       "malformed start",
+			request:    utils.Request{Method: "GET", QueryStringParameters: map[string]string{"start": "yesterday"}},
+			wantStatus: 400,
+		},
+		{
+			name: "index without the admin token",
+			request: utils.Request{
+				Method:                "GET",
+				QueryStringParameters: map[string]string{"index": "x", "keyName": "k", "keyValue": "v"},
+				Authorizer:            map[string]interface{}{"projectId": "sensors"},
+			},
+			wantStatus: 403,
+		},
+		{
+			name:       "failed query",
+			request:    utils.Request{Method: "GET"},
+			setup:      func(server *dynamotest.Server) { server.Fail("Query", "InternalServerError") },
+			wantStatus: 500,
+		},
+		{
+			name:       "other methods",
+			request:    utils.Request{Method: "POST"},
+			wantStatus: 405,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			for name, value := range test.env {
+				t.Setenv(name, value)
+			}
+			server := dynamotest.NewServer(t)
+			utils.SetClient(server.Client())
+			if test.setup != nil {
+				test.setup(server)
+			}
+			server.Respond("Query", `{"Count": 3, "ScannedCount": 3, "Items": [
+				{"DeviceId": {"S": "d1"}, "EpochTime": {"N": "2"}},
+				{"DeviceId": {"S": "d1"}, "EpochTime": {"N": "1"},
+					"Latitude": {"N": "52.1"}, "ProjectId#DeviceId": {"S": "sensors#d1"},
+					"ProjectId#LocationId": {"S": "sensors#roof"}},
+				{"DeviceId": {"S": "d2"}, "EpochTime": {"N": "4"}}
+			]}`)
+			request := test.request
+			request.PathParameters = map[string]string{"ProjectId": "sensors"}
+
+			response, err := earliestByDeviceHandler(&request)
+			if err != nil {
+				t.Fatalf("earliestByDeviceHandler() error = %v", err)
+			}
+			if response.StatusCode != test.wantStatus {
+				t.Fatalf("status = %d, want %d, body %s", response.StatusCode, test.wantStatus, response.Body)
+			}
+			for _, want := range test.wantBody {
+				if !strings.Contains(response.Body, want) {
+					t.Errorf("body = %s, want %s in it", response.Body, want)
+				}
+			}
+			for _, avoid := range test.avoidBody {
+				if strings.Contains(response.Body, avoid) {
+					t.Errorf("body = %s, want no %s in it", response.Body, avoid)
+				}
+			}
+			if test.wantStatus != 200 {
+				return
+			}
+			queries := server.Calls("Query")
+			if len(queries) != 1 || queries[0].Input["Limit"] != nil || queries[0].Input["ScanIndexForward"] == false {
+				t.Errorf("queries = %v, want one of every reading, oldest first", queries)
+			}
+		})
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+
+	"telemetry/utils"
+)
+
+// maxSamples caps the 'samples' query string parameter, keeping the query to a single page.
+const maxSamples = 1000
+
+// fieldsEndpointHandler is an AWS Lambda function
+// that parses the URL used to access the API Gateway.
+// It samples a device's most recent readings and describes the attributes they contain,
+// mapping each name to its inferred type, as a discovery aid for dashboard developers.
+// The optional 'samples' query string parameter sets how many readings are sampled.
+func fieldsEndpointHandler(
+	request *utils.Request,
+) (events.APIGatewayProxyResponse, error) {
+	client := utils.Client()
+
+	// This handler only handles GET requests.
+	if request.Method == "GET" {
+		samples := utils.SchemaSampleSize()
+		if samplesStr, ok := request.QueryStringParameters["samples"]; ok {
+			parsed, err := strconv.Atoi(samplesStr)
+			if err != nil || parsed < 1 || parsed > maxSamples {
+				return utils.BadRequestResponse(
+					fmt.Sprintf("samples must be a whole number from 1 to %d, got %q", maxSamples, samplesStr),
+				)
+			}
+			samples = parsed
+		}
+
+		params := utils.QueryParams{
+			TenantId:   request.TenantId,
+			ProjectId:  request.PathParameters["ProjectId"],
+			DeviceId:   request.PathParameters["DeviceId"],
+			Limit:      samples,
+			Descending: true,
+		}
+		items, err := utils.QueryItems(request.Context(), client, params)
+		if err != nil {
+			log.Printf("Query failed, %v", err)
+			return utils.StorageErrorResponse(err, "Failed to query table")
+		}
+		// Restricted tokens don't learn of the project's sensitive fields.
+		utils.RedactFields(items, utils.RequestRedactions(request))
+		return utils.JSONResponse(utils.InferSchema(items))
+	}
+	return utils.MethodNotAllowedResponse()
+}
+
+func main() {
+	lambda.Start(utils.Adapt(utils.Recover(utils.WithMetrics(fieldsEndpointHandler))))
+}
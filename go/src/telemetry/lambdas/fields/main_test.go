@@ -0,0 +1,98 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"telemetry/utils"
+	"telemetry/utils/dynamotest"
+)
+
+func TestFieldsEndpointHandler(t *testing.T) {
+	tests := []struct {
+		name       string
+		env        map[string]string
+		request    utils.Request
+		wantStatus int
+		wantBody   string
+		wantLimit  float64
+	}{
+		{
+			name:       "attributes of the sampled readings",
+			request:    utils.Request{Method: "GET"},
+			wantStatus: 200,
+			wantBody:   `{"DeviceId":"string","EpochTime":"number","Status":"mixed","Temperature":"number"}`,
+			wantLimit:  50,
+		},
+		{
+			name: "sensitive fields redacted",
+			env:  map[string]string{"REDACT_FIELDS_sensors": "Temperature"},
+			request: utils.Request{
+				Method:     "GET",
+				Authorizer: map[string]interface{}{"privilege": utils.RestrictedPrivilege},
+			},
+			wantStatus: 200,
+			wantBody:   `{"DeviceId":"string","EpochTime":"number","Status":"mixed"}`,
+			wantLimit:  50,
+		},
+		{
+			name:       "samples",
+			request:    utils.Request{Method: "GET", QueryStringParameters: map[string]string{"samples": "5"}},
+			wantStatus: 200,
+			wantLimit:  5,
+		},
+		{
+			name:       "too many samples",
+			request:    utils.Request{Method: "GET", QueryStringParameters: map[string]string{"samples": "1001"}},
+			wantStatus: 400,
+		},
+		{
+			name:       "malformed samples",
+			request:    utils.Request{Method: "GET", QueryStringParameters: map[string]string{"samples": "all"}},
+			wantStatus: 400,
+		},
+		{
+			name:       "other methods",
+			request:    utils.Request{Method: "POST"},
+			wantStatus: 405,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			for name, value := range test.env {
+				t.Setenv(name, value)
+			}
+			server := dynamotest.NewServer(t)
+			utils.SetClient(server.Client())
+			server.Respond("Query", `{"Count": 2, "ScannedCount": 2, "Items": [
+				{"ProjectId#DeviceId": {"S": "sensors#d1"}, "DeviceId": {"S": "d1"}, "EpochTime": {"N": "2"},
+					"Temperature": {"N": "21.5"}, "Status": {"S": "ok"}},
+				{"ProjectId#DeviceId": {"S": "sensors#d1"}, "DeviceId": {"S": "d1"}, "EpochTime": {"N": "1"},
+					"Status": {"N": "1"}}
+			]}`)
+			request := test.request
+			request.PathParameters = map[string]string{"ProjectId": "sensors", "DeviceId": "d1"}
+
+			response, err := fieldsEndpointHandler(&request)
+			if err != nil {
+				t.Fatalf("fieldsEndpointHandler() error = %v", err)
+			}
+			if response.StatusCode != test.wantStatus {
+				t.Fatalf("status = %d, want %d, body %s", response.StatusCode, test.wantStatus, response.Body)
+			}
+			if test.wantBody != "" && response.Body != test.wantBody {
+				t.Errorf("body = %s, want %s", response.Body, test.wantBody)
+			}
+			if test.wantLimit == 0 {
+				return
+			}
+			queries := server.Calls("Query")
+			if len(queries) != 1 || queries[0].Input["Limit"] != test.wantLimit || queries[0].Input["ScanIndexForward"] != false {
+				t.Errorf("queries = %v, want one of the %v newest readings", queries, test.wantLimit)
+			}
+			if strings.Contains(response.Body, "ProjectId#DeviceId") {
+				t.Errorf("body = %s, want no server-managed attributes", response.Body)
+			}
+		})
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"telemetry/utils"
+	"telemetry/utils/dynamotest"
+)
+
+func TestLatestByLocationHandler(t *testing.T) {
+	tests := []struct {
+		name       string
+		env        map[string]string
+		request    utils.Request
+		wantStatus int
+		wantBody   []string
+		avoidBody  []string
+	}{
+		{
+			name:       "latest reading at each location",
+			request:    utils.Request{Method: "GET"},
+			wantStatus: 200,
+			wantBody:   []string{`"lab":{`, `"roof":{`, `"EpochTime":{"Value":"3"}`},
+			avoidBody:  []string{`"EpochTime":{"Value":"2"}`},
+		},
+		{
+			name:       "composite keys dropped",
+			request:    utils.Request{Method: "GET"},
+			wantStatus: 200,
+			wantBody:   []string{`"roof":{`},
+			avoidBody:  []string{"#"},
+		},
+		{
+			name:       "sensitive fields shown",
+			env:        map[string]string{"REDACT_FIELDS_sensors": "Latitude"},
+			request:    utils.Request{Method: "GET"},
+			wantStatus: 200,
+			wantBody:   []string{`"Latitude":{"Value":"52.1"}`},
+		},
+		{
+			name: "sensitive fields redacted",
+			env:  map[string]string{"REDACT_FIELDS_sensors": "Latitude"},
+			request: utils.Request{
+				Method:     "GET",
+				Authorizer: map[string]interface{}{"privilege": utils.RestrictedPrivilege},
+			},
+			wantStatus: 200,
+			wantBody:   []string{`"roof":{`},
+			avoidBody:  []string{"Latitude"},
+		},
+		{
+			name:       "single and limit ignored",
+			request:    utils.Request{Method: "GET", QueryStringParameters: map[string]string{"single": "true", "limit": "1"}},
+			wantStatus: 200,
+			wantBody:   []string{`"lab":{`, `"roof":{`},
+		},
+		{
+			name:       "recent ignored",
+			request:    utils.Request{Method: "GET", QueryStringParameters: map[string]string{"recent": "1"}},
+			wantStatus: 200,
+			wantBody:   []string{`"lab":{`, `"roof":{`},
+		},
+		{
+			name:       "malformed start",
+			request:    utils.Request{Method: "GET", QueryStringParameters: map[string]string{"start": "yesterday"}},
+			wantStatus: 400,
+		},
+		{
+			name:       "other methods",
+			request:    utils.Request{Method: "POST"},
+			wantStatus: 405,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			for name, value := range test.env {
+				t.Setenv(name, value)
+			}
+			server := dynamotest.NewServer(t)
+			utils.SetClient(server.Client())
+			server.Respond("Query", `{"Count": 3, "ScannedCount": 3, "Items": [
+				{"LocationId": {"S": "roof"}, "DeviceId": {"S": "d1"}, "EpochTime": {"N": "2"}},
+				{"LocationId": {"S": "roof"}, "DeviceId": {"S": "d1"}, "EpochTime": {"N": "3"},
+					"Latitude": {"N": "52.1"}, "ProjectId#LocationId": {"S": "sensors#roof"},
+					"ProjectId#DeviceId": {"S": "sensors#d1"}},
+				{"LocationId": {"S": "lab"}, "DeviceId": {"S": "d2"}, "EpochTime": {"N": "1"}}
+			]}`)
+			request := test.request
+			request.PathParameters = map[string]string{"ProjectId": "sensors"}
+
+			response, err := latestByLocationHandler(&request)
+			if err != nil {
+				t.Fatalf("latestByLocationHandler() error = %v", err)
+			}
+			if response.StatusCode != test.wantStatus {
+				t.Fatalf("status = %d, want %d, body %s", response.StatusCode, test.wantStatus, response.Body)
+			}
+			for _, want := range test.wantBody {
+				if !strings.Contains(response.Body, want) {
+					t.Errorf("body = %s, want %s in it", response.Body, want)
+				}
+			}
+			for _, avoid := range test.avoidBody {
+				if strings.Contains(response.Body, avoid) {
+					t.Errorf("body = %s, want no %s in it", response.Body, avoid)
+				}
+			}
+		})
+	}
+}
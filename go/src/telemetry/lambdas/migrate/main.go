@@ -0,0 +1,77 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+
+	"telemetry/utils"
+)
+
+// defaultBatchSize is the number of items scanned per batch when 'limit' isn't given.
+const defaultBatchSize = 100
+
+// migrateHandler is an AWS Lambda function
+// that parses the URL used to access the API Gateway.
+// It is an admin endpoint that repairs readings written before the location composite key
+// was added, which the location endpoint can't find, one batch of the table per request.
+// Each response's 'nextCursor' is passed back as the 'cursor' query string parameter to migrate
+// the next batch, and the 'limit' query string parameter sets how many items each batch scans.
+// Nothing is written unless the 'dryRun' query string parameter is falsy.
+func migrateHandler(
+	request *utils.Request,
+) (events.APIGatewayProxyResponse, error) {
+	client := utils.Client()
+
+	// This handler only handles POST requests.
+	if request.Method == "POST" {
+		if !request.IsAdmin() {
+			return utils.ForbiddenResponse("Migrations require the admin token")
+		}
+
+		batchSize := defaultBatchSize
+		if limitStr, limitOk := request.QueryStringParameters["limit"]; limitOk {
+			limit, err := strconv.Atoi(limitStr)
+			if err != nil || limit < 1 {
+				return utils.BadRequestResponse(
+					fmt.Sprintf("limit must be a whole number of at least 1, got %q", limitStr),
+				)
+			}
+			batchSize = limit
+		}
+		dryRun := true
+		if dryRunStr, dryRunOk := request.QueryStringParameters["dryRun"]; dryRunOk {
+			var err error
+			if dryRun, err = utils.ParseBoolParam(dryRunStr); err != nil {
+				return utils.BadRequestResponse("dryRun: " + err.Error())
+			}
+		}
+
+		result, err := utils.BackfillLocationKeys(
+			request.Context(),
+			client,
+			request.QueryStringParameters["cursor"],
+			batchSize,
+			dryRun,
+		)
+		if errors.Is(err, utils.ErrInvalidCursor) {
+			return utils.BadRequestResponse(err.Error())
+		}
+		if err != nil {
+			log.Printf("Migration failed, %v", err)
+			return utils.StorageErrorResponse(err, "Failed to migrate readings")
+		}
+		log.Printf("Migrated %d of %d readings missing the location key (dry run: %t)",
+			result.Updated, result.Missing, result.DryRun)
+		return utils.JSONResponse(result)
+	}
+	return utils.MethodNotAllowedResponse()
+}
+
+func main() {
+	lambda.Start(utils.Adapt(utils.Recover(utils.WithMetrics(migrateHandler))))
+}
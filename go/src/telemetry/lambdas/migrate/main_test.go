@@ -0,0 +1,118 @@
+package main
+
+import (
+	"testing"
+
+	"telemetry/utils"
+	"telemetry/utils/dynamotest"
+)
+
+func TestMigrateHandler(t *testing.T) {
+	admin := map[string]interface{}{"projectId": "*"}
+	tests := []struct {
+		name        string
+		request     utils.Request
+		setup       func(server *dynamotest.Server)
+		wantStatus  int
+		wantBody    string
+		wantLimit   float64
+		wantUpdates int
+	}{
+		{
+			name:       "dry run by default",
+			request:    utils.Request{Method: "POST", Authorizer: admin},
+			wantStatus: 200,
+			wantBody:   `{"dryRun":true,"missing":1,"scanned":4,"updated":0}`,
+			wantLimit:  100,
+		},
+		{
+			name: "migrated",
+			request: utils.Request{
+				Method:                "POST",
+				Authorizer:            admin,
+				QueryStringParameters: map[string]string{"dryRun": "false", "limit": "10"},
+			},
+			wantStatus:  200,
+			wantBody:    `{"dryRun":false,"missing":1,"scanned":4,"updated":1}`,
+			wantLimit:   10,
+			wantUpdates: 1,
+		},
+		{
+			name:       "without the admin token",
+			request:    utils.Request{Method: "POST", Authorizer: map[string]interface{}{"projectId": "sensors"}},
+			wantStatus: 403,
+		},
+		{
+			name: "malformed limit",
+			request: utils.Request{
+				Method:                "POST",
+				Authorizer:            admin,
+				QueryStringParameters: map[string]string{"limit": "0"},
+			},
+			wantStatus: 400,
+		},
+		{
+			name: "malformed dryRun",
+			request: utils.Request{
+				Method:                "POST",
+				Authorizer:            admin,
+				QueryStringParameters: map[string]string{"dryRun": "perhaps"},
+			},
+			wantStatus: 400,
+		},
+		{
+			name: "malformed cursor",
+			request: utils.Request{
+				Method:                "POST",
+				Authorizer:            admin,
+				QueryStringParameters: map[string]string{"cursor": "???"},
+			},
+			wantStatus: 400,
+		},
+		{
+			name:       "throttled",
+			request:    utils.Request{Method: "POST", Authorizer: admin},
+			setup:      func(server *dynamotest.Server) { server.Fail("Scan", "ProvisionedThroughputExceededException") },
+			wantStatus: 503,
+		},
+		{
+			name:       "other methods",
+			request:    utils.Request{Method: "GET", Authorizer: admin},
+			wantStatus: 405,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := dynamotest.NewServer(t)
+			utils.SetClient(server.Client())
+			if test.setup != nil {
+				test.setup(server)
+			}
+			server.Respond("Scan", `{"Count": 1, "ScannedCount": 4, "Items": [
+				{"ProjectId#DeviceId": {"S": "sensors#d1"}, "EpochTime": {"N": "1"},
+					"ProjectId": {"S": "sensors"}, "LocationId": {"S": "roof"}}
+			]}`)
+			request := test.request
+
+			response, err := migrateHandler(&request)
+			if err != nil {
+				t.Fatalf("migrateHandler() error = %v", err)
+			}
+			if response.StatusCode != test.wantStatus {
+				t.Fatalf("status = %d, want %d, body %s", response.StatusCode, test.wantStatus, response.Body)
+			}
+			if test.wantBody != "" && response.Body != test.wantBody {
+				t.Errorf("body = %s, want %s", response.Body, test.wantBody)
+			}
+			if test.wantLimit != 0 {
+				scans := server.Calls("Scan")
+				if len(scans) != 1 || scans[0].Input["Limit"] != test.wantLimit {
+					t.Errorf("scans = %v, want one of %v items", scans, test.wantLimit)
+				}
+			}
+			if updates := server.Calls("UpdateItem"); len(updates) != test.wantUpdates {
+				t.Errorf("made %d updates, want %d", len(updates), test.wantUpdates)
+			}
+		})
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+
+	"telemetry/utils"
+)
+
+// multiProjectResult is the body returned by the multi-project endpoint.
+// Errors lists, by ProjectId, the projects whose readings could not be retrieved.
+type multiProjectResult struct {
+	Items  []map[string]types.AttributeValue `json:"items"`
+	Errors map[string]string                 `json:"errors,omitempty"`
+}
+
+// multiProjectHandler is an AWS Lambda function
+// that parses the URL used to access the API Gateway.
+// It is an admin endpoint for cross-project monitoring, returning the readings of every project
+// named in the comma-separated 'projects' query string parameter, merged and tagged by ProjectId.
+// The optional 'account' query string parameter names a member account, configured in
+// ACCOUNT_ROLES, whose table is read instead of this account's.
+// The remaining query string parameters apply to each project's query.
+func multiProjectHandler(
+	request *utils.Request,
+) (events.APIGatewayProxyResponse, error) {
+	// This handler only handles GET requests.
+	if request.Method == "GET" {
+		if !request.IsAdmin() {
+			return utils.ForbiddenResponse("Cross-project queries require the admin token")
+		}
+		client, err := utils.AccountClient(request.Context(), request.QueryStringParameters["account"])
+		if errors.Is(err, utils.ErrUnknownAccount) {
+			return utils.BadRequestResponse(err.Error())
+		}
+		if err != nil {
+			log.Printf("Failed to create client for account, %v", err)
+			return utils.InternalErrorResponse("Failed to create client for account")
+		}
+
+		var projects []string
+		for _, project := range strings.Split(request.QueryStringParameters["projects"], ",") {
+			if project = strings.TrimSpace(project); project != "" {
+				projects = append(projects, project)
+			}
+		}
+		if len(projects) == 0 {
+			return utils.BadRequestResponse("projects must name at least one project")
+		}
+
+		params, err := utils.ParseQueryParams(request)
+		if err != nil {
+			return utils.BadRequestResponse(err.Error())
+		}
+		params.Single = false
+		if err := params.Validate(); err != nil {
+			return utils.BadRequestResponse(err.Error())
+		}
+		// Queries without a time range default to the configured recent window.
+		utils.ApplyDefaultWindow(&params)
+		utils.ClampTimeRange(&params)
+
+		items, errs := utils.QueryProjects(request.Context(), client, projects, params)
+		if len(errs) == len(projects) {
+			for project, err := range errs {
+				log.Printf("Query of project %s failed, %v", project, err)
+			}
+			return utils.InternalErrorResponse("Failed to query table")
+		}
+
+		result := multiProjectResult{Items: items}
+		if len(errs) > 0 {
+			result.Errors = make(map[string]string, len(errs))
+			for project, err := range errs {
+				log.Printf("Query of project %s failed, %v", project, err)
+				result.Errors[project] = "Failed to query table"
+			}
+		}
+		if result.Items == nil {
+			result.Items = []map[string]types.AttributeValue{}
+		}
+		return utils.JSONResponse(result)
+	}
+	return utils.MethodNotAllowedResponse()
+}
+
+func main() {
+	lambda.Start(utils.Adapt(utils.Recover(utils.WithMetrics(multiProjectHandler))))
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"telemetry/utils"
+	"telemetry/utils/dynamotest"
+)
+
+func TestMultiProjectHandler(t *testing.T) {
+	admin := map[string]interface{}{"projectId": "*"}
+	tests := []struct {
+		name       string
+		request    utils.Request
+		setup      func(server *dynamotest.Server)
+		wantStatus int
+		wantBody   []string
+		wantQuery  int
+	}{
+		{
+			name: "merged readings of each project",
+			request: utils.Request{
+				Method:                "GET",
+				QueryStringParameters: map[string]string{"projects": "sensors, dogs"},
+				Authorizer:            admin,
+			},
+			setup: func(server *dynamotest.Server) {
+				server.Respond("Query", `{"Count": 1, "Items": [{"EpochTime": {"N": "1"}}]}`)
+				server.Respond("Query", `{"Count": 1, "Items": [{"EpochTime": {"N": "2"}}]}`)
+			},
+			wantStatus: 200,
+			wantBody:   []string{`"items":[`, `"ProjectId":{"Value":"sensors"}`, `"ProjectId":{"Value":"dogs"}`},
+			wantQuery:  2,
+		},
+		{
+			name: "a failed project reported",
+			request: utils.Request{
+				Method:                "GET",
+				QueryStringParameters: map[string]string{"projects": "sensors,dogs"},
+				Authorizer:            admin,
+			},
+			setup:      func(server *dynamotest.Server) { server.Fail("Query", "InternalServerError") },
+			wantStatus: 200,
+			wantBody:   []string{`"errors":{`, "Failed to query table"},
+			wantQuery:  2,
+		},
+		{
+			name: "every project failed",
+			request: utils.Request{
+				Method:                "GET",
+				QueryStringParameters: map[string]string{"projects": "sensors,dogs"},
+				Authorizer:            admin,
+			},
+			setup: func(server *dynamotest.Server) {
+				server.Fail("Query", "InternalServerError")
+				server.Fail("Query", "InternalServerError")
+			},
+			wantStatus: 500,
+			wantQuery:  2,
+		},
+		{
+			name: "without the admin token",
+			request: utils.Request{
+				Method:                "GET",
+				QueryStringParameters: map[string]string{"projects": "sensors"},
+				Authorizer:            map[string]interface{}{"projectId": "sensors"},
+			},
+			wantStatus: 403,
+		},
+		{
+			name: "no projects",
+			request: utils.Request{
+				Method:                "GET",
+				QueryStringParameters: map[string]string{"projects": " , "},
+				Authorizer:            admin,
+			},
+			wantStatus: 400,
+		},
+		{
+			name: "unknown account",
+			request: utils.Request{
+				Method:                "GET",
+				QueryStringParameters: map[string]string{"projects": "sensors", "account": "east"},
+				Authorizer:            admin,
+			},
+			wantStatus: 400,
+			wantBody:   []string{"account is not configured"},
+		},
+		{
+			name:       "other methods",
+			request:    utils.Request{Method: "POST", Authorizer: admin},
+			wantStatus: 405,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := dynamotest.NewServer(t)
+			utils.SetClient(server.Client())
+			if test.setup != nil {
+				test.setup(server)
+			}
+
+			response, err := multiProjectHandler(&test.request)
+			if err != nil {
+				t.Fatalf("multiProjectHandler() error = %v", err)
+			}
+			if response.StatusCode != test.wantStatus {
+				t.Fatalf("status = %d, want %d, body %s", response.StatusCode, test.wantStatus, response.Body)
+			}
+			for _, want := range test.wantBody {
+				if !strings.Contains(response.Body, want) {
+					t.Errorf("body = %s, want %s in it", response.Body, want)
+				}
+			}
+			if queries := server.Calls("Query"); len(queries) != test.wantQuery {
+				t.Errorf("made %d queries, want %d", len(queries), test.wantQuery)
+			}
+		})
+	}
+}
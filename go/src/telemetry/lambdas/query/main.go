@@ -0,0 +1,103 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"strconv"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+
+	"telemetry/utils"
+)
+
+// queryHandler is an AWS Lambda function
+// that parses the URL used to access the API Gateway.
+// It runs the structured query POSTed in the body against the project in the path,
+// for clients whose filters, field selections, and aggregations outgrow the query string.
+// Like the GET endpoints, its limit is clamped to MaxLimit, and items that would overflow
+// the response stop at a 'nextCursor', passed back as the spec's 'cursor' to retrieve the rest.
+func queryHandler(
+	request *utils.Request,
+) (events.APIGatewayProxyResponse, error) {
+	client := utils.Client()
+
+	// This handler only handles POST requests.
+	if request.Method == "POST" {
+		spec, err := utils.DecodeQuerySpec(request.Body)
+		if err != nil {
+			return utils.BadRequestResponse(err.Error())
+		}
+		spec.TenantId = request.TenantId
+		spec.ProjectId = request.PathParameters["ProjectId"]
+		if err := spec.Validate(); err != nil {
+			return utils.BadRequestResponse(err.Error())
+		}
+		params, _ := spec.QueryParams()
+
+		// Restricted tokens can't read the project's sensitive fields, even by filtering on them.
+		redacted := utils.RequestRedactions(request)
+		if err := spec.CheckRedactedFilters(redacted); err != nil {
+			return utils.ForbiddenResponse(err.Error())
+		}
+		if spec.Aggregate != nil {
+			if err := utils.CheckRedactedField(spec.Aggregate.Field, redacted); err != nil {
+				return utils.ForbiddenResponse(err.Error())
+			}
+		}
+
+		// Queries without a time range default to the configured recent window.
+		utils.ApplyDefaultWindow(&params)
+		// Unbounded or overly long time ranges are clamped to the configured maximum span.
+		clamped := utils.ClampTimeRange(&params)
+		// Items returned as they are must fit in the response, unlike those reduced to an aggregate.
+		if spec.Aggregate == nil {
+			params.SizeBudget = utils.ResponseSizeBudget()
+		}
+
+		items, stats, err := utils.QueryItemsWithStats(request.Context(), client, params)
+		if errors.Is(err, utils.ErrInvalidCursor) {
+			return utils.BadRequestResponse(err.Error())
+		}
+		if err != nil {
+			log.Printf("Query failed, %v", err)
+			return utils.StorageErrorResponse(err, "Failed to query table")
+		}
+
+		// Unless the 'raw' query string parameter is truthy, internal key attributes are removed.
+		if raw, _ := utils.ParseBoolParam(request.QueryStringParameters["raw"]); !raw {
+			items = utils.CleanItems(items)
+		}
+		utils.RedactFields(items, redacted)
+
+		var response events.APIGatewayProxyResponse
+		switch {
+		case spec.Aggregate != nil:
+			response, err = utils.JSONResponse(
+				utils.ComputeStats(items, spec.Aggregate.Field, spec.Aggregate.Percentiles),
+			)
+		case stats.TruncatedBySize:
+			response, err = utils.JSONResponse(utils.ItemsEnvelope{
+				Items:           items,
+				Count:           len(items),
+				LimitClamped:    params.LimitClamped,
+				TruncatedBySize: true,
+				NextCursor:      stats.NextCursor,
+			})
+		default:
+			response, err = utils.GetSuccessResponse(items, false)
+		}
+		if clamped != "" {
+			response.Headers["X-Time-Range-Clamped"] = clamped
+		}
+		if params.LimitClamped {
+			response.Headers["X-Limit-Clamped"] = strconv.Itoa(utils.MaxLimit())
+		}
+		return response, err
+	}
+	return utils.MethodNotAllowedResponse()
+}
+
+func main() {
+	lambda.Start(utils.Adapt(utils.Recover(utils.WithMetrics(queryHandler))))
+}
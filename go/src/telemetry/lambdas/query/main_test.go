@@ -0,0 +1,217 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"telemetry/utils"
+	"telemetry/utils/dynamotest"
+)
+
+func TestQueryHandler(t *testing.T) {
+	tests := []struct {
+		name       string
+		env        map[string]string
+		request    utils.Request
+		wantStatus int
+		wantBody   []string
+		avoidBody  []string
+		wantHeader map[string]string
+		wantQuery  bool
+	}{
+		{
+			name:       "items",
+			request:    utils.Request{Method: "POST", Body: `{"deviceId": "d1", "start": 1}`},
+			wantStatus: 200,
+			wantBody:   []string{`"Temperature":{"Value":"20"}`, `"Temperature":{"Value":"22"}`},
+			avoidBody:  []string{"ProjectId#DeviceId"},
+			wantQuery:  true,
+		},
+		{
+			name:       "raw items",
+			request:    utils.Request{Method: "POST", Body: `{"deviceId": "d1", "start": 1}`, QueryStringParameters: map[string]string{"raw": "true"}},
+			wantStatus: 200,
+			wantBody:   []string{"ProjectId#DeviceId"},
+			wantQuery:  true,
+		},
+		{
+			name: "aggregate",
+			request: utils.Request{
+				Method: "POST",
+				Body:   `{"deviceId": "d1", "start": 1, "aggregate": {"field": "Temperature", "percentiles": [50]}}`,
+			},
+			wantStatus: 200,
+			wantBody:   []string{`"count":2`, `"avg":21`, `"p50":21`},
+			wantQuery:  true,
+		},
+		{
+			name:       "clamped time range",
+			env:        map[string]string{"MAX_QUERY_SPAN_SECONDS": "100"},
+			request:    utils.Request{Method: "POST", Body: `{"deviceId": "d1", "start": 1, "end": 1000}`},
+			wantStatus: 200,
+			wantHeader: map[string]string{"X-Time-Range-Clamped": "start=900"},
+			wantQuery:  true,
+		},
+		{
+			name: "sensitive fields redacted",
+			env:  map[string]string{"REDACT_FIELDS_sensors": "Temperature"},
+			request: utils.Request{
+				Method:     "POST",
+				Body:       `{"deviceId": "d1", "start": 1}`,
+				Authorizer: map[string]interface{}{"privilege": utils.RestrictedPrivilege},
+			},
+			wantStatus: 200,
+			wantBody:   []string{`"EpochTime":{"Value":"2"}`},
+			avoidBody:  []string{"Temperature"},
+			wantQuery:  true,
+		},
+		{
+			name: "aggregate of a sensitive field",
+			env:  map[string]string{"REDACT_FIELDS_sensors": "Temperature"},
+			request: utils.Request{
+				Method:     "POST",
+				Body:       `{"deviceId": "d1", "start": 1, "aggregate": {"field": "Temperature"}}`,
+				Authorizer: map[string]interface{}{"privilege": utils.RestrictedPrivilege},
+			},
+			wantStatus: 403,
+		},
+		{
+			name:       "limit clamped",
+			env:        map[string]string{"MAX_LIMIT": "1"},
+			request:    utils.Request{Method: "POST", Body: `{"deviceId": "d1", "start": 1, "limit": 5}`},
+			wantStatus: 200,
+			wantBody:   []string{`"Temperature":{"Value":"20"}`},
+			avoidBody:  []string{`"Temperature":{"Value":"22"}`},
+			wantHeader: map[string]string{"X-Limit-Clamped": "1"},
+			wantQuery:  true,
+		},
+		{
+			name:       "truncated by size",
+			env:        map[string]string{"RESPONSE_SIZE_BUDGET_BYTES": "1"},
+			request:    utils.Request{Method: "POST", Body: `{"deviceId": "d1", "start": 1}`},
+			wantStatus: 200,
+			wantBody:   []string{`"truncatedBySize":true`, `"nextCursor":`, `"Temperature":{"Value":"20"}`},
+			avoidBody:  []string{`"Temperature":{"Value":"22"}`},
+			wantQuery:  true,
+		},
+		{
+			name: "filter on a sensitive field",
+			env:  map[string]string{"REDACT_FIELDS_sensors": "Temperature"},
+			request: utils.Request{
+				Method:     "POST",
+				Body:       `{"deviceId": "d1", "start": 1, "filters": [{"field": "Temperature", "op": ">", "value": 21}]}`,
+				Authorizer: map[string]interface{}{"privilege": utils.RestrictedPrivilege},
+			},
+			wantStatus: 403,
+		},
+		{
+			name:       "invalid cursor",
+			request:    utils.Request{Method: "POST", Body: `{"deviceId": "d1", "start": 1, "cursor": "!!!"}`},
+			wantStatus: 400,
+		},
+		{
+			name:       "unknown field",
+			request:    utils.Request{Method: "POST", Body: `{"device": "d1"}`},
+			wantStatus: 400,
+		},
+		{
+			name:       "invalid filter",
+			request:    utils.Request{Method: "POST", Body: `{"filters": [{"field": "a", "op": "like", "value": 1}]}`},
+			wantStatus: 400,
+		},
+		{
+			name:       "other methods",
+			request:    utils.Request{Method: "GET"},
+			wantStatus: 405,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			for name, value := range test.env {
+				t.Setenv(name, value)
+			}
+			server := dynamotest.NewServer(t)
+			utils.SetClient(server.Client())
+			server.Respond("Query", `{"Count": 2, "Items": [
+				{"ProjectId#DeviceId": {"S": "sensors#d1"}, "EpochTime": {"N": "1"}, "Temperature": {"N": "20"}},
+				{"ProjectId#DeviceId": {"S": "sensors#d1"}, "EpochTime": {"N": "2"}, "Temperature": {"N": "22"}}
+			]}`)
+			request := test.request
+			request.PathParameters = map[string]string{"ProjectId": "sensors"}
+
+			response, err := queryHandler(&request)
+			if err != nil {
+				t.Fatalf("queryHandler() error = %v", err)
+			}
+			if response.StatusCode != test.wantStatus {
+				t.Fatalf("status = %d, want %d, body %s", response.StatusCode, test.wantStatus, response.Body)
+			}
+			for _, want := range test.wantBody {
+				if !strings.Contains(response.Body, want) {
+					t.Errorf("body = %s, want %s in it", response.Body, want)
+				}
+			}
+			for _, avoid := range test.avoidBody {
+				if strings.Contains(response.Body, avoid) {
+					t.Errorf("body = %s, want no %s in it", response.Body, avoid)
+				}
+			}
+			for name, want := range test.wantHeader {
+				if got := response.Headers[name]; got != want {
+					t.Errorf("%s = %q, want %q", name, got, want)
+				}
+			}
+			if queried := len(server.Calls("Query")) > 0; queried != test.wantQuery {
+				t.Errorf("queried = %v, want %v", queried, test.wantQuery)
+			}
+		})
+	}
+}
+
+func TestQueryHandlerResumes(t *testing.T) {
+	t.Setenv("RESPONSE_SIZE_BUDGET_BYTES", "1")
+	server := dynamotest.NewServer(t)
+	utils.SetClient(server.Client())
+	server.Respond("Query", `{"Count": 2, "Items": [
+		{"ProjectId#DeviceId": {"S": "sensors#d1"}, "EpochTime": {"N": "1"}, "Temperature": {"N": "20"}},
+		{"ProjectId#DeviceId": {"S": "sensors#d1"}, "EpochTime": {"N": "2"}, "Temperature": {"N": "22"}}
+	]}`)
+	server.Respond("Query", `{"Count": 1, "Items": [
+		{"ProjectId#DeviceId": {"S": "sensors#d1"}, "EpochTime": {"N": "2"}, "Temperature": {"N": "22"}}
+	]}`)
+	query := func(body string) string {
+		request := utils.Request{
+			Method:         "POST",
+			Body:           body,
+			PathParameters: map[string]string{"ProjectId": "sensors"},
+		}
+		response, err := queryHandler(&request)
+		if err != nil || response.StatusCode != 200 {
+			t.Fatalf("queryHandler() = %d, %v, body %s", response.StatusCode, err, response.Body)
+		}
+		return response.Body
+	}
+
+	var first struct {
+		TruncatedBySize bool   `json:"truncatedBySize"`
+		NextCursor      string `json:"nextCursor"`
+	}
+	body := query(`{"deviceId": "d1", "start": 1, "fields": ["Temperature"]}`)
+	if err := json.Unmarshal([]byte(body), &first); err != nil || !first.TruncatedBySize || first.NextCursor == "" {
+		t.Fatalf("first response = %s, want it truncated with a cursor", body)
+	}
+	rest := query(`{"deviceId": "d1", "start": 1, "fields": ["Temperature"], "cursor": "` + first.NextCursor + `"}`)
+	if strings.Contains(rest, "truncatedBySize") || !strings.Contains(rest, `"Temperature":{"Value":"22"}`) {
+		t.Errorf("rest = %s, want the rest of the items", rest)
+	}
+
+	queries := server.Calls("Query")
+	if len(queries) != 2 {
+		t.Fatalf("queries = %d, want 2", len(queries))
+	}
+	key, _ := queries[1].Input["ExclusiveStartKey"].(map[string]interface{})
+	if key["EpochTime"] == nil || key["ProjectId#DeviceId"] == nil {
+		t.Errorf("ExclusiveStartKey = %v, want the first item's key", queries[1].Input["ExclusiveStartKey"])
+	}
+}
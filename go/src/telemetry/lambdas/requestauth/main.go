@@ -2,19 +2,30 @@ package main
 
 import (
 	"context"
+	"crypto/subtle"
 	"errors"
+	"log"
+	"os"
+	"strings"
 
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
 
 	"telemetry/constants"
+	"telemetry/utils"
 )
 
 // generatePolicy is a helper function to generate an IAM policy post-authorization.
+// The project the token was authorized for is passed to the endpoint in the authorizer context,
+// so that the endpoint can confirm it matches the project in the path, along with the tenant
+// that owns the project, which partitions its readings while tenants are isolated,
+// and the token's privilege, which decides whether the project's sensitive fields are redacted.
 func generatePolicy(
 	principalId,
 	effect,
-	resource string,
+	resource,
+	project string,
+	privilege string,
 ) events.APIGatewayCustomAuthorizerResponse {
 	authResponse := events.APIGatewayCustomAuthorizerResponse{PrincipalID: principalId}
 
@@ -30,24 +41,135 @@ func generatePolicy(
 			},
 		}
 	}
+	if project != "" {
+		authResponse.Context = map[string]interface{}{"projectId": project}
+		if tenant := utils.ProjectTenant(project); tenant != "" {
+			authResponse.Context["tenantId"] = tenant
+		}
+		if privilege != "" {
+			authResponse.Context["privilege"] = privilege
+		}
+	}
 
 	return authResponse
 }
 
+// adminPolicy allows the admin token, which is recorded as authorized for every project.
+// On a project's path, the tenant that owns the project is recorded as well, so that admin
+// requests are served within that tenant's partitions while tenants are isolated.
+func adminPolicy(resource string, project string) events.APIGatewayCustomAuthorizerResponse {
+	authResponse := generatePolicy("admin", "Allow", resource, "*", "full")
+	if tenant := utils.ProjectTenant(project); tenant != "" {
+		authResponse.Context["tenantId"] = tenant
+	}
+	return authResponse
+}
+
+// defaultTokens are the tokens honored for each project when no rotation is configured.
+var defaultTokens = map[string][]string{
+	"sensors":  {constants.SENSORS_TOKEN},
+	"scitizen": {constants.SCITIZEN_TOKEN},
+	"dogs":     {constants.DOGS_TOKEN},
+}
+
+// projectTokens returns the set of tokens currently valid for the project.
+// A comma-separated PROJECT_TOKENS_<ProjectId> environment variable replaces the default,
+// so that old and new tokens can both be honored while a token is rotated,
+// and the old one dropped afterwards.
+func projectTokens(project string) []string {
+	if tokens, ok := os.LookupEnv(utils.ProjectEnvName("PROJECT_TOKENS_", project)); ok {
+		return tokenList(tokens)
+	}
+	return defaultTokens[project]
+}
+
+// tokenList splits a comma-separated list of tokens, ignoring blanks.
+func tokenList(tokens string) []string {
+	var valid []string
+	for _, token := range strings.Split(tokens, ",") {
+		if token = strings.TrimSpace(token); token != "" {
+			valid = append(valid, token)
+		}
+	}
+	return valid
+}
+
+// restrictedTokens returns the set of tokens valid for the project that may not read its
+// sensitive fields, from the comma-separated RESTRICTED_TOKENS_<ProjectId> environment variable.
+func restrictedTokens(project string) []string {
+	return tokenList(os.Getenv(utils.ProjectEnvName("RESTRICTED_TOKENS_", project)))
+}
+
+// isRestrictedToken reports whether the token is one of the project's restricted tokens.
+func isRestrictedToken(token string, project string) bool {
+	for _, restricted := range restrictedTokens(project) {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(restricted)) == 1 {
+			return true
+		}
+	}
+	return false
+}
+
+// isProjectToken reports whether the token is one of the project's valid tokens.
+func isProjectToken(token string, project string) bool {
+	for _, valid := range projectTokens(project) {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(valid)) == 1 {
+			return true
+		}
+	}
+	return false
+}
+
+// isAdminToken reports whether the token is the admin token set in the ADMIN_TOKEN
+// environment variable. Admin tokens are accepted for every project, as well as for
+// the cross-project endpoints, which have no ProjectId in their path.
+// No admin token is honored when the variable is unset.
+func isAdminToken(token string) bool {
+	admin := os.Getenv("ADMIN_TOKEN")
+	return admin != "" && subtle.ConstantTimeCompare([]byte(token), []byte(admin)) == 1
+}
+
+// isDevToken reports whether the token is the development token set in the DEV_TOKEN
+// environment variable, which is accepted for every project while developing locally.
+// It is only honored with DEV_MODE set, and never in a deployed Lambda function, so that
+// a stray DEV_MODE in a deployment's configuration can't open every project: the function
+// must be running under 'sam local', which sets AWS_SAM_LOCAL, or outside Lambda altogether.
+func isDevToken(token string) bool {
+	devMode, _ := utils.ParseBoolParam(os.Getenv("DEV_MODE"))
+	if !devMode {
+		return false
+	}
+	_, deployed := os.LookupEnv("AWS_LAMBDA_FUNCTION_NAME")
+	if deployed && os.Getenv("AWS_SAM_LOCAL") != "true" {
+		log.Printf("Ignoring DEV_MODE in a deployed function")
+		return false
+	}
+	dev := os.Getenv("DEV_TOKEN")
+	return dev != "" && subtle.ConstantTimeCompare([]byte(token), []byte(dev)) == 1
+}
+
 func validateToken(
 	token string,
 	project string,
 	event *events.APIGatewayCustomAuthorizerRequestTypeRequest,
 ) (events.APIGatewayCustomAuthorizerResponse, error) {
 	switch {
-	case token == constants.SENSORS_TOKEN && project == "sensors":
-		return generatePolicy("user", "Allow", event.MethodArn), nil
-	case token == constants.SCITIZEN_TOKEN && project == "scitizen":
-		return generatePolicy("user", "Allow", event.MethodArn), nil
-	case token == constants.DOGS_TOKEN && project == "dogs":
-		return generatePolicy("user", "Allow", event.MethodArn), nil
+	case event.QueryStringParameters["index"] != "":
+		// Querying an index by name is reserved for administrators.
+		if isAdminToken(token) {
+			return adminPolicy(event.MethodArn, project), nil
+		}
+		return generatePolicy("user", "Deny", event.MethodArn, "", ""), nil
+	case token != "" && isProjectToken(token, project):
+		return generatePolicy("user", "Allow", event.MethodArn, project, "full"), nil
+	case token != "" && isRestrictedToken(token, project):
+		return generatePolicy("user", "Allow", event.MethodArn, project, utils.RestrictedPrivilege), nil
+	case isAdminToken(token):
+		return adminPolicy(event.MethodArn, project), nil
+	case token != "" && isDevToken(token):
+		return generatePolicy("dev", "Allow", event.MethodArn, project, "full"), nil
 	case token == "deny":
-		return generatePolicy("user", "Deny", event.MethodArn), nil
+		return generatePolicy("user", "Deny", event.MethodArn, "", ""), nil
 	case token == "unauthorized":
 		// Return a 401 Unauthorized response
 		return events.APIGatewayCustomAuthorizerResponse{}, errors.New("Unauthorized")
@@ -66,7 +188,8 @@ func requestAuthorizer(
 	event events.APIGatewayCustomAuthorizerRequestTypeRequest,
 ) (events.APIGatewayCustomAuthorizerResponse, error) {
 	token := event.Headers["authorization-token"]
-	project := event.PathParameters["ProjectId"]
+	// Tokens are matched against the same normalized ProjectId the endpoints use.
+	project := utils.NormalizeProjectId(event.PathParameters["ProjectId"])
 
 	return validateToken(token, project, &event)
 }
@@ -0,0 +1,358 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+
+	"telemetry/constants"
+)
+
+func TestValidateToken(t *testing.T) {
+	tests := []struct {
+		name          string
+		env           map[string]string
+		token         string
+		project       string
+		index         string
+		wantErr       bool
+		wantEffect    string
+		wantProject   interface{}
+		wantPrivilege interface{}
+		wantTenant    interface{}
+	}{
+		{
+			name:          "project token",
+			token:         constants.SENSORS_TOKEN,
+			project:       "sensors",
+			wantEffect:    "Allow",
+			wantProject:   "sensors",
+			wantPrivilege: "full",
+		},
+		{
+			name:    "another project's token",
+			token:   constants.DOGS_TOKEN,
+			project: "sensors",
+			wantErr: true,
+		},
+		{
+			name:          "rotated token",
+			env:           map[string]string{"PROJECT_TOKENS_sensors": "old, new"},
+			token:         "new",
+			project:       "sensors",
+			wantEffect:    "Allow",
+			wantProject:   "sensors",
+			wantPrivilege: "full",
+		},
+		{
+			name:          "mixed-case project's rotated token",
+			env:           map[string]string{"NORMALIZE_PROJECT_ID": "true", "PROJECT_TOKENS_Sensors": "new"},
+			token:         "new",
+			project:       "sensors",
+			wantEffect:    "Allow",
+			wantProject:   "sensors",
+			wantPrivilege: "full",
+		},
+		{
+			name:          "mixed-case project's restricted token",
+			env:           map[string]string{"NORMALIZE_PROJECT_ID": "true", "RESTRICTED_TOKENS_Sensors": "partner"},
+			token:         "partner",
+			project:       "sensors",
+			wantEffect:    "Allow",
+			wantProject:   "sensors",
+			wantPrivilege: "restricted",
+		},
+		{
+			name:    "token replaced by rotation",
+			env:     map[string]string{"PROJECT_TOKENS_sensors": "new"},
+			token:   constants.SENSORS_TOKEN,
+			project: "sensors",
+			wantErr: true,
+		},
+		{
+			name:          "restricted token",
+			env:           map[string]string{"RESTRICTED_TOKENS_sensors": "partner"},
+			token:         "partner",
+			project:       "sensors",
+			wantEffect:    "Allow",
+			wantProject:   "sensors",
+			wantPrivilege: "restricted",
+		},
+		{
+			name:          "admin token",
+			env:           map[string]string{"ADMIN_TOKEN": "root"},
+			token:         "root",
+			project:       "sensors",
+			wantEffect:    "Allow",
+			wantProject:   "*",
+			wantPrivilege: "full",
+		},
+		{
+			name:          "admin token on a tenant's project",
+			env:           map[string]string{"ADMIN_TOKEN": "root", "PROJECT_TENANTS": `{"sensors": "acme"}`},
+			token:         "root",
+			project:       "sensors",
+			wantEffect:    "Allow",
+			wantProject:   "*",
+			wantPrivilege: "full",
+			wantTenant:    "acme",
+		},
+		{
+			name:          "admin token without a project",
+			env:           map[string]string{"ADMIN_TOKEN": "root", "PROJECT_TENANTS": `{"sensors": "acme"}`},
+			token:         "root",
+			wantEffect:    "Allow",
+			wantProject:   "*",
+			wantPrivilege: "full",
+		},
+		{
+			name:    "empty token without an admin token",
+			token:   "",
+			project: "sensors",
+			wantErr: true,
+		},
+		{
+			name:          "index with the admin token",
+			env:           map[string]string{"ADMIN_TOKEN": "root"},
+			token:         "root",
+			project:       "sensors",
+			index:         "x",
+			wantEffect:    "Allow",
+			wantProject:   "*",
+			wantPrivilege: "full",
+		},
+		{
+			name:       "index with a project token",
+			token:      constants.SENSORS_TOKEN,
+			project:    "sensors",
+			index:      "x",
+			wantEffect: "Deny",
+		},
+		{
+			name:          "dev token locally",
+			env:           map[string]string{"DEV_MODE": "true", "DEV_TOKEN": "dev"},
+			token:         "dev",
+			project:       "sensors",
+			wantEffect:    "Allow",
+			wantProject:   "sensors",
+			wantPrivilege: "full",
+		},
+		{
+			name: "dev token in a deployed function",
+			env: map[string]string{
+				"DEV_MODE":                 "true",
+				"DEV_TOKEN":                "dev",
+				"AWS_LAMBDA_FUNCTION_NAME": "requestauth",
+			},
+			token:   "dev",
+			project: "sensors",
+			wantErr: true,
+		},
+		{
+			name:       "deny",
+			token:      "deny",
+			project:    "sensors",
+			wantEffect: "Deny",
+		},
+		{
+			name:    "unauthorized",
+			token:   "unauthorized",
+			project: "sensors",
+			wantErr: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			for name, value := range test.env {
+				t.Setenv(name, value)
+			}
+			event := events.APIGatewayCustomAuthorizerRequestTypeRequest{
+				MethodArn:             "arn:aws:execute-api:us-east-1:0:api/GET/sensors",
+				QueryStringParameters: map[string]string{"index": test.index},
+			}
+
+			response, err := validateToken(test.token, test.project, &event)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("validateToken() error = %v, wantErr %v", err, test.wantErr)
+			}
+			if test.wantErr {
+				return
+			}
+			if effect := response.PolicyDocument.Statement[0].Effect; effect != test.wantEffect {
+				t.Errorf("effect = %q, want %q", effect, test.wantEffect)
+			}
+			if project := response.Context["projectId"]; project != test.wantProject {
+				t.Errorf("projectId = %v, want %v", project, test.wantProject)
+			}
+			if privilege := response.Context["privilege"]; privilege != test.wantPrivilege {
+				t.Errorf("privilege = %v, want %v", privilege, test.wantPrivilege)
+			}
+			if tenant := response.Context["tenantId"]; tenant != test.wantTenant {
+				t.Errorf("tenantId = %v, want %v", tenant, test.wantTenant)
+			}
+		})
+	}
+}
+
+func TestProjectTokens(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		project string
+		want    []string
+	}{
+		{name: "default", project: "sensors", want: []string{constants.SENSORS_TOKEN}},
+		{name: "unknown project", project: "cats"},
+		{
+			name:    "rotation",
+			env:     map[string]string{"PROJECT_TOKENS_sensors": " old ,, new "},
+			project: "sensors",
+			want:    []string{"old", "new"},
+		},
+		{
+			name:    "every token revoked",
+			env:     map[string]string{"PROJECT_TOKENS_sensors": ""},
+			project: "sensors",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			for name, value := range test.env {
+				t.Setenv(name, value)
+			}
+			if got := projectTokens(test.project); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("projectTokens() = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestGeneratePolicy(t *testing.T) {
+	tests := []struct {
+		name        string
+		effect      string
+		project     string
+		wantContext bool
+		wantTenant  interface{}
+	}{
+		{name: "project", effect: "Allow", project: "sensors", wantContext: true},
+		{name: "tenant's project", effect: "Allow", project: "dogs", wantContext: true, wantTenant: "acme"},
+		{name: "admin", effect: "Allow", project: "*", wantContext: true},
+		{name: "denied", effect: "Deny"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Setenv("PROJECT_TENANTS", `{"dogs": "acme"}`)
+			response := generatePolicy("user", test.effect, "arn", test.project, "")
+			if effect := response.PolicyDocument.Statement[0].Effect; effect != test.effect {
+				t.Errorf("effect = %q, want %q", effect, test.effect)
+			}
+			project, ok := response.Context["projectId"]
+			if ok != test.wantContext || (ok && project != test.project) {
+				t.Errorf("projectId = %v, want %q in the context %v", project, test.project, test.wantContext)
+			}
+			if tenant := response.Context["tenantId"]; tenant != test.wantTenant {
+				t.Errorf("tenantId = %v, want %v", tenant, test.wantTenant)
+			}
+		})
+	}
+}
+
+func TestIsAdminToken(t *testing.T) {
+	tests := []struct {
+		name  string
+		admin string
+		token string
+		want  bool
+	}{
+		{name: "admin token", admin: "root", token: "root", want: true},
+		{name: "other token", admin: "root", token: "rooted"},
+		{name: "no admin token", token: ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Setenv("ADMIN_TOKEN", test.admin)
+			if got := isAdminToken(test.token); got != test.want {
+				t.Errorf("isAdminToken() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestIsDevToken(t *testing.T) {
+	tests := []struct {
+		name  string
+		env   map[string]string
+		token string
+		want  bool
+	}{
+		{name: "locally", env: map[string]string{"DEV_MODE": "true", "DEV_TOKEN": "dev"}, token: "dev", want: true},
+		{name: "other token", env: map[string]string{"DEV_MODE": "true", "DEV_TOKEN": "dev"}, token: "devs"},
+		{name: "no dev token", env: map[string]string{"DEV_MODE": "true"}, token: ""},
+		{name: "without dev mode", env: map[string]string{"DEV_TOKEN": "dev"}, token: "dev"},
+		{name: "dev mode off", env: map[string]string{"DEV_MODE": "false", "DEV_TOKEN": "dev"}, token: "dev"},
+		{
+			name: "deployed",
+			env: map[string]string{
+				"DEV_MODE":                 "true",
+				"DEV_TOKEN":                "dev",
+				"AWS_LAMBDA_FUNCTION_NAME": "requestauth",
+			},
+			token: "dev",
+		},
+		{
+			name: "under sam local",
+			env: map[string]string{
+				"DEV_MODE":                 "true",
+				"DEV_TOKEN":                "dev",
+				"AWS_LAMBDA_FUNCTION_NAME": "requestauth",
+				"AWS_SAM_LOCAL":            "true",
+			},
+			token: "dev",
+			want:  true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			for name, value := range test.env {
+				t.Setenv(name, value)
+			}
+			if got := isDevToken(test.token); got != test.want {
+				t.Errorf("isDevToken() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestRequestAuthorizer(t *testing.T) {
+	tests := []struct {
+		name      string
+		normalize string
+		project   string
+		wantErr   bool
+	}{
+		{name: "project", project: "sensors"},
+		{name: "mixed case project", project: "Sensors", wantErr: true},
+		{name: "normalized mixed case project", normalize: "true", project: "Sensors"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Setenv("NORMALIZE_PROJECT_ID", test.normalize)
+			event := events.APIGatewayCustomAuthorizerRequestTypeRequest{
+				MethodArn:      "arn:aws:execute-api:us-east-1:0:api/GET/sensors",
+				Headers:        map[string]string{"authorization-token": constants.SENSORS_TOKEN},
+				PathParameters: map[string]string{"ProjectId": test.project},
+			}
+
+			response, err := requestAuthorizer(context.Background(), event)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("requestAuthorizer() error = %v, wantErr %v", err, test.wantErr)
+			}
+			if !test.wantErr && response.Context["projectId"] != "sensors" {
+				t.Errorf("projectId = %v, want sensors", response.Context["projectId"])
+			}
+		})
+	}
+}
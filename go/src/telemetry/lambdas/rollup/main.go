@@ -0,0 +1,36 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+
+	"telemetry/utils"
+)
+
+// rollupHandler is an AWS Lambda function that consumes the table's DynamoDB stream.
+// Each newly inserted reading is added to the hourly rollup of its device, which holds the count,
+// sum, min, and max of each measurement, so that dashboards don't aggregate on read.
+// Modified and removed readings are ignored: readings are only overwritten by retried writes
+// of the same data, and they are only removed when archived, after which the rollups should remain.
+func rollupHandler(ctx context.Context, event events.DynamoDBEvent) error {
+	client := utils.Client()
+	for _, record := range event.Records {
+		if record.EventName != string(events.DynamoDBOperationTypeInsert) {
+			continue
+		}
+		item := utils.StreamImageToAttributeValues(record.Change.NewImage)
+
+		// Returning an error has the batch redelivered, which the rollup updates tolerate.
+		if err := utils.ApplyRollup(ctx, client, item); err != nil {
+			return fmt.Errorf("failed to roll up record %s, %v", record.EventID, err)
+		}
+	}
+	return nil
+}
+
+func main() {
+	lambda.Start(rollupHandler)
+}
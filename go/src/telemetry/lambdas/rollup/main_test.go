@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+
+	"telemetry/utils"
+	"telemetry/utils/dynamotest"
+)
+
+// readingRecord returns a stream record of a change to a reading with a Temperature measurement.
+func readingRecord(eventName events.DynamoDBOperationType) events.DynamoDBEventRecord {
+	return events.DynamoDBEventRecord{
+		EventID:   "1",
+		EventName: string(eventName),
+		Change: events.DynamoDBStreamRecord{
+			NewImage: map[string]events.DynamoDBAttributeValue{
+				"ProjectId#DeviceId": events.NewStringAttribute("sensors#d1"),
+				"ProjectId":          events.NewStringAttribute("sensors"),
+				"DeviceId":           events.NewStringAttribute("d1"),
+				"EpochTime":          events.NewNumberAttribute("1600000000"),
+				"Temperature":        events.NewNumberAttribute("21.5"),
+			},
+		},
+	}
+}
+
+func TestRollupHandler(t *testing.T) {
+	tests := []struct {
+		name        string
+		records     []events.DynamoDBEventRecord
+		setup       func(server *dynamotest.Server)
+		wantErr     bool
+		wantUpdates int
+	}{
+		{
+			name:        "inserted reading rolled up",
+			records:     []events.DynamoDBEventRecord{readingRecord(events.DynamoDBOperationTypeInsert)},
+			wantUpdates: 3,
+		},
+		{
+			name: "modified and removed readings ignored",
+			records: []events.DynamoDBEventRecord{
+				readingRecord(events.DynamoDBOperationTypeModify),
+				readingRecord(events.DynamoDBOperationTypeRemove),
+			},
+		},
+		{
+			name:        "failed update redelivers the batch",
+			records:     []events.DynamoDBEventRecord{readingRecord(events.DynamoDBOperationTypeInsert)},
+			setup:       func(server *dynamotest.Server) { server.Fail("UpdateItem", "InternalServerError") },
+			wantErr:     true,
+			wantUpdates: 1,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := dynamotest.NewServer(t)
+			utils.SetClient(server.Client())
+			if test.setup != nil {
+				test.setup(server)
+			}
+
+			err := rollupHandler(context.Background(), events.DynamoDBEvent{Records: test.records})
+			if (err != nil) != test.wantErr {
+				t.Fatalf("rollupHandler() error = %v, wantErr %v", err, test.wantErr)
+			}
+			if updates := server.Calls("UpdateItem"); len(updates) != test.wantUpdates {
+				t.Errorf("made %d updates, want %d", len(updates), test.wantUpdates)
+			}
+		})
+	}
+}
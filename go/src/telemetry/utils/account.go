@@ -0,0 +1,91 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	awsv2 "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+)
+
+// AccountRole is the role assumed to read another account's telemetry table, and its region.
+type AccountRole struct {
+	RoleArn string `json:"roleArn"`
+	Region  string `json:"region"`
+}
+
+// AccountRoles maps the names of member accounts to the roles used to read their tables,
+// from the ACCOUNT_ROLES environment variable, a JSON object like
+// {"west":{"roleArn":"arn:aws:iam::123456789012:role/TelemetryReader","region":"us-west-2"}}.
+func AccountRoles() map[string]AccountRole {
+	roles := make(map[string]AccountRole)
+	envJSON("ACCOUNT_ROLES", &roles)
+	return roles
+}
+
+// ErrUnknownAccount is returned for an account missing from AccountRoles.
+var ErrUnknownAccount = errors.New("account is not configured")
+
+var (
+	accountClients      = make(map[string]*dynamodb.Client)
+	accountClientsMutex sync.Mutex
+)
+
+// AccountClient returns a client for the named member account, shared across invocations
+// like Client. An empty account returns the default client.
+func AccountClient(ctx context.Context, account string) (*dynamodb.Client, error) {
+	if account == "" {
+		return Client(), nil
+	}
+	role, ok := AccountRoles()[account]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownAccount, account)
+	}
+
+	accountClientsMutex.Lock()
+	defer accountClientsMutex.Unlock()
+	if client, ok := accountClients[account]; ok {
+		return client, nil
+	}
+	client, err := InitClientForAccount(ctx, role.RoleArn, role.Region)
+	if err != nil {
+		return nil, err
+	}
+	accountClients[account] = client
+	return client, nil
+}
+
+// InitClientForAccount returns a client scoped to another account, whose credentials come from
+// assuming the role through STS and are refreshed as they expire. An empty region keeps the
+// default configuration's region.
+func InitClientForAccount(ctx context.Context, roleArn string, region string) (*dynamodb.Client, error) {
+	cfg, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load configuration, %v", err)
+	}
+	return dynamodb.NewFromConfig(accountConfig(cfg, sts.NewFromConfig(cfg), roleArn, region)), nil
+}
+
+// accountConfig scopes a base configuration to another account,
+// assuming the role with the given STS client.
+func accountConfig(
+	cfg awsv2.Config,
+	stsClient stscreds.AssumeRoleAPIClient,
+	roleArn string,
+	region string,
+) awsv2.Config {
+	if region != "" {
+		cfg.Region = region
+	}
+	cfg.Credentials = awsv2.NewCredentialsCache(
+		stscreds.NewAssumeRoleProvider(stsClient, roleArn, func(options *stscreds.AssumeRoleOptions) {
+			options.RoleSessionName = "telemetry-cross-account"
+		}),
+	)
+	return cfg
+}
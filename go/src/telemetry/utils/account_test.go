@@ -0,0 +1,125 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	awsv2 "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	ststypes "github.com/aws/aws-sdk-go-v2/service/sts/types"
+)
+
+// fakeSTS answers AssumeRole with fixed credentials, recording the roles assumed.
+type fakeSTS struct {
+	inputs []*sts.AssumeRoleInput
+}
+
+func (f *fakeSTS) AssumeRole(
+	ctx context.Context,
+	input *sts.AssumeRoleInput,
+	optFns ...func(*sts.Options),
+) (*sts.AssumeRoleOutput, error) {
+	f.inputs = append(f.inputs, input)
+	return &sts.AssumeRoleOutput{Credentials: &ststypes.Credentials{
+		AccessKeyId:     awsv2.String("AKID"),
+		SecretAccessKey: awsv2.String("secret"),
+		SessionToken:    awsv2.String("token"),
+		Expiration:      awsv2.Time(time.Now().Add(time.Hour)),
+	}}, nil
+}
+
+func TestAccountRoles(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  map[string]AccountRole
+	}{
+		{name: "unset", want: map[string]AccountRole{}},
+		{
+			name:  "roles",
+			value: `{"west": {"roleArn": "arn:aws:iam::123456789012:role/TelemetryReader", "region": "us-west-2"}}`,
+			want: map[string]AccountRole{
+				"west": {RoleArn: "arn:aws:iam::123456789012:role/TelemetryReader", Region: "us-west-2"},
+			},
+		},
+		{name: "invalid", value: `["west"]`, want: map[string]AccountRole{}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Setenv("ACCOUNT_ROLES", test.value)
+			if got := AccountRoles(); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("AccountRoles() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestAccountClient(t *testing.T) {
+	previous := sharedClient
+	t.Cleanup(func() { sharedClient = previous })
+	shared := dynamodb.New(dynamodb.Options{Region: "us-east-1"})
+	SetClient(shared)
+	west := dynamodb.New(dynamodb.Options{Region: "us-west-2"})
+	accountClients["west"] = west
+	t.Cleanup(func() { delete(accountClients, "west") })
+	t.Setenv("ACCOUNT_ROLES", `{"west": {"roleArn": "arn:aws:iam::123456789012:role/TelemetryReader"}}`)
+
+	tests := []struct {
+		name    string
+		account string
+		want    *dynamodb.Client
+		wantErr error
+	}{
+		{name: "this account", want: shared},
+		{name: "member account", account: "west", want: west},
+		{name: "unknown account", account: "east", wantErr: ErrUnknownAccount},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := AccountClient(context.Background(), test.account)
+			if !errors.Is(err, test.wantErr) {
+				t.Fatalf("AccountClient() error = %v, want %v", err, test.wantErr)
+			}
+			if got != test.want {
+				t.Errorf("AccountClient() = %p, want %p", got, test.want)
+			}
+		})
+	}
+}
+
+func TestAccountConfig(t *testing.T) {
+	const roleArn = "arn:aws:iam::123456789012:role/TelemetryReader"
+	tests := []struct {
+		name       string
+		region     string
+		wantRegion string
+	}{
+		{name: "default region", wantRegion: "us-east-1"},
+		{name: "member region", region: "us-west-2", wantRegion: "us-west-2"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			stsClient := &fakeSTS{}
+			cfg := accountConfig(awsv2.Config{Region: "us-east-1"}, stsClient, roleArn, test.region)
+			if cfg.Region != test.wantRegion {
+				t.Errorf("Region = %q, want %q", cfg.Region, test.wantRegion)
+			}
+
+			credentials, err := cfg.Credentials.Retrieve(context.Background())
+			if err != nil {
+				t.Fatalf("Retrieve() error = %v", err)
+			}
+			if credentials.AccessKeyID != "AKID" {
+				t.Errorf("AccessKeyID = %q, want the assumed role's", credentials.AccessKeyID)
+			}
+			if len(stsClient.inputs) != 1 || awsv2.ToString(stsClient.inputs[0].RoleArn) != roleArn ||
+				awsv2.ToString(stsClient.inputs[0].RoleSessionName) != "telemetry-cross-account" {
+				t.Errorf("AssumeRole() inputs = %v, want one of %s", stsClient.inputs, roleArn)
+			}
+		})
+	}
+}
@@ -0,0 +1,24 @@
+package utils
+
+import (
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// AgeField names the field AddAge adds to each item.
+const AgeField = "ageSeconds"
+
+// AddAge adds the number of seconds between each item's EpochTime and now to the item, in place,
+// so that clients can show how old a reading is without trusting their own clocks.
+// Items without an EpochTime are left as they are.
+func AddAge(items []map[string]types.AttributeValue, now time.Time) {
+	nowSeconds := float64(now.UnixNano()) / float64(time.Second)
+	for _, item := range items {
+		epoch, ok := NumberAttribute(item, "EpochTime")
+		if !ok {
+			continue
+		}
+		item[AgeField] = &types.AttributeValueMemberN{Value: formatNumber(nowSeconds - epoch)}
+	}
+}
@@ -0,0 +1,31 @@
+package utils
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+func TestAddAge(t *testing.T) {
+	now := testNow.Add(500 * time.Millisecond)
+	tests := []struct {
+		name string
+		item map[string]types.AttributeValue
+		want types.AttributeValue
+	}{
+		{name: "whole seconds", item: map[string]types.AttributeValue{"EpochTime": numberAttr("1599999940")}, want: numberAttr("60.5")},
+		{name: "fractional", item: map[string]types.AttributeValue{"EpochTime": numberAttr("1600000000.25")}, want: numberAttr("0.25")},
+		{name: "in the future", item: map[string]types.AttributeValue{"EpochTime": numberAttr("1600000010.5")}, want: numberAttr("-10")},
+		{name: "no EpochTime", item: map[string]types.AttributeValue{"DeviceId": stringAttr("d1")}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			AddAge([]map[string]types.AttributeValue{test.item}, now)
+			if got := test.item[AgeField]; !reflect.DeepEqual(got, test.want) {
+				t.Errorf("%s = %v, want %v", AgeField, got, test.want)
+			}
+		})
+	}
+}
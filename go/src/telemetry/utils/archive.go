@@ -0,0 +1,134 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"sort"
+	"telemetry/constants"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go/aws"
+)
+
+type S3PutObjectAPI interface {
+	PutObject(
+		ctx context.Context,
+		params *s3.PutObjectInput,
+		optFns ...func(*s3.Options),
+	) (*s3.PutObjectOutput, error)
+}
+
+// GroupByDate partitions items by the UTC date of their sort key, the EpochTime by default,
+// formatted as YYYY-MM-DD. Items without one are left out.
+func GroupByDate(items []map[string]types.AttributeValue) map[string][]map[string]types.AttributeValue {
+	groups := make(map[string][]map[string]types.AttributeValue)
+	for _, item := range items {
+		epochTime, ok := NumberAttribute(item, SortKeyAttribute())
+		if !ok {
+			continue
+		}
+		date := time.Unix(int64(epochTime), 0).UTC().Format("2006-01-02")
+		groups[date] = append(groups[date], item)
+	}
+	return groups
+}
+
+// SortedDates returns the dates of the groups in ascending order.
+func SortedDates(groups map[string][]map[string]types.AttributeValue) []string {
+	dates := make([]string, 0, len(groups))
+	for date := range groups {
+		dates = append(dates, date)
+	}
+	sort.Strings(dates)
+	return dates
+}
+
+// ArchiveKey returns the S3 key an archive of a project's readings from one date, in one page
+// of a run, is written to, partitioned as <prefix>/ProjectId=<project>/date=<date>/<run>-<page>.ndjson
+// so that the archives can be queried in place by date.
+func ArchiveKey(prefix string, project string, date string, run time.Time, page int) string {
+	return path.Join(
+		prefix,
+		fmt.Sprintf("ProjectId=%s", project),
+		fmt.Sprintf("date=%s", date),
+		fmt.Sprintf("%d-%d.ndjson", run.Unix(), page),
+	)
+}
+
+// DynamoDbArchiveAPI defines the functions needed to archive readings: querying them a page
+// at a time, deleting each archived page, and keeping the checkpoint of where archiving stopped.
+type DynamoDbArchiveAPI interface {
+	DynamoDbRangeDeleteAPI
+	DynamoDbGetItemAPI
+	DynamoDbPutItemAPI
+	DynamoDbDeleteItemAPI
+}
+
+// archiveCheckpointKey is the key of the item recording where archiving a project's readings
+// stopped. Checkpoints share the table under an 'archive#' partition key no reading can have.
+func archiveCheckpointKey(tenant string, project string) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{
+		"ProjectId#DeviceId": &types.AttributeValueMemberS{
+			Value: bookkeepingKey("archive", tenant, project, "checkpoint"),
+		},
+		SortKeyAttribute(): &types.AttributeValueMemberN{Value: "0"},
+	}
+}
+
+// LoadArchiveCheckpoint returns the key archiving a project's readings should resume after,
+// or nil to start from its oldest reading.
+func LoadArchiveCheckpoint(
+	ctx context.Context,
+	api DynamoDbArchiveAPI,
+	tenant string,
+	project string,
+) (map[string]types.AttributeValue, error) {
+	output, err := api.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName:      aws.String(constants.TABLE_NAME),
+		Key:            archiveCheckpointKey(tenant, project),
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return nil, err
+	}
+	cursor, ok := StringAttribute(output.Item, "Cursor")
+	if !ok {
+		return nil, nil
+	}
+	lastKey, _, err := DecodeCursor(cursor)
+	return lastKey, err
+}
+
+// SaveArchiveCheckpoint records the key archiving a project's readings has reached,
+// once every reading up to it is archived and deleted. A nil key means archiving finished,
+// and clears the checkpoint.
+func SaveArchiveCheckpoint(
+	ctx context.Context,
+	api DynamoDbArchiveAPI,
+	tenant string,
+	project string,
+	lastKey map[string]types.AttributeValue,
+) error {
+	key := archiveCheckpointKey(tenant, project)
+	if lastKey == nil {
+		_, err := api.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+			TableName: aws.String(constants.TABLE_NAME),
+			Key:       key,
+		})
+		return err
+	}
+	cursor, err := EncodeCursor(lastKey, 0)
+	if err != nil {
+		return err
+	}
+	key["Cursor"] = &types.AttributeValueMemberS{Value: cursor}
+	_, err = api.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(constants.TABLE_NAME),
+		Item:      key,
+	})
+	return err
+}
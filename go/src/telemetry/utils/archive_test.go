@@ -0,0 +1,93 @@
+package utils
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+
+	"telemetry/utils/dynamotest"
+)
+
+func TestGroupByDate(t *testing.T) {
+	// 1600000000 is 2020-09-13T12:26:40Z.
+	items := append(readingsAt("1600000000", "1600041599", "1600041600", "1599955199"),
+		map[string]types.AttributeValue{"DeviceId": stringAttr("d1")},
+	)
+	groups := GroupByDate(items)
+	want := map[string][]string{
+		"2020-09-13": {"1600000000", "1600041599"},
+		"2020-09-14": {"1600041600"},
+		"2020-09-12": {"1599955199"},
+	}
+	got := make(map[string][]string, len(groups))
+	for date, group := range groups {
+		got[date] = epochTimes(group)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("GroupByDate() = %v, want %v", got, want)
+	}
+	if dates := SortedDates(groups); !reflect.DeepEqual(dates, []string{"2020-09-12", "2020-09-13", "2020-09-14"}) {
+		t.Errorf("SortedDates() = %v, want them in ascending order", dates)
+	}
+}
+
+func TestArchiveKey(t *testing.T) {
+	tests := []struct {
+		name   string
+		prefix string
+		want   string
+	}{
+		{name: "prefixed", prefix: "archive", want: "archive/ProjectId=sensors/date=2020-09-13/1600000000-2.ndjson"},
+		{name: "no prefix", want: "ProjectId=sensors/date=2020-09-13/1600000000-2.ndjson"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := ArchiveKey(test.prefix, "sensors", "2020-09-13", testNow, 2); got != test.want {
+				t.Errorf("ArchiveKey() = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestArchiveCheckpoint(t *testing.T) {
+	lastKey := map[string]types.AttributeValue{
+		"ProjectId#DeviceId": stringAttr("sensors#d1"),
+		"EpochTime":          numberAttr("1600000000"),
+	}
+	server := dynamotest.NewServer(t)
+	ctx := context.Background()
+
+	if err := SaveArchiveCheckpoint(ctx, server.Client(), "", "sensors", lastKey); err != nil {
+		t.Fatalf("SaveArchiveCheckpoint() error = %v", err)
+	}
+	puts := server.Calls("PutItem")
+	if len(puts) != 1 || partitionKeyOf(puts[0], "Item") != "archive#sensors#checkpoint" {
+		t.Fatalf("puts = %v, want the project's checkpoint", puts)
+	}
+
+	// The checkpoint is read back as it was written.
+	item, _ := puts[0].Input["Item"].(map[string]interface{})
+	cursor, _ := item["Cursor"].(map[string]interface{})
+	server.Respond("GetItem", `{"Item": {"Cursor": {"S": "`+cursor["S"].(string)+`"}}}`)
+	loaded, err := LoadArchiveCheckpoint(ctx, server.Client(), "", "sensors")
+	if err != nil {
+		t.Fatalf("LoadArchiveCheckpoint() error = %v", err)
+	}
+	if !reflect.DeepEqual(loaded, lastKey) {
+		t.Errorf("LoadArchiveCheckpoint() = %v, want %v", loaded, lastKey)
+	}
+
+	// Finishing clears the checkpoint, so the next run starts from the oldest reading.
+	if err := SaveArchiveCheckpoint(ctx, server.Client(), "", "sensors", nil); err != nil {
+		t.Fatalf("SaveArchiveCheckpoint() error = %v", err)
+	}
+	if deletes := server.Calls("DeleteItem"); len(deletes) != 1 {
+		t.Errorf("made %d deletes, want 1", len(deletes))
+	}
+	loaded, err = LoadArchiveCheckpoint(ctx, server.Client(), "", "sensors")
+	if err != nil || loaded != nil {
+		t.Errorf("LoadArchiveCheckpoint() = %v, %v, want no checkpoint", loaded, err)
+	}
+}
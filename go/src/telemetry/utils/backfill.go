@@ -0,0 +1,95 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/smithy-go"
+)
+
+// DynamoDbScanAPI defines interface for Scan function.
+type DynamoDbScanAPI interface {
+	Scan(
+		ctx context.Context,
+		params *dynamodb.ScanInput,
+		optFns ...func(*dynamodb.Options),
+	) (*dynamodb.ScanOutput, error)
+}
+
+// IsIndexBackfilling reports whether a query failed because its global secondary index
+// is still being backfilled, as it is for a while after the index is added to the table.
+func IsIndexBackfilling(err error) bool {
+	var apiErr smithy.APIError
+	return errors.As(err, &apiErr) && apiErr.ErrorCode() == "ValidationException" &&
+		strings.Contains(strings.ToLower(apiErr.ErrorMessage()), "backfilling")
+}
+
+// IndexBackfillFallback reports whether queries on a backfilling index are answered by scanning
+// the base table instead, when the INDEX_BACKFILL_FALLBACK environment variable is truthy.
+// Scans read the whole table, so this is only meant for small tables, or brief deployments.
+func IndexBackfillFallback() bool {
+	enabled, _ := ParseBoolParam(os.Getenv("INDEX_BACKFILL_FALLBACK"))
+	return enabled
+}
+
+// BackfillFallbackScan decides whether a query that failed with err can be answered by scanning
+// the base table instead, which it can when the failure was a backfilling index, the fallback is
+// enabled, and the client can scan. It returns the scan to run, filtered by the query's conditions.
+func BackfillFallbackScan(
+	api DynamoDbQueryAPI,
+	input *dynamodb.QueryInput,
+	err error,
+) (DynamoDbScanAPI, *dynamodb.ScanInput, bool) {
+	if !IsIndexBackfilling(err) || !IndexBackfillFallback() {
+		return nil, nil, false
+	}
+	scanner, ok := api.(DynamoDbScanAPI)
+	if !ok {
+		return nil, nil, false
+	}
+
+	// A key condition is also a valid filter, which keeps the same items the query would have.
+	filter := *input.KeyConditionExpression
+	if input.FilterExpression != nil && *input.FilterExpression != "" {
+		filter = fmt.Sprintf("(%s) AND (%s)", filter, *input.FilterExpression)
+	}
+	return scanner, &dynamodb.ScanInput{
+		TableName:                 input.TableName,
+		FilterExpression:          &filter,
+		ExpressionAttributeNames:  input.ExpressionAttributeNames,
+		ExpressionAttributeValues: input.ExpressionAttributeValues,
+		ReturnConsumedCapacity:    input.ReturnConsumedCapacity,
+	}, true
+}
+
+// ScanAll runs a scan, following its pagination until the whole table has been read,
+// and returns the matching items in no particular order.
+func ScanAll(
+	ctx context.Context,
+	api DynamoDbScanAPI,
+	input *dynamodb.ScanInput,
+	stats *QueryStats,
+) ([]map[string]types.AttributeValue, error) {
+	var items []map[string]types.AttributeValue
+	for {
+		output, err := api.Scan(ctx, input)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan table, %w", err)
+		}
+		items = append(items, output.Items...)
+		stats.Pages++
+		stats.ScannedCount += int(output.ScannedCount)
+		if output.ConsumedCapacity != nil && output.ConsumedCapacity.CapacityUnits != nil {
+			stats.ConsumedCapacity += *output.ConsumedCapacity.CapacityUnits
+		}
+		if output.LastEvaluatedKey == nil {
+			return items, nil
+		}
+		input.ExclusiveStartKey = output.LastEvaluatedKey
+	}
+}
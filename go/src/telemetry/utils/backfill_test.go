@@ -0,0 +1,165 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/smithy-go"
+
+	"telemetry/constants"
+	"telemetry/utils/dynamotest"
+)
+
+// backfillingMessage is the error DynamoDB answers queries on a backfilling index with.
+const backfillingMessage = "Cannot read from backfilling global secondary index: ProjectId-EpochTime-index"
+
+// queryOnly is a client that can query but not scan.
+type queryOnly struct {
+	DynamoDbQueryAPI
+}
+
+func TestIsIndexBackfilling(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "no error"},
+		{name: "backfilling", err: &smithy.GenericAPIError{Code: "ValidationException", Message: backfillingMessage}, want: true},
+		{name: "other validation error", err: &smithy.GenericAPIError{Code: "ValidationException", Message: "bad key"}},
+		{name: "other error", err: errors.New("backfilling")},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := IsIndexBackfilling(test.err); got != test.want {
+				t.Errorf("IsIndexBackfilling() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestBackfillFallbackScan(t *testing.T) {
+	backfilling := &smithy.GenericAPIError{Code: "ValidationException", Message: backfillingMessage}
+	server := dynamotest.NewServer(t)
+	tests := []struct {
+		name       string
+		fallback   string
+		api        DynamoDbQueryAPI
+		err        error
+		filter     string
+		wantOk     bool
+		wantFilter string
+	}{
+		{
+			name:       "key condition as the filter",
+			fallback:   "true",
+			api:        server.Client(),
+			err:        backfilling,
+			wantOk:     true,
+			wantFilter: "#primaryName = :primaryValue",
+		},
+		{
+			name:       "with the query's filter",
+			fallback:   "true",
+			api:        server.Client(),
+			err:        backfilling,
+			filter:     "attribute_exists(Temperature)",
+			wantOk:     true,
+			wantFilter: "(#primaryName = :primaryValue) AND (attribute_exists(Temperature))",
+		},
+		{name: "fallback disabled", api: server.Client(), err: backfilling},
+		{name: "client can't scan", fallback: "true", api: queryOnly{server.Client()}, err: backfilling},
+		{name: "other error", fallback: "true", api: server.Client(), err: errors.New("failed")},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Setenv("INDEX_BACKFILL_FALLBACK", test.fallback)
+			input := CreateIndexQueryInput(constants.PROJECT_INDEX, "ProjectId", "sensors")
+			input.KeyConditionExpression = aws.String("#primaryName = :primaryValue")
+			if test.filter != "" {
+				input.FilterExpression = aws.String(test.filter)
+			}
+
+			_, scan, ok := BackfillFallbackScan(test.api, input, test.err)
+			if ok != test.wantOk {
+				t.Fatalf("BackfillFallbackScan() ok = %v, want %v", ok, test.wantOk)
+			}
+			if !ok {
+				return
+			}
+			if filter := aws.ToString(scan.FilterExpression); filter != test.wantFilter {
+				t.Errorf("FilterExpression = %q, want %q", filter, test.wantFilter)
+			}
+			if scan.IndexName != nil || !reflect.DeepEqual(scan.ExpressionAttributeValues, input.ExpressionAttributeValues) {
+				t.Errorf("scan = %+v, want the base table scanned with the query's values", scan)
+			}
+		})
+	}
+}
+
+func TestScanAll(t *testing.T) {
+	server := dynamotest.NewServer(t)
+	server.Respond("Scan", `{"Count": 1, "ScannedCount": 10, "Items": [{"EpochTime": {"N": "2"}}],
+		"ConsumedCapacity": {"CapacityUnits": 2},
+		"LastEvaluatedKey": {"ProjectId#DeviceId": {"S": "sensors#d1"}, "EpochTime": {"N": "2"}}}`)
+	server.Respond("Scan", `{"Count": 1, "ScannedCount": 5, "Items": [{"EpochTime": {"N": "1"}}]}`)
+
+	var stats QueryStats
+	items, err := ScanAll(context.Background(), server.Client(), &dynamodb.ScanInput{TableName: aws.String("t")}, &stats)
+	if err != nil {
+		t.Fatalf("ScanAll() error = %v", err)
+	}
+	if got := epochTimes(items); !reflect.DeepEqual(got, []string{"2", "1"}) {
+		t.Errorf("ScanAll() = %v, want both pages", got)
+	}
+	if stats.Pages != 2 || stats.ScannedCount != 15 || stats.ConsumedCapacity != 2 {
+		t.Errorf("stats = %+v, want 2 pages, 15 scanned, 2 units", stats)
+	}
+	scans := server.Calls("Scan")
+	if len(scans) != 2 || scans[1].Input["ExclusiveStartKey"] == nil {
+		t.Errorf("scans = %v, want the second resumed from the first", scans)
+	}
+}
+
+func TestGetDataOfBackfillingIndex(t *testing.T) {
+	tests := []struct {
+		name      string
+		fallback  string
+		wantErr   bool
+		wantTimes []string
+	}{
+		{name: "error without the fallback", wantErr: true},
+		{name: "table scanned and ordered", fallback: "true", wantTimes: []string{"1", "2"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			captureMetrics(t)
+			t.Setenv("INDEX_BACKFILL_FALLBACK", test.fallback)
+			server := dynamotest.NewServer(t)
+			server.FailWithMessage("Query", "ValidationException", backfillingMessage)
+			server.Respond("Scan", `{"Count": 2, "Items": [{"EpochTime": {"N": "2"}}, {"EpochTime": {"N": "1"}}]}`)
+			input, err := BuildQueryInput(QueryParams{ProjectId: "sensors"})
+			if err != nil {
+				t.Fatalf("BuildQueryInput() error = %v", err)
+			}
+
+			items, _, err := GetDataWithStats(context.Background(), server.Client(), input, 0)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("GetDataWithStats() error = %v, wantErr %v", err, test.wantErr)
+			}
+			if test.wantErr {
+				if !IsIndexBackfilling(err) {
+					t.Errorf("GetDataWithStats() error = %v, want the backfilling index reported", err)
+				}
+				return
+			}
+			if got := epochTimes(items); !reflect.DeepEqual(got, test.wantTimes) {
+				t.Errorf("GetDataWithStats() = %v, want %v", got, test.wantTimes)
+			}
+		})
+	}
+}
@@ -0,0 +1,40 @@
+package utils
+
+import (
+	"encoding/json"
+	"log"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// BatchItemError describes why one item of a batch was not written.
+type BatchItemError struct {
+	Index  int    `json:"index"`
+	Reason string `json:"reason"`
+}
+
+// BatchWriteResult summarizes a batch write, which may have partially succeeded.
+type BatchWriteResult struct {
+	Written int              `json:"written"`
+	Errors  []BatchItemError `json:"errors"`
+}
+
+// BatchWriteResponse reports the outcome of a batch write.
+// The status is 200 if any item was written, and 400 if none were.
+func BatchWriteResponse(result BatchWriteResult) (events.APIGatewayProxyResponse, error) {
+	json, err := json.Marshal(result)
+	if err != nil {
+		log.Fatalf("Could not encode results")
+	}
+
+	statusCode := 200
+	if result.Written == 0 {
+		statusCode = 400
+	}
+
+	return events.APIGatewayProxyResponse{
+		Body:       string(json),
+		Headers:    BaseHeaders(),
+		StatusCode: statusCode,
+	}, nil
+}
@@ -0,0 +1,52 @@
+package utils
+
+import (
+	"testing"
+)
+
+func TestBatchWriteResponse(t *testing.T) {
+	tests := []struct {
+		name       string
+		result     BatchWriteResult
+		wantStatus int
+		wantBody   string
+	}{
+		{
+			name:       "all written",
+			result:     BatchWriteResult{Written: 2},
+			wantStatus: 200,
+			wantBody:   `{"written":2,"errors":null}`,
+		},
+		{
+			name: "partially written",
+			result: BatchWriteResult{
+				Written: 1,
+				Errors:  []BatchItemError{{Index: 1, Reason: "Missing DeviceId"}},
+			},
+			wantStatus: 200,
+			wantBody:   `{"written":1,"errors":[{"index":1,"reason":"Missing DeviceId"}]}`,
+		},
+		{
+			name: "none written",
+			result: BatchWriteResult{
+				Errors: []BatchItemError{{Index: 0, Reason: "Missing DeviceId"}},
+			},
+			wantStatus: 400,
+			wantBody:   `{"written":0,"errors":[{"index":0,"reason":"Missing DeviceId"}]}`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			response, err := BatchWriteResponse(test.result)
+			if err != nil {
+				t.Fatalf("BatchWriteResponse() error = %v", err)
+			}
+			if response.StatusCode != test.wantStatus {
+				t.Errorf("status = %d, want %d", response.StatusCode, test.wantStatus)
+			}
+			if response.Body != test.wantBody {
+				t.Errorf("body = %s, want %s", response.Body, test.wantBody)
+			}
+		})
+	}
+}
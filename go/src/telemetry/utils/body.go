@@ -0,0 +1,59 @@
+package utils
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// maxDecompressedBody caps a decompressed body, so a small, highly compressed payload
+// can't exhaust the function's memory.
+const maxDecompressedBody = 10 * 1024 * 1024
+
+// ErrBodyTooLarge is returned for a compressed body that decompresses past the limit.
+var ErrBodyTooLarge = errors.New("decompressed body is too large")
+
+// DecodeRequestBody returns the raw bytes of a request's body. Bodies that API Gateway
+// passed through as binary media are base64 decoded, and bodies sent with
+// 'Content-Encoding: gzip', as battery-constrained devices do to save radio time, are decompressed.
+func DecodeRequestBody(request *Request) ([]byte, error) {
+	body := []byte(request.Body)
+	if request.IsBase64Encoded {
+		decoded, err := base64.StdEncoding.DecodeString(request.Body)
+		if err != nil {
+			return nil, fmt.Errorf("Could not decode base64 body, %v", err)
+		}
+		body = decoded
+	}
+
+	encoding := strings.ToLower(strings.TrimSpace(request.Header("Content-Encoding")))
+	switch encoding {
+	case "", "identity":
+		return body, nil
+	case "gzip":
+		return gunzip(body)
+	default:
+		return nil, fmt.Errorf("Content-Encoding %q is not supported", encoding)
+	}
+}
+
+func gunzip(body []byte) ([]byte, error) {
+	reader, err := gzip.NewReader(bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("Could not decompress body, %v", err)
+	}
+	defer reader.Close()
+
+	decompressed, err := io.ReadAll(io.LimitReader(reader, maxDecompressedBody+1))
+	if err != nil {
+		return nil, fmt.Errorf("Could not decompress body, %v", err)
+	}
+	if len(decompressed) > maxDecompressedBody {
+		return nil, ErrBodyTooLarge
+	}
+	return decompressed, nil
+}
@@ -0,0 +1,96 @@
+package utils
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"errors"
+	"testing"
+)
+
+// gzipped compresses a body as a device sending 'Content-Encoding: gzip' would.
+func gzipped(t *testing.T, body []byte) []byte {
+	t.Helper()
+	var buffer bytes.Buffer
+	writer := gzip.NewWriter(&buffer)
+	if _, err := writer.Write(body); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	return buffer.Bytes()
+}
+
+func TestDecodeRequestBody(t *testing.T) {
+	const reading = `{"DeviceId": "d1", "EpochTime": 1600000000}`
+	compressed := gzipped(t, []byte(reading))
+	tooLarge := gzipped(t, make([]byte, maxDecompressedBody+1))
+	tests := []struct {
+		name    string
+		request Request
+		want    string
+		wantErr bool
+		errorIs error
+	}{
+		{name: "plain", request: Request{Body: reading}, want: reading},
+		{
+			name:    "identity",
+			request: Request{Body: reading, Headers: map[string]string{"Content-Encoding": "identity"}},
+			want:    reading,
+		},
+		{
+			name:    "base64",
+			request: Request{Body: base64.StdEncoding.EncodeToString([]byte(reading)), IsBase64Encoded: true},
+			want:    reading,
+		},
+		{
+			name: "gzip",
+			request: Request{
+				Body:            base64.StdEncoding.EncodeToString(compressed),
+				IsBase64Encoded: true,
+				Headers:         map[string]string{"Content-Encoding": " GZIP "},
+			},
+			want: reading,
+		},
+		{
+			name:    "malformed base64",
+			request: Request{Body: "!!!", IsBase64Encoded: true},
+			wantErr: true,
+		},
+		{
+			name:    "malformed gzip",
+			request: Request{Body: reading, Headers: map[string]string{"Content-Encoding": "gzip"}},
+			wantErr: true,
+		},
+		{
+			name:    "unsupported encoding",
+			request: Request{Body: reading, Headers: map[string]string{"Content-Encoding": "br"}},
+			wantErr: true,
+		},
+		{
+			name: "decompressed past the limit",
+			request: Request{
+				Body:            base64.StdEncoding.EncodeToString(tooLarge),
+				IsBase64Encoded: true,
+				Headers:         map[string]string{"Content-Encoding": "gzip"},
+			},
+			wantErr: true,
+			errorIs: ErrBodyTooLarge,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := DecodeRequestBody(&test.request)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("DecodeRequestBody() error = %v, wantErr %v", err, test.wantErr)
+			}
+			if test.errorIs != nil && !errors.Is(err, test.errorIs) {
+				t.Errorf("DecodeRequestBody() error = %v, want %v", err, test.errorIs)
+			}
+			if string(got) != test.want {
+				t.Errorf("DecodeRequestBody() = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
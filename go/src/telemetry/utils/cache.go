@@ -0,0 +1,24 @@
+package utils
+
+import (
+	"fmt"
+	"time"
+)
+
+// CacheHeadersFor decides whether a query's results can be cached.
+// A query bounded on both sides, whose end is at least CACHE_SETTLE_SECONDS (5 minutes
+// by default) in the past, reads history that rarely changes, so the client may cache it
+// for CACHE_MAX_AGE_SECONDS (5 minutes by default). History can still be changed by
+// a PATCH or a delete, which is why the default is short. Results are only ever cached
+// privately, since what a request may read depends on its token.
+// Open-ended and recent queries are never cached.
+func CacheHeadersFor(params QueryParams) map[string]string {
+	settle := envInt("CACHE_SETTLE_SECONDS", 5*60)
+	maxAge := envInt("CACHE_MAX_AGE_SECONDS", 5*60)
+
+	settled := float64(Now().Add(-time.Duration(settle) * time.Second).Unix())
+	if params.Start == nil || params.End == nil || *params.End > settled || maxAge <= 0 {
+		return map[string]string{"Cache-Control": "no-cache"}
+	}
+	return map[string]string{"Cache-Control": fmt.Sprintf("private, max-age=%d", maxAge)}
+}
@@ -0,0 +1,45 @@
+package utils
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCacheHeadersFor(t *testing.T) {
+	// The clock is stopped at 1600000000, so history settles before 1599999700.
+	tests := []struct {
+		name   string
+		env    map[string]string
+		params QueryParams
+		want   string
+	}{
+		{name: "open-ended", params: QueryParams{Start: float(1)}, want: "no-cache"},
+		{name: "unbounded below", params: QueryParams{End: float(2)}, want: "no-cache"},
+		{name: "settled history", params: QueryParams{Start: float(1), End: float(1599999700)}, want: "private, max-age=300"},
+		{name: "recent", params: QueryParams{Start: float(1), End: float(1599999701)}, want: "no-cache"},
+		{
+			name:   "configured",
+			env:    map[string]string{"CACHE_SETTLE_SECONDS": "0", "CACHE_MAX_AGE_SECONDS": "60"},
+			params: QueryParams{Start: float(1), End: float(1600000000)},
+			want:   "private, max-age=60",
+		},
+		{
+			name:   "caching disabled",
+			env:    map[string]string{"CACHE_MAX_AGE_SECONDS": "0"},
+			params: QueryParams{Start: float(1), End: float(2)},
+			want:   "no-cache",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			stopClock(t)
+			for name, value := range test.env {
+				t.Setenv(name, value)
+			}
+			want := map[string]string{"Cache-Control": test.want}
+			if got := CacheHeadersFor(test.params); !reflect.DeepEqual(got, want) {
+				t.Errorf("CacheHeadersFor() = %v, want %v", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,30 @@
+package utils
+
+import (
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+)
+
+var (
+	sharedClient     *dynamodb.Client
+	sharedClientOnce sync.Once
+)
+
+// Client returns a DynamoDB client shared across invocations.
+// Lambda reuses the process between warm invocations, so loading the configuration
+// and constructing the client happens once per cold start rather than once per request.
+func Client() *dynamodb.Client {
+	sharedClientOnce.Do(func() {
+		if sharedClient == nil {
+			sharedClient = InitClient()
+		}
+	})
+	return sharedClient
+}
+
+// SetClient replaces the shared client, e.g. with one pointed at DynamoDB Local.
+// It is not safe to call concurrently with Client, so it belongs in setup code.
+func SetClient(client *dynamodb.Client) {
+	sharedClient = client
+}
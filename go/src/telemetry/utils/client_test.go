@@ -0,0 +1,24 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+)
+
+func TestClient(t *testing.T) {
+	previous := sharedClient
+	t.Cleanup(func() { sharedClient = previous })
+
+	first := dynamodb.New(dynamodb.Options{Region: "us-east-1"})
+	second := dynamodb.New(dynamodb.Options{Region: "us-west-2"})
+
+	SetClient(first)
+	if Client() != first || Client() != first {
+		t.Error("Client() did not return the client set, on every call")
+	}
+	SetClient(second)
+	if Client() != second {
+		t.Error("Client() did not return the replacement client")
+	}
+}
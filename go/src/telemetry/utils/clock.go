@@ -0,0 +1,37 @@
+package utils
+
+import "time"
+
+// Clock tells the current time. Time-based logic reads it through a Clock,
+// rather than calling time.Now directly, so that it can be run against a fixed time.
+type Clock interface {
+	Now() time.Time
+}
+
+// SystemClock is the real Clock, reading the system time.
+type SystemClock struct{}
+
+func (SystemClock) Now() time.Time {
+	return time.Now()
+}
+
+// FixedClock is a Clock that is stopped at a single instant.
+type FixedClock time.Time
+
+func (c FixedClock) Now() time.Time {
+	return time.Time(c)
+}
+
+// clock is the Clock used by TTLs, time range clamping, cache headers, rate limits, and metrics.
+var clock Clock = SystemClock{}
+
+// SetClock replaces the Clock used to tell the current time, e.g. with a FixedClock.
+// It is not safe to call concurrently with requests, so it belongs in setup code.
+func SetClock(c Clock) {
+	clock = c
+}
+
+// Now returns the current time according to the configured Clock.
+func Now() time.Time {
+	return clock.Now()
+}
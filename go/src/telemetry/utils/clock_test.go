@@ -0,0 +1,50 @@
+package utils
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNow(t *testing.T) {
+	tests := []struct {
+		name  string
+		clock Clock
+		check func(t *testing.T, now time.Time)
+	}{
+		{
+			name:  "fixed clock",
+			clock: FixedClock(testNow),
+			check: func(t *testing.T, now time.Time) {
+				if !now.Equal(testNow) {
+					t.Errorf("Now() = %v, want %v", now, testNow)
+				}
+			},
+		},
+		{
+			name:  "system clock",
+			clock: SystemClock{},
+			check: func(t *testing.T, now time.Time) {
+				if elapsed := time.Since(now); elapsed < 0 || elapsed > time.Minute {
+					t.Errorf("Now() = %v, want the system time", now)
+				}
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			SetClock(test.clock)
+			t.Cleanup(func() { SetClock(SystemClock{}) })
+
+			test.check(t, Now())
+		})
+	}
+}
+
+func TestFixedClockStopped(t *testing.T) {
+	stopClock(t)
+	first := Now()
+	time.Sleep(time.Millisecond)
+	if second := Now(); !second.Equal(first) {
+		t.Errorf("Now() moved from %v to %v, want it stopped", first, second)
+	}
+}
@@ -0,0 +1,63 @@
+package utils
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// Conversions are the unit conversions that can be applied to numeric fields of returned items,
+// keyed by the name used in the 'convert' query string parameter.
+var Conversions = map[string]func(float64) float64{
+	// Temperature
+	"C2F": func(c float64) float64 { return c*9/5 + 32 },
+	"F2C": func(f float64) float64 { return (f - 32) * 5 / 9 },
+	"C2K": func(c float64) float64 { return c + 273.15 },
+	"K2C": func(k float64) float64 { return k - 273.15 },
+
+	// Pressure
+	"HPA2INHG": func(hpa float64) float64 { return hpa * 0.0295299830714 },
+	"INHG2HPA": func(inhg float64) float64 { return inhg / 0.0295299830714 },
+}
+
+// ConversionSpec names a conversion to apply to a field, as in 'Temperature:C2F'.
+type ConversionSpec struct {
+	Field      string
+	Conversion string
+}
+
+// ParseConversions parses conversion specs of the form Field:Conversion,
+// rejecting any that name a conversion missing from Conversions.
+func ParseConversions(values []string) ([]ConversionSpec, error) {
+	specs := make([]ConversionSpec, 0, len(values))
+	for _, value := range values {
+		parts := strings.SplitN(value, ":", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("convert must be of the form Field:Conversion, got %q", value)
+		}
+		spec := ConversionSpec{Field: parts[0], Conversion: strings.ToUpper(parts[1])}
+		if _, ok := Conversions[spec.Conversion]; !ok {
+			return nil, fmt.Errorf("unknown conversion %q", parts[1])
+		}
+		specs = append(specs, spec)
+	}
+	return specs, nil
+}
+
+// ApplyConversions rewrites the converted fields of each item in place.
+// Items where the field is missing or not a number are left untouched.
+func ApplyConversions(items []map[string]types.AttributeValue, specs []ConversionSpec) {
+	for _, spec := range specs {
+		convert := Conversions[spec.Conversion]
+		if convert == nil {
+			continue
+		}
+		for _, item := range items {
+			if value, ok := NumberAttribute(item, spec.Field); ok {
+				// Converted values are written with the same precision as stored ones.
+				item[spec.Field] = toAttributeValue(convert(value))
+			}
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package utils
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+func TestParseConversions(t *testing.T) {
+	tests := []struct {
+		name    string
+		values  []string
+		want    []ConversionSpec
+		wantErr bool
+	}{
+		{name: "none", want: []ConversionSpec{}},
+		{
+			name:   "case insensitive",
+			values: []string{"Temperature:c2f", "Pressure:HPA2INHG"},
+			want: []ConversionSpec{
+				{Field: "Temperature", Conversion: "C2F"},
+				{Field: "Pressure", Conversion: "HPA2INHG"},
+			},
+		},
+		{name: "unknown conversion", values: []string{"Temperature:C2X"}, wantErr: true},
+		{name: "missing field", values: []string{":C2F"}, wantErr: true},
+		{name: "missing conversion", values: []string{"Temperature"}, wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := ParseConversions(test.values)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("ParseConversions() error = %v, wantErr %v", err, test.wantErr)
+			}
+			if !test.wantErr && !reflect.DeepEqual(got, test.want) {
+				t.Errorf("ParseConversions() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestApplyConversions(t *testing.T) {
+	tests := []struct {
+		name  string
+		item  map[string]types.AttributeValue
+		specs []ConversionSpec
+		want  map[string]types.AttributeValue
+	}{
+		{
+			name:  "celsius to fahrenheit",
+			item:  map[string]types.AttributeValue{"Temperature": numberAttr("100")},
+			specs: []ConversionSpec{{Field: "Temperature", Conversion: "C2F"}},
+			want:  map[string]types.AttributeValue{"Temperature": numberAttr("212.000000")},
+		},
+		{
+			name:  "kelvin to celsius",
+			item:  map[string]types.AttributeValue{"Temperature": numberAttr("273.15")},
+			specs: []ConversionSpec{{Field: "Temperature", Conversion: "K2C"}},
+			want:  map[string]types.AttributeValue{"Temperature": numberAttr("0.000000")},
+		},
+		{
+			name:  "non-numeric field untouched",
+			item:  map[string]types.AttributeValue{"Temperature": stringAttr("hot")},
+			specs: []ConversionSpec{{Field: "Temperature", Conversion: "C2F"}},
+			want:  map[string]types.AttributeValue{"Temperature": stringAttr("hot")},
+		},
+		{
+			name:  "missing field untouched",
+			item:  map[string]types.AttributeValue{"Humidity": numberAttr("50")},
+			specs: []ConversionSpec{{Field: "Temperature", Conversion: "C2F"}},
+			want:  map[string]types.AttributeValue{"Humidity": numberAttr("50")},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			items := []map[string]types.AttributeValue{test.item}
+			ApplyConversions(items, test.specs)
+			if !reflect.DeepEqual(items[0], test.want) {
+				t.Errorf("ApplyConversions() = %v, want %v", items[0], test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,39 @@
+package utils
+
+import (
+	"net/url"
+	"os"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// ReadingKey identifies a single reading, as echoed back to the client that wrote it.
+type ReadingKey struct {
+	ProjectId string  `json:"ProjectId"`
+	DeviceId  string  `json:"DeviceId"`
+	EpochTime float64 `json:"EpochTime"`
+}
+
+// ReadingKeyOf returns the key of a reading stored as the item.
+func ReadingKeyOf(item map[string]types.AttributeValue) ReadingKey {
+	var key ReadingKey
+	key.ProjectId, _ = StringAttribute(item, "ProjectId")
+	key.DeviceId, _ = StringAttribute(item, "DeviceId")
+	key.EpochTime, _ = NumberAttribute(item, "EpochTime")
+	return key
+}
+
+// Location is the path at which the reading can be read back from the device endpoint.
+func (key ReadingKey) Location() string {
+	return "/projects/" + url.PathEscape(key.ProjectId) +
+		"/devices/" + url.PathEscape(key.DeviceId) +
+		"?at=" + url.QueryEscape(formatNumber(key.EpochTime))
+}
+
+// CreatedStatusOnPost reports whether a successful POST of a single reading is answered with
+// 201 Created and a JSON body echoing the reading's key, when the CREATED_STATUS_ON_POST
+// environment variable is truthy. Otherwise it is answered with 200 OK, as existing clients expect.
+func CreatedStatusOnPost() bool {
+	enabled, _ := ParseBoolParam(os.Getenv("CREATED_STATUS_ON_POST"))
+	return enabled
+}
@@ -0,0 +1,94 @@
+package utils
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+func TestReadingKeyOf(t *testing.T) {
+	item := map[string]types.AttributeValue{
+		"ProjectId#DeviceId": stringAttr("sensors#d1"),
+		"ProjectId":          stringAttr("sensors"),
+		"DeviceId":           stringAttr("d1"),
+		"EpochTime":          numberAttr("1600000000.5"),
+		"Temperature":        numberAttr("21.5"),
+	}
+	want := ReadingKey{ProjectId: "sensors", DeviceId: "d1", EpochTime: 1600000000.5}
+	if got := ReadingKeyOf(item); got != want {
+		t.Errorf("ReadingKeyOf() = %+v, want %+v", got, want)
+	}
+}
+
+func TestReadingKeyLocation(t *testing.T) {
+	tests := []struct {
+		name string
+		key  ReadingKey
+		want string
+	}{
+		{
+			name: "whole seconds",
+			key:  ReadingKey{ProjectId: "sensors", DeviceId: "d1", EpochTime: 1600000000},
+			want: "/projects/sensors/devices/d1?at=1600000000",
+		},
+		{
+			name: "fractional seconds",
+			key:  ReadingKey{ProjectId: "sensors", DeviceId: "d1", EpochTime: 1600000000.25},
+			want: "/projects/sensors/devices/d1?at=1600000000.25",
+		},
+		{
+			name: "escaped",
+			key:  ReadingKey{ProjectId: "my sensors", DeviceId: "d1/a", EpochTime: 1},
+			want: "/projects/my%20sensors/devices/d1%2Fa?at=1",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.key.Location(); got != test.want {
+				t.Errorf("Location() = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestPostSuccessResponse(t *testing.T) {
+	key := ReadingKey{ProjectId: "sensors", DeviceId: "d1", EpochTime: 1600000000}
+	tests := []struct {
+		name       string
+		created    string
+		wantStatus int
+		wantBody   string
+	}{
+		{name: "OK by default", wantStatus: 200, wantBody: "Success! Item added"},
+		{name: "OK when disabled", created: "false", wantStatus: 200, wantBody: "Success! Item added"},
+		{
+			name:       "created",
+			created:    "true",
+			wantStatus: 201,
+			wantBody:   `{"ProjectId":"sensors","DeviceId":"d1","EpochTime":1600000000}`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Setenv("CREATED_STATUS_ON_POST", test.created)
+			response, err := PostSuccessResponse(key)
+			if err != nil {
+				t.Fatalf("PostSuccessResponse() error = %v", err)
+			}
+			if response.StatusCode != test.wantStatus || response.Body != test.wantBody {
+				t.Errorf("PostSuccessResponse() = %d %s, want %d %s",
+					response.StatusCode, response.Body, test.wantStatus, test.wantBody)
+			}
+			if location := response.Headers["Location"]; location != key.Location() {
+				t.Errorf("Location = %q, want %q", location, key.Location())
+			}
+			if test.wantStatus == 201 {
+				var echoed ReadingKey
+				if err := json.Unmarshal([]byte(response.Body), &echoed); err != nil || echoed != key {
+					t.Errorf("body = %s, want the key echoed", response.Body)
+				}
+			}
+		})
+	}
+}
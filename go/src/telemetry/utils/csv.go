@@ -0,0 +1,73 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"sort"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// ItemsToCSV flattens items into CSV. The header row is the union of every item's attributes,
+// with EpochTime first and the rest in alphabetical order. Missing attributes are empty cells,
+// and nested lists and maps are written as JSON.
+func ItemsToCSV(items []map[string]types.AttributeValue) (string, error) {
+	columnSet := make(map[string]bool)
+	for _, item := range items {
+		for key := range item {
+			columnSet[key] = true
+		}
+	}
+	columns := make([]string, 0, len(columnSet))
+	for column := range columnSet {
+		if column != "EpochTime" {
+			columns = append(columns, column)
+		}
+	}
+	sort.Strings(columns)
+	if columnSet["EpochTime"] {
+		columns = append([]string{"EpochTime"}, columns...)
+	}
+
+	var buffer bytes.Buffer
+	writer := csv.NewWriter(&buffer)
+	if err := writer.Write(columns); err != nil {
+		return "", err
+	}
+	row := make([]string, len(columns))
+	for _, item := range items {
+		for i, column := range columns {
+			cell, err := csvCell(item[column])
+			if err != nil {
+				return "", err
+			}
+			row[i] = cell
+		}
+		if err := writer.Write(row); err != nil {
+			return "", err
+		}
+	}
+	writer.Flush()
+	return buffer.String(), writer.Error()
+}
+
+func csvCell(value types.AttributeValue) (string, error) {
+	if value == nil {
+		return "", nil
+	}
+	switch v := value.(type) {
+	case *types.AttributeValueMemberS:
+		return v.Value, nil
+	case *types.AttributeValueMemberN:
+		return v.Value, nil
+	case *types.AttributeValueMemberBOOL:
+		return strconv.FormatBool(v.Value), nil
+	case *types.AttributeValueMemberNULL:
+		return "", nil
+	default:
+		encoded, err := json.Marshal(AttributeValueToJSON(value))
+		return string(encoded), err
+	}
+}
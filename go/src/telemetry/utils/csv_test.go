@@ -0,0 +1,72 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+func TestItemsToCSV(t *testing.T) {
+	tests := []struct {
+		name  string
+		items []map[string]types.AttributeValue
+		want  string
+	}{
+		{name: "no items", items: nil, want: "\n"},
+		{
+			name: "EpochTime first, then alphabetical",
+			items: []map[string]types.AttributeValue{
+				{"Temperature": numberAttr("21.5"), "EpochTime": numberAttr("1"), "DeviceId": stringAttr("d1")},
+			},
+			want: "EpochTime,DeviceId,Temperature\n1,d1,21.5\n",
+		},
+		{
+			name: "missing attributes are empty",
+			items: []map[string]types.AttributeValue{
+				{"EpochTime": numberAttr("1"), "Temperature": numberAttr("21.5")},
+				{"EpochTime": numberAttr("2"), "Humidity": numberAttr("40")},
+			},
+			want: "EpochTime,Humidity,Temperature\n1,,21.5\n2,40,\n",
+		},
+		{
+			name: "other types",
+			items: []map[string]types.AttributeValue{{
+				"Charging": &types.AttributeValueMemberBOOL{Value: true},
+				"Error":    &types.AttributeValueMemberNULL{Value: true},
+				"Label":    stringAttr("north, upper"),
+				"Samples":  &types.AttributeValueMemberL{Value: []types.AttributeValue{numberAttr("1"), numberAttr("2")}},
+			}},
+			want: "Charging,Error,Label,Samples\ntrue,,\"north, upper\",\"[1,2]\"\n",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := ItemsToCSV(test.items)
+			if err != nil {
+				t.Fatalf("ItemsToCSV() error = %v", err)
+			}
+			if got != test.want {
+				t.Errorf("ItemsToCSV() = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestExportFilename(t *testing.T) {
+	tests := []struct {
+		name   string
+		params QueryParams
+		want   string
+	}{
+		{name: "project", params: QueryParams{ProjectId: "sensors"}, want: "sensors.csv"},
+		{name: "device", params: QueryParams{ProjectId: "sensors", DeviceId: "d1"}, want: "sensors-d1.csv"},
+		{name: "location", params: QueryParams{ProjectId: "sensors", LocationId: "roof"}, want: "sensors-roof.csv"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := exportFilename(test.params); got != test.want {
+				t.Errorf("exportFilename() = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
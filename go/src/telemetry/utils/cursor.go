@@ -0,0 +1,71 @@
+package utils
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// ErrInvalidCursor is returned for a cursor that wasn't made by EncodeCursor.
+var ErrInvalidCursor = errors.New("cursor is not valid")
+
+// cursorKeyValue is the JSON form of one attribute of a LastEvaluatedKey.
+// Key attributes are always strings or numbers.
+type cursorKeyValue struct {
+	S *string `json:"S,omitempty"`
+	N *string `json:"N,omitempty"`
+}
+
+// cursorState is what a cursor carries from one page request to the next.
+type cursorState struct {
+	Key   map[string]cursorKeyValue `json:"k"`
+	Count int                       `json:"c"`
+}
+
+// EncodeCursor packs the key a query stopped at, and the number of items returned before it,
+// into an opaque string that resumes the query when passed back as the 'cursor' parameter.
+func EncodeCursor(lastKey map[string]types.AttributeValue, count int) (string, error) {
+	state := cursorState{Key: make(map[string]cursorKeyValue, len(lastKey)), Count: count}
+	for name, value := range lastKey {
+		switch v := value.(type) {
+		case *types.AttributeValueMemberS:
+			state.Key[name] = cursorKeyValue{S: &v.Value}
+		case *types.AttributeValueMemberN:
+			state.Key[name] = cursorKeyValue{N: &v.Value}
+		default:
+			return "", fmt.Errorf("unsupported key attribute %s", name)
+		}
+	}
+	encoded, err := json.Marshal(state)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(encoded), nil
+}
+
+// DecodeCursor unpacks a cursor made by EncodeCursor.
+func DecodeCursor(cursor string) (map[string]types.AttributeValue, int, error) {
+	decoded, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, 0, ErrInvalidCursor
+	}
+	var state cursorState
+	if err := json.Unmarshal(decoded, &state); err != nil || len(state.Key) == 0 || state.Count < 0 {
+		return nil, 0, ErrInvalidCursor
+	}
+	lastKey := make(map[string]types.AttributeValue, len(state.Key))
+	for name, value := range state.Key {
+		switch {
+		case value.S != nil:
+			lastKey[name] = &types.AttributeValueMemberS{Value: *value.S}
+		case value.N != nil:
+			lastKey[name] = &types.AttributeValueMemberN{Value: *value.N}
+		default:
+			return nil, 0, ErrInvalidCursor
+		}
+	}
+	return lastKey, state.Count, nil
+}
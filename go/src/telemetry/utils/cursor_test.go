@@ -0,0 +1,80 @@
+package utils
+
+import (
+	"encoding/base64"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+func TestEncodeCursor(t *testing.T) {
+	tests := []struct {
+		name    string
+		lastKey map[string]types.AttributeValue
+		count   int
+		wantErr bool
+	}{
+		{
+			name: "base table key",
+			lastKey: map[string]types.AttributeValue{
+				"ProjectId#DeviceId": stringAttr("sensors#d1"),
+				"EpochTime":          numberAttr("1600000000"),
+			},
+			count: 100,
+		},
+		{
+			name: "index key",
+			lastKey: map[string]types.AttributeValue{
+				"ProjectId#DeviceId": stringAttr("sensors#d1"),
+				"ProjectId":          stringAttr("sensors"),
+				"EpochTime":          numberAttr("1600000000.5"),
+			},
+		},
+		{
+			name:    "unsupported key attribute",
+			lastKey: map[string]types.AttributeValue{"Flag": &types.AttributeValueMemberBOOL{Value: true}},
+			wantErr: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cursor, err := EncodeCursor(test.lastKey, test.count)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("EncodeCursor() error = %v, wantErr %v", err, test.wantErr)
+			}
+			if test.wantErr {
+				return
+			}
+			lastKey, count, err := DecodeCursor(cursor)
+			if err != nil {
+				t.Fatalf("DecodeCursor() error = %v", err)
+			}
+			if !reflect.DeepEqual(lastKey, test.lastKey) || count != test.count {
+				t.Errorf("DecodeCursor() = %v, %d, want %v, %d", lastKey, count, test.lastKey, test.count)
+			}
+		})
+	}
+}
+
+func TestDecodeCursor(t *testing.T) {
+	encode := func(state string) string { return base64.RawURLEncoding.EncodeToString([]byte(state)) }
+	tests := []struct {
+		name   string
+		cursor string
+	}{
+		{name: "not base64", cursor: "!!!"},
+		{name: "not JSON", cursor: encode("key")},
+		{name: "no key", cursor: encode(`{"k": {}, "c": 1}`)},
+		{name: "negative count", cursor: encode(`{"k": {"EpochTime": {"N": "1"}}, "c": -1}`)},
+		{name: "untyped key attribute", cursor: encode(`{"k": {"EpochTime": {}}, "c": 1}`)},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, _, err := DecodeCursor(test.cursor); !errors.Is(err, ErrInvalidCursor) {
+				t.Errorf("DecodeCursor() error = %v, want ErrInvalidCursor", err)
+			}
+		})
+	}
+}
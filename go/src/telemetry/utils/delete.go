@@ -0,0 +1,125 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go/aws"
+
+	"telemetry/constants"
+)
+
+type DynamoDbBatchWriteItemAPI interface {
+	BatchWriteItem(
+		ctx context.Context,
+		params *dynamodb.BatchWriteItemInput,
+		optFns ...func(*dynamodb.Options),
+	) (*dynamodb.BatchWriteItemOutput, error)
+}
+
+// batchWriteSize is the most requests DynamoDB accepts in one BatchWriteItem call.
+const batchWriteSize = 25
+
+// maxUnprocessedRetries bounds how often DeleteItems resubmits deletes DynamoDB left unprocessed.
+const maxUnprocessedRetries = 5
+
+// ItemKey returns the base table's primary key of a reading item.
+func ItemKey(item map[string]types.AttributeValue) map[string]types.AttributeValue {
+	sortKey := SortKeyAttribute()
+	return map[string]types.AttributeValue{
+		"ProjectId#DeviceId": item["ProjectId#DeviceId"],
+		sortKey:              item[sortKey],
+	}
+}
+
+// DeleteItems deletes the given items from the table in batches,
+// resubmitting any deletes DynamoDB leaves unprocessed.
+func DeleteItems(
+	ctx context.Context,
+	api DynamoDbBatchWriteItemAPI,
+	items []map[string]types.AttributeValue,
+) error {
+	for start := 0; start < len(items); start += batchWriteSize {
+		end := start + batchWriteSize
+		if end > len(items) {
+			end = len(items)
+		}
+		requests := make([]types.WriteRequest, 0, end-start)
+		for _, item := range items[start:end] {
+			requests = append(requests, types.WriteRequest{
+				DeleteRequest: &types.DeleteRequest{Key: ItemKey(item)},
+			})
+		}
+
+		pending := map[string][]types.WriteRequest{constants.TABLE_NAME: requests}
+		for attempt := 0; len(pending) > 0; attempt++ {
+			if attempt > maxUnprocessedRetries {
+				return fmt.Errorf("%d deletes left unprocessed", len(pending[constants.TABLE_NAME]))
+			}
+			output, err := api.BatchWriteItem(ctx, &dynamodb.BatchWriteItemInput{RequestItems: pending})
+			if err != nil {
+				return fmt.Errorf("failed to delete items, %v", err)
+			}
+			pending = output.UnprocessedItems
+		}
+	}
+	return nil
+}
+
+// DynamoDbRangeDeleteAPI defines the functions needed to delete a range of readings.
+type DynamoDbRangeDeleteAPI interface {
+	DynamoDbQueryAPI
+	DynamoDbBatchWriteItemAPI
+}
+
+// DeleteRange permanently deletes every one of a device's readings with an EpochTime from start
+// to end, inclusive, soft-deleted ones included, returning how many were deleted. Only the keys
+// of the readings are read, a page at a time, and each page is deleted before the next is read.
+// Both bounds are required, so that a whole device's history can't be deleted by mistake.
+func DeleteRange(
+	ctx context.Context,
+	api DynamoDbRangeDeleteAPI,
+	tenant string,
+	project string,
+	deviceId string,
+	start *float64,
+	end *float64,
+) (int, error) {
+	if start == nil || end == nil {
+		return 0, errors.New("deleting a range requires both start and end")
+	}
+	if *start > *end {
+		return 0, errors.New("start cannot be greater than end")
+	}
+	input, err := BuildQueryInput(QueryParams{
+		TenantId:       tenant,
+		ProjectId:      project,
+		DeviceId:       deviceId,
+		Start:          start,
+		End:            end,
+		IncludeDeleted: true,
+	})
+	if err != nil {
+		return 0, err
+	}
+	input.ProjectionExpression = aws.String("#keyPartition, #keySort")
+	input.ExpressionAttributeNames["#keyPartition"] = "ProjectId#DeviceId"
+	input.ExpressionAttributeNames["#keySort"] = SortKeyAttribute()
+
+	deleted := 0
+	var deleteErr error
+	_, err = PaginateQuery(ctx, api, input, func(output *dynamodb.QueryOutput) bool {
+		if deleteErr = DeleteItems(ctx, api, output.Items); deleteErr != nil {
+			return true
+		}
+		deleted += len(output.Items)
+		return false
+	})
+	if err != nil {
+		return deleted, err
+	}
+	return deleted, deleteErr
+}
@@ -0,0 +1,215 @@
+package utils
+
+import (
+	"context"
+	"strconv"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+
+	"telemetry/utils/dynamotest"
+)
+
+// deleteRequests counts the delete requests in each recorded BatchWriteItem call.
+func deleteRequests(calls []dynamotest.Call) []int {
+	counts := make([]int, len(calls))
+	for i, call := range calls {
+		tables, _ := call.Input["RequestItems"].(map[string]interface{})
+		requests, _ := tables["TelemetryOld"].([]interface{})
+		counts[i] = len(requests)
+	}
+	return counts
+}
+
+// keyedReadings returns a device's readings at each EpochTime, with their keys.
+func keyedReadings(times ...string) []map[string]types.AttributeValue {
+	items := readingsAt(times...)
+	for _, item := range items {
+		item["ProjectId#DeviceId"] = stringAttr("sensors#d1")
+	}
+	return items
+}
+
+func TestItemKey(t *testing.T) {
+	item := map[string]types.AttributeValue{
+		"ProjectId#DeviceId": stringAttr("sensors#d1"),
+		"EpochTime":          numberAttr("1"),
+		"Temperature":        numberAttr("21.5"),
+	}
+	key := ItemKey(item)
+	if len(key) != 2 || key["ProjectId#DeviceId"] != item["ProjectId#DeviceId"] || key["EpochTime"] != item["EpochTime"] {
+		t.Errorf("ItemKey() = %v, want the partition and sort keys", key)
+	}
+}
+
+func TestDeleteItems(t *testing.T) {
+	var many []string
+	for i := 0; i < 30; i++ {
+		many = append(many, strconv.Itoa(i))
+	}
+	unprocessed := `{"UnprocessedItems": {"TelemetryOld": [
+		{"DeleteRequest": {"Key": {"ProjectId#DeviceId": {"S": "sensors#d1"}, "EpochTime": {"N": "1"}}}}
+	]}}`
+	tests := []struct {
+		name     string
+		items    []map[string]types.AttributeValue
+		setup    func(server *dynamotest.Server)
+		wantErr  bool
+		wantSent []int
+	}{
+		{name: "no items", wantSent: []int{}},
+		{name: "one batch", items: keyedReadings("1", "2"), wantSent: []int{2}},
+		{name: "several batches", items: keyedReadings(many...), wantSent: []int{25, 5}},
+		{
+			name:     "unprocessed deletes resubmitted",
+			items:    keyedReadings("1", "2"),
+			setup:    func(server *dynamotest.Server) { server.Respond("BatchWriteItem", unprocessed) },
+			wantSent: []int{2, 1},
+		},
+		{
+			name:  "unprocessed deletes given up on",
+			items: keyedReadings("1"),
+			setup: func(server *dynamotest.Server) {
+				for i := 0; i <= maxUnprocessedRetries; i++ {
+					server.Respond("BatchWriteItem", unprocessed)
+				}
+			},
+			wantErr:  true,
+			wantSent: []int{1, 1, 1, 1, 1, 1},
+		},
+		{
+			name:     "failed",
+			items:    keyedReadings("1"),
+			setup:    func(server *dynamotest.Server) { server.Fail("BatchWriteItem", "InternalServerError") },
+			wantErr:  true,
+			wantSent: []int{1},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := dynamotest.NewServer(t)
+			if test.setup != nil {
+				test.setup(server)
+			}
+
+			err := DeleteItems(context.Background(), server.Client(), test.items)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("DeleteItems() error = %v, wantErr %v", err, test.wantErr)
+			}
+			sent := deleteRequests(server.Calls("BatchWriteItem"))
+			if len(sent) != len(test.wantSent) {
+				t.Fatalf("sent batches of %v, want %v", sent, test.wantSent)
+			}
+			for i := range sent {
+				if sent[i] != test.wantSent[i] {
+					t.Errorf("sent batches of %v, want %v", sent, test.wantSent)
+					break
+				}
+			}
+		})
+	}
+}
+
+func TestDeleteRange(t *testing.T) {
+	firstPage := `{"Count": 2, "Items": [
+		{"ProjectId#DeviceId": {"S": "sensors#d1"}, "EpochTime": {"N": "1"}},
+		{"ProjectId#DeviceId": {"S": "sensors#d1"}, "EpochTime": {"N": "2"}}
+	], "LastEvaluatedKey": {"ProjectId#DeviceId": {"S": "sensors#d1"}, "EpochTime": {"N": "2"}}}`
+	lastPage := `{"Count": 1, "Items": [
+		{"ProjectId#DeviceId": {"S": "sensors#d1"}, "EpochTime": {"N": "3"}}
+	]}`
+	tests := []struct {
+		name        string
+		start       *float64
+		end         *float64
+		setup       func(server *dynamotest.Server)
+		wantErr     bool
+		wantDeleted int
+		wantQueries int
+		wantSent    []int
+	}{
+		{name: "missing start", end: float(3), wantErr: true, wantSent: []int{}},
+		{name: "missing end", start: float(1), wantErr: true, wantSent: []int{}},
+		{name: "start after end", start: float(3), end: float(1), wantErr: true, wantSent: []int{}},
+		{
+			name:  "each page deleted",
+			start: float(1),
+			end:   float(3),
+			setup: func(server *dynamotest.Server) {
+				server.Respond("Query", firstPage)
+				server.Respond("Query", lastPage)
+			},
+			wantDeleted: 3,
+			wantQueries: 2,
+			wantSent:    []int{2, 1},
+		},
+		{
+			name:        "nothing in range",
+			start:       float(1),
+			end:         float(3),
+			setup:       func(server *dynamotest.Server) { server.Respond("Query", `{"Count": 0, "Items": []}`) },
+			wantQueries: 1,
+			wantSent:    []int{},
+		},
+		{
+			name:        "failed query",
+			start:       float(1),
+			end:         float(3),
+			setup:       func(server *dynamotest.Server) { server.Fail("Query", "InternalServerError") },
+			wantErr:     true,
+			wantQueries: 1,
+			wantSent:    []int{},
+		},
+		{
+			name:  "failed delete stops paging",
+			start: float(1),
+			end:   float(3),
+			setup: func(server *dynamotest.Server) {
+				server.Respond("Query", firstPage)
+				server.Fail("BatchWriteItem", "InternalServerError")
+			},
+			wantErr:     true,
+			wantQueries: 1,
+			wantSent:    []int{2},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := dynamotest.NewServer(t)
+			if test.setup != nil {
+				test.setup(server)
+			}
+
+			deleted, err := DeleteRange(context.Background(), server.Client(), "", "sensors", "d1", test.start, test.end)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("DeleteRange() error = %v, wantErr %v", err, test.wantErr)
+			}
+			if deleted != test.wantDeleted {
+				t.Errorf("deleted %d readings, want %d", deleted, test.wantDeleted)
+			}
+			queries := server.Calls("Query")
+			if len(queries) != test.wantQueries {
+				t.Fatalf("made %d queries, want %d", len(queries), test.wantQueries)
+			}
+			// Only the keys are read, and soft-deleted readings are deleted too.
+			for _, query := range queries {
+				if query.Input["ProjectionExpression"] != "#keyPartition, #keySort" {
+					t.Errorf("ProjectionExpression = %v, want only the keys", query.Input["ProjectionExpression"])
+				}
+				if filter, ok := query.Input["FilterExpression"]; ok {
+					t.Errorf("FilterExpression = %v, want soft-deleted readings included", filter)
+				}
+			}
+			sent := deleteRequests(server.Calls("BatchWriteItem"))
+			if len(sent) != len(test.wantSent) {
+				t.Fatalf("sent batches of %v, want %v", sent, test.wantSent)
+			}
+			for i := range sent {
+				if sent[i] != test.wantSent[i] {
+					t.Errorf("sent batches of %v, want %v", sent, test.wantSent)
+					break
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,47 @@
+package utils
+
+import (
+	"os"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// DeltaSuffix is appended to a field's name to name the field holding its delta.
+const DeltaSuffix = "_delta"
+
+// DeltaResetToRaw reports whether a counter that went down is taken to have been reset,
+// in which case its delta is its new value, as set by the DELTA_RESET_TO_RAW environment variable.
+// Otherwise deltas are reported as they are, even when negative.
+func DeltaResetToRaw() bool {
+	enabled, _ := ParseBoolParam(os.Getenv("DELTA_RESET_TO_RAW"))
+	return enabled
+}
+
+// ComputeDelta adds the change in a cumulative numeric field since the previous reading to each
+// of the items, in place, as a field named with DeltaSuffix, e.g. PacketCount_delta.
+// Readings are taken in EpochTime order, whatever the order of the items. The first reading
+// with the field has a null delta, as do readings without it, which are otherwise skipped over.
+func ComputeDelta(items []map[string]types.AttributeValue, field string) {
+	ordered := make([]map[string]types.AttributeValue, len(items))
+	copy(ordered, items)
+	StableSortReadings(ordered)
+
+	resetToRaw := DeltaResetToRaw()
+	var previous *float64
+	for _, item := range ordered {
+		value, ok := NumberAttribute(item, field)
+		if !ok || previous == nil {
+			item[field+DeltaSuffix] = &types.AttributeValueMemberNULL{Value: true}
+			if ok {
+				previous = &value
+			}
+			continue
+		}
+		delta := value - *previous
+		if delta < 0 && resetToRaw {
+			delta = value
+		}
+		item[field+DeltaSuffix] = toAttributeValue(delta)
+		previous = &value
+	}
+}
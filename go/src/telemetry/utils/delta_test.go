@@ -0,0 +1,66 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+func TestComputeDelta(t *testing.T) {
+	counter := func(epochTime string, count string) map[string]types.AttributeValue {
+		item := map[string]types.AttributeValue{"EpochTime": numberAttr(epochTime)}
+		if count != "" {
+			item["PacketCount"] = numberAttr(count)
+		}
+		return item
+	}
+	tests := []struct {
+		name       string
+		resetToRaw string
+		items      []map[string]types.AttributeValue
+		want       []*float64
+	}{
+		{
+			name:  "increases",
+			items: []map[string]types.AttributeValue{counter("1", "10"), counter("2", "15"), counter("3", "15")},
+			want:  []*float64{nil, float(5), float(0)},
+		},
+		{
+			name:  "newest first",
+			items: []map[string]types.AttributeValue{counter("3", "18"), counter("2", "15"), counter("1", "10")},
+			want:  []*float64{float(3), float(5), nil},
+		},
+		{
+			name:  "readings without the field skipped",
+			items: []map[string]types.AttributeValue{counter("1", "10"), counter("2", ""), counter("3", "12")},
+			want:  []*float64{nil, nil, float(2)},
+		},
+		{
+			name:  "reset reported as it is",
+			items: []map[string]types.AttributeValue{counter("1", "10"), counter("2", "3")},
+			want:  []*float64{nil, float(-7)},
+		},
+		{
+			name:       "reset to the raw value",
+			resetToRaw: "true",
+			items:      []map[string]types.AttributeValue{counter("1", "10"), counter("2", "3")},
+			want:       []*float64{nil, float(3)},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Setenv("DELTA_RESET_TO_RAW", test.resetToRaw)
+			ComputeDelta(test.items, "PacketCount")
+			for i, item := range test.items {
+				delta := item["PacketCount"+DeltaSuffix]
+				if _, isNull := delta.(*types.AttributeValueMemberNULL); isNull != (test.want[i] == nil) {
+					t.Errorf("item %d delta = %v, want %s", i, delta, bound(test.want[i]))
+					continue
+				}
+				if value, _ := NumberAttribute(item, "PacketCount"+DeltaSuffix); test.want[i] != nil && value != *test.want[i] {
+					t.Errorf("item %d delta = %v, want %v", i, value, *test.want[i])
+				}
+			}
+		})
+	}
+}
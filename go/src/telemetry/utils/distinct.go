@@ -0,0 +1,67 @@
+package utils
+
+import (
+	"context"
+	"sort"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go/aws"
+)
+
+// DistinctValues returns the distinct values of a string attribute across the items, sorted.
+// Items without the attribute are skipped.
+func DistinctValues(items []map[string]types.AttributeValue, field string) []string {
+	seen := make(map[string]bool)
+	addDistinctValues(seen, items, field)
+	return sortedKeys(seen)
+}
+
+func addDistinctValues(seen map[string]bool, items []map[string]types.AttributeValue, field string) {
+	for _, item := range items {
+		if value, ok := StringAttribute(item, field); ok {
+			seen[value] = true
+		}
+	}
+}
+
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// QueryDistinct returns the distinct values of a string attribute among the items that match
+// the query parameters, such as every DeviceId that has reported to a project.
+// Only the attribute is read, and each page is reduced to its distinct values as it arrives,
+// so large projects don't have to be held in memory.
+func QueryDistinct(
+	ctx context.Context,
+	api DynamoDbQueryAPI,
+	params QueryParams,
+	field string,
+) ([]string, error) {
+	params.Single = false
+	params.Limit = 0
+	params.Recent = 0
+	input, err := BuildQueryInput(params)
+	if err != nil {
+		return nil, err
+	}
+	input.Limit = nil
+	input.ProjectionExpression = aws.String("#distinct")
+	input.ExpressionAttributeNames["#distinct"] = field
+
+	seen := make(map[string]bool)
+	_, err = PaginateQuery(ctx, api, input, func(output *dynamodb.QueryOutput) bool {
+		addDistinctValues(seen, output.Items, field)
+		return false
+	})
+	if err != nil {
+		return nil, err
+	}
+	return sortedKeys(seen), nil
+}
@@ -0,0 +1,74 @@
+package utils
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+
+	"telemetry/utils/dynamotest"
+)
+
+func TestDistinctValues(t *testing.T) {
+	tests := []struct {
+		name  string
+		items []map[string]types.AttributeValue
+		want  []string
+	}{
+		{name: "no items", want: []string{}},
+		{
+			name: "sorted and deduplicated",
+			items: []map[string]types.AttributeValue{
+				{"DeviceId": stringAttr("d2")},
+				{"DeviceId": stringAttr("d1")},
+				{"DeviceId": stringAttr("d2")},
+			},
+			want: []string{"d1", "d2"},
+		},
+		{
+			name: "missing and non-string values skipped",
+			items: []map[string]types.AttributeValue{
+				{"DeviceId": stringAttr("d1")},
+				{"DeviceId": numberAttr("2")},
+				{"LocationId": stringAttr("roof")},
+			},
+			want: []string{"d1"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := DistinctValues(test.items, "DeviceId"); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("DistinctValues() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestQueryDistinct(t *testing.T) {
+	server := dynamotest.NewServer(t)
+	server.Respond("Query", `{"Count": 2, "Items": [{"DeviceId": {"S": "d2"}}, {"DeviceId": {"S": "d1"}}],
+		"LastEvaluatedKey": {"ProjectId": {"S": "sensors"}, "EpochTime": {"N": "2"}}}`)
+	server.Respond("Query", `{"Count": 2, "Items": [{"DeviceId": {"S": "d3"}}, {"DeviceId": {"S": "d1"}}]}`)
+
+	params := QueryParams{ProjectId: "sensors", Single: true, Limit: 1}
+	got, err := QueryDistinct(context.Background(), server.Client(), params, "DeviceId")
+	if err != nil {
+		t.Fatalf("QueryDistinct() error = %v", err)
+	}
+	if want := []string{"d1", "d2", "d3"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("QueryDistinct() = %v, want %v", got, want)
+	}
+
+	// Every page is read, for only the field, whatever the limits asked for.
+	queries := server.Calls("Query")
+	if len(queries) != 2 {
+		t.Fatalf("made %d queries, want 2", len(queries))
+	}
+	if _, ok := queries[0].Input["Limit"]; ok {
+		t.Errorf("Limit = %v, want none", queries[0].Input["Limit"])
+	}
+	if projection := queries[0].Input["ProjectionExpression"]; projection != "#distinct" {
+		t.Errorf("ProjectionExpression = %v, want only the field", projection)
+	}
+}
@@ -3,10 +3,15 @@ package utils
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"math"
+	"os"
 	"strconv"
+	"strings"
 	"telemetry/constants"
+	"time"
 
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-sdk-go-v2/config"
@@ -35,52 +40,139 @@ type DynamoDbQueryAPI interface {
 
 // ListToAttributeValues converts a list into a list of DynamoDB AttributeValues
 func ListToAttributeValues(anyList []interface{}) []types.AttributeValue {
-	var attList []types.AttributeValue
+	attList := make([]types.AttributeValue, 0, len(anyList))
 	for _, value := range anyList {
-		switch value.(type) {
-		case string:
-			attList = append(attList, &types.AttributeValueMemberS{Value: value.(string)})
-		case float64:
-			attList = append(attList, &types.AttributeValueMemberN{Value: fmt.Sprintf("%f", value)})
-		case bool:
-			attList = append(attList, &types.AttributeValueMemberBOOL{Value: value.(bool)})
-		case []interface{}:
-			childList := ListToAttributeValues(value.([]interface{}))
-			attList = append(attList, &types.AttributeValueMemberL{Value: childList})
-		case map[string]interface{}:
-			childMap := MapToAttributeValues(value.(map[string]interface{}))
-			attList = append(attList, &types.AttributeValueMemberM{Value: childMap})
-		default:
-			attList = append(attList, &types.AttributeValueMemberNULL{Value: true})
-		}
+		attList = append(attList, toAttributeValue(value))
 	}
 	return attList
 }
 
 // MapToAttributeValues converts a map into a map of DynamoDB AttributeValues
 func MapToAttributeValues(anyMap map[string]interface{}) map[string]types.AttributeValue {
-	attMap := make(map[string]types.AttributeValue)
+	attMap := make(map[string]types.AttributeValue, len(anyMap))
 	for key, value := range anyMap {
-		switch value.(type) {
-		case string:
-			attMap[key] = &types.AttributeValueMemberS{Value: value.(string)}
-		case float64:
-			attMap[key] = &types.AttributeValueMemberN{Value: fmt.Sprintf("%f", value)}
-		case bool:
-			attMap[key] = &types.AttributeValueMemberBOOL{Value: value.(bool)}
-		case []interface{}:
-			childList := ListToAttributeValues(value.([]interface{}))
-			attMap[key] = &types.AttributeValueMemberL{Value: childList}
-		case map[string]interface{}:
-			childMap := MapToAttributeValues(value.(map[string]interface{}))
-			attMap[key] = &types.AttributeValueMemberM{Value: childMap}
-		default:
-			attMap[key] = &types.AttributeValueMemberNULL{Value: true}
-		}
+		attMap[key] = toAttributeValue(value)
 	}
 	return attMap
 }
 
+// toAttributeValue converts a single decoded JSON value, binding the concrete type
+// once in the type switch rather than asserting it again in each case.
+func toAttributeValue(value interface{}) types.AttributeValue {
+	switch v := value.(type) {
+	case string:
+		return &types.AttributeValueMemberS{Value: v}
+	case float64:
+		// DynamoDB rejects NaN and infinite numbers, which ingest filters out beforehand,
+		// so any that slip through are stored as null rather than failing the write.
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return &types.AttributeValueMemberNULL{Value: true}
+		}
+		return &types.AttributeValueMemberN{Value: strconv.FormatFloat(v, 'f', 6, 64)}
+	case bool:
+		return &types.AttributeValueMemberBOOL{Value: v}
+	case []interface{}:
+		return &types.AttributeValueMemberL{Value: ListToAttributeValues(v)}
+	case map[string]interface{}:
+		return &types.AttributeValueMemberM{Value: MapToAttributeValues(v)}
+	default:
+		return &types.AttributeValueMemberNULL{Value: true}
+	}
+}
+
+// AttributeValueToInterface converts a DynamoDB AttributeValue into a plain Go value,
+// reversing MapToAttributeValues. Numbers decode as float64.
+func AttributeValueToInterface(value types.AttributeValue) interface{} {
+	return convertAttributeValue(value, floatNumber)
+}
+
+// AttributeValuesToMap converts a map of DynamoDB AttributeValues into a plain map
+func AttributeValuesToMap(attMap map[string]types.AttributeValue) map[string]interface{} {
+	return convertAttributeValues(attMap, floatNumber)
+}
+
+// AttributeValueToJSON converts a DynamoDB AttributeValue into a plain Go value for encoding
+// in a response. Numbers decode as json.Number, so they are written exactly as stored,
+// in plain decimal notation and without losing precision to float64.
+func AttributeValueToJSON(value types.AttributeValue) interface{} {
+	return convertAttributeValue(value, literalNumber)
+}
+
+// AttributeValuesToJSON converts a map of DynamoDB AttributeValues like AttributeValueToJSON.
+func AttributeValuesToJSON(attMap map[string]types.AttributeValue) map[string]interface{} {
+	return convertAttributeValues(attMap, literalNumber)
+}
+
+func floatNumber(literal string) interface{} {
+	number, err := strconv.ParseFloat(literal, 64)
+	if err != nil {
+		return literal
+	}
+	return number
+}
+
+func literalNumber(literal string) interface{} {
+	// Any literal in exponent form is rewritten in plain decimal notation.
+	if strings.ContainsAny(literal, "eE") {
+		if number, err := strconv.ParseFloat(literal, 64); err == nil {
+			return json.Number(strconv.FormatFloat(number, 'f', -1, 64))
+		}
+	}
+	return json.Number(literal)
+}
+
+func convertAttributeValue(value types.AttributeValue, number func(string) interface{}) interface{} {
+	switch v := value.(type) {
+	case *types.AttributeValueMemberS:
+		return v.Value
+	case *types.AttributeValueMemberN:
+		return number(v.Value)
+	case *types.AttributeValueMemberBOOL:
+		return v.Value
+	case *types.AttributeValueMemberB:
+		return v.Value
+	case *types.AttributeValueMemberL:
+		list := make([]interface{}, 0, len(v.Value))
+		for _, child := range v.Value {
+			list = append(list, convertAttributeValue(child, number))
+		}
+		return list
+	case *types.AttributeValueMemberM:
+		return convertAttributeValues(v.Value, number)
+	case *types.AttributeValueMemberSS:
+		return v.Value
+	case *types.AttributeValueMemberNS:
+		numbers := make([]interface{}, 0, len(v.Value))
+		for _, n := range v.Value {
+			numbers = append(numbers, number(n))
+		}
+		return numbers
+	case *types.AttributeValueMemberBS:
+		return v.Value
+	default:
+		return nil
+	}
+}
+
+func convertAttributeValues(
+	attMap map[string]types.AttributeValue,
+	number func(string) interface{},
+) map[string]interface{} {
+	anyMap := make(map[string]interface{}, len(attMap))
+	for key, value := range attMap {
+		anyMap[key] = convertAttributeValue(value, number)
+	}
+	return anyMap
+}
+
+// IsItemCollectionFull reports whether a write failed because the item collection
+// sharing its partition key has reached the size limit DynamoDB imposes on tables
+// with local secondary indexes.
+func IsItemCollectionFull(err error) bool {
+	var sizeExceeded *types.ItemCollectionSizeLimitExceededException
+	return errors.As(err, &sizeExceeded)
+}
+
 // PutTableItem enters a single item into a DynamoDB table.
 func PutTableItem(
 	c context.Context,
@@ -99,17 +191,9 @@ func QueryTable(
 	return api.Query(c, input)
 }
 
-func CreateCompositeKey(
-	request *events.APIGatewayProxyRequest,
-	param1 string,
-	param2 string,
-) string {
-	key := fmt.Sprintf(
-		"%s#%s",
-		request.PathParameters[param1],
-		request.PathParameters[param2],
-	)
-	return key
+// CompositeKey joins key parts with '#', as in the ProjectId#DeviceId attribute.
+func CompositeKey(parts ...string) string {
+	return strings.Join(parts, "#")
 }
 
 func CreateQueryInput(
@@ -118,6 +202,8 @@ func CreateQueryInput(
 ) *dynamodb.QueryInput {
 	input := &dynamodb.QueryInput{
 		TableName: aws.String(constants.TABLE_NAME),
+		// The capacity each query consumes is reported, for cost visibility.
+		ReturnConsumedCapacity: types.ReturnConsumedCapacityTotal,
 		ExpressionAttributeNames: map[string]string{
 			"#primaryName": primaryName,
 		},
@@ -130,65 +216,94 @@ func CreateQueryInput(
 	return input
 }
 
-func EvaluateSingleParam(
-	request *events.APIGatewayProxyRequest,
-	input *dynamodb.QueryInput,
-) bool {
-	singleStr, singleOk := request.QueryStringParameters["single"]
-	single := false
-	if singleOk {
-		single, _ = strconv.ParseBool(singleStr)
-		if single {
-			input.Limit = aws.Int32(1)
-			input.ScanIndexForward = aws.Bool(false)
-		}
-	}
-	return single
+// CreateIndexQueryInput creates a query on a global secondary index of the table,
+// keyed on the index's partition key.
+func CreateIndexQueryInput(
+	indexName string,
+	primaryName string,
+	primaryValue string,
+) *dynamodb.QueryInput {
+	input := CreateQueryInput(primaryName, primaryValue)
+	input.IndexName = aws.String(indexName)
+	return input
 }
 
-func EvaluateStartEndParams(
-	request *events.APIGatewayProxyRequest,
-	input *dynamodb.QueryInput,
-) {
-	start, startOk := request.QueryStringParameters["start"]
-	end, endOk := request.QueryStringParameters["end"]
-	switch {
-	case startOk && endOk:
-		setTimeRange(input, start, end)
-	case startOk:
-		setLowerTimeBound(input, start)
-	case endOk:
-		setUpperTimeBound(input, end)
-	default:
-		input.KeyConditionExpression = aws.String("#primaryName = :primaryValue")
+// SortKeyAttribute names the sort key the time bounds apply to, from the SORT_KEY_ATTR
+// environment variable, for tables that order readings by another monotonically increasing
+// attribute, like an Offset. It defaults to EpochTime.
+func SortKeyAttribute() string {
+	if name := os.Getenv("SORT_KEY_ATTR"); name != "" {
+		return name
 	}
+	return "EpochTime"
+}
+
+// setSortKeyName names the sort key in the query's key condition, as #sortKey.
+func setSortKeyName(input *dynamodb.QueryInput) {
+	input.ExpressionAttributeNames["#sortKey"] = SortKeyAttribute()
 }
 
-func setTimeRange(input *dynamodb.QueryInput, start string, end string) {
+// setTimeRange bounds the sort key from both ends, inclusively unless told otherwise.
+// A key condition allows only one comparison on the sort key, so exclusive ends are inclusive
+// in the BETWEEN and dropped by the filter instead.
+func setTimeRange(
+	input *dynamodb.QueryInput,
+	start string,
+	end string,
+	startInclusive bool,
+	endInclusive bool,
+) {
 	input.KeyConditionExpression = aws.String(
-		"#primaryName = :primaryValue AND EpochTime BETWEEN :start AND :end",
+		"#primaryName = :primaryValue AND #sortKey BETWEEN :start AND :end",
 	)
+	setSortKeyName(input)
 	input.ExpressionAttributeValues[":start"] = &types.AttributeValueMemberN{
 		Value: start,
 	}
 	input.ExpressionAttributeValues[":end"] = &types.AttributeValueMemberN{
 		Value: end,
 	}
+	if !startInclusive {
+		addFilter(input, "#sortKey <> :start")
+	}
+	if !endInclusive {
+		addFilter(input, "#sortKey <> :end")
+	}
 }
 
-func setLowerTimeBound(input *dynamodb.QueryInput, start string) {
+func setLowerTimeBound(input *dynamodb.QueryInput, start string, inclusive bool) {
+	operator := ">="
+	if !inclusive {
+		operator = ">"
+	}
 	input.KeyConditionExpression = aws.String(
-		"#primaryName = :primaryValue AND EpochTime >= :start",
+		"#primaryName = :primaryValue AND #sortKey " + operator + " :start",
 	)
+	setSortKeyName(input)
 	input.ExpressionAttributeValues[":start"] = &types.AttributeValueMemberN{
 		Value: start,
 	}
 }
 
-func setUpperTimeBound(input *dynamodb.QueryInput, end string) {
+func setExclusiveLowerTimeBound(input *dynamodb.QueryInput, after string) {
 	input.KeyConditionExpression = aws.String(
-		"#primaryName = :primaryValue AND EpochTime <= :end",
+		"#primaryName = :primaryValue AND #sortKey > :after",
 	)
+	setSortKeyName(input)
+	input.ExpressionAttributeValues[":after"] = &types.AttributeValueMemberN{
+		Value: after,
+	}
+}
+
+func setUpperTimeBound(input *dynamodb.QueryInput, end string, inclusive bool) {
+	operator := "<="
+	if !inclusive {
+		operator = "<"
+	}
+	input.KeyConditionExpression = aws.String(
+		"#primaryName = :primaryValue AND #sortKey " + operator + " :end",
+	)
+	setSortKeyName(input)
 	input.ExpressionAttributeValues[":end"] = &types.AttributeValueMemberN{
 		Value: end,
 	}
@@ -203,48 +318,233 @@ func InitClient() *dynamodb.Client {
 	return dynamodb.NewFromConfig(cfg)
 }
 
+// PaginateQuery runs a query, calling fn with each page of results DynamoDB returns,
+// until fn reports that it's done or there are no more pages. The query starts from
+// input.ExclusiveStartKey, and PaginateQuery advances it as it goes.
+// It returns the number of pages read.
+func PaginateQuery(
+	ctx context.Context,
+	api DynamoDbQueryAPI,
+	input *dynamodb.QueryInput,
+	fn func(output *dynamodb.QueryOutput) (done bool),
+) (int, error) {
+	pages := 0
+	for {
+		output, err := QueryTable(ctx, api, input)
+		if err != nil {
+			return pages, fmt.Errorf("failed to query table, %w", err)
+		}
+		pages++
+		if fn(output) || output.LastEvaluatedKey == nil {
+			return pages, nil
+		}
+		input.ExclusiveStartKey = output.LastEvaluatedKey
+	}
+}
+
+// QueryStats describes the work DynamoDB did to answer a query.
+// ScannedCount is the number of items read before any filter was applied,
+// so a large gap between it and the items returned points at a missing index.
+// ConsumedCapacity is the total of the read capacity units consumed by every page,
+// and Elapsed the time spent retrieving them.
+type QueryStats struct {
+	Pages            int
+	ScannedCount     int
+	ConsumedCapacity float64
+	Elapsed          time.Duration
+
+	// TruncatedBySize notes that the query stopped short of its size budget,
+	// and ResumeKey is the key of the last item retrieved, from which it can be resumed.
+	// QueryItemsWithStats packs the key into NextCursor, for the client to pass back.
+	TruncatedBySize bool
+	ResumeKey       map[string]types.AttributeValue
+	NextCursor      string
+
+	// TimedOut notes that the query ran past its QueryTimeout, so only some items were retrieved.
+	TimedOut bool
+}
+
+// add accounts for a page of results in the stats.
+func (stats *QueryStats) add(output *dynamodb.QueryOutput) {
+	stats.Pages++
+	stats.ScannedCount += int(output.ScannedCount)
+	if output.ConsumedCapacity != nil && output.ConsumedCapacity.CapacityUnits != nil {
+		stats.ConsumedCapacity += *output.ConsumedCapacity.CapacityUnits
+	}
+}
+
+// Debug describes the stats for clients that ask for them with 'debug=true'.
+func (stats QueryStats) Debug() *DebugInfo {
+	return &DebugInfo{
+		ConsumedCapacity: stats.ConsumedCapacity,
+		ElapsedMs:        stats.Elapsed.Milliseconds(),
+	}
+}
+
+// GetData runs a query, following DynamoDB's pagination until every item is retrieved,
+// or until limit items have been retrieved when limit is positive.
 func GetData(
-	client *dynamodb.Client,
+	ctx context.Context,
+	api DynamoDbQueryAPI,
 	input *dynamodb.QueryInput,
-	single bool,
-) []map[string]types.AttributeValue {
+	limit int,
+) ([]map[string]types.AttributeValue, error) {
+	items, _, err := GetDataWithStats(ctx, api, input, limit)
+	return items, err
+}
+
+// GetDataWithStats runs a query like GetData, also reporting the work DynamoDB did across pages.
+func GetDataWithStats(
+	ctx context.Context,
+	api DynamoDbQueryAPI,
+	input *dynamodb.QueryInput,
+	limit int,
+) ([]map[string]types.AttributeValue, QueryStats, error) {
+	return GetDataWithinBudget(ctx, api, input, limit, 0)
+}
+
+// ResponseSizeBudget returns the most bytes of items a response may carry, from the
+// RESPONSE_SIZE_BUDGET_BYTES environment variable, by default leaving some room
+// under API Gateway's 10MB response limit for the rest of the response.
+func ResponseSizeBudget() int {
+	return envInt("RESPONSE_SIZE_BUDGET_BYTES", constants.RESPONSE_SIZE_BUDGET)
+}
+
+// GetDataWithinBudget runs a query like GetDataWithStats, but when budget is positive, stops before
+// the items retrieved would take more than budget bytes of JSON, noting in the stats that it did,
+// and the key the query can be resumed from. At least one item is always retrieved.
+// A query that runs past its QueryTimeout returns the items retrieved so far with ErrQueryTimeout.
+func GetDataWithinBudget(
+	ctx context.Context,
+	api DynamoDbQueryAPI,
+	input *dynamodb.QueryInput,
+	limit int,
+	budget int,
+) ([]map[string]types.AttributeValue, QueryStats, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
 	var items []map[string]types.AttributeValue
-	output, err := QueryTable(context.TODO(), client, input)
-	if err != nil {
-		log.Fatalf("Failed to query table, %v", err)
+	var stats QueryStats
+	size := 0
+	start := Now()
+	pages, err := PaginateQuery(ctx, api, input, func(output *dynamodb.QueryOutput) bool {
+		stats.add(output)
+		for _, item := range output.Items {
+			// Items past the limit are trimmed once the items are ordered, so they don't count.
+			if budget > 0 && (limit <= 0 || len(items) < limit) {
+				size += serializedSize(item)
+				if size > budget && len(items) > 0 {
+					stats.TruncatedBySize = true
+					stats.ResumeKey = itemKey(input, items[len(items)-1])
+					return true
+				}
+			}
+			items = append(items, item)
+		}
+		return limit > 0 && len(items) >= limit
+	})
+	if scanner, scanInput, ok := BackfillFallbackScan(api, input, err); ok {
+		// The scan reads every item before any can be ordered, so the size budget doesn't apply.
+		log.Printf("Index %s is backfilling, scanning the table instead", indexLabel(input))
+		stats = QueryStats{}
+		items, err = ScanAll(ctx, scanner, scanInput, &stats)
+		pages = stats.Pages
+	}
+	stats.Elapsed = Now().Sub(start)
+	err = queryTimeoutError(ctx, err)
+	if errors.Is(err, ErrQueryTimeout) {
+		stats.TimedOut = true
+	} else if err != nil {
+		return nil, stats, err
 	}
-	items = append(items, output.Items...)
 
-	// DynamoDB paginates the results returned. If the queried data spans multiple
-	// pages, the handler will send multiple requests.
-	if !single {
-		items = getMoreData(client, input, output.LastEvaluatedKey, items)
+	orderItems(input, items)
+	if limit > 0 && len(items) > limit {
+		items = items[:limit]
+	}
+
+	EmitMetrics(
+		ctx,
+		map[string]string{"IndexName": indexLabel(input)},
+		Metric{Name: "ItemsReturned", Unit: "Count", Value: float64(len(items))},
+		Metric{Name: "PagesScanned", Unit: "Count", Value: float64(pages)},
+	)
+	return items, stats, err
+}
+
+// serializedSize returns the number of bytes the item takes in a JSON array of items,
+// in the plain JSON form responses encode it in.
+func serializedSize(item map[string]types.AttributeValue) int {
+	encoded, err := json.Marshal(AttributeValuesToJSON(item))
+	if err != nil {
+		return 0
 	}
-	return items
+	return len(encoded) + 1
 }
 
-func getMoreData(
-	client *dynamodb.Client,
+// itemKey returns the key that resumes the query after the item, made up of the table's key
+// attributes, along with the index's when the query is served by one.
+func itemKey(
 	input *dynamodb.QueryInput,
-	lastKey map[string]types.AttributeValue,
+	item map[string]types.AttributeValue,
+) map[string]types.AttributeValue {
+	names := []string{"ProjectId#DeviceId", SortKeyAttribute(), input.ExpressionAttributeNames["#primaryName"]}
+	if input.IndexName != nil && *input.IndexName == constants.SEQUENCE_INDEX {
+		names = append(names, "SequenceNum")
+	}
+	key := make(map[string]types.AttributeValue, len(names))
+	for _, name := range names {
+		if value, ok := item[name]; ok {
+			key[name] = value
+		}
+	}
+	return key
+}
+
+// orderItems puts the items of a query in their final order. Readings that share an EpochTime
+// come back in no particular order, so ties are broken by SequenceNum before the query's direction
+// is applied. Queries on the sequence index are already in SequenceNum order, and are left alone.
+func orderItems(input *dynamodb.QueryInput, items []map[string]types.AttributeValue) {
+	if input.IndexName != nil && *input.IndexName == constants.SEQUENCE_INDEX {
+		return
+	}
+	StableSortReadings(items)
+	if input.ScanIndexForward != nil && !*input.ScanIndexForward {
+		reverseItems(items)
+	}
+}
+
+func indexLabel(input *dynamodb.QueryInput) string {
+	if input.IndexName != nil {
+		return *input.IndexName
+	}
+	return constants.TABLE_NAME
+}
+
+// GetSuccessResponse encodes the items of a query as a JSON array. For single item queries,
+// the item is encoded on its own as an object instead, or as an empty object when there is none.
+func GetSuccessResponse(
 	items []map[string]types.AttributeValue,
-) []map[string]types.AttributeValue {
-	var output *dynamodb.QueryOutput
-	var err error
-	for lastKey != nil {
-		input.ExclusiveStartKey = lastKey
-		output, err = QueryTable(context.TODO(), client, input)
-		if err != nil {
-			log.Fatalf("Failed to query table, %v", err)
+	single bool,
+) (events.APIGatewayProxyResponse, error) {
+	if single {
+		if len(items) == 0 {
+			return JSONResponse(map[string]types.AttributeValue{})
 		}
-		lastKey = output.LastEvaluatedKey
-		items = append(items, output.Items...)
+		return JSONResponse(items[0])
+	}
+	// An empty result is an empty array, not null.
+	if items == nil {
+		items = []map[string]types.AttributeValue{}
 	}
-	return items
+	return JSONResponse(items)
 }
 
-func GetSuccessResponse(items []map[string]types.AttributeValue) (events.APIGatewayProxyResponse, error) {
-	json, err := json.Marshal(items)
+// JSONResponse encodes any result as the body of a successful GET response.
+func JSONResponse(result interface{}) (events.APIGatewayProxyResponse, error) {
+	// Keys are always sorted, so identical results produce byte-for-byte identical bodies.
+	json, err := CanonicalJSON(result)
 	if err != nil {
 		log.Fatalf("Could not encode results")
 	}
@@ -252,38 +552,168 @@ func GetSuccessResponse(items []map[string]types.AttributeValue) (events.APIGate
 	return events.APIGatewayProxyResponse{
 		Body: string(json),
 		// The lambda handler includes necessary CORS headers in the API Gateway response
-		Headers: map[string]string{
-			"Access-Control-Allow-Headers": "Content-Type,X-Amz-Date,Authorization," +
-				"X-Api-Key,X-Amz-Security-Token,authorization-token",
-			"Access-Control-Allow-Origin":  "*",
-			"Access-Control-Allow-Methods": "OPTIONS,POST,GET",
-		},
+		Headers:    BaseHeaders(),
 		StatusCode: 200,
 	}, nil
 }
 
-func PostSuccessResponse() (events.APIGatewayProxyResponse, error) {
+// PostSuccessResponse reports that the reading with the key was written, with a Location header
+// pointing at it. The status is 201 Created, with the key echoed in the body, only when
+// CreatedStatusOnPost is set.
+func PostSuccessResponse(key ReadingKey) (events.APIGatewayProxyResponse, error) {
+	headers := BaseHeaders()
+	headers["Location"] = key.Location()
+	if !CreatedStatusOnPost() {
+		return events.APIGatewayProxyResponse{
+			Body:       "Success! Item added",
+			Headers:    headers,
+			StatusCode: 200,
+		}, nil
+	}
+
+	json, err := json.Marshal(key)
+	if err != nil {
+		log.Fatalf("Could not encode key")
+	}
+	headers["Content-Type"] = "application/json"
 	return events.APIGatewayProxyResponse{
-		Body: "Success! Item added",
-		Headers: map[string]string{
-			"Access-Control-Allow-Headers": "Content-Type,X-Amz-Date,Authorization," +
-				"X-Api-Key,X-Amz-Security-Token,authorization-token",
-			"Access-Control-Allow-Origin":  "*",
-			"Access-Control-Allow-Methods": "OPTIONS,POST,GET",
-		},
+		Body:       string(json),
+		Headers:    headers,
+		StatusCode: 201,
+	}, nil
+}
+
+func UpdateSuccessResponse() (events.APIGatewayProxyResponse, error) {
+	return events.APIGatewayProxyResponse{
+		Body:       "Success! Item updated",
+		Headers:    BaseHeaders(),
+		StatusCode: 200,
+	}, nil
+}
+
+func DeleteSuccessResponse() (events.APIGatewayProxyResponse, error) {
+	return events.APIGatewayProxyResponse{
+		Body:       "Success! Item deleted",
+		Headers:    BaseHeaders(),
 		StatusCode: 200,
 	}, nil
 }
 
+// ErrorBody is the JSON body of every error response.
+type ErrorBody struct {
+	Error ErrorDetail `json:"error"`
+}
+
+// ErrorDetail gives a machine-readable code and a human-readable message for an error,
+// along with the individual violations when a reading breaks several rules.
+type ErrorDetail struct {
+	Code       string   `json:"code"`
+	Message    string   `json:"message"`
+	Violations []string `json:"violations,omitempty"`
+}
+
+// ErrorResponse builds an error response with a JSON body like
+// {"error":{"code":"METHOD_NOT_ALLOWED","message":"Method not supported"}}.
+func ErrorResponse(status int, code string, message string) (events.APIGatewayProxyResponse, error) {
+	return errorDetailResponse(status, ErrorDetail{Code: code, Message: message})
+}
+
+func errorDetailResponse(status int, detail ErrorDetail) (events.APIGatewayProxyResponse, error) {
+	json, err := json.Marshal(ErrorBody{Error: detail})
+	if err != nil {
+		log.Fatalf("Could not encode error")
+	}
+	headers := BaseHeaders()
+	headers["Content-Type"] = "application/json"
+
+	return events.APIGatewayProxyResponse{
+		Body:       string(json),
+		Headers:    headers,
+		StatusCode: status,
+	}, nil
+}
+
 func MethodNotAllowedResponse() (events.APIGatewayProxyResponse, error) {
+	return ErrorResponse(405, "METHOD_NOT_ALLOWED", "Method not supported")
+}
+
+func ForbiddenResponse(message string) (events.APIGatewayProxyResponse, error) {
+	return ErrorResponse(403, "FORBIDDEN", message)
+}
+
+func NotFoundResponse(message string) (events.APIGatewayProxyResponse, error) {
+	return ErrorResponse(404, "NOT_FOUND", message)
+}
+
+func ConflictResponse(message string) (events.APIGatewayProxyResponse, error) {
+	return ErrorResponse(409, "CONFLICT", message)
+}
+
+func PayloadTooLargeResponse(message string) (events.APIGatewayProxyResponse, error) {
+	return ErrorResponse(413, "PAYLOAD_TOO_LARGE", message)
+}
+
+func NotAcceptableResponse(message string) (events.APIGatewayProxyResponse, error) {
+	return ErrorResponse(406, "NOT_ACCEPTABLE", message)
+}
+
+func UnsupportedMediaTypeResponse(message string) (events.APIGatewayProxyResponse, error) {
+	return ErrorResponse(415, "UNSUPPORTED_MEDIA_TYPE", message)
+}
+
+// UnprocessableEntityResponse rejects a well-formed reading that breaks semantic rules,
+// listing each of the violations.
+func UnprocessableEntityResponse(message string, violations []string) (events.APIGatewayProxyResponse, error) {
+	return errorDetailResponse(422, ErrorDetail{
+		Code:       "UNPROCESSABLE_ENTITY",
+		Message:    message,
+		Violations: violations,
+	})
+}
+
+func BadRequestResponse(message string) (events.APIGatewayProxyResponse, error) {
+	return ErrorResponse(400, "BAD_REQUEST", message)
+}
+
+func TooManyRequestsResponse(message string, retryAfter int) (events.APIGatewayProxyResponse, error) {
+	return retryAfterResponse(429, "TOO_MANY_REQUESTS", message, retryAfter)
+}
+
+func InsufficientStorageResponse(message string) (events.APIGatewayProxyResponse, error) {
+	return ErrorResponse(507, "ITEM_COLLECTION_FULL", message)
+}
+
+func ServiceUnavailableResponse(message string, retryAfter int) (events.APIGatewayProxyResponse, error) {
+	return retryAfterResponse(503, "SERVICE_UNAVAILABLE", message, retryAfter)
+}
+
+func GatewayTimeoutResponse(message string) (events.APIGatewayProxyResponse, error) {
+	return ErrorResponse(504, "QUERY_TIMEOUT", message)
+}
+
+func InternalErrorResponse(message string) (events.APIGatewayProxyResponse, error) {
+	return ErrorResponse(500, "INTERNAL_ERROR", message)
+}
+
+func NDJSONResponse(body string) (events.APIGatewayProxyResponse, error) {
+	headers := BaseHeaders()
+	headers["Content-Type"] = "application/x-ndjson"
+
 	return events.APIGatewayProxyResponse{
-		Body: "Method not supported",
-		Headers: map[string]string{
-			"Access-Control-Allow-Headers": "Content-Type,X-Amz-Date,Authorization," +
-				"X-Api-Key,X-Amz-Security-Token,authorization-token",
-			"Access-Control-Allow-Origin":  "*",
-			"Access-Control-Allow-Methods": "OPTIONS,POST,GET",
-		},
-		StatusCode: 405,
+		Body:       body,
+		Headers:    headers,
+		StatusCode: 200,
+	}, nil
+}
+
+func CSVResponse(body string, filename string) (events.APIGatewayProxyResponse, error) {
+	headers := BaseHeaders()
+	headers["Content-Type"] = "text/csv"
+	headers["Content-Disposition"] = fmt.Sprintf("attachment; filename=%q", filename)
+
+	return events.APIGatewayProxyResponse{
+		Body:       body,
+		Headers:    headers,
+		StatusCode: 200,
 	}, nil
 }
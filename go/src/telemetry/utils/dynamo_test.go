@@ -0,0 +1,613 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go/aws"
+
+	"telemetry/constants"
+	"telemetry/utils/dynamotest"
+)
+
+func TestMapToAttributeValues(t *testing.T) {
+	tests := []struct {
+		name  string
+		value map[string]interface{}
+		want  map[string]types.AttributeValue
+	}{
+		{
+			name: "scalars",
+			value: map[string]interface{}{
+				"DeviceId": "d1", "Temperature": 21.5, "Charging": true, "Error": nil,
+			},
+			want: map[string]types.AttributeValue{
+				"DeviceId":    stringAttr("d1"),
+				"Temperature": numberAttr("21.500000"),
+				"Charging":    &types.AttributeValueMemberBOOL{Value: true},
+				"Error":       &types.AttributeValueMemberNULL{Value: true},
+			},
+		},
+		{
+			name:  "non-finite numbers stored as null",
+			value: map[string]interface{}{"Temperature": math.NaN()},
+			want: map[string]types.AttributeValue{
+				"Temperature": &types.AttributeValueMemberNULL{Value: true},
+			},
+		},
+		{
+			name: "nested",
+			value: map[string]interface{}{
+				"Config":  map[string]interface{}{"gain": 2.0},
+				"Samples": []interface{}{"a", 1.0},
+			},
+			want: map[string]types.AttributeValue{
+				"Config": &types.AttributeValueMemberM{Value: map[string]types.AttributeValue{
+					"gain": numberAttr("2.000000"),
+				}},
+				"Samples": &types.AttributeValueMemberL{Value: []types.AttributeValue{
+					stringAttr("a"), numberAttr("1.000000"),
+				}},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := MapToAttributeValues(test.value); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("MapToAttributeValues() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestAttributeValuesToMap(t *testing.T) {
+	item := map[string]types.AttributeValue{
+		"DeviceId":    stringAttr("d1"),
+		"Temperature": numberAttr("21.5"),
+		"Charging":    &types.AttributeValueMemberBOOL{Value: true},
+		"Tags":        &types.AttributeValueMemberSS{Value: []string{"a", "b"}},
+		"Readings":    &types.AttributeValueMemberNS{Value: []string{"1", "2.5"}},
+		"Config": &types.AttributeValueMemberM{Value: map[string]types.AttributeValue{
+			"Samples": &types.AttributeValueMemberL{Value: []types.AttributeValue{numberAttr("3")}},
+		}},
+		"Error": &types.AttributeValueMemberNULL{Value: true},
+	}
+	want := map[string]interface{}{
+		"DeviceId":    "d1",
+		"Temperature": 21.5,
+		"Charging":    true,
+		"Tags":        []string{"a", "b"},
+		"Readings":    []interface{}{1.0, 2.5},
+		"Config":      map[string]interface{}{"Samples": []interface{}{3.0}},
+		"Error":       nil,
+	}
+	if got := AttributeValuesToMap(item); !reflect.DeepEqual(got, want) {
+		t.Errorf("AttributeValuesToMap() = %v, want %v", got, want)
+	}
+}
+
+func TestAttributeValuesToJSON(t *testing.T) {
+	tests := []struct {
+		name string
+		item map[string]types.AttributeValue
+		want string
+	}{
+		{
+			name: "epoch milliseconds",
+			item: map[string]types.AttributeValue{"EpochTime": numberAttr("1609459200123")},
+			want: `{"EpochTime":1609459200123}`,
+		},
+		{
+			name: "exponent rewritten",
+			item: map[string]types.AttributeValue{"EpochTime": numberAttr("1.609459e+09")},
+			want: `{"EpochTime":1609459000}`,
+		},
+		{
+			name: "precision kept",
+			item: map[string]types.AttributeValue{"Counter": numberAttr("12345678901234567890.5")},
+			want: `{"Counter":12345678901234567890.5}`,
+		},
+		{
+			name: "nested numbers",
+			item: map[string]types.AttributeValue{
+				"Samples":  &types.AttributeValueMemberL{Value: []types.AttributeValue{numberAttr("1E3")}},
+				"Readings": &types.AttributeValueMemberNS{Value: []string{"2.5"}},
+			},
+			want: `{"Readings":[2.5],"Samples":[1000]}`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			encoded, err := json.Marshal(AttributeValuesToJSON(test.item))
+			if err != nil {
+				t.Fatalf("json.Marshal() error = %v", err)
+			}
+			if string(encoded) != test.want {
+				t.Errorf("AttributeValuesToJSON() encoded as %s, want %s", encoded, test.want)
+			}
+		})
+	}
+}
+
+func TestPaginateQuery(t *testing.T) {
+	const page = `{"Count": 1, "Items": [{"EpochTime": {"N": "1"}}],
+		"LastEvaluatedKey": {"ProjectId#DeviceId": {"S": "sensors#d1"}, "EpochTime": {"N": "1"}}}`
+	const lastPage = `{"Count": 1, "Items": [{"EpochTime": {"N": "2"}}]}`
+	tests := []struct {
+		name      string
+		responses []string
+		fail      bool
+		doneAfter int
+		wantPages int
+		wantErr   bool
+	}{
+		{name: "one page", responses: []string{lastPage}, wantPages: 1},
+		{name: "every page", responses: []string{page, page, lastPage}, wantPages: 3},
+		{name: "done early", responses: []string{page, page, lastPage}, doneAfter: 2, wantPages: 2},
+		{name: "failed page", responses: []string{page}, fail: true, wantPages: 1, wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := dynamotest.NewServer(t)
+			for _, response := range test.responses {
+				server.Respond("Query", response)
+			}
+			if test.fail {
+				server.Fail("Query", "InternalServerError")
+			}
+
+			calls := 0
+			pages, err := PaginateQuery(context.Background(), server.Client(), CreateQueryInput("ProjectId", "sensors"),
+				func(output *dynamodb.QueryOutput) bool {
+					calls++
+					return calls == test.doneAfter
+				})
+			if (err != nil) != test.wantErr {
+				t.Fatalf("PaginateQuery() error = %v, wantErr %v", err, test.wantErr)
+			}
+			if pages != test.wantPages {
+				t.Errorf("PaginateQuery() = %d pages, want %d", pages, test.wantPages)
+			}
+			queries := server.Calls("Query")
+			for i, query := range queries {
+				if _, ok := query.Input["ExclusiveStartKey"]; ok != (i > 0) {
+					t.Errorf("query %d ExclusiveStartKey sent = %v, want %v", i, ok, i > 0)
+				}
+			}
+		})
+	}
+}
+
+func TestGetSuccessResponse(t *testing.T) {
+	tests := []struct {
+		name   string
+		items  []map[string]types.AttributeValue
+		single bool
+		want   string
+	}{
+		{name: "no items", want: `[]`},
+		{name: "items", items: readingsAt("1", "2"), want: `[{"EpochTime":{"Value":"1"}},{"EpochTime":{"Value":"2"}}]`},
+		{name: "single item", items: readingsAt("2"), single: true, want: `{"EpochTime":{"Value":"2"}}`},
+		{name: "single item of several", items: readingsAt("2", "1"), single: true, want: `{"EpochTime":{"Value":"2"}}`},
+		{name: "no single item", single: true, want: `{}`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			response, err := GetSuccessResponse(test.items, test.single)
+			if err != nil {
+				t.Fatalf("GetSuccessResponse() error = %v", err)
+			}
+			if response.StatusCode != 200 || response.Body != test.want {
+				t.Errorf("GetSuccessResponse() = %d %s, want 200 %s", response.StatusCode, response.Body, test.want)
+			}
+		})
+	}
+}
+
+func TestGetData(t *testing.T) {
+	// Readings sharing an EpochTime come back out of their generated order.
+	const items = `{"Count": 4, "ScannedCount": 4, "Items": [
+		{"EpochTime": {"N": "2"}, "SequenceNum": {"N": "2"}},
+		{"EpochTime": {"N": "1"}},
+		{"EpochTime": {"N": "2"}, "SequenceNum": {"N": "1"}},
+		{"EpochTime": {"N": "3"}}
+	]}`
+	tests := []struct {
+		name       string
+		descending bool
+		limit      int
+		want       []map[string]types.AttributeValue
+	}{
+		{
+			name: "ties broken by SequenceNum",
+			want: []map[string]types.AttributeValue{
+				{"EpochTime": numberAttr("1")},
+				{"EpochTime": numberAttr("2"), "SequenceNum": numberAttr("1")},
+				{"EpochTime": numberAttr("2"), "SequenceNum": numberAttr("2")},
+				{"EpochTime": numberAttr("3")},
+			},
+		},
+		{
+			name:       "descending",
+			descending: true,
+			want: []map[string]types.AttributeValue{
+				{"EpochTime": numberAttr("3")},
+				{"EpochTime": numberAttr("2"), "SequenceNum": numberAttr("2")},
+				{"EpochTime": numberAttr("2"), "SequenceNum": numberAttr("1")},
+				{"EpochTime": numberAttr("1")},
+			},
+		},
+		{
+			name:  "limited after ordering",
+			limit: 2,
+			want: []map[string]types.AttributeValue{
+				{"EpochTime": numberAttr("1")},
+				{"EpochTime": numberAttr("2"), "SequenceNum": numberAttr("1")},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			captureMetrics(t)
+			server := dynamotest.NewServer(t)
+			server.Respond("Query", items)
+			input := CreateQueryInput("ProjectId#DeviceId", "sensors#d1")
+			input.ScanIndexForward = aws.Bool(!test.descending)
+
+			got, err := GetData(context.Background(), server.Client(), input, test.limit)
+			if err != nil {
+				t.Fatalf("GetData() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("GetData() = %v, want %v", epochTimes(got), epochTimes(test.want))
+			}
+		})
+	}
+}
+
+func TestOrderItems(t *testing.T) {
+	tests := []struct {
+		name    string
+		index   string
+		forward bool
+		want    []string
+	}{
+		{name: "ascending", forward: true, want: []string{"1", "2", "3"}},
+		{name: "descending", want: []string{"3", "2", "1"}},
+		{name: "sequence index left in order", index: constants.SEQUENCE_INDEX, want: []string{"2", "3", "1"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			input := CreateQueryInput("ProjectId#DeviceId", "sensors#d1")
+			input.ScanIndexForward = aws.Bool(test.forward)
+			if test.index != "" {
+				input.IndexName = aws.String(test.index)
+			}
+			items := readingsAt("2", "3", "1")
+			orderItems(input, items)
+			if got := epochTimes(items); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("orderItems() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestGetDataWithStats(t *testing.T) {
+	const page = `{"Count": 1, "ScannedCount": 5, "Items": [{"EpochTime": {"N": "1"}}],
+		"ConsumedCapacity": {"CapacityUnits": 1.5},
+		"LastEvaluatedKey": {"ProjectId#DeviceId": {"S": "sensors#d1"}, "EpochTime": {"N": "1"}}}`
+	const lastPage = `{"Count": 0, "ScannedCount": 3, "Items": [], "ConsumedCapacity": {"CapacityUnits": 0.5}}`
+	tests := []struct {
+		name         string
+		responses    []string
+		limit        int
+		wantPages    int
+		wantScanned  int
+		wantCapacity float64
+	}{
+		{name: "one page", responses: []string{lastPage}, wantPages: 1, wantScanned: 3, wantCapacity: 0.5},
+		{
+			name:         "scanned across pages",
+			responses:    []string{page, page, lastPage},
+			wantPages:    3,
+			wantScanned:  13,
+			wantCapacity: 3.5,
+		},
+		{
+			name:         "stopped at the limit",
+			responses:    []string{page, page, lastPage},
+			limit:        1,
+			wantPages:    1,
+			wantScanned:  5,
+			wantCapacity: 1.5,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			captureMetrics(t)
+			server := dynamotest.NewServer(t)
+			for _, response := range test.responses {
+				server.Respond("Query", response)
+			}
+
+			_, stats, err := GetDataWithStats(context.Background(), server.Client(),
+				CreateQueryInput("ProjectId#DeviceId", "sensors#d1"), test.limit)
+			if err != nil {
+				t.Fatalf("GetDataWithStats() error = %v", err)
+			}
+			if stats.Pages != test.wantPages || stats.ScannedCount != test.wantScanned {
+				t.Errorf("GetDataWithStats() stats = %d pages, %d scanned, want %d, %d",
+					stats.Pages, stats.ScannedCount, test.wantPages, test.wantScanned)
+			}
+			if stats.ConsumedCapacity != test.wantCapacity {
+				t.Errorf("ConsumedCapacity = %v, want %v", stats.ConsumedCapacity, test.wantCapacity)
+			}
+		})
+	}
+}
+
+func TestGetDataWithinBudget(t *testing.T) {
+	const page = `{"Count": 3, "Items": [
+		{"ProjectId#DeviceId": {"S": "sensors#d1"}, "EpochTime": {"N": "1"}, "Note": {"S": "aaaa"}},
+		{"ProjectId#DeviceId": {"S": "sensors#d1"}, "EpochTime": {"N": "2"}, "Note": {"S": "bbbb"}},
+		{"ProjectId#DeviceId": {"S": "sensors#d1"}, "EpochTime": {"N": "3"}, "Note": {"S": "cccc"}}
+	]}`
+	itemSize := serializedSize(map[string]types.AttributeValue{
+		"ProjectId#DeviceId": stringAttr("sensors#d1"), "EpochTime": numberAttr("1"), "Note": stringAttr("aaaa"),
+	})
+	tests := []struct {
+		name          string
+		limit         int
+		budget        int
+		wantTimes     []string
+		wantTruncated bool
+	}{
+		{name: "no budget", wantTimes: []string{"1", "2", "3"}},
+		{name: "within the budget", budget: 3 * itemSize, wantTimes: []string{"1", "2", "3"}},
+		{name: "over the budget", budget: 2 * itemSize, wantTimes: []string{"1", "2"}, wantTruncated: true},
+		{name: "at least one item", budget: 1, wantTimes: []string{"1"}, wantTruncated: true},
+		{name: "limit within the budget", limit: 2, budget: 2 * itemSize, wantTimes: []string{"1", "2"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			captureMetrics(t)
+			server := dynamotest.NewServer(t)
+			server.Respond("Query", page)
+
+			items, stats, err := GetDataWithinBudget(context.Background(), server.Client(),
+				CreateQueryInput("ProjectId#DeviceId", "sensors#d1"), test.limit, test.budget)
+			if err != nil {
+				t.Fatalf("GetDataWithinBudget() error = %v", err)
+			}
+			if got := epochTimes(items); !reflect.DeepEqual(got, test.wantTimes) {
+				t.Errorf("GetDataWithinBudget() = %v, want %v", got, test.wantTimes)
+			}
+			if stats.TruncatedBySize != test.wantTruncated {
+				t.Errorf("TruncatedBySize = %v, want %v", stats.TruncatedBySize, test.wantTruncated)
+			}
+			if !test.wantTruncated {
+				return
+			}
+			last := test.wantTimes[len(test.wantTimes)-1]
+			wantKey := map[string]types.AttributeValue{
+				"ProjectId#DeviceId": stringAttr("sensors#d1"), "EpochTime": numberAttr(last),
+			}
+			if !reflect.DeepEqual(stats.ResumeKey, wantKey) {
+				t.Errorf("ResumeKey = %v, want %v", stats.ResumeKey, wantKey)
+			}
+		})
+	}
+}
+
+func TestResumeKey(t *testing.T) {
+	item := map[string]types.AttributeValue{
+		"ProjectId#DeviceId":   stringAttr("sensors#d1"),
+		"ProjectId#LocationId": stringAttr("sensors#roof"),
+		"EpochTime":            numberAttr("1"),
+		"SequenceNum":          numberAttr("7"),
+		"Temperature":          numberAttr("20"),
+	}
+	tests := []struct {
+		name  string
+		input *dynamodb.QueryInput
+		want  []string
+	}{
+		{
+			name:  "base table",
+			input: CreateQueryInput("ProjectId#DeviceId", "sensors#d1"),
+			want:  []string{"EpochTime", "ProjectId#DeviceId"},
+		},
+		{
+			name:  "location index",
+			input: CreateIndexQueryInput(constants.LOCATION_INDEX, "ProjectId#LocationId", "sensors#roof"),
+			want:  []string{"EpochTime", "ProjectId#DeviceId", "ProjectId#LocationId"},
+		},
+		{
+			name:  "sequence index",
+			input: CreateIndexQueryInput(constants.SEQUENCE_INDEX, "ProjectId#DeviceId", "sensors#d1"),
+			want:  []string{"EpochTime", "ProjectId#DeviceId", "SequenceNum"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var got []string
+			for name := range itemKey(test.input, item) {
+				got = append(got, name)
+			}
+			sort.Strings(got)
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("itemKey() attributes = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestResponseSizeBudget(t *testing.T) {
+	if got := ResponseSizeBudget(); got != constants.RESPONSE_SIZE_BUDGET {
+		t.Errorf("ResponseSizeBudget() = %d, want %d by default", got, constants.RESPONSE_SIZE_BUDGET)
+	}
+	t.Setenv("RESPONSE_SIZE_BUDGET_BYTES", "1024")
+	if got := ResponseSizeBudget(); got != 1024 {
+		t.Errorf("ResponseSizeBudget() = %d, want 1024", got)
+	}
+}
+
+func TestQueryStatsDebug(t *testing.T) {
+	stats := QueryStats{Pages: 2, ConsumedCapacity: 2.5, Elapsed: 1500 * time.Millisecond}
+	want := &DebugInfo{ConsumedCapacity: 2.5, ElapsedMs: 1500}
+	if got := stats.Debug(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Debug() = %+v, want %+v", got, want)
+	}
+}
+
+func TestIsItemCollectionFull(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "no error"},
+		{name: "other error", err: errors.New("throttled")},
+		{name: "collection full", err: &types.ItemCollectionSizeLimitExceededException{}, want: true},
+		{
+			name: "wrapped",
+			err:  fmt.Errorf("put failed: %w", &types.ItemCollectionSizeLimitExceededException{}),
+			want: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := IsItemCollectionFull(test.err); got != test.want {
+				t.Errorf("IsItemCollectionFull() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestErrorResponse(t *testing.T) {
+	tests := []struct {
+		name       string
+		respond    func() (events.APIGatewayProxyResponse, error)
+		wantStatus int
+		want       ErrorDetail
+	}{
+		{
+			name:       "method not allowed",
+			respond:    MethodNotAllowedResponse,
+			wantStatus: 405,
+			want:       ErrorDetail{Code: "METHOD_NOT_ALLOWED", Message: "Method not supported"},
+		},
+		{
+			name:       "forbidden",
+			respond:    func() (events.APIGatewayProxyResponse, error) { return ForbiddenResponse("no") },
+			wantStatus: 403,
+			want:       ErrorDetail{Code: "FORBIDDEN", Message: "no"},
+		},
+		{
+			name:       "bad request",
+			respond:    func() (events.APIGatewayProxyResponse, error) { return BadRequestResponse("bad") },
+			wantStatus: 400,
+			want:       ErrorDetail{Code: "BAD_REQUEST", Message: "bad"},
+		},
+		{
+			name:       "not found",
+			respond:    func() (events.APIGatewayProxyResponse, error) { return NotFoundResponse("gone") },
+			wantStatus: 404,
+			want:       ErrorDetail{Code: "NOT_FOUND", Message: "gone"},
+		},
+		{
+			name:       "unsupported media type",
+			respond:    func() (events.APIGatewayProxyResponse, error) { return UnsupportedMediaTypeResponse("json only") },
+			wantStatus: 415,
+			want:       ErrorDetail{Code: "UNSUPPORTED_MEDIA_TYPE", Message: "json only"},
+		},
+		{
+			name:       "internal error",
+			respond:    func() (events.APIGatewayProxyResponse, error) { return InternalErrorResponse("oops") },
+			wantStatus: 500,
+			want:       ErrorDetail{Code: "INTERNAL_ERROR", Message: "oops"},
+		},
+		{
+			name:       "custom code",
+			respond:    func() (events.APIGatewayProxyResponse, error) { return ErrorResponse(418, "TEAPOT", "short") },
+			wantStatus: 418,
+			want:       ErrorDetail{Code: "TEAPOT", Message: "short"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			response, err := test.respond()
+			if err != nil {
+				t.Fatalf("response error = %v", err)
+			}
+			if response.StatusCode != test.wantStatus {
+				t.Errorf("status = %d, want %d", response.StatusCode, test.wantStatus)
+			}
+			if contentType := response.Headers["Content-Type"]; contentType != "application/json" {
+				t.Errorf("Content-Type = %q, want application/json", contentType)
+			}
+			var body ErrorBody
+			if err := json.Unmarshal([]byte(response.Body), &body); err != nil {
+				t.Fatalf("body %s is not JSON: %v", response.Body, err)
+			}
+			if !reflect.DeepEqual(body.Error, test.want) {
+				t.Errorf("error = %+v, want %+v", body.Error, test.want)
+			}
+		})
+	}
+}
+
+func BenchmarkMapToAttributeValues(b *testing.B) {
+	// A reading shaped like a typical device's, with scalar fields and a nested status object.
+	reading := map[string]interface{}{
+		"ProjectId":  "sensors",
+		"DeviceId":   "d1",
+		"LocationId": "roof",
+		"EpochTime":  1600000000.0,
+		"Charging":   true,
+		"Status": map[string]interface{}{
+			"Firmware": "1.2.3",
+			"Uptime":   86400.0,
+			"Errors":   []interface{}{"E1", "E2"},
+		},
+	}
+	for i := 0; i < 20; i++ {
+		reading["Field"+strconv.Itoa(i)] = float64(i) + 0.5
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		MapToAttributeValues(reading)
+	}
+}
+
+func TestSortKeyAttribute(t *testing.T) {
+	tests := []struct {
+		name    string
+		sortKey string
+		want    string
+	}{
+		{name: "default", want: "EpochTime"},
+		{name: "configured", sortKey: "Offset", want: "Offset"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Setenv("SORT_KEY_ATTR", test.sortKey)
+			if got := SortKeyAttribute(); got != test.want {
+				t.Errorf("SortKeyAttribute() = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
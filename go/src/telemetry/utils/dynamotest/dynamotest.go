@@ -0,0 +1,125 @@
+// Package dynamotest serves a scripted stand-in for the DynamoDB API over HTTP,
+// so that handlers using the shared client can be tested without a table.
+// Each operation answers with the responses queued for it, in order, and with an empty
+// response once they run out. Every request is recorded for the test to inspect.
+package dynamotest
+
+import (
+	"encoding/json"
+	"hash/crc32"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+)
+
+// Call is one request the server received.
+type Call struct {
+	// Operation is the DynamoDB operation, such as "Query" or "PutItem".
+	Operation string
+	// Input is the request's JSON body, decoded.
+	Input map[string]interface{}
+}
+
+// response is a queued answer to an operation.
+type response struct {
+	status int
+	body   string
+}
+
+// Server is a scripted DynamoDB endpoint.
+type Server struct {
+	server *httptest.Server
+
+	mutex     sync.Mutex
+	calls     []Call
+	responses map[string][]response
+}
+
+// NewServer starts a server, which is closed when the test finishes.
+func NewServer(t testing.TB) *Server {
+	s := &Server{responses: make(map[string][]response)}
+	s.server = httptest.NewServer(http.HandlerFunc(s.serve))
+	t.Cleanup(s.server.Close)
+	return s
+}
+
+// Client returns a DynamoDB client that sends its requests to the server, without retries.
+func (s *Server) Client() *dynamodb.Client {
+	return dynamodb.New(dynamodb.Options{
+		Region:           "us-east-1",
+		Credentials:      credentials.NewStaticCredentialsProvider("test", "test", ""),
+		EndpointResolver: dynamodb.EndpointResolverFromURL(s.server.URL),
+		Retryer:          aws.NopRetryer{},
+	})
+}
+
+// Respond queues a successful response to the operation, as the JSON body of its output.
+func (s *Server) Respond(operation string, body string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.responses[operation] = append(s.responses[operation], response{status: http.StatusOK, body: body})
+}
+
+// Fail queues an error response to the operation, of the named DynamoDB error type,
+// such as "ConditionalCheckFailedException".
+func (s *Server) Fail(operation string, errorType string) {
+	s.FailWithMessage(operation, errorType, errorType)
+}
+
+// FailWithMessage queues an error response to the operation, like Fail, with the given message.
+func (s *Server) FailWithMessage(operation string, errorType string, message string) {
+	status := http.StatusBadRequest
+	if errorType == "InternalServerError" {
+		status = http.StatusInternalServerError
+	}
+	body, _ := json.Marshal(map[string]string{
+		"__type":  "com.amazonaws.dynamodb.v20120810#" + errorType,
+		"message": message,
+	})
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.responses[operation] = append(s.responses[operation], response{status: status, body: string(body)})
+}
+
+// Calls returns the requests received for the operation, or every request when it is empty.
+func (s *Server) Calls(operation string) []Call {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	var calls []Call
+	for _, call := range s.calls {
+		if operation == "" || call.Operation == operation {
+			calls = append(calls, call)
+		}
+	}
+	return calls
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	target := r.Header.Get("X-Amz-Target")
+	operation := target[strings.LastIndex(target, ".")+1:]
+	body, _ := io.ReadAll(r.Body)
+	var input map[string]interface{}
+	json.Unmarshal(body, &input)
+
+	s.mutex.Lock()
+	s.calls = append(s.calls, Call{Operation: operation, Input: input})
+	answer := response{status: http.StatusOK, body: "{}"}
+	if queued := s.responses[operation]; len(queued) > 0 {
+		answer, s.responses[operation] = queued[0], queued[1:]
+	}
+	s.mutex.Unlock()
+
+	w.Header().Set("Content-Type", "application/x-amz-json-1.0")
+	// The client checks the body against its CRC32, as DynamoDB sends it.
+	w.Header().Set("X-Amz-Crc32", strconv.FormatUint(uint64(crc32.ChecksumIEEE([]byte(answer.body))), 10))
+	w.WriteHeader(answer.status)
+	io.WriteString(w, answer.body)
+}
@@ -0,0 +1,24 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+// CanonicalJSON encodes v so that logically equal values always produce identical bytes.
+// The value is round-tripped through generic maps, which encoding/json writes with sorted keys,
+// and numbers are kept as their original literals rather than reformatted as floats.
+func CanonicalJSON(v interface{}) ([]byte, error) {
+	encoded, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(encoded))
+	decoder.UseNumber()
+	var generic interface{}
+	if err := decoder.Decode(&generic); err != nil {
+		return nil, err
+	}
+	return json.Marshal(generic)
+}
@@ -0,0 +1,56 @@
+package utils
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestCanonicalJSON(t *testing.T) {
+	type reading struct {
+		Temperature json.Number
+		DeviceId    string
+	}
+	tests := []struct {
+		name    string
+		value   interface{}
+		want    string
+		wantErr bool
+	}{
+		{
+			name:  "map keys sorted",
+			value: map[string]interface{}{"b": 1, "a": map[string]interface{}{"d": 2, "c": 3}},
+			want:  `{"a":{"c":3,"d":2},"b":1}`,
+		},
+		{
+			name:  "struct fields sorted",
+			value: reading{Temperature: "21.50", DeviceId: "d1"},
+			want:  `{"DeviceId":"d1","Temperature":21.50}`,
+		},
+		{
+			name:  "large integers kept exact",
+			value: map[string]interface{}{"Id": json.Number("12345678901234567890")},
+			want:  `{"Id":12345678901234567890}`,
+		},
+		{
+			name:  "lists in order",
+			value: []interface{}{map[string]int{"z": 1, "y": 2}, "x"},
+			want:  `[{"y":2,"z":1},"x"]`,
+		},
+		{
+			name:    "unencodable",
+			value:   map[string]interface{}{"f": func() {}},
+			wantErr: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := CanonicalJSON(test.value)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("CanonicalJSON() error = %v, wantErr %v", err, test.wantErr)
+			}
+			if !test.wantErr && string(got) != test.want {
+				t.Errorf("CanonicalJSON() = %s, want %s", got, test.want)
+			}
+		})
+	}
+}
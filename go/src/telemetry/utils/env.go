@@ -0,0 +1,37 @@
+package utils
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"strconv"
+)
+
+// envInt reads an integer from the named environment variable,
+// falling back to the default when it is unset or malformed.
+func envInt(name string, fallback int) int {
+	value, ok := os.LookupEnv(name)
+	if !ok || value == "" {
+		return fallback
+	}
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		log.Printf("Ignoring invalid %s value %q, %v", name, value, err)
+		return fallback
+	}
+	return parsed
+}
+
+// envJSON decodes the JSON document in the named environment variable into target,
+// reporting whether the variable was set and valid.
+func envJSON(name string, target interface{}) bool {
+	value, ok := os.LookupEnv(name)
+	if !ok || value == "" {
+		return false
+	}
+	if err := json.Unmarshal([]byte(value), target); err != nil {
+		log.Printf("Ignoring invalid %s value, %v", name, err)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,65 @@
+package utils
+
+import "testing"
+
+func TestEnvInt(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		set   bool
+		want  int
+	}{
+		{name: "unset", want: 7},
+		{name: "empty", value: "", set: true, want: 7},
+		{name: "valid", value: "42", set: true, want: 42},
+		{name: "negative", value: "-3", set: true, want: -3},
+		{name: "malformed", value: "forty", set: true, want: 7},
+		{name: "fractional", value: "1.5", set: true, want: 7},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if test.set {
+				t.Setenv("TEST_ENV_INT", test.value)
+			}
+			if got := envInt("TEST_ENV_INT", 7); got != test.want {
+				t.Errorf("envInt() = %d, want %d", got, test.want)
+			}
+		})
+	}
+}
+
+func TestEnvJSON(t *testing.T) {
+	tests := []struct {
+		name   string
+		value  string
+		set    bool
+		want   map[string]int
+		wantOk bool
+	}{
+		{name: "unset"},
+		{name: "empty", value: "", set: true},
+		{name: "valid", value: `{"a": 1, "b": 2}`, set: true, want: map[string]int{"a": 1, "b": 2}, wantOk: true},
+		{name: "malformed", value: `{"a": `, set: true},
+		{name: "wrong type", value: `["a"]`, set: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if test.set {
+				t.Setenv("TEST_ENV_JSON", test.value)
+			}
+			var got map[string]int
+			ok := envJSON("TEST_ENV_JSON", &got)
+			if ok != test.wantOk {
+				t.Fatalf("envJSON() = %v, want %v", ok, test.wantOk)
+			}
+			if len(got) != len(test.want) {
+				t.Fatalf("envJSON() decoded %v, want %v", got, test.want)
+			}
+			for key, value := range test.want {
+				if got[key] != value {
+					t.Errorf("envJSON() decoded %v, want %v", got, test.want)
+				}
+			}
+		})
+	}
+}
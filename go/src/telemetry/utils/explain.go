@@ -0,0 +1,59 @@
+package utils
+
+import (
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+)
+
+// hiddenTenant stands in for the tenant in an explained query, which the client didn't supply.
+const hiddenTenant = "{tenant}"
+
+// QueryExplanation describes the DynamoDB query built for a request, as returned when
+// 'explain=true', so that developers can see how the parameters were translated.
+type QueryExplanation struct {
+	TableName                 string                 `json:"tableName"`
+	IndexName                 string                 `json:"indexName,omitempty"`
+	KeyConditionExpression    string                 `json:"keyConditionExpression"`
+	FilterExpression          string                 `json:"filterExpression,omitempty"`
+	ExpressionAttributeNames  map[string]string      `json:"expressionAttributeNames"`
+	ExpressionAttributeValues map[string]interface{} `json:"expressionAttributeValues"`
+	Limit                     *int32                 `json:"limit,omitempty"`
+	ScanIndexForward          bool                   `json:"scanIndexForward"`
+	ConsistentRead            bool                   `json:"consistentRead"`
+}
+
+// ExplainQuery describes the query input. The tenant, which comes from the authorizer rather
+// than the client, is hidden wherever it appears in the expression attribute values.
+func ExplainQuery(input *dynamodb.QueryInput, tenant string) QueryExplanation {
+	explanation := QueryExplanation{
+		TableName:                 stringValue(input.TableName),
+		IndexName:                 stringValue(input.IndexName),
+		KeyConditionExpression:    stringValue(input.KeyConditionExpression),
+		FilterExpression:          stringValue(input.FilterExpression),
+		ExpressionAttributeNames:  input.ExpressionAttributeNames,
+		ExpressionAttributeValues: AttributeValuesToJSON(input.ExpressionAttributeValues),
+		Limit:                     input.Limit,
+		ScanIndexForward:          input.ScanIndexForward == nil || *input.ScanIndexForward,
+		ConsistentRead:            input.ConsistentRead != nil && *input.ConsistentRead,
+	}
+	if tenant != "" {
+		for name, value := range explanation.ExpressionAttributeValues {
+			if text, ok := value.(string); ok {
+				if text == tenant {
+					explanation.ExpressionAttributeValues[name] = hiddenTenant
+				} else if strings.HasPrefix(text, tenant+"#") {
+					explanation.ExpressionAttributeValues[name] = hiddenTenant + strings.TrimPrefix(text, tenant)
+				}
+			}
+		}
+	}
+	return explanation
+}
+
+func stringValue(value *string) string {
+	if value == nil {
+		return ""
+	}
+	return *value
+}
@@ -0,0 +1,68 @@
+package utils
+
+import (
+	"testing"
+
+	"telemetry/constants"
+)
+
+func TestExplainQuery(t *testing.T) {
+	tests := []struct {
+		name       string
+		params     QueryParams
+		tenant     string
+		wantIndex  string
+		wantKey    interface{}
+		wantLimit  bool
+		wantFilter bool
+	}{
+		{
+			name:       "device",
+			params:     QueryParams{ProjectId: "sensors", DeviceId: "d1", Single: true},
+			wantKey:    "sensors#d1",
+			wantLimit:  true,
+			wantFilter: true,
+		},
+		{
+			name:       "project index",
+			params:     QueryParams{ProjectId: "sensors"},
+			wantIndex:  constants.PROJECT_INDEX,
+			wantKey:    "sensors",
+			wantFilter: true,
+		},
+		{
+			name:       "tenant hidden",
+			params:     QueryParams{TenantId: "acme", ProjectId: "sensors", DeviceId: "d1"},
+			tenant:     "acme",
+			wantKey:    "{tenant}#sensors#d1",
+			wantFilter: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			input, err := BuildQueryInput(test.params)
+			if err != nil {
+				t.Fatalf("BuildQueryInput() error = %v", err)
+			}
+			got := ExplainQuery(input, test.tenant)
+			if got.TableName != constants.TABLE_NAME || got.IndexName != test.wantIndex {
+				t.Errorf("ExplainQuery() table = %q, index = %q, want %q, %q",
+					got.TableName, got.IndexName, constants.TABLE_NAME, test.wantIndex)
+			}
+			if key := got.ExpressionAttributeValues[":primaryValue"]; key != test.wantKey {
+				t.Errorf(":primaryValue = %v, want %v", key, test.wantKey)
+			}
+			if got.KeyConditionExpression == "" || (got.FilterExpression != "") != test.wantFilter {
+				t.Errorf("ExplainQuery() = %+v, want its expressions described", got)
+			}
+			if (got.Limit != nil) != test.wantLimit {
+				t.Errorf("Limit = %v, want a limit %v", got.Limit, test.wantLimit)
+			}
+			for _, value := range got.ExpressionAttributeValues {
+				if test.tenant != "" && value == test.tenant {
+					t.Errorf("ExpressionAttributeValues = %v, want the tenant hidden", got.ExpressionAttributeValues)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,65 @@
+package utils
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go/aws"
+)
+
+// addFilter combines a condition with any existing FilterExpression using AND.
+func addFilter(input *dynamodb.QueryInput, condition string) {
+	if input.FilterExpression == nil || *input.FilterExpression == "" {
+		input.FilterExpression = aws.String(condition)
+		return
+	}
+	input.FilterExpression = aws.String(fmt.Sprintf("(%s) AND (%s)", *input.FilterExpression, condition))
+}
+
+// ApplyExistsFilter keeps only items that have every one of the given attributes.
+// Attribute names are escaped through ExpressionAttributeNames, so any name is safe to use.
+func ApplyExistsFilter(input *dynamodb.QueryInput, fields []string) {
+	for i, field := range fields {
+		placeholder := fmt.Sprintf("#exists%d", i)
+		input.ExpressionAttributeNames[placeholder] = field
+		addFilter(input, fmt.Sprintf("attribute_exists(%s)", placeholder))
+	}
+}
+
+// Sentinel is a value a device reports for a field in place of a reading it failed to take,
+// such as -999 for a failed temperature sensor.
+type Sentinel struct {
+	Field string
+	Value string
+}
+
+// ParseSentinel parses a sentinel written as Field:Value, e.g. Temperature:-999.
+func ParseSentinel(value string) (Sentinel, error) {
+	separator := strings.Index(value, ":")
+	if separator <= 0 {
+		return Sentinel{}, fmt.Errorf("excludeSentinel must be Field:Value, got %q", value)
+	}
+	return Sentinel{Field: value[:separator], Value: value[separator+1:]}, nil
+}
+
+// ApplySentinelFilter leaves out items where any of the fields holds its sentinel value.
+// A sentinel that looks like a number is compared as one, and otherwise as a string.
+// Items without the field are kept. Attribute names and values are both escaped through
+// placeholders, so any field or sentinel is safe to use.
+func ApplySentinelFilter(input *dynamodb.QueryInput, sentinels []Sentinel) {
+	for i, sentinel := range sentinels {
+		name := fmt.Sprintf("#sentinel%d", i)
+		value := fmt.Sprintf(":sentinel%d", i)
+		input.ExpressionAttributeNames[name] = sentinel.Field
+		if number, err := strconv.ParseFloat(sentinel.Value, 64); err == nil && !math.IsNaN(number) && !math.IsInf(number, 0) {
+			input.ExpressionAttributeValues[value] = &types.AttributeValueMemberN{Value: sentinel.Value}
+		} else {
+			input.ExpressionAttributeValues[value] = &types.AttributeValueMemberS{Value: sentinel.Value}
+		}
+		addFilter(input, fmt.Sprintf("attribute_not_exists(%s) OR %s <> %s", name, name, value))
+	}
+}
@@ -0,0 +1,132 @@
+package utils
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go/aws"
+)
+
+func TestApplyExistsFilter(t *testing.T) {
+	tests := []struct {
+		name       string
+		filter     string
+		fields     []string
+		wantFilter string
+		wantNames  map[string]string
+	}{
+		{
+			name:      "no fields",
+			wantNames: map[string]string{"#primaryName": "ProjectId"},
+		},
+		{
+			name:       "several fields",
+			fields:     []string{"Temperature", "Battery Level"},
+			wantFilter: "(attribute_exists(#exists0)) AND (attribute_exists(#exists1))",
+			wantNames: map[string]string{
+				"#primaryName": "ProjectId",
+				"#exists0":     "Temperature",
+				"#exists1":     "Battery Level",
+			},
+		},
+		{
+			name:       "combined with an existing filter",
+			filter:     "#tenant = :tenant",
+			fields:     []string{"Temperature"},
+			wantFilter: "(#tenant = :tenant) AND (attribute_exists(#exists0))",
+			wantNames:  map[string]string{"#primaryName": "ProjectId", "#exists0": "Temperature"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			input := CreateQueryInput("ProjectId", "sensors")
+			if test.filter != "" {
+				input.FilterExpression = aws.String(test.filter)
+			}
+
+			ApplyExistsFilter(input, test.fields)
+			if filter := aws.StringValue(input.FilterExpression); filter != test.wantFilter {
+				t.Errorf("FilterExpression = %q, want %q", filter, test.wantFilter)
+			}
+			if !reflect.DeepEqual(input.ExpressionAttributeNames, test.wantNames) {
+				t.Errorf("ExpressionAttributeNames = %v, want %v", input.ExpressionAttributeNames, test.wantNames)
+			}
+		})
+	}
+}
+
+func TestParseSentinel(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    Sentinel
+		wantErr bool
+	}{
+		{value: "Temperature:-999", want: Sentinel{Field: "Temperature", Value: "-999"}},
+		{value: "Status:error:sensor", want: Sentinel{Field: "Status", Value: "error:sensor"}},
+		{value: "Status:", want: Sentinel{Field: "Status", Value: ""}},
+		{value: "Temperature", wantErr: true},
+		{value: ":-999", wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.value, func(t *testing.T) {
+			got, err := ParseSentinel(test.value)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("ParseSentinel() error = %v, wantErr %v", err, test.wantErr)
+			}
+			if got != test.want {
+				t.Errorf("ParseSentinel() = %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestApplySentinelFilter(t *testing.T) {
+	tests := []struct {
+		name       string
+		sentinels  []Sentinel
+		wantFilter string
+		wantNames  map[string]string
+		wantValues map[string]types.AttributeValue
+	}{
+		{name: "no sentinels"},
+		{
+			name:       "numeric",
+			sentinels:  []Sentinel{{Field: "Temperature", Value: "-999"}},
+			wantFilter: "attribute_not_exists(#sentinel0) OR #sentinel0 <> :sentinel0",
+			wantNames:  map[string]string{"#sentinel0": "Temperature"},
+			wantValues: map[string]types.AttributeValue{":sentinel0": numberAttr("-999")},
+		},
+		{
+			name:      "compared as strings unless numbers",
+			sentinels: []Sentinel{{Field: "Status", Value: "failed"}, {Field: "Battery Level", Value: "NaN"}},
+			wantFilter: "(attribute_not_exists(#sentinel0) OR #sentinel0 <> :sentinel0) AND " +
+				"(attribute_not_exists(#sentinel1) OR #sentinel1 <> :sentinel1)",
+			wantNames: map[string]string{"#sentinel0": "Status", "#sentinel1": "Battery Level"},
+			wantValues: map[string]types.AttributeValue{
+				":sentinel0": stringAttr("failed"),
+				":sentinel1": stringAttr("NaN"),
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			input := CreateQueryInput("ProjectId", "sensors")
+
+			ApplySentinelFilter(input, test.sentinels)
+			if filter := aws.StringValue(input.FilterExpression); filter != test.wantFilter {
+				t.Errorf("FilterExpression = %q, want %q", filter, test.wantFilter)
+			}
+			for name, want := range test.wantNames {
+				if got := input.ExpressionAttributeNames[name]; got != want {
+					t.Errorf("%s = %q, want %q", name, got, want)
+				}
+			}
+			for name, want := range test.wantValues {
+				if got := input.ExpressionAttributeValues[name]; !reflect.DeepEqual(got, want) {
+					t.Errorf("%s = %v, want %v", name, got, want)
+				}
+			}
+		})
+	}
+}
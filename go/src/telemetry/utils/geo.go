@@ -0,0 +1,46 @@
+package utils
+
+import (
+	"fmt"
+	"os"
+)
+
+// GeoFields returns the fields that hold GPS coordinates as {"lat":..,"lon":..} objects,
+// from the comma-separated GEO_FIELDS environment variable, e.g. GEO_FIELDS=Position.
+func GeoFields() []string {
+	return splitList(os.Getenv("GEO_FIELDS"))
+}
+
+// ValidateCoordinates checks that every geo field present in a POST body is an object
+// with a numeric lat between -90 and 90 and a numeric lon between -180 and 180,
+// so that bad GPS fixes are rejected rather than stored.
+func ValidateCoordinates(itemMap map[string]interface{}, fields []string) error {
+	for _, field := range fields {
+		value, ok := itemMap[field]
+		if !ok {
+			continue
+		}
+		coordinates, ok := value.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("%s must be an object with lat and lon", field)
+		}
+		if err := checkCoordinate(coordinates, field, "lat", 90); err != nil {
+			return err
+		}
+		if err := checkCoordinate(coordinates, field, "lon", 180); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func checkCoordinate(coordinates map[string]interface{}, field string, name string, limit float64) error {
+	value, ok := coordinates[name].(float64)
+	if !ok {
+		return fmt.Errorf("%s.%s must be a number", field, name)
+	}
+	if value < -limit || value > limit {
+		return fmt.Errorf("%s.%s must be between %v and %v, got %v", field, name, -limit, limit, value)
+	}
+	return nil
+}
@@ -0,0 +1,38 @@
+package utils
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestGeoFields(t *testing.T) {
+	t.Setenv("GEO_FIELDS", "Position, Home")
+	if got, want := GeoFields(), []string{"Position", "Home"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("GeoFields() = %q, want %q", got, want)
+	}
+}
+
+func TestValidateCoordinates(t *testing.T) {
+	tests := []struct {
+		name    string
+		item    map[string]interface{}
+		wantErr bool
+	}{
+		{name: "no position", item: map[string]interface{}{"Temperature": 21.5}},
+		{name: "valid", item: map[string]interface{}{"Position": map[string]interface{}{"lat": 45.5, "lon": -122.7}}},
+		{name: "bounds", item: map[string]interface{}{"Position": map[string]interface{}{"lat": -90.0, "lon": 180.0}}},
+		{name: "latitude too high", item: map[string]interface{}{"Position": map[string]interface{}{"lat": 90.1, "lon": 0.0}}, wantErr: true},
+		{name: "longitude too low", item: map[string]interface{}{"Position": map[string]interface{}{"lat": 0.0, "lon": -180.5}}, wantErr: true},
+		{name: "missing longitude", item: map[string]interface{}{"Position": map[string]interface{}{"lat": 0.0}}, wantErr: true},
+		{name: "string latitude", item: map[string]interface{}{"Position": map[string]interface{}{"lat": "45", "lon": 0.0}}, wantErr: true},
+		{name: "not an object", item: map[string]interface{}{"Position": "45,-122"}, wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := ValidateCoordinates(test.item, []string{"Position"})
+			if (err != nil) != test.wantErr {
+				t.Errorf("ValidateCoordinates() error = %v, wantErr %v", err, test.wantErr)
+			}
+		})
+	}
+}
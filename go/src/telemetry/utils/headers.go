@@ -0,0 +1,22 @@
+package utils
+
+// BaseHeaders returns the headers included in every response: the CORS headers the browser
+// clients need, merged with any deployment-specific headers, like X-Frame-Options, given
+// as a JSON object in the EXTRA_RESPONSE_HEADERS environment variable.
+// Extra headers take precedence, so a deployment can also narrow the CORS headers.
+// Each call returns a new map, which the caller is free to add to.
+func BaseHeaders() map[string]string {
+	headers := map[string]string{
+		"Access-Control-Allow-Headers": "Content-Type,X-Amz-Date,Authorization," +
+			"X-Api-Key,X-Amz-Security-Token,authorization-token",
+		"Access-Control-Allow-Origin":  "*",
+		"Access-Control-Allow-Methods": "OPTIONS,POST,GET,PATCH,DELETE",
+	}
+	var extra map[string]string
+	if envJSON("EXTRA_RESPONSE_HEADERS", &extra) {
+		for name, value := range extra {
+			headers[name] = value
+		}
+	}
+	return headers
+}
@@ -0,0 +1,69 @@
+package utils
+
+import (
+	"testing"
+)
+
+func TestBaseHeaders(t *testing.T) {
+	tests := []struct {
+		name  string
+		extra string
+		want  map[string]string
+	}{
+		{
+			name: "CORS headers",
+			want: map[string]string{"Access-Control-Allow-Origin": "*"},
+		},
+		{
+			name:  "extra headers",
+			extra: `{"X-Frame-Options": "DENY"}`,
+			want:  map[string]string{"Access-Control-Allow-Origin": "*", "X-Frame-Options": "DENY"},
+		},
+		{
+			name:  "CORS headers narrowed",
+			extra: `{"Access-Control-Allow-Origin": "https://example.com"}`,
+			want:  map[string]string{"Access-Control-Allow-Origin": "https://example.com"},
+		},
+		{
+			name:  "invalid extra headers ignored",
+			extra: `["X-Frame-Options"]`,
+			want:  map[string]string{"Access-Control-Allow-Origin": "*"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Setenv("EXTRA_RESPONSE_HEADERS", test.extra)
+			headers := BaseHeaders()
+			for name, want := range test.want {
+				if got := headers[name]; got != want {
+					t.Errorf("BaseHeaders()[%q] = %q, want %q", name, got, want)
+				}
+			}
+			if _, ok := headers["Access-Control-Allow-Methods"]; !ok {
+				t.Error("BaseHeaders() has no Access-Control-Allow-Methods")
+			}
+		})
+	}
+}
+
+func TestBaseHeadersFresh(t *testing.T) {
+	BaseHeaders()["Content-Type"] = "text/csv"
+	if _, ok := BaseHeaders()["Content-Type"]; ok {
+		t.Error("BaseHeaders() returned a map changed by an earlier caller")
+	}
+}
+
+func TestResponsesIncludeExtraHeaders(t *testing.T) {
+	t.Setenv("EXTRA_RESPONSE_HEADERS", `{"X-Frame-Options": "DENY"}`)
+	response, err := JSONResponse([]string{})
+	if err != nil {
+		t.Fatalf("JSONResponse() error = %v", err)
+	}
+	if response.Headers["X-Frame-Options"] != "DENY" {
+		t.Errorf("JSONResponse() headers = %v, want the extra header", response.Headers)
+	}
+	response, _ = NotFoundResponse("missing")
+	if response.Headers["X-Frame-Options"] != "DENY" {
+		t.Errorf("NotFoundResponse() headers = %v, want the extra header", response.Headers)
+	}
+}
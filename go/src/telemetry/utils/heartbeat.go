@@ -0,0 +1,54 @@
+package utils
+
+import (
+	"context"
+	"strconv"
+	"telemetry/constants"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go/aws"
+)
+
+// StatusKey returns the key of a device's status item, which tracks its liveness apart from
+// its readings. Status items share the table under a 'status#' partition key no reading can have.
+func StatusKey(tenant string, project string, deviceId string) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{
+		"ProjectId#DeviceId": &types.AttributeValueMemberS{
+			Value: bookkeepingKey("status", tenant, project, deviceId),
+		},
+		SortKeyAttribute(): &types.AttributeValueMemberN{Value: "0"},
+	}
+}
+
+// BuildHeartbeatUpdate builds the update that sets a device's LastSeen time.
+func BuildHeartbeatUpdate(
+	tenant string,
+	project string,
+	deviceId string,
+	now time.Time,
+) *dynamodb.UpdateItemInput {
+	return &dynamodb.UpdateItemInput{
+		TableName:        aws.String(constants.TABLE_NAME),
+		Key:              StatusKey(tenant, project, deviceId),
+		UpdateExpression: aws.String("SET LastSeen = :now"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":now": &types.AttributeValueMemberN{Value: strconv.FormatInt(now.Unix(), 10)},
+		},
+	}
+}
+
+// RecordHeartbeat records that a device is alive, without storing a reading,
+// returning the LastSeen time it set.
+func RecordHeartbeat(
+	ctx context.Context,
+	api DynamoDbUpdateItemAPI,
+	tenant string,
+	project string,
+	deviceId string,
+) (time.Time, error) {
+	now := Now()
+	_, err := api.UpdateItem(ctx, BuildHeartbeatUpdate(tenant, project, deviceId, now))
+	return now, err
+}
@@ -0,0 +1,63 @@
+package utils
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+
+	"telemetry/utils/dynamotest"
+)
+
+func TestStatusKey(t *testing.T) {
+	want := map[string]types.AttributeValue{
+		"ProjectId#DeviceId": stringAttr("status#sensors#d1"),
+		"EpochTime":          numberAttr("0"),
+	}
+	if got := StatusKey("", "sensors", "d1"); !reflect.DeepEqual(got, want) {
+		t.Errorf("StatusKey() = %v, want %v", got, want)
+	}
+}
+
+func TestBuildHeartbeatUpdate(t *testing.T) {
+	input := BuildHeartbeatUpdate("", "sensors", "d1", testNow)
+	if expression := *input.UpdateExpression; expression != "SET LastSeen = :now" {
+		t.Errorf("UpdateExpression = %q, want LastSeen set", expression)
+	}
+	if now := input.ExpressionAttributeValues[":now"]; !reflect.DeepEqual(now, numberAttr("1600000000")) {
+		t.Errorf(":now = %v, want 1600000000", now)
+	}
+}
+
+func TestRecordHeartbeat(t *testing.T) {
+	tests := []struct {
+		name    string
+		fail    bool
+		wantErr bool
+	}{
+		{name: "recorded"},
+		{name: "update failed", fail: true, wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			stopClock(t)
+			server := dynamotest.NewServer(t)
+			if test.fail {
+				server.Fail("UpdateItem", "InternalServerError")
+			}
+
+			lastSeen, err := RecordHeartbeat(context.Background(), server.Client(), "", "sensors", "d1")
+			if (err != nil) != test.wantErr {
+				t.Fatalf("RecordHeartbeat() error = %v, wantErr %v", err, test.wantErr)
+			}
+			if !lastSeen.Equal(testNow) {
+				t.Errorf("RecordHeartbeat() = %v, want %v", lastSeen, testNow)
+			}
+			updates := server.Calls("UpdateItem")
+			if len(updates) != 1 || partitionKeyOf(updates[0], "Key") != "status#sensors#d1" {
+				t.Errorf("updates = %v, want one of the device's status", updates)
+			}
+		})
+	}
+}
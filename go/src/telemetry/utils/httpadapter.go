@@ -0,0 +1,127 @@
+package utils
+
+import (
+	"encoding/base64"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// maxHTTPBodyBytes matches the largest payload API Gateway accepts,
+// so a handler behind net/http sees no more than it would behind API Gateway.
+const maxHTTPBodyBytes = 10 * 1024 * 1024
+
+// HTTPHandler serves a Handler behind a standard net/http server, for running the endpoints
+// locally or outside Lambda. The route names the path parameters in braces, as API Gateway does,
+// e.g. "/projects/{ProjectId}", and requests whose path doesn't match it are answered with a 404.
+// As behind API Gateway, requests without a tenant are refused while tenants are isolated.
+func HTTPHandler(handler Handler, route string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		pathParameters, ok := matchRoute(route, r.URL.Path)
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		request, err := RequestFromHTTP(r, pathParameters)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		response, err := serve(handler, request)
+		if err != nil {
+			log.Printf("Handler failed, %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		writeHTTPResponse(w, response)
+	})
+}
+
+// RequestFromHTTP normalizes a net/http request like an API Gateway event,
+// with the path parameters already extracted from its path.
+func RequestFromHTTP(r *http.Request, pathParameters map[string]string) (*Request, error) {
+	body, err := io.ReadAll(http.MaxBytesReader(nil, r.Body, maxHTTPBodyBytes))
+	if err != nil {
+		return nil, err
+	}
+
+	headers := make(map[string]string, len(r.Header))
+	for name, values := range r.Header {
+		headers[name] = strings.Join(values, ",")
+	}
+	multiValues := r.URL.Query()
+	params := make(map[string]string, len(multiValues))
+	for key, values := range multiValues {
+		params[key] = values[len(values)-1]
+	}
+
+	request := &Request{
+		Method:                          r.Method,
+		Path:                            r.URL.Path,
+		Headers:                         headers,
+		PathParameters:                  pathParameters,
+		QueryStringParameters:           params,
+		MultiValueQueryStringParameters: multiValues,
+		Body:                            string(body),
+		ctx:                             r.Context(),
+	}
+	if project, projectOk := request.PathParameters["ProjectId"]; projectOk {
+		request.PathParameters["ProjectId"] = NormalizeProjectId(project)
+	}
+	return request, nil
+}
+
+// matchRoute extracts the path parameters named in the route from the path,
+// reporting whether the path matches the route at all.
+func matchRoute(route string, path string) (map[string]string, bool) {
+	routeSegments := strings.Split(strings.Trim(route, "/"), "/")
+	pathSegments := strings.Split(strings.Trim(path, "/"), "/")
+	if len(routeSegments) != len(pathSegments) {
+		return nil, false
+	}
+	pathParameters := make(map[string]string)
+	for i, segment := range routeSegments {
+		if strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") {
+			if pathSegments[i] == "" {
+				return nil, false
+			}
+			pathParameters[strings.Trim(segment, "{}")] = pathSegments[i]
+		} else if segment != pathSegments[i] {
+			return nil, false
+		}
+	}
+	return pathParameters, true
+}
+
+// writeHTTPResponse writes an API Gateway response to a net/http response writer.
+func writeHTTPResponse(w http.ResponseWriter, response events.APIGatewayProxyResponse) {
+	for name, value := range response.Headers {
+		w.Header().Set(name, value)
+	}
+	for name, values := range response.MultiValueHeaders {
+		for _, value := range values {
+			w.Header().Add(name, value)
+		}
+	}
+	// API Gateway answers with JSON unless the handler says otherwise, rather than sniffing the body.
+	if w.Header().Get("Content-Type") == "" {
+		w.Header().Set("Content-Type", "application/json")
+	}
+	body := []byte(response.Body)
+	if response.IsBase64Encoded {
+		decoded, err := base64.StdEncoding.DecodeString(response.Body)
+		if err != nil {
+			log.Printf("Failed to decode response body, %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		body = decoded
+	}
+	w.WriteHeader(response.StatusCode)
+	if _, err := w.Write(body); err != nil {
+		log.Printf("Failed to write response, %v", err)
+	}
+}
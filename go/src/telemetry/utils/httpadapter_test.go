@@ -0,0 +1,200 @@
+package utils
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+func TestMatchRoute(t *testing.T) {
+	tests := []struct {
+		name   string
+		route  string
+		path   string
+		want   map[string]string
+		wantOk bool
+	}{
+		{
+			name:   "path parameter",
+			route:  "/projects/{ProjectId}",
+			path:   "/projects/sensors",
+			want:   map[string]string{"ProjectId": "sensors"},
+			wantOk: true,
+		},
+		{
+			name:   "trailing slash",
+			route:  "/projects/{ProjectId}",
+			path:   "/projects/sensors/",
+			want:   map[string]string{"ProjectId": "sensors"},
+			wantOk: true,
+		},
+		{
+			name:   "several path parameters",
+			route:  "/projects/{ProjectId}/devices/{DeviceId}",
+			path:   "/projects/sensors/devices/d1",
+			want:   map[string]string{"ProjectId": "sensors", "DeviceId": "d1"},
+			wantOk: true,
+		},
+		{name: "other literal", route: "/projects/{ProjectId}", path: "/devices/sensors"},
+		{name: "too few segments", route: "/projects/{ProjectId}", path: "/projects"},
+		{name: "too many segments", route: "/projects/{ProjectId}", path: "/projects/sensors/d1"},
+		{name: "empty path parameter", route: "/projects/{ProjectId}/devices", path: "/projects//devices"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, ok := matchRoute(test.route, test.path)
+			if ok != test.wantOk || !reflect.DeepEqual(got, test.want) {
+				t.Errorf("matchRoute() = %v, %v, want %v, %v", got, ok, test.want, test.wantOk)
+			}
+		})
+	}
+}
+
+func TestRequestFromHTTP(t *testing.T) {
+	t.Setenv("NORMALIZE_PROJECT_ID", "true")
+	r := httptest.NewRequest("POST", "/projects/Sensors?device=d1&device=d2&limit=5", strings.NewReader(`{"a":1}`))
+	r.Header.Add("Accept", "text/csv")
+	r.Header.Add("X-Tag", "one")
+	r.Header.Add("X-Tag", "two")
+
+	request, err := RequestFromHTTP(r, map[string]string{"ProjectId": "Sensors"})
+	if err != nil {
+		t.Fatalf("RequestFromHTTP() error = %v", err)
+	}
+	if request.Method != "POST" || request.Path != "/projects/Sensors" || request.Body != `{"a":1}` {
+		t.Errorf("request = %s %s %q, want the method, path, and body", request.Method, request.Path, request.Body)
+	}
+	if request.PathParameters["ProjectId"] != "sensors" {
+		t.Errorf("ProjectId = %q, want it normalized", request.PathParameters["ProjectId"])
+	}
+	if request.Headers["Accept"] != "text/csv" || request.Headers["X-Tag"] != "one,two" {
+		t.Errorf("Headers = %v, want repeated headers joined", request.Headers)
+	}
+	// The last of a repeated parameter wins, as in API Gateway's single-value parameters.
+	if request.QueryStringParameters["device"] != "d2" || request.QueryStringParameters["limit"] != "5" {
+		t.Errorf("QueryStringParameters = %v, want the last of each", request.QueryStringParameters)
+	}
+	if devices := request.MultiValueQueryStringParameters["device"]; !reflect.DeepEqual(devices, []string{"d1", "d2"}) {
+		t.Errorf("MultiValueQueryStringParameters[device] = %v, want every value", devices)
+	}
+
+	tooLarge := httptest.NewRequest("POST", "/projects/sensors", strings.NewReader(strings.Repeat("a", maxHTTPBodyBytes+1)))
+	if _, err := RequestFromHTTP(tooLarge, map[string]string{"ProjectId": "sensors"}); err == nil {
+		t.Errorf("RequestFromHTTP() of a body over %d bytes error = nil, want an error", maxHTTPBodyBytes)
+	}
+}
+
+func TestHTTPHandler(t *testing.T) {
+	var served *Request
+	respond := func(response events.APIGatewayProxyResponse) Handler {
+		return func(request *Request) (events.APIGatewayProxyResponse, error) {
+			served = request
+			return response, nil
+		}
+	}
+	tests := []struct {
+		name            string
+		env             map[string]string
+		handler         Handler
+		path            string
+		wantStatus      int
+		wantContentType string
+		wantBody        string
+		wantServed      bool
+	}{
+		{
+			name:            "served as JSON",
+			handler:         respond(events.APIGatewayProxyResponse{StatusCode: 200, Body: `{}`}),
+			path:            "/projects/sensors",
+			wantStatus:      200,
+			wantContentType: "application/json",
+			wantBody:        `{}`,
+			wantServed:      true,
+		},
+		{
+			name: "headers of the response",
+			handler: respond(events.APIGatewayProxyResponse{
+				StatusCode: 201,
+				Headers:    map[string]string{"Content-Type": "text/csv"},
+				Body:       "a,b",
+			}),
+			path:            "/projects/sensors",
+			wantStatus:      201,
+			wantContentType: "text/csv",
+			wantBody:        "a,b",
+			wantServed:      true,
+		},
+		{
+			name: "base64-encoded body decoded",
+			handler: respond(events.APIGatewayProxyResponse{
+				StatusCode:      200,
+				Headers:         map[string]string{"Content-Type": "application/octet-stream"},
+				Body:            base64.StdEncoding.EncodeToString([]byte("raw")),
+				IsBase64Encoded: true,
+			}),
+			path:            "/projects/sensors",
+			wantStatus:      200,
+			wantContentType: "application/octet-stream",
+			wantBody:        "raw",
+			wantServed:      true,
+		},
+		{
+			name:       "malformed base64-encoded body",
+			handler:    respond(events.APIGatewayProxyResponse{StatusCode: 200, Body: "!", IsBase64Encoded: true}),
+			path:       "/projects/sensors",
+			wantStatus: 500,
+			wantServed: true,
+		},
+		{
+			name: "failed handler",
+			handler: func(request *Request) (events.APIGatewayProxyResponse, error) {
+				served = request
+				return events.APIGatewayProxyResponse{}, http.ErrHandlerTimeout
+			},
+			path:       "/projects/sensors",
+			wantStatus: 500,
+			wantServed: true,
+		},
+		{
+			name:       "path off the route",
+			handler:    respond(events.APIGatewayProxyResponse{StatusCode: 200}),
+			path:       "/devices/d1",
+			wantStatus: 404,
+		},
+		{
+			name:       "no tenant while tenants are isolated",
+			env:        map[string]string{"TENANT_ISOLATION": "true"},
+			handler:    respond(events.APIGatewayProxyResponse{StatusCode: 200}),
+			path:       "/projects/sensors",
+			wantStatus: 403,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			for name, value := range test.env {
+				t.Setenv(name, value)
+			}
+			served = nil
+			recorder := httptest.NewRecorder()
+
+			HTTPHandler(test.handler, "/projects/{ProjectId}").ServeHTTP(recorder, httptest.NewRequest("GET", test.path, nil))
+			if recorder.Code != test.wantStatus {
+				t.Fatalf("status = %d, want %d, body %s", recorder.Code, test.wantStatus, recorder.Body)
+			}
+			if (served != nil) != test.wantServed {
+				t.Errorf("served = %v, want %v", served != nil, test.wantServed)
+			}
+			if test.wantContentType != "" && recorder.Header().Get("Content-Type") != test.wantContentType {
+				t.Errorf("Content-Type = %q, want %q", recorder.Header().Get("Content-Type"), test.wantContentType)
+			}
+			if test.wantBody != "" && recorder.Body.String() != test.wantBody {
+				t.Errorf("body = %s, want %s", recorder.Body, test.wantBody)
+			}
+		})
+	}
+}
@@ -0,0 +1,115 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"telemetry/constants"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go/aws"
+)
+
+// DynamoDbDeleteItemAPI defines interface for DeleteItem function.
+type DynamoDbDeleteItemAPI interface {
+	DeleteItem(
+		ctx context.Context,
+		params *dynamodb.DeleteItemInput,
+		optFns ...func(*dynamodb.Options),
+	) (*dynamodb.DeleteItemOutput, error)
+}
+
+// DynamoDbGetItemAPI defines interface for GetItem function.
+type DynamoDbGetItemAPI interface {
+	GetItem(
+		ctx context.Context,
+		params *dynamodb.GetItemInput,
+		optFns ...func(*dynamodb.Options),
+	) (*dynamodb.GetItemOutput, error)
+}
+
+// idempotencyMarkerKey is the primary key of the marker item recording that an
+// idempotency key was used. Markers share the table, under a partition key that
+// no reading can have.
+func idempotencyMarkerKey(tenant string, project string, key string) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{
+		"ProjectId#DeviceId": &types.AttributeValueMemberS{
+			Value: bookkeepingKey("idempotency", tenant, project, key),
+		},
+		SortKeyAttribute(): &types.AttributeValueMemberN{Value: "0"},
+	}
+}
+
+// buildIdempotencyMarkerPut builds the put of an idempotency key's marker, conditioned on the key
+// not having been used, for a transaction alongside the write it guards. The marker expires after
+// IDEMPOTENCY_TTL_SECONDS (a day by default) through the table's ExpiresAt TTL attribute.
+func buildIdempotencyMarkerPut(tenant string, project string, key string) *types.Put {
+	ttl := envInt("IDEMPOTENCY_TTL_SECONDS", constants.IDEMPOTENCY_TTL)
+	marker := idempotencyMarkerKey(tenant, project, key)
+	marker["ExpiresAt"] = &types.AttributeValueMemberN{
+		Value: strconv.FormatInt(Now().Add(time.Duration(ttl)*time.Second).Unix(), 10),
+	}
+	return &types.Put{
+		TableName:           aws.String(constants.TABLE_NAME),
+		Item:                marker,
+		ConditionExpression: aws.String("attribute_not_exists(#pk)"),
+		ExpressionAttributeNames: map[string]string{
+			"#pk": "ProjectId#DeviceId",
+		},
+	}
+}
+
+// PutIdempotent writes an item at most once per idempotency key within a project.
+// The item and the key's marker are written in one transaction, which is cancelled
+// if the key was already used, so that a marker is never left without its item.
+// It reports whether the write was a duplicate, in which case nothing was written.
+func PutIdempotent(
+	ctx context.Context,
+	api DynamoDbTransactWriteAPI,
+	input *dynamodb.PutItemInput,
+	tenant string,
+	project string,
+	key string,
+) (bool, error) {
+	err := TransactWriteItems(ctx, api, []types.TransactWriteItem{
+		{Put: &types.Put{
+			TableName:                input.TableName,
+			Item:                     input.Item,
+			ConditionExpression:      input.ConditionExpression,
+			ExpressionAttributeNames: input.ExpressionAttributeNames,
+		}},
+		{Put: buildIdempotencyMarkerPut(tenant, project, key)},
+	})
+	var canceled *TransactionCanceledError
+	if errors.As(err, &canceled) && canceled.Code(1) == "ConditionalCheckFailed" {
+		return true, nil
+	}
+	return false, err
+}
+
+// IdempotencyKeyUsed reports whether the idempotency key's marker exists, meaning a write
+// with the key already succeeded within the project. The marker is read consistently,
+// so that a retry sent straight after its original is still recognized.
+func IdempotencyKeyUsed(
+	ctx context.Context,
+	api DynamoDbGetItemAPI,
+	tenant string,
+	project string,
+	key string,
+) (bool, error) {
+	output, err := api.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName:            aws.String(constants.TABLE_NAME),
+		Key:                  idempotencyMarkerKey(tenant, project, key),
+		ConsistentRead:       aws.Bool(true),
+		ProjectionExpression: aws.String("#pk"),
+		ExpressionAttributeNames: map[string]string{
+			"#pk": "ProjectId#DeviceId",
+		},
+	})
+	if err != nil {
+		return false, err
+	}
+	return len(output.Item) > 0, nil
+}
@@ -0,0 +1,124 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go/aws"
+
+	"telemetry/constants"
+	"telemetry/utils/dynamotest"
+)
+
+// partitionKeyOf returns the partition key of a recorded request's Item or Key.
+func partitionKeyOf(call dynamotest.Call, field string) interface{} {
+	item, _ := call.Input[field].(map[string]interface{})
+	key, _ := item["ProjectId#DeviceId"].(map[string]interface{})
+	return key["S"]
+}
+
+func TestPutIdempotent(t *testing.T) {
+	tests := []struct {
+		name          string
+		tenant        string
+		err           error
+		wantDuplicate bool
+		wantErr       bool
+		wantMarker    string
+	}{
+		{
+			name:       "first write",
+			wantMarker: "idempotency#sensors#k",
+		},
+		{
+			name:       "tenant's marker",
+			tenant:     "acme",
+			wantMarker: "idempotency#acme#sensors#k",
+		},
+		{
+			name:          "duplicate",
+			err:           canceled("None", "ConditionalCheckFailed"),
+			wantDuplicate: true,
+			wantMarker:    "idempotency#sensors#k",
+		},
+		{
+			name:       "item write failed",
+			err:        canceled("ValidationError", "None"),
+			wantErr:    true,
+			wantMarker: "idempotency#sensors#k",
+		},
+		{
+			name:       "transaction failed",
+			err:        errors.New("network error"),
+			wantErr:    true,
+			wantMarker: "idempotency#sensors#k",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			api := &fakeTransactor{err: test.err}
+			input := &dynamodb.PutItemInput{
+				TableName: aws.String(constants.TABLE_NAME),
+				Item: map[string]types.AttributeValue{
+					"ProjectId#DeviceId": stringAttr("sensors#d1"),
+					"EpochTime":          numberAttr("1"),
+				},
+			}
+
+			duplicate, err := PutIdempotent(context.Background(), api, input, test.tenant, "sensors", "k")
+			if (err != nil) != test.wantErr {
+				t.Fatalf("PutIdempotent() error = %v, wantErr %v", err, test.wantErr)
+			}
+			if duplicate != test.wantDuplicate {
+				t.Errorf("PutIdempotent() = %v, want %v", duplicate, test.wantDuplicate)
+			}
+			if len(api.inputs) != 1 || len(api.inputs[0].TransactItems) != 2 {
+				t.Fatalf("transactions = %+v, want one of the item and its marker", api.inputs)
+			}
+			items := api.inputs[0].TransactItems
+			if !reflect.DeepEqual(items[0].Put.Item, input.Item) {
+				t.Errorf("first item = %v, want the item", items[0].Put.Item)
+			}
+			marker := items[1].Put
+			if key := marker.Item["ProjectId#DeviceId"]; !reflect.DeepEqual(key, stringAttr(test.wantMarker)) {
+				t.Errorf("marker = %v, want %s", key, test.wantMarker)
+			}
+			if marker.ConditionExpression == nil || *marker.ConditionExpression != "attribute_not_exists(#pk)" {
+				t.Errorf("marker ConditionExpression = %v, want the key unused", marker.ConditionExpression)
+			}
+		})
+	}
+}
+
+func TestIdempotencyKeyUsed(t *testing.T) {
+	tests := []struct {
+		name     string
+		response string
+		want     bool
+	}{
+		{name: "used", response: `{"Item": {"ProjectId#DeviceId": {"S": "idempotency#sensors#k"}}}`, want: true},
+		{name: "unused", response: `{}`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := dynamotest.NewServer(t)
+			server.Respond("GetItem", test.response)
+
+			used, err := IdempotencyKeyUsed(context.Background(), server.Client(), "", "sensors", "k")
+			if err != nil {
+				t.Fatalf("IdempotencyKeyUsed() error = %v", err)
+			}
+			if used != test.want {
+				t.Errorf("IdempotencyKeyUsed() = %v, want %v", used, test.want)
+			}
+			gets := server.Calls("GetItem")
+			if len(gets) != 1 || gets[0].Input["ConsistentRead"] != true {
+				t.Errorf("gets = %v, want one consistent read", gets)
+			}
+		})
+	}
+}
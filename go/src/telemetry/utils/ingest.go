@@ -0,0 +1,170 @@
+package utils
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strings"
+)
+
+// AttributeAliases returns the configured mapping of alternate attribute names to
+// their canonical names, read from the ATTRIBUTE_ALIASES environment variable,
+// e.g. {"temp": "Temperature", "t": "Temperature"}.
+func AttributeAliases() map[string]string {
+	var aliases map[string]string
+	envJSON("ATTRIBUTE_ALIASES", &aliases)
+	return aliases
+}
+
+// ApplyAliases renames aliased attributes in the item to their canonical names.
+// If the item already has the canonical attribute, its value is kept and the alias dropped.
+// Attributes without an alias pass through unchanged.
+func ApplyAliases(itemMap map[string]interface{}, aliases map[string]string) {
+	for alias, canonical := range aliases {
+		value, ok := itemMap[alias]
+		if !ok || alias == canonical {
+			continue
+		}
+		delete(itemMap, alias)
+		if _, exists := itemMap[canonical]; !exists {
+			itemMap[canonical] = value
+		}
+	}
+}
+
+// AddCompositeKeys sets the composite key attributes that the table and its indexes are keyed on,
+// prefixed by the item's TenantId when it has one.
+func AddCompositeKeys(itemMap map[string]interface{}) {
+	tenant, _ := itemMap["TenantId"].(string)
+	project := fmt.Sprintf("%s", itemMap["ProjectId"])
+	itemMap["ProjectId#DeviceId"] = PartitionKey(tenant, project, fmt.Sprintf("%s", itemMap["DeviceId"]))
+	if locationID, locationIDOk := itemMap["LocationId"]; locationIDOk {
+		itemMap["ProjectId#LocationId"] = PartitionKey(tenant, project, fmt.Sprintf("%s", locationID))
+	}
+}
+
+// FieldRounding returns the configured number of decimal places to round each numeric field to,
+// read from the ROUND_FIELDS environment variable, e.g. {"Temperature": 2}.
+func FieldRounding() map[string]int {
+	var rounding map[string]int
+	envJSON("ROUND_FIELDS", &rounding)
+	return rounding
+}
+
+// ApplyRounding rounds the configured numeric fields of the item to their number of decimal places.
+// Fields that aren't configured, or aren't numbers, are untouched.
+func ApplyRounding(itemMap map[string]interface{}, rounding map[string]int) {
+	for field, places := range rounding {
+		value, ok := itemMap[field].(float64)
+		if !ok {
+			continue
+		}
+		scale := math.Pow(10, float64(places))
+		itemMap[field] = math.Round(value*scale) / scale
+	}
+}
+
+// ServerManagedFields are attributes that only the server may set: the tenant and composite keys,
+// the TTL attribute that expires items such as idempotency markers, and the time a reading arrived.
+var ServerManagedFields = []string{
+	"TenantId", "ProjectId#DeviceId", "ProjectId#LocationId", "ExpiresAt", "ReceivedAt",
+}
+
+// RecordReceivedAt reports whether readings record the time the server received them,
+// in Unix seconds, as their ReceivedAt attribute, when the RECORD_RECEIVED_AT environment
+// variable is truthy. Comparing it with a reading's EpochTime shows devices with skewed clocks.
+func RecordReceivedAt() bool {
+	enabled, _ := ParseBoolParam(os.Getenv("RECORD_RECEIVED_AT"))
+	return enabled
+}
+
+// RemoveServerManagedFields guards against clients spoofing server-managed attributes.
+// By default they are silently dropped, to be set authoritatively afterwards, but when the
+// SERVER_FIELDS_MODE environment variable is "reject", an item containing any of them is an error.
+func RemoveServerManagedFields(itemMap map[string]interface{}) error {
+	var supplied []string
+	for _, field := range ServerManagedFields {
+		if _, ok := itemMap[field]; ok {
+			supplied = append(supplied, field)
+		}
+	}
+	if len(supplied) == 0 {
+		return nil
+	}
+	if strings.EqualFold(os.Getenv("SERVER_FIELDS_MODE"), "reject") {
+		sort.Strings(supplied)
+		return fmt.Errorf("Server-managed fields cannot be set: %s", strings.Join(supplied, ", "))
+	}
+	for _, field := range supplied {
+		delete(itemMap, field)
+	}
+	return nil
+}
+
+// DropNonFiniteNumbers reports whether NaN and infinite numbers are dropped from an item,
+// as set by NON_FINITE_NUMBERS=drop, rather than rejected, the default.
+// DynamoDB can't store them, and would otherwise fail the whole write.
+func DropNonFiniteNumbers() bool {
+	return strings.EqualFold(os.Getenv("NON_FINITE_NUMBERS"), "drop")
+}
+
+// HandleNonFiniteNumbers finds NaN and infinite numbers anywhere in an item, including nested
+// objects and lists. When drop is set they are removed, and otherwise they are rejected
+// with an error naming the first one found.
+func HandleNonFiniteNumbers(itemMap map[string]interface{}, drop bool) error {
+	_, _, err := handleNonFinite(itemMap, "", drop)
+	return err
+}
+
+// handleNonFinite returns the value with any non-finite numbers dropped,
+// and whether the value itself should be kept.
+func handleNonFinite(value interface{}, path string, drop bool) (interface{}, bool, error) {
+	switch v := value.(type) {
+	case float64:
+		if !math.IsNaN(v) && !math.IsInf(v, 0) {
+			return v, true, nil
+		}
+		if !drop {
+			return nil, false, fmt.Errorf("%s must be a finite number, got %v", path, v)
+		}
+		return nil, false, nil
+	case map[string]interface{}:
+		// Keys are visited in order, so the same item always reports the same field.
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			childPath := key
+			if path != "" {
+				childPath = path + "." + key
+			}
+			child, keep, err := handleNonFinite(v[key], childPath, drop)
+			if err != nil {
+				return nil, false, err
+			}
+			if keep {
+				v[key] = child
+			} else {
+				delete(v, key)
+			}
+		}
+		return v, true, nil
+	case []interface{}:
+		kept := v[:0]
+		for i, element := range v {
+			child, keep, err := handleNonFinite(element, fmt.Sprintf("%s[%d]", path, i), drop)
+			if err != nil {
+				return nil, false, err
+			}
+			if keep {
+				kept = append(kept, child)
+			}
+		}
+		return kept, true, nil
+	default:
+		return v, true, nil
+	}
+}
@@ -0,0 +1,252 @@
+package utils
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestApplyAliases(t *testing.T) {
+	aliases := map[string]string{"temp": "Temperature", "t": "Temperature", "Humidity": "Humidity"}
+	tests := []struct {
+		name string
+		item map[string]interface{}
+		want map[string]interface{}
+	}{
+		{
+			name: "alias renamed",
+			item: map[string]interface{}{"temp": 21.5, "DeviceId": "d1"},
+			want: map[string]interface{}{"Temperature": 21.5, "DeviceId": "d1"},
+		},
+		{
+			name: "canonical kept over the alias",
+			item: map[string]interface{}{"Temperature": 20.0, "t": 21.5},
+			want: map[string]interface{}{"Temperature": 20.0},
+		},
+		{
+			name: "alias to itself kept",
+			item: map[string]interface{}{"Humidity": 40.0},
+			want: map[string]interface{}{"Humidity": 40.0},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ApplyAliases(test.item, aliases)
+			if !reflect.DeepEqual(test.item, test.want) {
+				t.Errorf("ApplyAliases() = %v, want %v", test.item, test.want)
+			}
+		})
+	}
+}
+
+func TestAttributeAliases(t *testing.T) {
+	tests := []struct {
+		name    string
+		aliases string
+		want    map[string]string
+	}{
+		{name: "unset"},
+		{name: "configured", aliases: `{"temp": "Temperature"}`, want: map[string]string{"temp": "Temperature"}},
+		{name: "malformed", aliases: `{"temp":`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Setenv("ATTRIBUTE_ALIASES", test.aliases)
+			if got := AttributeAliases(); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("AttributeAliases() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestAddCompositeKeys(t *testing.T) {
+	tests := []struct {
+		name string
+		item map[string]interface{}
+		want map[string]interface{}
+	}{
+		{
+			name: "device",
+			item: map[string]interface{}{"ProjectId": "sensors", "DeviceId": "d1"},
+			want: map[string]interface{}{
+				"ProjectId": "sensors", "DeviceId": "d1", "ProjectId#DeviceId": "sensors#d1",
+			},
+		},
+		{
+			name: "device and location",
+			item: map[string]interface{}{"ProjectId": "sensors", "DeviceId": "d1", "LocationId": "roof"},
+			want: map[string]interface{}{
+				"ProjectId": "sensors", "DeviceId": "d1", "LocationId": "roof",
+				"ProjectId#DeviceId": "sensors#d1", "ProjectId#LocationId": "sensors#roof",
+			},
+		},
+		{
+			name: "tenant",
+			item: map[string]interface{}{"TenantId": "acme", "ProjectId": "sensors", "DeviceId": "d1"},
+			want: map[string]interface{}{
+				"TenantId": "acme", "ProjectId": "sensors", "DeviceId": "d1",
+				"ProjectId#DeviceId": "acme#sensors#d1",
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			AddCompositeKeys(test.item)
+			if !reflect.DeepEqual(test.item, test.want) {
+				t.Errorf("AddCompositeKeys() = %v, want %v", test.item, test.want)
+			}
+		})
+	}
+}
+
+func TestApplyRounding(t *testing.T) {
+	rounding := map[string]int{"Temperature": 1, "Humidity": 0, "Label": 2}
+	item := map[string]interface{}{"Temperature": 21.46, "Humidity": 40.5, "Label": "x", "Battery": 3.14159}
+	want := map[string]interface{}{"Temperature": 21.5, "Humidity": 41.0, "Label": "x", "Battery": 3.14159}
+
+	ApplyRounding(item, rounding)
+	if !reflect.DeepEqual(item, want) {
+		t.Errorf("ApplyRounding() = %v, want %v", item, want)
+	}
+}
+
+func TestRecordReceivedAt(t *testing.T) {
+	tests := []struct {
+		value string
+		want  bool
+	}{
+		{value: ""},
+		{value: "true", want: true},
+		{value: "0"},
+		{value: "sometimes"},
+	}
+	for _, test := range tests {
+		t.Run(test.value, func(t *testing.T) {
+			t.Setenv("RECORD_RECEIVED_AT", test.value)
+			if got := RecordReceivedAt(); got != test.want {
+				t.Errorf("RecordReceivedAt() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestRemoveServerManagedFields(t *testing.T) {
+	tests := []struct {
+		name    string
+		mode    string
+		item    map[string]interface{}
+		want    map[string]interface{}
+		wantErr bool
+	}{
+		{
+			name: "none supplied",
+			item: map[string]interface{}{"DeviceId": "d1"},
+			want: map[string]interface{}{"DeviceId": "d1"},
+		},
+		{
+			name: "dropped",
+			item: map[string]interface{}{"DeviceId": "d1", "TenantId": "acme", "ExpiresAt": 1.0},
+			want: map[string]interface{}{"DeviceId": "d1"},
+		},
+		{
+			name:    "rejected",
+			mode:    "reject",
+			item:    map[string]interface{}{"DeviceId": "d1", "ReceivedAt": 1.0},
+			want:    map[string]interface{}{"DeviceId": "d1", "ReceivedAt": 1.0},
+			wantErr: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Setenv("SERVER_FIELDS_MODE", test.mode)
+			err := RemoveServerManagedFields(test.item)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("RemoveServerManagedFields() error = %v, wantErr %v", err, test.wantErr)
+			}
+			if !reflect.DeepEqual(test.item, test.want) {
+				t.Errorf("RemoveServerManagedFields() = %v, want %v", test.item, test.want)
+			}
+		})
+	}
+}
+
+func TestDropNonFiniteNumbers(t *testing.T) {
+	tests := []struct {
+		mode string
+		want bool
+	}{
+		{mode: ""},
+		{mode: "reject"},
+		{mode: "drop", want: true},
+		{mode: "DROP", want: true},
+	}
+	for _, test := range tests {
+		t.Run(test.mode, func(t *testing.T) {
+			t.Setenv("NON_FINITE_NUMBERS", test.mode)
+			if got := DropNonFiniteNumbers(); got != test.want {
+				t.Errorf("DropNonFiniteNumbers() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestHandleNonFiniteNumbers(t *testing.T) {
+	item := func() map[string]interface{} {
+		return map[string]interface{}{
+			"Temperature": 21.5,
+			"Humidity":    math.NaN(),
+			"Config":      map[string]interface{}{"gain": math.Inf(1), "offset": 1.0},
+			"Samples":     []interface{}{1.0, math.Inf(-1), 2.0},
+		}
+	}
+	tests := []struct {
+		name    string
+		drop    bool
+		item    map[string]interface{}
+		want    map[string]interface{}
+		wantErr string
+	}{
+		{
+			name: "finite",
+			item: map[string]interface{}{"Temperature": 21.5, "Label": "x"},
+			want: map[string]interface{}{"Temperature": 21.5, "Label": "x"},
+		},
+		{
+			name:    "rejected, naming the first in order",
+			item:    item(),
+			wantErr: "Config.gain must be a finite number, got +Inf",
+		},
+		{
+			name:    "rejected in a list",
+			item:    map[string]interface{}{"Samples": []interface{}{1.0, math.Inf(-1)}},
+			wantErr: "Samples[1] must be a finite number, got -Inf",
+		},
+		{
+			name: "dropped",
+			drop: true,
+			item: item(),
+			want: map[string]interface{}{
+				"Temperature": 21.5,
+				"Config":      map[string]interface{}{"offset": 1.0},
+				"Samples":     []interface{}{1.0, 2.0},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := HandleNonFiniteNumbers(test.item, test.drop)
+			if test.wantErr != "" {
+				if err == nil || err.Error() != test.wantErr {
+					t.Errorf("HandleNonFiniteNumbers() error = %v, want %q", err, test.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("HandleNonFiniteNumbers() error = %v", err)
+			}
+			if !reflect.DeepEqual(test.item, test.want) {
+				t.Errorf("HandleNonFiniteNumbers() = %v, want %v", test.item, test.want)
+			}
+		})
+	}
+}
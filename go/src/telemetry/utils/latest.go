@@ -0,0 +1,105 @@
+package utils
+
+import (
+	"strconv"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// NumberAttribute returns the value of a numeric attribute of an item,
+// and whether the item has that attribute as a number.
+func NumberAttribute(item map[string]types.AttributeValue, name string) (float64, bool) {
+	number, ok := item[name].(*types.AttributeValueMemberN)
+	if !ok {
+		return 0, false
+	}
+	value, err := strconv.ParseFloat(number.Value, 64)
+	if err != nil {
+		return 0, false
+	}
+	return value, true
+}
+
+// StringAttribute returns the value of a string attribute of an item,
+// and whether the item has that attribute as a string.
+func StringAttribute(item map[string]types.AttributeValue, name string) (string, bool) {
+	str, ok := item[name].(*types.AttributeValueMemberS)
+	if !ok {
+		return "", false
+	}
+	return str.Value, true
+}
+
+// LatestPerLocation reduces items to the one with the greatest EpochTime for each LocationId,
+// in a single pass. Items without a LocationId or EpochTime are skipped, so a location with
+// no data is absent from the result. Readings from different devices with the same EpochTime
+// are resolved in favor of the lowest DeviceId, so the result doesn't depend on item order.
+func LatestPerLocation(
+	items []map[string]types.AttributeValue,
+) map[string]map[string]types.AttributeValue {
+	latest := make(map[string]map[string]types.AttributeValue)
+	for _, item := range items {
+		location, locationOk := StringAttribute(item, "LocationId")
+		epochTime, epochTimeOk := NumberAttribute(item, "EpochTime")
+		if !locationOk || !epochTimeOk {
+			continue
+		}
+
+		current, currentOk := latest[location]
+		if !currentOk {
+			latest[location] = item
+			continue
+		}
+		currentTime, _ := NumberAttribute(current, "EpochTime")
+		if epochTime > currentTime || (epochTime == currentTime && lowerDeviceId(item, current)) {
+			latest[location] = item
+		}
+	}
+	return latest
+}
+
+// EarliestPerDevice reduces items to the one with the least EpochTime for each DeviceId,
+// in a single pass, telling when each device first reported. Items without a DeviceId or EpochTime
+// are skipped, so no items reduce to an empty map. Readings with the same EpochTime are resolved
+// in favor of the lower SequenceNum, so the result doesn't depend on item order.
+func EarliestPerDevice(
+	items []map[string]types.AttributeValue,
+) map[string]map[string]types.AttributeValue {
+	earliest := make(map[string]map[string]types.AttributeValue)
+	for _, item := range items {
+		device, deviceOk := StringAttribute(item, "DeviceId")
+		epochTime, epochTimeOk := NumberAttribute(item, "EpochTime")
+		if !deviceOk || !epochTimeOk {
+			continue
+		}
+
+		current, currentOk := earliest[device]
+		if !currentOk {
+			earliest[device] = item
+			continue
+		}
+		currentTime, _ := NumberAttribute(current, "EpochTime")
+		if epochTime < currentTime || (epochTime == currentTime && lowerSequenceNum(item, current)) {
+			earliest[device] = item
+		}
+	}
+	return earliest
+}
+
+// lowerSequenceNum reports whether a's SequenceNum is less than b's, breaking ties between
+// readings from the same device. A reading without one sorts first.
+func lowerSequenceNum(a map[string]types.AttributeValue, b map[string]types.AttributeValue) bool {
+	aSequence, aOk := NumberAttribute(a, "SequenceNum")
+	bSequence, bOk := NumberAttribute(b, "SequenceNum")
+	if aOk != bOk {
+		return bOk
+	}
+	return aSequence < bSequence
+}
+
+// lowerDeviceId reports whether a's DeviceId sorts before b's, breaking ties between readings.
+func lowerDeviceId(a map[string]types.AttributeValue, b map[string]types.AttributeValue) bool {
+	aDevice, _ := StringAttribute(a, "DeviceId")
+	bDevice, _ := StringAttribute(b, "DeviceId")
+	return aDevice < bDevice
+}
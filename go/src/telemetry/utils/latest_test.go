@@ -0,0 +1,163 @@
+package utils
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// locationReading returns an item from a device at a location.
+func locationReading(location string, device string, epochTime string) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{
+		"LocationId": stringAttr(location),
+		"DeviceId":   stringAttr(device),
+		"EpochTime":  numberAttr(epochTime),
+	}
+}
+
+func TestNumberAttribute(t *testing.T) {
+	item := map[string]types.AttributeValue{
+		"EpochTime": numberAttr("1.5"),
+		"DeviceId":  stringAttr("d1"),
+		"Broken":    numberAttr("x"),
+	}
+	tests := []struct {
+		name   string
+		want   float64
+		wantOk bool
+	}{
+		{name: "EpochTime", want: 1.5, wantOk: true},
+		{name: "DeviceId"},
+		{name: "Broken"},
+		{name: "Missing"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, ok := NumberAttribute(item, test.name)
+			if got != test.want || ok != test.wantOk {
+				t.Errorf("NumberAttribute() = %v, %v, want %v, %v", got, ok, test.want, test.wantOk)
+			}
+		})
+	}
+}
+
+func TestStringAttribute(t *testing.T) {
+	item := map[string]types.AttributeValue{"DeviceId": stringAttr("d1"), "EpochTime": numberAttr("1")}
+	if got, ok := StringAttribute(item, "DeviceId"); got != "d1" || !ok {
+		t.Errorf("StringAttribute(DeviceId) = %q, %v, want d1, true", got, ok)
+	}
+	if got, ok := StringAttribute(item, "EpochTime"); got != "" || ok {
+		t.Errorf("StringAttribute(EpochTime) = %q, %v, want no string", got, ok)
+	}
+}
+
+func TestLatestPerLocation(t *testing.T) {
+	tests := []struct {
+		name  string
+		items []map[string]types.AttributeValue
+		want  map[string]map[string]types.AttributeValue
+	}{
+		{
+			name: "no items",
+			want: map[string]map[string]types.AttributeValue{},
+		},
+		{
+			name: "newest at each location",
+			items: []map[string]types.AttributeValue{
+				locationReading("roof", "d1", "2"),
+				locationReading("roof", "d1", "3"),
+				locationReading("roof", "d1", "1"),
+				locationReading("lab", "d2", "1"),
+			},
+			want: map[string]map[string]types.AttributeValue{
+				"roof": locationReading("roof", "d1", "3"),
+				"lab":  locationReading("lab", "d2", "1"),
+			},
+		},
+		{
+			name: "ties go to the lowest DeviceId",
+			items: []map[string]types.AttributeValue{
+				locationReading("roof", "d2", "1"),
+				locationReading("roof", "d1", "1"),
+				locationReading("roof", "d3", "1"),
+			},
+			want: map[string]map[string]types.AttributeValue{
+				"roof": locationReading("roof", "d1", "1"),
+			},
+		},
+		{
+			name: "items without a location or time skipped",
+			items: []map[string]types.AttributeValue{
+				{"DeviceId": stringAttr("d1"), "EpochTime": numberAttr("1")},
+				{"LocationId": stringAttr("roof"), "DeviceId": stringAttr("d1")},
+			},
+			want: map[string]map[string]types.AttributeValue{},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := LatestPerLocation(test.items); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("LatestPerLocation() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestEarliestPerDevice(t *testing.T) {
+	sequenced := func(device string, epochTime string, sequence string) map[string]types.AttributeValue {
+		item := map[string]types.AttributeValue{"DeviceId": stringAttr(device), "EpochTime": numberAttr(epochTime)}
+		if sequence != "" {
+			item["SequenceNum"] = numberAttr(sequence)
+		}
+		return item
+	}
+	tests := []struct {
+		name  string
+		items []map[string]types.AttributeValue
+		want  map[string]map[string]types.AttributeValue
+	}{
+		{
+			name: "no items",
+			want: map[string]map[string]types.AttributeValue{},
+		},
+		{
+			name: "oldest of each device",
+			items: []map[string]types.AttributeValue{
+				sequenced("d1", "2", ""),
+				sequenced("d1", "1", ""),
+				sequenced("d1", "3", ""),
+				sequenced("d2", "5", ""),
+			},
+			want: map[string]map[string]types.AttributeValue{
+				"d1": sequenced("d1", "1", ""),
+				"d2": sequenced("d2", "5", ""),
+			},
+		},
+		{
+			name:  "ties go to the lowest SequenceNum",
+			items: []map[string]types.AttributeValue{sequenced("d1", "1", "8"), sequenced("d1", "1", "7")},
+			want:  map[string]map[string]types.AttributeValue{"d1": sequenced("d1", "1", "7")},
+		},
+		{
+			name:  "ties go to the unsequenced reading",
+			items: []map[string]types.AttributeValue{sequenced("d1", "1", "7"), sequenced("d1", "1", "")},
+			want:  map[string]map[string]types.AttributeValue{"d1": sequenced("d1", "1", "")},
+		},
+		{
+			name: "items without a device or time skipped",
+			items: []map[string]types.AttributeValue{
+				{"EpochTime": numberAttr("1")},
+				{"DeviceId": stringAttr("d1")},
+			},
+			want: map[string]map[string]types.AttributeValue{},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := EarliestPerDevice(test.items); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("EarliestPerDevice() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,148 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"sync"
+	"telemetry/constants"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// Metric is a single CloudWatch metric value.
+type Metric struct {
+	Name  string
+	Unit  string
+	Value float64
+}
+
+// metricsOutput is where EMF documents are written. CloudWatch Logs picks them up from stdout.
+var metricsOutput io.Writer = os.Stdout
+
+// metricsOutputMutex serializes writes to metricsOutput, so that documents from concurrent
+// requests are never interleaved.
+var metricsOutputMutex sync.Mutex
+
+// metricsBuffer collects the EMF documents emitted while a handler wrapped by WithMetrics runs.
+// Each request has its own, carried in its context, so concurrent requests never share one.
+type metricsBuffer struct {
+	mutex  sync.Mutex
+	buffer bytes.Buffer
+}
+
+// metricsBufferKey is the context key of a request's metricsBuffer.
+type metricsBufferKey struct{}
+
+type emfMetricDefinition struct {
+	Name string `json:"Name"`
+	Unit string `json:"Unit,omitempty"`
+}
+
+type emfDirective struct {
+	Namespace  string                `json:"Namespace"`
+	Dimensions [][]string            `json:"Dimensions"`
+	Metrics    []emfMetricDefinition `json:"Metrics"`
+}
+
+type emfMetadata struct {
+	Timestamp         int64          `json:"Timestamp"`
+	CloudWatchMetrics []emfDirective `json:"CloudWatchMetrics"`
+}
+
+// EncodeEMF serializes metrics in the CloudWatch Embedded Metric Format,
+// with the given dimensions as a single dimension set.
+func EncodeEMF(
+	timestamp time.Time,
+	dimensions map[string]string,
+	metrics ...Metric,
+) ([]byte, error) {
+	dimensionNames := make([]string, 0, len(dimensions))
+	for name := range dimensions {
+		dimensionNames = append(dimensionNames, name)
+	}
+	sort.Strings(dimensionNames)
+
+	definitions := make([]emfMetricDefinition, 0, len(metrics))
+	for _, metric := range metrics {
+		definitions = append(definitions, emfMetricDefinition{Name: metric.Name, Unit: metric.Unit})
+	}
+
+	// EMF places the dimension and metric values at the top level of the document,
+	// next to the '_aws' metadata that describes them.
+	document := make(map[string]interface{}, len(dimensions)+len(metrics)+1)
+	for name, value := range dimensions {
+		document[name] = value
+	}
+	for _, metric := range metrics {
+		document[metric.Name] = metric.Value
+	}
+	document["_aws"] = emfMetadata{
+		Timestamp: timestamp.UnixNano() / int64(time.Millisecond),
+		CloudWatchMetrics: []emfDirective{
+			{
+				Namespace:  constants.METRICS_NAMESPACE,
+				Dimensions: [][]string{dimensionNames},
+				Metrics:    definitions,
+			},
+		},
+	}
+	return json.Marshal(document)
+}
+
+// EmitMetrics writes metrics to stdout in the Embedded Metric Format, or buffers them until
+// the handler returns when the context belongs to a request served by a handler wrapped by WithMetrics.
+// Failing to emit a metric is logged, but never fails the request.
+func EmitMetrics(ctx context.Context, dimensions map[string]string, metrics ...Metric) {
+	document, err := EncodeEMF(Now(), dimensions, metrics...)
+	if err != nil {
+		log.Printf("Could not encode metrics, %v", err)
+		return
+	}
+	document = append(document, '\n')
+
+	if buffer, ok := ctx.Value(metricsBufferKey{}).(*metricsBuffer); ok {
+		buffer.mutex.Lock()
+		defer buffer.mutex.Unlock()
+		buffer.buffer.Write(document)
+		return
+	}
+	writeMetrics(document)
+}
+
+// writeMetrics writes EMF documents to metricsOutput in a single write.
+func writeMetrics(documents []byte) {
+	metricsOutputMutex.Lock()
+	defer metricsOutputMutex.Unlock()
+	if _, err := metricsOutput.Write(documents); err != nil {
+		log.Printf("Could not write metrics, %v", err)
+	}
+}
+
+// flush writes the buffered metrics in a single write.
+func (buffer *metricsBuffer) flush() {
+	buffer.mutex.Lock()
+	defer buffer.mutex.Unlock()
+	if buffer.buffer.Len() > 0 {
+		writeMetrics(buffer.buffer.Bytes())
+		buffer.buffer.Reset()
+	}
+}
+
+// WithMetrics buffers the metrics a handler emits through its request's context, and flushes
+// them once it returns, whether it succeeds, fails, or panics, so that no metrics are lost when
+// the Lambda is frozen.
+func WithMetrics(handler Handler) Handler {
+	return func(request *Request) (events.APIGatewayProxyResponse, error) {
+		buffer := &metricsBuffer{}
+		defer buffer.flush()
+
+		ctx := context.WithValue(request.Context(), metricsBufferKey{}, buffer)
+		return handler(request.WithContext(ctx))
+	}
+}
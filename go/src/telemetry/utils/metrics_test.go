@@ -0,0 +1,192 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+
+	"telemetry/constants"
+)
+
+// captureMetrics redirects the metrics written until the test finishes into the returned buffer.
+func captureMetrics(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	var output bytes.Buffer
+	previous := metricsOutput
+	metricsOutput = &output
+	t.Cleanup(func() { metricsOutput = previous })
+	return &output
+}
+
+func TestEncodeEMF(t *testing.T) {
+	document, err := EncodeEMF(
+		time.Unix(1600000000, 5e6),
+		map[string]string{"ProjectId": "sensors", "Endpoint": "project"},
+		Metric{Name: "ItemsWritten", Unit: "Count", Value: 3},
+		Metric{Name: "Latency", Value: 12.5},
+	)
+	if err != nil {
+		t.Fatalf("EncodeEMF() error = %v", err)
+	}
+	var got map[string]interface{}
+	if err := json.Unmarshal(document, &got); err != nil {
+		t.Fatalf("EncodeEMF() = %s, not JSON, %v", document, err)
+	}
+	want := map[string]interface{}{
+		"ProjectId":    "sensors",
+		"Endpoint":     "project",
+		"ItemsWritten": 3.0,
+		"Latency":      12.5,
+		"_aws": map[string]interface{}{
+			"Timestamp": 1600000000005.0,
+			"CloudWatchMetrics": []interface{}{map[string]interface{}{
+				"Namespace":  constants.METRICS_NAMESPACE,
+				"Dimensions": []interface{}{[]interface{}{"Endpoint", "ProjectId"}},
+				"Metrics": []interface{}{
+					map[string]interface{}{"Name": "ItemsWritten", "Unit": "Count"},
+					map[string]interface{}{"Name": "Latency"},
+				},
+			}},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("EncodeEMF() = %v, want %v", got, want)
+	}
+}
+
+func TestEmitMetrics(t *testing.T) {
+	output := captureMetrics(t)
+	EmitMetrics(context.Background(), nil, Metric{Name: "ItemsWritten", Value: 1})
+	EmitMetrics(context.Background(), nil, Metric{Name: "ItemsRejected", Value: 2})
+
+	lines := strings.Split(strings.TrimSuffix(output.String(), "\n"), "\n")
+	if len(lines) != 2 || !strings.Contains(lines[0], `"ItemsWritten":1`) ||
+		!strings.Contains(lines[1], `"ItemsRejected":2`) {
+		t.Errorf("EmitMetrics() wrote %q, want a document per call", output.String())
+	}
+}
+
+func TestWithMetrics(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler Handler
+		panics  bool
+	}{
+		{
+			name: "returns",
+			handler: func(request *Request) (events.APIGatewayProxyResponse, error) {
+				EmitMetrics(request.Context(), nil, Metric{Name: "ItemsWritten", Value: 1})
+				return events.APIGatewayProxyResponse{StatusCode: 200}, nil
+			},
+		},
+		{
+			name: "panics",
+			handler: func(request *Request) (events.APIGatewayProxyResponse, error) {
+				EmitMetrics(request.Context(), nil, Metric{Name: "ItemsWritten", Value: 1})
+				panic("handler failed")
+			},
+			panics: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			output := captureMetrics(t)
+			handler := WithMetrics(func(request *Request) (events.APIGatewayProxyResponse, error) {
+				defer func() {
+					if output.Len() != 0 {
+						t.Errorf("metrics written before the handler returned: %q", output.String())
+					}
+				}()
+				return test.handler(request)
+			})
+
+			func() {
+				defer func() {
+					if recovered := recover(); (recovered != nil) != test.panics {
+						t.Errorf("recovered %v, want panic %v", recovered, test.panics)
+					}
+				}()
+				handler(&Request{})
+			}()
+			if !strings.Contains(output.String(), `"ItemsWritten":1`) {
+				t.Errorf("WithMetrics() flushed %q, want the handler's metrics", output.String())
+			}
+		})
+	}
+}
+
+func TestWithMetricsSeparatesRequests(t *testing.T) {
+	output := captureMetrics(t)
+	var inner *Request
+	outer := WithMetrics(func(request *Request) (events.APIGatewayProxyResponse, error) {
+		// A second request served while the first is running flushes only its own metrics.
+		WithMetrics(func(request *Request) (events.APIGatewayProxyResponse, error) {
+			inner = request
+			EmitMetrics(request.Context(), nil, Metric{Name: "Inner", Value: 1})
+			return events.APIGatewayProxyResponse{}, nil
+		})(&Request{})
+		EmitMetrics(request.Context(), nil, Metric{Name: "Outer", Value: 1})
+		if strings.Contains(output.String(), "Outer") || !strings.Contains(output.String(), "Inner") {
+			t.Errorf("after the inner request, wrote %q, want only its metrics", output.String())
+		}
+		return events.APIGatewayProxyResponse{}, nil
+	})
+	outer(&Request{})
+	if inner == nil || !strings.Contains(output.String(), "Outer") {
+		t.Errorf("WithMetrics() wrote %q, want both requests' metrics", output.String())
+	}
+}
+
+// countingWriter counts the writes made to it.
+type countingWriter struct {
+	bytes.Buffer
+	writes int
+}
+
+func (writer *countingWriter) Write(p []byte) (int, error) {
+	writer.writes++
+	return writer.Buffer.Write(p)
+}
+
+func TestWithMetricsFlushesOnce(t *testing.T) {
+	tests := []struct {
+		name    string
+		metrics []string
+		err     error
+		want    int
+	}{
+		{name: "no metrics", want: 0},
+		{name: "one metric", metrics: []string{"ItemsWritten"}, want: 1},
+		{name: "several metrics", metrics: []string{"ItemsWritten", "ItemsRejected", "Latency"}, want: 1},
+		{name: "failed handler", metrics: []string{"ItemsWritten"}, err: errors.New("failed"), want: 1},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			output := &countingWriter{}
+			previous := metricsOutput
+			metricsOutput = output
+			t.Cleanup(func() { metricsOutput = previous })
+
+			WithMetrics(func(request *Request) (events.APIGatewayProxyResponse, error) {
+				for _, name := range test.metrics {
+					EmitMetrics(request.Context(), nil, Metric{Name: name, Value: 1})
+				}
+				return events.APIGatewayProxyResponse{}, test.err
+			})(&Request{})
+
+			if output.writes != test.want {
+				t.Errorf("WithMetrics() made %d writes, want %d", output.writes, test.want)
+			}
+			if lines := strings.Count(output.String(), "\n"); lines != len(test.metrics) {
+				t.Errorf("WithMetrics() wrote %d documents, want %d", lines, len(test.metrics))
+			}
+		})
+	}
+}
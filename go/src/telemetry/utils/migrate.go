@@ -0,0 +1,131 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"telemetry/constants"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go/aws"
+)
+
+// DynamoDbMigrateAPI defines the interface for scanning items and updating them in place.
+type DynamoDbMigrateAPI interface {
+	DynamoDbScanAPI
+	DynamoDbUpdateItemAPI
+}
+
+// MigrationResult reports one batch of BackfillLocationKeys.
+// NextCursor resumes the migration where the batch ended, and is empty once the table is done.
+type MigrationResult struct {
+	Scanned    int    `json:"scanned"`
+	Missing    int    `json:"missing"`
+	Updated    int    `json:"updated"`
+	DryRun     bool   `json:"dryRun"`
+	NextCursor string `json:"nextCursor,omitempty"`
+}
+
+// BackfillLocationKeys scans one batch of up to batchSize items for readings that have
+// a LocationId but lack the ProjectId#LocationId composite key, as older writes do, and sets it,
+// so that the location endpoint can find them. Each batch resumes from the cursor returned
+// by the previous one, or starts at the beginning of the table when the cursor is empty.
+// With dryRun, the readings missing the key are counted but not updated.
+func BackfillLocationKeys(
+	ctx context.Context,
+	api DynamoDbMigrateAPI,
+	cursor string,
+	batchSize int,
+	dryRun bool,
+) (MigrationResult, error) {
+	result := MigrationResult{DryRun: dryRun}
+	input := &dynamodb.ScanInput{
+		TableName:        aws.String(constants.TABLE_NAME),
+		FilterExpression: aws.String("attribute_exists(#location) AND attribute_not_exists(#locationKey)"),
+		ExpressionAttributeNames: map[string]string{
+			"#location":    "LocationId",
+			"#locationKey": "ProjectId#LocationId",
+		},
+	}
+	if batchSize > 0 && batchSize <= math.MaxInt32 {
+		input.Limit = aws.Int32(int32(batchSize))
+	}
+	previous := 0
+	if cursor != "" {
+		var err error
+		if input.ExclusiveStartKey, previous, err = DecodeCursor(cursor); err != nil {
+			return result, err
+		}
+	}
+
+	output, err := api.Scan(ctx, input)
+	if err != nil {
+		return result, fmt.Errorf("failed to scan table, %w", err)
+	}
+	result.Scanned = int(output.ScannedCount)
+	result.Missing = len(output.Items)
+	if !dryRun {
+		for _, item := range output.Items {
+			updated, err := setLocationKey(ctx, api, item)
+			if err != nil {
+				return result, err
+			}
+			if updated {
+				result.Updated++
+			}
+		}
+	}
+	if output.LastEvaluatedKey != nil {
+		if result.NextCursor, err = EncodeCursor(output.LastEvaluatedKey, previous+result.Scanned); err != nil {
+			return result, err
+		}
+	}
+	return result, nil
+}
+
+// setLocationKey sets the reading's ProjectId#LocationId composite key from its identifiers,
+// reporting whether it did. A reading that gained the key, or was deleted, since it was scanned
+// is left alone.
+func setLocationKey(
+	ctx context.Context,
+	api DynamoDbUpdateItemAPI,
+	item map[string]types.AttributeValue,
+) (bool, error) {
+	project, projectOk := StringAttribute(item, "ProjectId")
+	if !projectOk {
+		return false, nil
+	}
+	tenant, _ := StringAttribute(item, "TenantId")
+	location, ok := StringAttribute(item, "LocationId")
+	if !ok {
+		// Some firmware stored the LocationId as a number, which is keyed by its canonical form.
+		number, numberOk := NumberAttribute(item, "LocationId")
+		if !numberOk {
+			return false, nil
+		}
+		location = formatNumber(number)
+	}
+	_, err := api.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:           aws.String(constants.TABLE_NAME),
+		Key:                 ItemKey(item),
+		UpdateExpression:    aws.String("SET #locationKey = :locationKey"),
+		ConditionExpression: aws.String("attribute_exists(#deviceKey) AND attribute_not_exists(#locationKey)"),
+		ExpressionAttributeNames: map[string]string{
+			"#deviceKey":   "ProjectId#DeviceId",
+			"#locationKey": "ProjectId#LocationId",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":locationKey": &types.AttributeValueMemberS{Value: PartitionKey(tenant, project, location)},
+		},
+	})
+	var conditionFailed *types.ConditionalCheckFailedException
+	if errors.As(err, &conditionFailed) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to update item, %w", err)
+	}
+	return true, nil
+}
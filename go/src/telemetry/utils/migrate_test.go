@@ -0,0 +1,126 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+
+	"telemetry/utils/dynamotest"
+)
+
+func TestBackfillLocationKeys(t *testing.T) {
+	const missing = `{"Count": 3, "ScannedCount": 10, "Items": [
+		{"ProjectId#DeviceId": {"S": "sensors#d1"}, "EpochTime": {"N": "1"},
+			"ProjectId": {"S": "sensors"}, "LocationId": {"S": "roof"}},
+		{"ProjectId#DeviceId": {"S": "acme#sensors#d1"}, "EpochTime": {"N": "2"},
+			"ProjectId": {"S": "sensors"}, "TenantId": {"S": "acme"}, "LocationId": {"N": "7.0"}},
+		{"ProjectId#DeviceId": {"S": "sensors#d1"}, "EpochTime": {"N": "3"}, "LocationId": {"S": "roof"}}
+	], "LastEvaluatedKey": {"ProjectId#DeviceId": {"S": "sensors#d1"}, "EpochTime": {"N": "3"}}}`
+	cursor, err := EncodeCursor(map[string]types.AttributeValue{
+		"ProjectId#DeviceId": stringAttr("sensors#d1"),
+		"EpochTime":          numberAttr("3"),
+	}, 10)
+	if err != nil {
+		t.Fatalf("EncodeCursor() error = %v", err)
+	}
+	tests := []struct {
+		name        string
+		cursor      string
+		dryRun      bool
+		setup       func(server *dynamotest.Server)
+		want        MigrationResult
+		wantErr     bool
+		wantErrIs   error
+		wantKeys    []string
+		wantResumed bool
+	}{
+		{
+			name:  "keys set",
+			setup: func(server *dynamotest.Server) { server.Respond("Scan", missing) },
+			// The reading without a ProjectId can't be keyed.
+			want:     MigrationResult{Scanned: 10, Missing: 3, Updated: 2, NextCursor: cursor},
+			wantKeys: []string{"sensors#roof", "acme#sensors#7"},
+		},
+		{
+			name:   "dry run",
+			dryRun: true,
+			setup:  func(server *dynamotest.Server) { server.Respond("Scan", missing) },
+			want:   MigrationResult{Scanned: 10, Missing: 3, DryRun: true, NextCursor: cursor},
+		},
+		{
+			name:   "resumed to the end of the table",
+			cursor: cursor,
+			setup: func(server *dynamotest.Server) {
+				server.Respond("Scan", `{"Count": 0, "ScannedCount": 5, "Items": []}`)
+			},
+			want:        MigrationResult{Scanned: 5},
+			wantResumed: true,
+		},
+		{
+			name: "keyed since the scan",
+			setup: func(server *dynamotest.Server) {
+				server.Respond("Scan", missing)
+				server.Fail("UpdateItem", "ConditionalCheckFailedException")
+			},
+			want:     MigrationResult{Scanned: 10, Missing: 3, Updated: 1, NextCursor: cursor},
+			wantKeys: []string{"sensors#roof", "acme#sensors#7"},
+		},
+		{name: "malformed cursor", cursor: "???", wantErr: true, wantErrIs: ErrInvalidCursor},
+		{
+			name:    "failed scan",
+			setup:   func(server *dynamotest.Server) { server.Fail("Scan", "InternalServerError") },
+			wantErr: true,
+		},
+		{
+			name: "failed update",
+			setup: func(server *dynamotest.Server) {
+				server.Respond("Scan", missing)
+				server.Fail("UpdateItem", "InternalServerError")
+			},
+			wantErr:  true,
+			wantKeys: []string{"sensors#roof"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := dynamotest.NewServer(t)
+			if test.setup != nil {
+				test.setup(server)
+			}
+
+			got, err := BackfillLocationKeys(context.Background(), server.Client(), test.cursor, 25, test.dryRun)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("BackfillLocationKeys() error = %v, wantErr %v", err, test.wantErr)
+			}
+			if test.wantErrIs != nil && !errors.Is(err, test.wantErrIs) {
+				t.Errorf("BackfillLocationKeys() error = %v, want %v", err, test.wantErrIs)
+			}
+			if !test.wantErr && got != test.want {
+				t.Errorf("BackfillLocationKeys() = %+v, want %+v", got, test.want)
+			}
+
+			scans := server.Calls("Scan")
+			for _, scan := range scans {
+				if scan.Input["Limit"] != 25.0 {
+					t.Errorf("Limit = %v, want 25", scan.Input["Limit"])
+				}
+				if _, resumed := scan.Input["ExclusiveStartKey"]; resumed != test.wantResumed {
+					t.Errorf("ExclusiveStartKey given %v, want %v", resumed, test.wantResumed)
+				}
+			}
+			updates := server.Calls("UpdateItem")
+			if len(updates) != len(test.wantKeys) {
+				t.Fatalf("made %d updates, want %d", len(updates), len(test.wantKeys))
+			}
+			for i, update := range updates {
+				values := update.Input["ExpressionAttributeValues"].(map[string]interface{})
+				key := values[":locationKey"].(map[string]interface{})["S"]
+				if key != test.wantKeys[i] {
+					t.Errorf("update %d set the location key %v, want %s", i, key, test.wantKeys[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,97 @@
+package utils
+
+import (
+	"context"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// SourceDeviceAttribute is the attribute QueryMultiple tags each item with, when asked,
+// naming the device, as it was listed, whose query returned the item.
+const SourceDeviceAttribute = "SourceDevice"
+
+// DeviceConcurrency is the number of devices QueryMultiple queries at once,
+// read from the DEVICE_QUERY_CONCURRENCY environment variable and 4 by default.
+func DeviceConcurrency() int {
+	if concurrency := envInt("DEVICE_QUERY_CONCURRENCY", 4); concurrency > 0 {
+		return concurrency
+	}
+	return 1
+}
+
+// deviceQueryInput copies the shared query input, keyed instead by the device's partition.
+// The key condition, filters, and time bounds are shared, so only the partition key value differs.
+func deviceQueryInput(shared *dynamodb.QueryInput, params QueryParams, device string) *dynamodb.QueryInput {
+	input := *shared
+	input.ExpressionAttributeValues = make(map[string]types.AttributeValue, len(shared.ExpressionAttributeValues))
+	for name, value := range shared.ExpressionAttributeValues {
+		input.ExpressionAttributeValues[name] = value
+	}
+	input.ExpressionAttributeValues[":primaryValue"] = &types.AttributeValueMemberS{
+		Value: PartitionKey(params.TenantId, NormalizeProjectId(params.ProjectId), device),
+	}
+	return &input
+}
+
+// QueryMultiple runs the same time-bounded query against each device of the project,
+// with at most DeviceConcurrency queries in flight, and merges the results into one series
+// ordered as the query asks. The query input is built once from the shared parameters
+// and only rekeyed for each device. When tag is set, every merged item carries
+// the device it was queried by in its SourceDevice attribute.
+// A device whose query fails is left out of the results, and its error is returned
+// in the map keyed by device, so one bad device doesn't hide the others' readings.
+func QueryMultiple(
+	ctx context.Context,
+	api DynamoDbQueryAPI,
+	devices []string,
+	params QueryParams,
+	tag bool,
+) ([]map[string]types.AttributeValue, map[string]error) {
+	errs := make(map[string]error)
+	if len(devices) == 0 {
+		return nil, errs
+	}
+	params.DeviceId = devices[0]
+	params.LocationId = ""
+	shared, err := BuildQueryInput(params)
+	if err != nil {
+		for _, device := range devices {
+			errs[device] = err
+		}
+		return nil, errs
+	}
+
+	results := make([][]map[string]types.AttributeValue, len(devices))
+	var mutex sync.Mutex
+	var wait sync.WaitGroup
+	slots := make(chan struct{}, DeviceConcurrency())
+
+	for i, device := range devices {
+		wait.Add(1)
+		go func(i int, device string) {
+			defer wait.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+
+			items, _, err := GetDataWithinBudget(ctx, api, deviceQueryInput(shared, params, device), params.maxItems(), 0)
+			if err != nil {
+				mutex.Lock()
+				errs[device] = err
+				mutex.Unlock()
+				return
+			}
+			items = Stride(items, params.Stride)
+			if tag {
+				for _, item := range items {
+					item[SourceDeviceAttribute] = &types.AttributeValueMemberS{Value: device}
+				}
+			}
+			results[i] = items
+		}(i, device)
+	}
+	wait.Wait()
+
+	return mergeResults(results, params), errs
+}
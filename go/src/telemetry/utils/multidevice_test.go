@@ -0,0 +1,108 @@
+package utils
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+func TestQueryMultiple(t *testing.T) {
+	tables := projectTables{
+		"sensors#d1": readingsAt("1", "3"),
+		"sensors#d2": readingsAt("2"),
+	}
+	reading := func(epochTime string) map[string]types.AttributeValue {
+		return map[string]types.AttributeValue{"EpochTime": numberAttr(epochTime)}
+	}
+	tagged := func(device string, epochTime string) map[string]types.AttributeValue {
+		return map[string]types.AttributeValue{"EpochTime": numberAttr(epochTime), SourceDeviceAttribute: stringAttr(device)}
+	}
+	tests := []struct {
+		name     string
+		devices  []string
+		params   QueryParams
+		tag      bool
+		want     []map[string]types.AttributeValue
+		wantErrs []string
+	}{
+		{name: "no devices"},
+		{
+			name:    "merged in order",
+			devices: []string{"d1", "d2"},
+			want:    []map[string]types.AttributeValue{reading("1"), reading("2"), reading("3")},
+		},
+		{
+			name:    "tagged with their device",
+			devices: []string{"d1", "d2"},
+			tag:     true,
+			want:    []map[string]types.AttributeValue{tagged("d1", "1"), tagged("d2", "2"), tagged("d1", "3")},
+		},
+		{
+			name:    "descending with a limit",
+			devices: []string{"d1", "d2"},
+			params:  QueryParams{Descending: true, Limit: 2},
+			want:    []map[string]types.AttributeValue{reading("3"), reading("2")},
+		},
+		{
+			name:    "most recent",
+			devices: []string{"d1", "d2"},
+			params:  QueryParams{Recent: 2},
+			want:    []map[string]types.AttributeValue{reading("2"), reading("3")},
+		},
+		{
+			name:     "failed device left out",
+			devices:  []string{"d2", "d3"},
+			tag:      true,
+			want:     []map[string]types.AttributeValue{tagged("d2", "2")},
+			wantErrs: []string{"d3"},
+		},
+		{
+			name:     "invalid query fails every device",
+			devices:  []string{"d1", "d2"},
+			params:   QueryParams{Index: "x"},
+			wantErrs: []string{"d1", "d2"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Setenv("DEVICE_QUERY_CONCURRENCY", "1")
+			params := test.params
+			params.ProjectId = "sensors"
+
+			got, errs := QueryMultiple(context.Background(), tables, test.devices, params, test.tag)
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("QueryMultiple() = %v, want %v", got, test.want)
+			}
+			var failed []string
+			for _, device := range test.devices {
+				if _, ok := errs[device]; ok {
+					failed = append(failed, device)
+				}
+			}
+			if !reflect.DeepEqual(failed, test.wantErrs) {
+				t.Errorf("failed devices = %v, want %v", failed, test.wantErrs)
+			}
+		})
+	}
+}
+
+func TestDeviceConcurrency(t *testing.T) {
+	tests := []struct {
+		value string
+		want  int
+	}{
+		{value: "", want: 4},
+		{value: "8", want: 8},
+		{value: "0", want: 1},
+	}
+	for _, test := range tests {
+		t.Run(test.value, func(t *testing.T) {
+			t.Setenv("DEVICE_QUERY_CONCURRENCY", test.value)
+			if got := DeviceConcurrency(); got != test.want {
+				t.Errorf("DeviceConcurrency() = %d, want %d", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,90 @@
+package utils
+
+import (
+	"context"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// ProjectConcurrency is the number of projects QueryProjects queries at once,
+// read from the PROJECT_QUERY_CONCURRENCY environment variable and 4 by default.
+func ProjectConcurrency() int {
+	if concurrency := envInt("PROJECT_QUERY_CONCURRENCY", 4); concurrency > 0 {
+		return concurrency
+	}
+	return 1
+}
+
+// QueryProjects runs the same query against each project's ProjectId-EpochTime-index,
+// with at most ProjectConcurrency queries in flight, and merges the results into one series
+// ordered as the query asks. Every merged item carries its ProjectId.
+// A project whose query fails is left out of the results, and its error is returned
+// in the map keyed by ProjectId, so one bad project doesn't hide the others' readings.
+// While tenants are isolated, each project's query is confined to the tenant that owns it.
+func QueryProjects(
+	ctx context.Context,
+	api DynamoDbQueryAPI,
+	projects []string,
+	params QueryParams,
+) ([]map[string]types.AttributeValue, map[string]error) {
+	results := make([][]map[string]types.AttributeValue, len(projects))
+	errs := make(map[string]error)
+	var mutex sync.Mutex
+	var wait sync.WaitGroup
+	slots := make(chan struct{}, ProjectConcurrency())
+
+	for i, project := range projects {
+		wait.Add(1)
+		go func(i int, project string) {
+			defer wait.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+
+			projectParams := params
+			projectParams.ProjectId = project
+			if TenantIsolation() {
+				projectParams.TenantId = ProjectTenant(NormalizeProjectId(project))
+			}
+			projectParams.DeviceId = ""
+			projectParams.LocationId = ""
+			items, err := QueryItems(ctx, api, projectParams)
+			if err != nil {
+				mutex.Lock()
+				errs[project] = err
+				mutex.Unlock()
+				return
+			}
+			for _, item := range items {
+				item["ProjectId"] = &types.AttributeValueMemberS{Value: project}
+			}
+			results[i] = items
+		}(i, project)
+	}
+	wait.Wait()
+
+	return mergeResults(results, params), errs
+}
+
+// mergeResults merges the results of several queries into one series, ordered and limited
+// as the query asks.
+func mergeResults(
+	results [][]map[string]types.AttributeValue,
+	params QueryParams,
+) []map[string]types.AttributeValue {
+	var merged []map[string]types.AttributeValue
+	for _, items := range results {
+		merged = append(merged, items...)
+	}
+	StableSortReadings(merged)
+	if params.Recent > 0 && len(merged) > params.Recent {
+		merged = merged[len(merged)-params.Recent:]
+	}
+	if params.Descending {
+		reverseItems(merged)
+	}
+	if params.Limit > 0 && len(merged) > params.Limit {
+		merged = merged[:params.Limit]
+	}
+	return merged
+}
@@ -0,0 +1,132 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// projectTables answers each project's query with its items, or fails it when it has none.
+type projectTables map[string][]map[string]types.AttributeValue
+
+func (tables projectTables) Query(
+	ctx context.Context,
+	params *dynamodb.QueryInput,
+	optFns ...func(*dynamodb.Options),
+) (*dynamodb.QueryOutput, error) {
+	project := params.ExpressionAttributeValues[":primaryValue"].(*types.AttributeValueMemberS).Value
+	items, ok := tables[project]
+	if !ok {
+		return nil, errors.New("query failed")
+	}
+	// Items are copied, so tagging them doesn't change the table.
+	copied := make([]map[string]types.AttributeValue, len(items))
+	for i, item := range items {
+		copied[i] = make(map[string]types.AttributeValue, len(item))
+		for name, value := range item {
+			copied[i][name] = value
+		}
+	}
+	return &dynamodb.QueryOutput{Items: copied, Count: int32(len(copied))}, nil
+}
+
+func TestQueryProjects(t *testing.T) {
+	tables := projectTables{
+		"sensors": readingsAt("1", "3"),
+		"dogs":    readingsAt("2"),
+	}
+	tagged := func(project string, epochTime string) map[string]types.AttributeValue {
+		return map[string]types.AttributeValue{"EpochTime": numberAttr(epochTime), "ProjectId": stringAttr(project)}
+	}
+	tests := []struct {
+		name     string
+		tenants  string
+		projects []string
+		params   QueryParams
+		want     []map[string]types.AttributeValue
+		wantErrs []string
+	}{
+		{
+			name:     "merged in order",
+			projects: []string{"sensors", "dogs"},
+			want:     []map[string]types.AttributeValue{tagged("sensors", "1"), tagged("dogs", "2"), tagged("sensors", "3")},
+		},
+		{
+			name:     "descending with a limit",
+			projects: []string{"sensors", "dogs"},
+			params:   QueryParams{Descending: true, Limit: 2},
+			want:     []map[string]types.AttributeValue{tagged("sensors", "3"), tagged("dogs", "2")},
+		},
+		{
+			name:     "most recent",
+			projects: []string{"sensors", "dogs"},
+			params:   QueryParams{Recent: 2},
+			want:     []map[string]types.AttributeValue{tagged("dogs", "2"), tagged("sensors", "3")},
+		},
+		{
+			name:     "failed project left out",
+			projects: []string{"dogs", "cats"},
+			want:     []map[string]types.AttributeValue{tagged("dogs", "2")},
+			wantErrs: []string{"cats"},
+		},
+		{
+			name:     "isolated tenants",
+			tenants:  `{"sensors": "acme", "dogs": "initech"}`,
+			projects: []string{"sensors", "dogs"},
+			want:     []map[string]types.AttributeValue{tagged("sensors", "1"), tagged("dogs", "2"), tagged("sensors", "3")},
+		},
+		{
+			name:     "isolated project without a tenant",
+			tenants:  `{"dogs": "initech"}`,
+			projects: []string{"sensors", "dogs"},
+			want:     []map[string]types.AttributeValue{tagged("dogs", "2")},
+			wantErrs: []string{"sensors"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			captureMetrics(t)
+			t.Setenv("PROJECT_QUERY_CONCURRENCY", "1")
+			if test.tenants != "" {
+				t.Setenv("TENANT_ISOLATION", "true")
+				t.Setenv("PROJECT_TENANTS", test.tenants)
+			}
+
+			got, errs := QueryProjects(context.Background(), tables, test.projects, test.params)
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("QueryProjects() = %v, want %v", got, test.want)
+			}
+			var failed []string
+			for project := range errs {
+				failed = append(failed, project)
+			}
+			if !reflect.DeepEqual(failed, test.wantErrs) {
+				t.Errorf("failed projects = %v, want %v", failed, test.wantErrs)
+			}
+		})
+	}
+}
+
+func TestProjectConcurrency(t *testing.T) {
+	tests := []struct {
+		value string
+		want  int
+	}{
+		{value: "", want: 4},
+		{value: "8", want: 8},
+		{value: "0", want: 1},
+		{value: "-2", want: 1},
+	}
+	for _, test := range tests {
+		t.Run(test.value, func(t *testing.T) {
+			t.Setenv("PROJECT_QUERY_CONCURRENCY", test.value)
+			if got := ProjectConcurrency(); got != test.want {
+				t.Errorf("ProjectConcurrency() = %d, want %d", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,26 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// EncodeNDJSON writes items as newline-delimited JSON, one plain JSON object per line.
+func EncodeNDJSON(items []map[string]types.AttributeValue) ([]byte, error) {
+	var buffer bytes.Buffer
+	encoder := json.NewEncoder(&buffer)
+	for _, item := range items {
+		if err := encoder.Encode(AttributeValuesToJSON(item)); err != nil {
+			return nil, err
+		}
+	}
+	return buffer.Bytes(), nil
+}
+
+// ItemsToNDJSON encodes items for streaming consumers, as EncodeNDJSON does for archives.
+func ItemsToNDJSON(items []map[string]types.AttributeValue) (string, error) {
+	body, err := EncodeNDJSON(items)
+	return string(body), err
+}
@@ -0,0 +1,36 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+func TestItemsToNDJSON(t *testing.T) {
+	tests := []struct {
+		name  string
+		items []map[string]types.AttributeValue
+		want  string
+	}{
+		{name: "no items", want: ""},
+		{
+			name: "one object per line",
+			items: []map[string]types.AttributeValue{
+				{"EpochTime": numberAttr("1"), "DeviceId": stringAttr("d1")},
+				{"EpochTime": numberAttr("2"), "Charging": &types.AttributeValueMemberBOOL{Value: true}},
+			},
+			want: "{\"DeviceId\":\"d1\",\"EpochTime\":1}\n{\"Charging\":true,\"EpochTime\":2}\n",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := ItemsToNDJSON(test.items)
+			if err != nil {
+				t.Fatalf("ItemsToNDJSON() error = %v", err)
+			}
+			if got != test.want {
+				t.Errorf("ItemsToNDJSON() = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
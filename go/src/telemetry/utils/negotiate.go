@@ -0,0 +1,79 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"mime"
+	"strconv"
+	"strings"
+)
+
+// Format is a serialization the GET endpoints can encode items in.
+type Format string
+
+const (
+	FormatJSON   Format = "json"
+	FormatCSV    Format = "csv"
+	FormatNDJSON Format = "ndjson"
+)
+
+// ErrNotAcceptable is returned when a client accepts none of the formats items can be encoded in.
+var ErrNotAcceptable = errors.New("not acceptable")
+
+// formatMediaTypes maps the media types, and media ranges, a client may accept to a format.
+var formatMediaTypes = map[string]Format{
+	"application/json":     FormatJSON,
+	"application/x-ndjson": FormatNDJSON,
+	"text/csv":             FormatCSV,
+	"*/*":                  FormatJSON,
+	"application/*":        FormatJSON,
+	"text/*":               FormatCSV,
+}
+
+// NegotiateFormat chooses the format to encode items in. The 'format' query string parameter,
+// one of json, csv, or ndjson, takes precedence. Otherwise, the Accept header's most preferred
+// supported media type is chosen, the first listed winning ties, and JSON when there is no
+// Accept header. A client that accepts none of them gets ErrNotAcceptable.
+func NegotiateFormat(request *Request) (Format, error) {
+	if format, formatOk := request.QueryStringParameters["format"]; formatOk {
+		switch chosen := Format(strings.ToLower(format)); chosen {
+		case FormatJSON, FormatCSV, FormatNDJSON:
+			return chosen, nil
+		}
+		return "", fmt.Errorf("%w: format must be json, csv, or ndjson, got %q", ErrNotAcceptable, format)
+	}
+
+	accept := request.Header("Accept")
+	if strings.TrimSpace(accept) == "" {
+		return FormatJSON, nil
+	}
+	var best Format
+	bestQuality := 0.0
+	for _, mediaRange := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(mediaRange)
+		if err != nil {
+			continue
+		}
+		format, supported := formatMediaTypes[mediaType]
+		if !supported {
+			continue
+		}
+		quality := 1.0
+		if q, qOk := params["q"]; qOk {
+			if quality, err = strconv.ParseFloat(q, 64); err != nil {
+				continue
+			}
+		}
+		if quality > bestQuality {
+			best, bestQuality = format, quality
+		}
+	}
+	if best == "" {
+		return "", fmt.Errorf(
+			"%w: Accept must allow application/json, text/csv, or application/x-ndjson, got %q",
+			ErrNotAcceptable,
+			accept,
+		)
+	}
+	return best, nil
+}
@@ -0,0 +1,49 @@
+package utils
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestNegotiateFormat(t *testing.T) {
+	tests := []struct {
+		name    string
+		format  string
+		accept  string
+		want    Format
+		wantErr bool
+	}{
+		{name: "default", want: FormatJSON},
+		{name: "format parameter", format: "CSV", want: FormatCSV},
+		{name: "format parameter over Accept", format: "ndjson", accept: "text/csv", want: FormatNDJSON},
+		{name: "unknown format parameter", format: "xml", wantErr: true},
+		{name: "CSV", accept: "text/csv", want: FormatCSV},
+		{name: "NDJSON", accept: "application/x-ndjson", want: FormatNDJSON},
+		{name: "anything", accept: "*/*", want: FormatJSON},
+		{name: "text range", accept: "text/*", want: FormatCSV},
+		{name: "by quality", accept: "application/json;q=0.5, text/csv;q=0.9", want: FormatCSV},
+		{name: "first wins ties", accept: "application/x-ndjson, application/json", want: FormatNDJSON},
+		{name: "unsupported types skipped", accept: "text/html, application/json;q=0.1", want: FormatJSON},
+		{name: "malformed quality skipped", accept: "text/csv;q=high, application/json;q=0.2", want: FormatJSON},
+		{name: "nothing supported", accept: "application/xml, text/html", wantErr: true},
+		{name: "refused", accept: "application/json;q=0", wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			request := &Request{Headers: map[string]string{"Accept": test.accept}}
+			if test.format != "" {
+				request.QueryStringParameters = map[string]string{"format": test.format}
+			}
+			got, err := NegotiateFormat(request)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("NegotiateFormat() error = %v, wantErr %v", err, test.wantErr)
+			}
+			if test.wantErr && !errors.Is(err, ErrNotAcceptable) {
+				t.Errorf("NegotiateFormat() error = %v, want ErrNotAcceptable", err)
+			}
+			if got != test.want {
+				t.Errorf("NegotiateFormat() = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
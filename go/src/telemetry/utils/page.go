@@ -0,0 +1,120 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// Page is one page of a paginated query, as returned when 'paginate=true'.
+type Page struct {
+	Items []map[string]types.AttributeValue `json:"items"`
+
+	// NextCursor resumes the query after this page, and is empty on the last page.
+	NextCursor string `json:"nextCursor,omitempty"`
+
+	// PageCount is the number of items on this page,
+	// and CumulativeCount the number on every page so far, including this one.
+	PageCount       int `json:"pageCount"`
+	CumulativeCount int `json:"cumulativeCount"`
+
+	// ScannedCount is the number of items read for the page before filtering,
+	// included only when requested.
+	ScannedCount *int `json:"scannedCount,omitempty"`
+
+	// LimitClamped notes that the page size was reduced to the maximum allowed.
+	LimitClamped bool `json:"limitClamped,omitempty"`
+
+	// Stats describes the work DynamoDB did for the page.
+	Stats QueryStats `json:"-"`
+
+	*DebugInfo
+}
+
+// FirstPage is the first page of a query, as returned when 'firstPageOnly=true'.
+// HasMore reports whether the query matched items beyond the page, which aren't retrieved.
+type FirstPage struct {
+	Items        []map[string]types.AttributeValue `json:"items"`
+	HasMore      bool                              `json:"hasMore"`
+	ScannedCount *int                              `json:"scannedCount,omitempty"`
+	LimitClamped bool                              `json:"limitClamped,omitempty"`
+	*DebugInfo
+}
+
+// ItemsEnvelope wraps the items of a query with details about it, when a client asks for them.
+type ItemsEnvelope struct {
+	Items        []map[string]types.AttributeValue `json:"items"`
+	Count        int                               `json:"count"`
+	ScannedCount *int                              `json:"scannedCount,omitempty"`
+	LimitClamped bool                              `json:"limitClamped,omitempty"`
+
+	// TruncatedBySize notes that the items stop short of the response size limit,
+	// and NextCursor, passed back as the 'cursor' parameter, retrieves the rest.
+	TruncatedBySize bool   `json:"truncatedBySize,omitempty"`
+	NextCursor      string `json:"nextCursor,omitempty"`
+
+	// TimedOut notes that the query ran past its timeout, so the items are only those retrieved.
+	TimedOut bool `json:"timedOut,omitempty"`
+
+	*DebugInfo
+}
+
+// DebugInfo reports what a query cost, included in an envelope when 'debug=true'.
+// ElapsedMs covers only the time spent retrieving items from DynamoDB.
+type DebugInfo struct {
+	ConsumedCapacity float64 `json:"consumedCapacity"`
+	ElapsedMs        int64   `json:"elapsedMs"`
+}
+
+// QueryPage retrieves a single page of the items that match the query parameters,
+// resuming from params.Cursor when it is set. A positive Limit sets the page size,
+// and otherwise a page holds as much as DynamoDB returns in one response.
+func QueryPage(ctx context.Context, api DynamoDbQueryAPI, params QueryParams) (Page, error) {
+	var page Page
+	input, err := BuildQueryInput(params)
+	if err != nil {
+		return page, err
+	}
+
+	previousCount := 0
+	if params.Cursor != "" {
+		if input.ExclusiveStartKey, previousCount, err = DecodeCursor(params.Cursor); err != nil {
+			return page, err
+		}
+	}
+
+	start := Now()
+	queryCtx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+	output, err := QueryTable(queryCtx, api, input)
+	if err = queryTimeoutError(queryCtx, err); err != nil {
+		return page, fmt.Errorf("failed to query table, %w", err)
+	}
+	page.Items = output.Items
+	page.Stats.add(output)
+	page.Stats.Elapsed = Now().Sub(start)
+	if page.Items == nil {
+		page.Items = []map[string]types.AttributeValue{}
+	}
+
+	// Items are ordered within the page as GetData orders the whole result.
+	orderItems(input, page.Items)
+	page.Items = Stride(page.Items, params.Stride)
+
+	page.PageCount = len(page.Items)
+	page.CumulativeCount = previousCount + page.PageCount
+	if output.LastEvaluatedKey != nil && !params.Single {
+		if page.NextCursor, err = EncodeCursor(output.LastEvaluatedKey, page.CumulativeCount); err != nil {
+			return page, err
+		}
+	}
+
+	EmitMetrics(
+		ctx,
+		map[string]string{"IndexName": indexLabel(input)},
+		Metric{Name: "ItemsReturned", Unit: "Count", Value: float64(page.PageCount)},
+		Metric{Name: "PagesScanned", Unit: "Count", Value: 1},
+	)
+	return page, nil
+}
@@ -0,0 +1,96 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+
+	"telemetry/utils/dynamotest"
+)
+
+func TestQueryPage(t *testing.T) {
+	lastKey := map[string]types.AttributeValue{
+		"ProjectId#DeviceId": stringAttr("sensors#d1"),
+		"EpochTime":          numberAttr("2"),
+	}
+	resume, err := EncodeCursor(lastKey, 2)
+	if err != nil {
+		t.Fatalf("EncodeCursor() error = %v", err)
+	}
+	const withMore = `{"Count": 2, "Items": [{"EpochTime": {"N": "2"}}, {"EpochTime": {"N": "1"}}],
+		"LastEvaluatedKey": {"ProjectId#DeviceId": {"S": "sensors#d1"}, "EpochTime": {"N": "2"}}}`
+	const last = `{"Count": 1, "Items": [{"EpochTime": {"N": "3"}}]}`
+	tests := []struct {
+		name           string
+		params         QueryParams
+		response       string
+		wantErr        error
+		wantTimes      []string
+		wantCumulative int
+		wantNext       bool
+		wantStartKey   bool
+	}{
+		{
+			name:           "first page",
+			params:         QueryParams{Limit: 2},
+			response:       withMore,
+			wantTimes:      []string{"1", "2"},
+			wantCumulative: 2,
+			wantNext:       true,
+		},
+		{
+			name:           "last page",
+			params:         QueryParams{Limit: 2, Cursor: resume},
+			response:       last,
+			wantTimes:      []string{"3"},
+			wantCumulative: 3,
+			wantStartKey:   true,
+		},
+		{
+			name:           "single item has no next page",
+			params:         QueryParams{Single: true},
+			response:       withMore,
+			wantTimes:      []string{"2", "1"},
+			wantCumulative: 2,
+		},
+		{
+			name:    "invalid cursor",
+			params:  QueryParams{Cursor: "!!!"},
+			wantErr: ErrInvalidCursor,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			captureMetrics(t)
+			server := dynamotest.NewServer(t)
+			server.Respond("Query", test.response)
+			params := test.params
+			params.ProjectId, params.DeviceId = "sensors", "d1"
+
+			page, err := QueryPage(context.Background(), server.Client(), params)
+			if !errors.Is(err, test.wantErr) {
+				t.Fatalf("QueryPage() error = %v, want %v", err, test.wantErr)
+			}
+			if test.wantErr != nil {
+				return
+			}
+			if times := epochTimes(page.Items); !reflect.DeepEqual(times, test.wantTimes) {
+				t.Errorf("items = %v, want %v", times, test.wantTimes)
+			}
+			if page.PageCount != len(test.wantTimes) || page.CumulativeCount != test.wantCumulative {
+				t.Errorf("counts = %d, %d, want %d, %d",
+					page.PageCount, page.CumulativeCount, len(test.wantTimes), test.wantCumulative)
+			}
+			if (page.NextCursor != "") != test.wantNext {
+				t.Errorf("NextCursor = %q, want one %v", page.NextCursor, test.wantNext)
+			}
+			queries := server.Calls("Query")
+			if _, ok := queries[0].Input["ExclusiveStartKey"]; ok != test.wantStartKey {
+				t.Errorf("ExclusiveStartKey sent = %v, want %v", ok, test.wantStartKey)
+			}
+		})
+	}
+}
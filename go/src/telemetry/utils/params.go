@@ -0,0 +1,745 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// ParseQueryParams translates the path and query string parameters shared by the GET endpoints
+// into query parameters. The endpoint fills in the DeviceId or LocationId it is keyed on.
+func ParseQueryParams(request *Request) (QueryParams, error) {
+	params := QueryParams{TenantId: request.TenantId, ProjectId: request.PathParameters["ProjectId"]}
+	var err error
+
+	// If the 'single' query string parameter exists and is truthy, fetch a single value only.
+	if params.Single, err = boolParam(request, "single"); err != nil {
+		return params, err
+	}
+	if params.Unclamped, err = boolParam(request, "unclamped"); err != nil {
+		return params, err
+	}
+	if params.Consistent, err = boolParam(request, "consistent"); err != nil {
+		return params, err
+	}
+	if params.IncludeDeleted, err = boolParam(request, "includeDeleted"); err != nil {
+		return params, err
+	}
+
+	// If 'paginate' is truthy, a single page is returned, and its 'nextCursor' is passed back
+	// as the 'cursor' query string parameter to fetch the next one. Results cut short to fit
+	// the response size limit are resumed with their 'nextCursor' the same way.
+	if params.Paginate, err = boolParam(request, "paginate"); err != nil {
+		return params, err
+	}
+	params.Cursor = request.QueryStringParameters["cursor"]
+	if params.FirstPageOnly, err = boolParam(request, "firstPageOnly"); err != nil {
+		return params, err
+	}
+
+	// The 'start' and 'end' query string parameters set the inclusive time range for queried data,
+	// while 'after' returns only items strictly newer than the given time.
+	if params.Start, err = numberParam(request, "start"); err != nil {
+		return params, err
+	}
+	if params.End, err = numberParam(request, "end"); err != nil {
+		return params, err
+	}
+	if params.After, err = numberParam(request, "after"); err != nil {
+		return params, err
+	}
+	// Setting 'startInclusive' or 'endInclusive' false leaves out readings exactly at that bound,
+	// so that consecutive windows sharing a bound don't both return its readings.
+	var inclusive bool
+	if inclusive, err = inclusiveParam(request, "startInclusive"); err != nil {
+		return params, err
+	}
+	params.StartExclusive = !inclusive
+	if inclusive, err = inclusiveParam(request, "endInclusive"); err != nil {
+		return params, err
+	}
+	params.EndExclusive = !inclusive
+
+	// The 'seqStart' and 'seqEnd' query string parameters instead set an inclusive range
+	// of SequenceNum for a device's readings.
+	if params.SeqStart, err = wholeNumberParam(request, "seqStart"); err != nil {
+		return params, err
+	}
+	if params.SeqEnd, err = wholeNumberParam(request, "seqEnd"); err != nil {
+		return params, err
+	}
+
+	// The 'recent' query string parameter fetches that many of the newest items.
+	if params.Recent, err = positiveIntParam(request, "recent"); err != nil {
+		return params, err
+	}
+
+	// The 'order' query string parameter sorts multiple items by EpochTime, ascending by default,
+	// except for the most recent items, which are newest first by default.
+	switch order := request.QueryStringParameters["order"]; order {
+	case "asc":
+	case "":
+		params.Descending = params.Recent > 0
+	case "desc":
+		params.Descending = true
+	default:
+		return params, fmt.Errorf("order must be asc or desc, got %q", order)
+	}
+
+	// The 'index', 'keyName', and 'keyValue' query string parameters query another index by name.
+	params.Index = request.QueryStringParameters["index"]
+	params.KeyName = request.QueryStringParameters["keyName"]
+	params.KeyValue = request.QueryStringParameters["keyValue"]
+
+	// Each 'exists' query string parameter names an attribute that returned items must have.
+	params.Exists = multiParam(request, "exists")
+	// Each 'excludeSentinel' query string parameter, e.g. 'excludeSentinel=Temperature:-999',
+	// leaves out items where the field holds a failed sensor's sentinel value.
+	for _, value := range multiParam(request, "excludeSentinel") {
+		sentinel, err := ParseSentinel(value)
+		if err != nil {
+			return params, err
+		}
+		params.Sentinels = append(params.Sentinels, sentinel)
+	}
+
+	if params.Limit, params.LimitClamped, err = limitParam(request); err != nil {
+		return params, err
+	}
+	if max := MaxLimit(); params.Recent > max {
+		params.Recent, params.LimitClamped = max, true
+	}
+	if params.Stride, err = positiveIntParam(request, "stride"); err != nil {
+		return params, err
+	}
+	return params, nil
+}
+
+// multiParam returns every value of a query string parameter that may be repeated.
+func multiParam(request *Request, name string) []string {
+	if values, valuesOk := request.MultiValueQueryStringParameters[name]; valuesOk {
+		return values
+	}
+	if value, valueOk := request.QueryStringParameters[name]; valueOk {
+		return []string{value}
+	}
+	return nil
+}
+
+// ParseBoolParam interprets a boolean query string value. The accepted forms are
+// true/false, 1/0, yes/no, and on/off, in any case.
+func ParseBoolParam(value string) (bool, error) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "true", "1", "yes", "on":
+		return true, nil
+	case "false", "0", "no", "off":
+		return false, nil
+	default:
+		return false, fmt.Errorf("invalid boolean %q", value)
+	}
+}
+
+// boolParam parses an optional boolean query string parameter, returning false when it is absent.
+func boolParam(request *Request, name string) (bool, error) {
+	valueStr, valueOk := request.QueryStringParameters[name]
+	if !valueOk {
+		return false, nil
+	}
+	value, err := ParseBoolParam(valueStr)
+	if err != nil {
+		return false, fmt.Errorf("%s must be true/false, 1/0, yes/no, or on/off, got %q", name, valueStr)
+	}
+	return value, nil
+}
+
+// inclusiveParam parses an optional boolean query string parameter, returning true when it is absent.
+func inclusiveParam(request *Request, name string) (bool, error) {
+	if _, ok := request.QueryStringParameters[name]; !ok {
+		return true, nil
+	}
+	return boolParam(request, name)
+}
+
+// numberParam parses an optional numeric query string parameter, returning nil when it is absent.
+func numberParam(request *Request, name string) (*float64, error) {
+	valueStr, valueOk := request.QueryStringParameters[name]
+	if !valueOk {
+		return nil, nil
+	}
+	value, err := strconv.ParseFloat(valueStr, 64)
+	if err != nil {
+		return nil, fmt.Errorf("%s must be a number, got %q", name, valueStr)
+	}
+	return &value, nil
+}
+
+// wholeNumberParam parses an optional integer query string parameter, returning nil when it is absent.
+func wholeNumberParam(request *Request, name string) (*int64, error) {
+	valueStr, valueOk := request.QueryStringParameters[name]
+	if !valueOk {
+		return nil, nil
+	}
+	value, err := strconv.ParseInt(valueStr, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("%s must be a whole number, got %q", name, valueStr)
+	}
+	return &value, nil
+}
+
+// MaxLimit is the largest number of items a query may ask for, from the MAX_LIMIT
+// environment variable, 10000 by default.
+func MaxLimit() int {
+	if limit := envInt("MAX_LIMIT", 10000); limit > 0 {
+		return limit
+	}
+	return 10000
+}
+
+// limitParam parses the optional 'limit' query string parameter, clamping it to MaxLimit
+// so that a client can't page through the whole table in one request.
+// It reports whether the requested limit was clamped.
+func limitParam(request *Request) (int, bool, error) {
+	limit, err := positiveIntParam(request, "limit")
+	if err != nil {
+		return 0, false, err
+	}
+	if max := MaxLimit(); limit > max {
+		return max, true, nil
+	}
+	return limit, false, nil
+}
+
+// positiveIntParam parses an optional whole-number query string parameter of at least 1,
+// returning 0 when it is absent.
+func positiveIntParam(request *Request, name string) (int, error) {
+	valueStr, valueOk := request.QueryStringParameters[name]
+	if !valueOk {
+		return 0, nil
+	}
+	value, err := strconv.Atoi(valueStr)
+	if err != nil || value < 1 {
+		return 0, fmt.Errorf("%s must be a whole number of at least 1, got %q", name, valueStr)
+	}
+	return value, nil
+}
+
+// ResponseOptions control how a GET endpoint presents the items it retrieves.
+type ResponseOptions struct {
+	// CSV encodes the items as CSV instead of JSON, and NDJSON as one JSON object per line.
+	CSV    bool
+	NDJSON bool
+
+	// StatsField, when set, replaces the items with a summary of that numeric field,
+	// including the requested Percentiles. A comma-separated list of fields summarizes
+	// each of them, keyed by field name.
+	StatsField  string
+	Percentiles []float64
+
+	// Conversions are unit conversions applied to the items' fields before they are presented.
+	Conversions []ConversionSpec
+
+	// ExtremeField, when set, replaces the items with the single item that has the largest value
+	// of that numeric field, or the smallest when ExtremeMin is set.
+	ExtremeField string
+	ExtremeMin   bool
+
+	// Strict answers a query for a device or location that has never reported with a 404,
+	// rather than an empty result.
+	Strict bool
+
+	// Raw keeps the internal composite key attributes in the items, which are otherwise removed.
+	Raw bool
+
+	// Redacted are the sensitive fields removed from the items because the request's token is
+	// restricted, and which can't be read through stats, distinct, maxOf, minOf, or changesOnly either.
+	Redacted []string
+
+	// DistinctField, when set, replaces the items with the sorted distinct values of that field.
+	DistinctField string
+
+	// ScannedCount wraps the items in an envelope that also reports how many items were read
+	// before filtering, next to how many were returned.
+	ScannedCount bool
+
+	// Debug wraps the items in an envelope that also reports the read capacity the query
+	// consumed and how long it took, to help spot expensive access patterns.
+	Debug bool
+
+	// Explain returns the DynamoDB query built for the request instead of running it.
+	Explain bool
+
+	// DeltaField, when set, adds the change in that cumulative field since the previous reading
+	// to each item, before any stats are computed, so that its deltas can be summarized too.
+	DeltaField string
+
+	// ChangesField, when set, keeps only the items where that field's value changed
+	// from the previous reading's, dropping the repeats in between.
+	ChangesField string
+
+	// IncludeAge adds the seconds since each item's EpochTime to the item, as ageSeconds.
+	IncludeAge bool
+}
+
+// statsFields lists the fields named by StatsField.
+func (options ResponseOptions) statsFields() []string {
+	return splitList(options.StatsField)
+}
+
+// export reports whether the items are encoded in an export format rather than as JSON.
+func (options ResponseOptions) export() bool {
+	return options.CSV || options.NDJSON
+}
+
+// ParseResponseOptions reads the query string parameters and headers
+// that shape a GET endpoint's response.
+func ParseResponseOptions(request *Request) (ResponseOptions, error) {
+	options := ResponseOptions{
+		StatsField: request.QueryStringParameters["stats"],
+
+		// The 'distinct' query string parameter, e.g. 'distinct=DeviceId', lists a field's values.
+		DistinctField: request.QueryStringParameters["distinct"],
+
+		// The 'delta' query string parameter, e.g. 'delta=PacketCount', adds a counter's increases.
+		DeltaField: request.QueryStringParameters["delta"],
+
+		// The 'changesOnly' query string parameter, e.g. 'changesOnly=Temperature', drops repeated values.
+		ChangesField: request.QueryStringParameters["changesOnly"],
+
+		Redacted: RequestRedactions(request),
+	}
+	// The items are encoded as the Accept header or the 'format' query string parameter asks.
+	format, err := NegotiateFormat(request)
+	if err != nil {
+		return options, err
+	}
+	options.CSV, options.NDJSON = format == FormatCSV, format == FormatNDJSON
+
+	// If the 'includeAge' query string parameter is truthy, each item's age is reported.
+	if options.IncludeAge, err = boolParam(request, "includeAge"); err != nil {
+		return options, err
+	}
+	// If the 'includeScannedCount' query string parameter is truthy, the scanned count is reported.
+	if options.ScannedCount, err = boolParam(request, "includeScannedCount"); err != nil {
+		return options, err
+	}
+	// The 'maxOf' and 'minOf' query string parameters, e.g. 'maxOf=Temperature', choose the item
+	// with the extreme value of a field over the window.
+	maxOf, minOf := request.QueryStringParameters["maxOf"], request.QueryStringParameters["minOf"]
+	if maxOf != "" && minOf != "" {
+		return options, errors.New("maxOf cannot be combined with minOf")
+	}
+	options.ExtremeField, options.ExtremeMin = maxOf, minOf != ""
+	if minOf != "" {
+		options.ExtremeField = minOf
+	}
+	if options.ExtremeField != "" && (options.StatsField != "" || options.DistinctField != "") {
+		return options, errors.New("maxOf and minOf cannot be combined with stats or distinct")
+	}
+
+	// If the 'strict' query string parameter is truthy, unknown devices and locations are 404s.
+	if options.Strict, err = boolParam(request, "strict"); err != nil {
+		return options, err
+	}
+
+	// If the 'raw' query string parameter is truthy, items are returned exactly as stored.
+	if options.Raw, err = boolParam(request, "raw"); err != nil {
+		return options, err
+	}
+	// If the 'debug' query string parameter is truthy, the query's cost is reported.
+	if options.Debug, err = boolParam(request, "debug"); err != nil {
+		return options, err
+	}
+	// If the 'explain' query string parameter is truthy, the query is described rather than run.
+	if options.Explain, err = boolParam(request, "explain"); err != nil {
+		return options, err
+	}
+	if options.Debug && (options.StatsField != "" || options.export() || options.DistinctField != "") {
+		return options, errors.New("debug cannot be combined with stats, distinct, CSV, or NDJSON")
+	}
+	if options.DistinctField != "" && (options.StatsField != "" || options.export()) {
+		return options, errors.New("distinct cannot be combined with stats, CSV, or NDJSON")
+	}
+
+	// The 'percentiles' query string parameter, e.g. 'percentiles=50,95,99', adds percentiles to stats.
+	if list, listOk := request.QueryStringParameters["percentiles"]; listOk {
+		if options.StatsField == "" {
+			return options, errors.New("percentiles requires the stats parameter")
+		}
+		percentiles, err := ParsePercentiles(list)
+		if err != nil {
+			return options, err
+		}
+		options.Percentiles = percentiles
+	}
+
+	// Each 'convert' query string parameter, e.g. 'convert=Temperature:C2F', converts a field's units.
+	conversions, err := ParseConversions(multiParam(request, "convert"))
+	if err != nil {
+		return options, err
+	}
+	options.Conversions = conversions
+	return options, nil
+}
+
+// QueryResponse runs the query for a GET endpoint and encodes the items it returns,
+// as JSON by default or as CSV or NDJSON when the request asks for it.
+func QueryResponse(
+	ctx context.Context,
+	api DynamoDbQueryAPI,
+	request *Request,
+	params QueryParams,
+) (events.APIGatewayProxyResponse, error) {
+	if err := request.CheckIndexAccess(params.Index); err != nil {
+		return ForbiddenResponse(err.Error())
+	}
+	if err := params.Validate(); err != nil {
+		return BadRequestResponse(err.Error())
+	}
+	options, err := ParseResponseOptions(request)
+	if errors.Is(err, ErrNotAcceptable) {
+		return NotAcceptableResponse(err.Error())
+	}
+	if err != nil {
+		return BadRequestResponse(err.Error())
+	}
+	for _, field := range append(options.statsFields(), options.DistinctField, options.ExtremeField, options.ChangesField) {
+		if err := CheckRedactedField(field, options.Redacted); err != nil {
+			return ForbiddenResponse(err.Error())
+		}
+	}
+
+	if options.ExtremeField != "" && params.Single {
+		return BadRequestResponse("maxOf and minOf cannot be combined with single")
+	}
+	paged := params.Paginate || params.FirstPageOnly
+	if paged && options.ExtremeField != "" {
+		return BadRequestResponse("paginate and firstPageOnly cannot be combined with maxOf or minOf")
+	}
+	if paged && (options.StatsField != "" || options.export() || options.DistinctField != "") {
+		return BadRequestResponse(
+			"paginate and firstPageOnly cannot be combined with stats, distinct, CSV, or NDJSON",
+		)
+	}
+	// A page's first delta would need the previous page's last reading.
+	if paged && options.DeltaField != "" {
+		return BadRequestResponse("paginate and firstPageOnly cannot be combined with delta")
+	}
+	// Likewise, whether a page's first reading changed depends on the previous page.
+	if paged && options.ChangesField != "" {
+		return BadRequestResponse("paginate and firstPageOnly cannot be combined with changesOnly")
+	}
+
+	// Queries without a time range default to the configured recent window.
+	requested := params
+	ApplyDefaultWindow(&params)
+	// Unbounded or overly long time ranges are clamped to the configured maximum span.
+	clamped := ClampTimeRange(&params)
+	if options.Explain {
+		input, err := BuildQueryInput(params)
+		if err != nil {
+			return BadRequestResponse(err.Error())
+		}
+		response, err := JSONResponse(ExplainQuery(input, params.TenantId))
+		addQueryHeaders(&response, params, clamped)
+		return response, err
+	}
+	if paged {
+		return pageResponse(ctx, api, params, options, clamped)
+	}
+
+	if options.DistinctField != "" {
+		return distinctResponse(ctx, api, params, options.DistinctField, clamped)
+	}
+
+	// Items returned as they are must fit in the response, unlike those reduced to stats or maxOf.
+	if options.StatsField == "" && options.ExtremeField == "" {
+		params.SizeBudget = ResponseSizeBudget()
+	}
+	items, stats, err := QueryItemsWithStats(ctx, api, params)
+	if errors.Is(err, ErrInvalidCursor) {
+		return BadRequestResponse(err.Error())
+	}
+	if errors.Is(err, ErrQueryTimeout) {
+		log.Printf("Query failed, %v", err)
+		return timeoutResponse(items, params, options, clamped)
+	}
+	if err != nil {
+		log.Printf("Query failed, %v", err)
+		return StorageErrorResponse(err, "Failed to query table")
+	}
+	if options.Strict && len(items) == 0 {
+		notFound, err := strictNotFound(ctx, api, requested, params)
+		if err != nil {
+			log.Printf("Query failed, %v", err)
+			return StorageErrorResponse(err, "Failed to query table")
+		}
+		if notFound {
+			return NotFoundResponse(notFoundMessage(requested))
+		}
+	}
+	items = transformItems(items, options)
+
+	// maxOf and minOf reduce the window to its single item with the extreme value,
+	// which is then presented like the item of a single item query.
+	single := params.Single
+	if options.ExtremeField != "" {
+		extreme, found := ExtremeBy(items, options.ExtremeField, !options.ExtremeMin)
+		items = nil
+		if found {
+			items = []map[string]types.AttributeValue{extreme}
+		}
+		single = true
+	}
+
+	var response events.APIGatewayProxyResponse
+	switch {
+	case options.StatsField != "":
+		if fields := options.statsFields(); len(fields) == 1 {
+			response, err = JSONResponse(ComputeStats(items, fields[0], options.Percentiles))
+		} else {
+			response, err = JSONResponse(ComputeFieldStats(items, fields, options.Percentiles))
+		}
+	case options.CSV:
+		body, csvErr := ItemsToCSV(items)
+		if csvErr != nil {
+			log.Printf("Could not encode CSV, %v", csvErr)
+			return InternalErrorResponse("Could not encode results")
+		}
+		response, err = CSVResponse(body, exportFilename(params))
+	case options.NDJSON:
+		body, ndjsonErr := ItemsToNDJSON(items)
+		if ndjsonErr != nil {
+			log.Printf("Could not encode NDJSON, %v", ndjsonErr)
+			return InternalErrorResponse("Could not encode results")
+		}
+		response, err = NDJSONResponse(body)
+	case options.ScannedCount || options.Debug || stats.TruncatedBySize:
+		if items == nil {
+			items = []map[string]types.AttributeValue{}
+		}
+		envelope := ItemsEnvelope{
+			Items:           items,
+			Count:           len(items),
+			LimitClamped:    params.LimitClamped,
+			TruncatedBySize: stats.TruncatedBySize,
+			NextCursor:      stats.NextCursor,
+		}
+		if options.ScannedCount {
+			envelope.ScannedCount = &stats.ScannedCount
+		}
+		if options.Debug {
+			envelope.DebugInfo = stats.Debug()
+		}
+		response, err = JSONResponse(envelope)
+	default:
+		response, err = GetSuccessResponse(items, single)
+	}
+	addQueryHeaders(&response, params, clamped)
+	// Ages are only true at the moment they're computed, however settled the readings are.
+	if options.IncludeAge {
+		response.Headers["Cache-Control"] = "no-cache"
+	}
+	// Exports have no envelope, so their truncation is reported in headers instead.
+	if stats.TruncatedBySize && options.export() {
+		response.Headers["X-Truncated-By-Size"] = "true"
+		response.Headers["X-Next-Cursor"] = stats.NextCursor
+	}
+	return response, err
+}
+
+// strictNotFound decides whether a strict query's empty result means that its device or location
+// has never reported, rather than that it was quiet during the window:
+//
+//	project query                  never; projects aren't looked up
+//	bounded by time or sequence    never; the window was just quiet
+//	filtered by 'exists'           never; the readings may lack the attributes
+//	otherwise                      when the device or location has no reading at all
+//
+// When a default window or clamp bounded the query run since the client sent it, the whole
+// history is checked for its latest reading.
+func strictNotFound(
+	ctx context.Context,
+	api DynamoDbQueryAPI,
+	requested QueryParams,
+	run QueryParams,
+) (bool, error) {
+	if (requested.DeviceId == "" && requested.LocationId == "") || requested.Index != "" {
+		return false, nil
+	}
+	bounded := requested.Start != nil || requested.End != nil || requested.After != nil ||
+		requested.sequenceRange()
+	if bounded || len(requested.Exists) > 0 {
+		return false, nil
+	}
+	if run.Start == nil && run.End == nil && run.After == nil {
+		return true, nil
+	}
+
+	latest := requested
+	latest.Single = true
+	latest.Stride = 0
+	latest.Unclamped = true
+	items, err := QueryItems(ctx, api, latest)
+	return len(items) == 0, err
+}
+
+// notFoundMessage names the device or location that has never reported.
+func notFoundMessage(params QueryParams) string {
+	if params.DeviceId != "" {
+		return fmt.Sprintf("Device %q has never reported", params.DeviceId)
+	}
+	return fmt.Sprintf("Location %q has never reported", params.LocationId)
+}
+
+// pageResponse runs a paginated query for a GET endpoint, encoding the page and its cursor as JSON,
+// or, for firstPageOnly queries, the page and whether any items were left unread.
+func pageResponse(
+	ctx context.Context,
+	api DynamoDbQueryAPI,
+	params QueryParams,
+	options ResponseOptions,
+	clamped string,
+) (events.APIGatewayProxyResponse, error) {
+	page, err := QueryPage(ctx, api, params)
+	if err != nil {
+		if errors.Is(err, ErrInvalidCursor) {
+			return BadRequestResponse(err.Error())
+		}
+		log.Printf("Query failed, %v", err)
+		return StorageErrorResponse(err, "Failed to query table")
+	}
+	page.Items = transformItems(page.Items, options)
+
+	if options.ScannedCount {
+		page.ScannedCount = &page.Stats.ScannedCount
+	}
+	page.LimitClamped = params.LimitClamped
+	if options.Debug {
+		page.DebugInfo = page.Stats.Debug()
+	}
+
+	var response events.APIGatewayProxyResponse
+	if params.FirstPageOnly {
+		response, err = JSONResponse(FirstPage{
+			Items:        page.Items,
+			HasMore:      page.NextCursor != "",
+			ScannedCount: page.ScannedCount,
+			LimitClamped: page.LimitClamped,
+			DebugInfo:    page.DebugInfo,
+		})
+	} else {
+		response, err = JSONResponse(page)
+	}
+	addQueryHeaders(&response, params, clamped)
+	if options.IncludeAge {
+		response.Headers["Cache-Control"] = "no-cache"
+	}
+	return response, err
+}
+
+// distinctResponse lists the distinct values of a field among the items the query matches.
+func distinctResponse(
+	ctx context.Context,
+	api DynamoDbQueryAPI,
+	params QueryParams,
+	field string,
+	clamped string,
+) (events.APIGatewayProxyResponse, error) {
+	values, err := QueryDistinct(ctx, api, params, field)
+	if err != nil {
+		log.Printf("Query failed, %v", err)
+		return StorageErrorResponse(err, "Failed to query table")
+	}
+
+	response, err := JSONResponse(values)
+	addQueryHeaders(&response, params, clamped)
+	return response, err
+}
+
+// timeoutResponse answers a query that ran past its timeout with a 504, carrying the items
+// it retrieved in an envelope marked as timed out. Stats, maxOf, minOf, and exports of only
+// some of the items would be misleading, so those get a plain 504 instead.
+func timeoutResponse(
+	items []map[string]types.AttributeValue,
+	params QueryParams,
+	options ResponseOptions,
+	clamped string,
+) (events.APIGatewayProxyResponse, error) {
+	if options.StatsField != "" || options.ExtremeField != "" || options.export() {
+		return GatewayTimeoutResponse("Query timed out, narrow the time range or retry later")
+	}
+	items = transformItems(items, options)
+	if items == nil {
+		items = []map[string]types.AttributeValue{}
+	}
+	response, err := JSONResponse(ItemsEnvelope{
+		Items:        items,
+		Count:        len(items),
+		LimitClamped: params.LimitClamped,
+		TimedOut:     true,
+	})
+	response.StatusCode = 504
+	addQueryHeaders(&response, params, clamped)
+	// Partial results must not be cached in place of the complete ones.
+	response.Headers["Cache-Control"] = "no-cache"
+	return response, err
+}
+
+// transformItems applies the response options to queried items, in order: cleaning, redaction,
+// dropping unchanged readings, unit conversions, deltas, and ages.
+// Partial results of a timed out query go through the same steps as complete ones.
+func transformItems(
+	items []map[string]types.AttributeValue,
+	options ResponseOptions,
+) []map[string]types.AttributeValue {
+	if !options.Raw {
+		items = CleanItems(items)
+	}
+	RedactFields(items, options.Redacted)
+	if options.ChangesField != "" {
+		items = ChangesOnly(items, options.ChangesField)
+	}
+	ApplyConversions(items, options.Conversions)
+	if options.DeltaField != "" {
+		ComputeDelta(items, options.DeltaField)
+	}
+	if options.IncludeAge {
+		AddAge(items, Now())
+	}
+	return items
+}
+
+// addQueryHeaders adds the caching headers suited to the query,
+// and notes any adjustment made to its time range or limit.
+func addQueryHeaders(response *events.APIGatewayProxyResponse, params QueryParams, clamped string) {
+	for name, value := range CacheHeadersFor(params) {
+		response.Headers[name] = value
+	}
+	// The same URL is encoded differently depending on the Accept header, and reads different
+	// fields depending on the token, both of which caches must respect.
+	response.Headers["Vary"] = "Accept, Authorization-Token"
+	if clamped != "" {
+		response.Headers["X-Time-Range-Clamped"] = clamped
+	}
+	if params.LimitClamped {
+		response.Headers["X-Limit-Clamped"] = strconv.Itoa(params.maxItems())
+	}
+}
+
+// exportFilename names a CSV export after the project and the device or location queried.
+func exportFilename(params QueryParams) string {
+	parts := []string{params.ProjectId}
+	if params.DeviceId != "" {
+		parts = append(parts, params.DeviceId)
+	}
+	if params.LocationId != "" {
+		parts = append(parts, params.LocationId)
+	}
+	return strings.Join(parts, "-") + ".csv"
+}
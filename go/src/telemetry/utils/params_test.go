@@ -0,0 +1,893 @@
+package utils
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+
+	"telemetry/utils/dynamotest"
+)
+
+func TestParseBoolParam(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    bool
+		wantErr bool
+	}{
+		{value: "true", want: true},
+		{value: " YES ", want: true},
+		{value: "1", want: true},
+		{value: "On", want: true},
+		{value: "false"},
+		{value: "0"},
+		{value: "no"},
+		{value: "off"},
+		{value: "", wantErr: true},
+		{value: "maybe", wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.value, func(t *testing.T) {
+			got, err := ParseBoolParam(test.value)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("ParseBoolParam() error = %v, wantErr %v", err, test.wantErr)
+			}
+			if got != test.want {
+				t.Errorf("ParseBoolParam() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestParseQueryParams(t *testing.T) {
+	seq := func(value int64) *int64 { return &value }
+	tests := []struct {
+		name    string
+		env     map[string]string
+		query   map[string]string
+		multi   map[string][]string
+		want    QueryParams
+		wantErr bool
+	}{
+		{
+			name: "defaults",
+			want: QueryParams{ProjectId: "sensors"},
+		},
+		{
+			name:  "range and flags",
+			query: map[string]string{"start": "1", "end": "2.5", "single": "yes", "consistent": "1", "endInclusive": "false"},
+			want: QueryParams{
+				ProjectId: "sensors", Start: float(1), End: float(2.5), EndExclusive: true,
+				Single: true, Consistent: true,
+			},
+		},
+		{
+			name:  "descending with a limit and stride",
+			query: map[string]string{"order": "desc", "limit": "10", "stride": "2"},
+			want:  QueryParams{ProjectId: "sensors", Descending: true, Limit: 10, Stride: 2},
+		},
+		{
+			name:  "recent is newest first",
+			query: map[string]string{"recent": "5"},
+			want:  QueryParams{ProjectId: "sensors", Recent: 5, Descending: true},
+		},
+		{
+			name:  "recent in ascending order",
+			query: map[string]string{"recent": "5", "order": "asc"},
+			want:  QueryParams{ProjectId: "sensors", Recent: 5},
+		},
+		{
+			name:  "limit clamped",
+			env:   map[string]string{"MAX_LIMIT": "100"},
+			query: map[string]string{"limit": "500"},
+			want:  QueryParams{ProjectId: "sensors", Limit: 100, LimitClamped: true},
+		},
+		{
+			name:  "repeated exists",
+			multi: map[string][]string{"exists": {"Temperature", "Humidity"}},
+			want:  QueryParams{ProjectId: "sensors", Exists: []string{"Temperature", "Humidity"}},
+		},
+		{
+			name:  "recent clamped",
+			env:   map[string]string{"MAX_LIMIT": "100"},
+			query: map[string]string{"recent": "500"},
+			want:  QueryParams{ProjectId: "sensors", Recent: 100, Descending: true, LimitClamped: true},
+		},
+		{
+			name:  "index",
+			query: map[string]string{"index": "Battery-index", "keyName": "Battery", "keyValue": "low"},
+			want:  QueryParams{ProjectId: "sensors", Index: "Battery-index", KeyName: "Battery", KeyValue: "low"},
+		},
+		{
+			name:  "sentinels excluded",
+			multi: map[string][]string{"excludeSentinel": {"Temperature:-999", "Status:failed"}},
+			want: QueryParams{
+				ProjectId: "sensors",
+				Sentinels: []Sentinel{{Field: "Temperature", Value: "-999"}, {Field: "Status", Value: "failed"}},
+			},
+		},
+		{
+			name:  "limit at the default maximum",
+			query: map[string]string{"limit": "10000"},
+			want:  QueryParams{ProjectId: "sensors", Limit: 10000},
+		},
+		{
+			name:  "limit over the default maximum",
+			query: map[string]string{"limit": "10001"},
+			want:  QueryParams{ProjectId: "sensors", Limit: 10000, LimitClamped: true},
+		},
+		{
+			name:  "deleted readings included",
+			query: map[string]string{"includeDeleted": "true"},
+			want:  QueryParams{ProjectId: "sensors", IncludeDeleted: true},
+		},
+		{
+			name:  "exclusive start",
+			query: map[string]string{"start": "1", "startInclusive": "false", "endInclusive": "true"},
+			want:  QueryParams{ProjectId: "sensors", Start: float(1), StartExclusive: true},
+		},
+		{name: "malformed startInclusive", query: map[string]string{"start": "1", "startInclusive": "no way"}, wantErr: true},
+		{name: "malformed sentinel", query: map[string]string{"excludeSentinel": "Temperature"}, wantErr: true},
+		{name: "malformed recent", query: map[string]string{"recent": "latest"}, wantErr: true},
+		{name: "zero recent", query: map[string]string{"recent": "0"}, wantErr: true},
+		{name: "malformed start", query: map[string]string{"start": "yesterday"}, wantErr: true},
+		{name: "malformed single", query: map[string]string{"single": "maybe"}, wantErr: true},
+		{name: "malformed order", query: map[string]string{"order": "random"}, wantErr: true},
+		{name: "zero limit", query: map[string]string{"limit": "0"}, wantErr: true},
+		{
+			name:  "sequence range",
+			query: map[string]string{"seqStart": "3", "seqEnd": "7"},
+			want:  QueryParams{ProjectId: "sensors", SeqStart: seq(3), SeqEnd: seq(7)},
+		},
+		{name: "fractional seqStart", query: map[string]string{"seqStart": "1.5"}, wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			for name, value := range test.env {
+				t.Setenv(name, value)
+			}
+			request := &Request{
+				PathParameters:                  map[string]string{"ProjectId": "sensors"},
+				QueryStringParameters:           test.query,
+				MultiValueQueryStringParameters: test.multi,
+			}
+			got, err := ParseQueryParams(request)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("ParseQueryParams() error = %v, wantErr %v", err, test.wantErr)
+			}
+			if !test.wantErr && !reflect.DeepEqual(got, test.want) {
+				t.Errorf("ParseQueryParams() = %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestMaxLimit(t *testing.T) {
+	tests := []struct {
+		name  string
+		limit string
+		want  int
+	}{
+		{name: "default", want: 10000},
+		{name: "configured", limit: "250", want: 250},
+		{name: "not positive", limit: "0", want: 10000},
+		{name: "malformed", limit: "lots", want: 10000},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Setenv("MAX_LIMIT", test.limit)
+			if got := MaxLimit(); got != test.want {
+				t.Errorf("MaxLimit() = %d, want %d", got, test.want)
+			}
+		})
+	}
+}
+
+func TestParseResponseOptions(t *testing.T) {
+	tests := []struct {
+		name    string
+		query   map[string]string
+		want    ResponseOptions
+		wantErr bool
+	}{
+		{name: "defaults", want: ResponseOptions{}},
+		{
+			name:  "minimum",
+			query: map[string]string{"minOf": "Temperature"},
+			want:  ResponseOptions{ExtremeField: "Temperature", ExtremeMin: true},
+		},
+		{
+			name:  "stats with percentiles",
+			query: map[string]string{"stats": "Temperature", "percentiles": "50,95"},
+			want:  ResponseOptions{StatsField: "Temperature", Percentiles: []float64{50, 95}},
+		},
+		{
+			name:  "conversion",
+			query: map[string]string{"convert": "Temperature:c2f"},
+			want:  ResponseOptions{Conversions: []ConversionSpec{{Field: "Temperature", Conversion: "C2F"}}},
+		},
+		{
+			name:  "scanned count",
+			query: map[string]string{"includeScannedCount": "1"},
+			want:  ResponseOptions{ScannedCount: true},
+		},
+		{name: "malformed scanned count", query: map[string]string{"includeScannedCount": "sure"}, wantErr: true},
+		{name: "debug", query: map[string]string{"debug": "true"}, want: ResponseOptions{Debug: true}},
+		{name: "debug with stats", query: map[string]string{"debug": "true", "stats": "Temperature"}, wantErr: true},
+		{name: "debug with CSV", query: map[string]string{"debug": "true", "format": "csv"}, wantErr: true},
+		{name: "unknown conversion", query: map[string]string{"convert": "Temperature:C2X"}, wantErr: true},
+		{name: "maximum and minimum", query: map[string]string{"maxOf": "a", "minOf": "b"}, wantErr: true},
+		{name: "maximum with stats", query: map[string]string{"maxOf": "a", "stats": "b"}, wantErr: true},
+		{name: "maximum with distinct", query: map[string]string{"maxOf": "a", "distinct": "b"}, wantErr: true},
+		{name: "percentiles without stats", query: map[string]string{"percentiles": "50"}, wantErr: true},
+		{name: "debug with stats", query: map[string]string{"debug": "true", "stats": "a"}, wantErr: true},
+		{name: "distinct", query: map[string]string{"distinct": "DeviceId"}, want: ResponseOptions{DistinctField: "DeviceId"}},
+		{name: "distinct with stats", query: map[string]string{"distinct": "a", "stats": "b"}, wantErr: true},
+		{name: "distinct as CSV", query: map[string]string{"distinct": "a", "format": "csv"}, wantErr: true},
+		{name: "raw", query: map[string]string{"raw": "1"}, want: ResponseOptions{Raw: true}},
+		{name: "malformed raw", query: map[string]string{"raw": "maybe"}, wantErr: true},
+		{name: "age", query: map[string]string{"includeAge": "true"}, want: ResponseOptions{IncludeAge: true}},
+		{name: "malformed age", query: map[string]string{"includeAge": "old"}, wantErr: true},
+		{name: "strict", query: map[string]string{"strict": "true"}, want: ResponseOptions{Strict: true}},
+		{name: "malformed strict", query: map[string]string{"strict": "always"}, wantErr: true},
+		{name: "delta", query: map[string]string{"delta": "PacketCount"}, want: ResponseOptions{DeltaField: "PacketCount"}},
+		{name: "changes only", query: map[string]string{"changesOnly": "Status"}, want: ResponseOptions{ChangesField: "Status"}},
+		{name: "explain", query: map[string]string{"explain": "yes"}, want: ResponseOptions{Explain: true}},
+		{name: "malformed explain", query: map[string]string{"explain": "please"}, wantErr: true},
+		{name: "NDJSON", query: map[string]string{"format": "ndjson"}, want: ResponseOptions{NDJSON: true}},
+		{name: "unknown format", query: map[string]string{"format": "xml"}, wantErr: true},
+		{name: "debug with NDJSON", query: map[string]string{"debug": "true", "format": "ndjson"}, wantErr: true},
+		{name: "distinct as NDJSON", query: map[string]string{"distinct": "a", "format": "ndjson"}, wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			request := &Request{QueryStringParameters: test.query}
+			got, err := ParseResponseOptions(request)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("ParseResponseOptions() error = %v, wantErr %v", err, test.wantErr)
+			}
+			// Empty lists are compared as absent.
+			if len(got.Conversions) == 0 {
+				got.Conversions = nil
+			}
+			if len(got.Redacted) == 0 {
+				got.Redacted = nil
+			}
+			if !test.wantErr && !reflect.DeepEqual(got, test.want) {
+				t.Errorf("ParseResponseOptions() = %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestQueryResponse(t *testing.T) {
+	const items = `{"Count": 2, "ScannedCount": 2, "Items": [
+		{"ProjectId#DeviceId": {"S": "sensors#d1"}, "DeviceId": {"S": "d1"}, "EpochTime": {"N": "1"}},
+		{"ProjectId#DeviceId": {"S": "sensors#d1"}, "DeviceId": {"S": "d1"}, "EpochTime": {"N": "2"}}
+	]}`
+	restricted := map[string]interface{}{"privilege": RestrictedPrivilege}
+	tests := []struct {
+		name       string
+		query      map[string]string
+		accept     string
+		authorizer map[string]interface{}
+		params     QueryParams
+		wantStatus int
+		wantHeader map[string]string
+		wantBody   []string
+		avoidBody  []string
+	}{
+		{
+			name:       "items without their composite keys",
+			params:     QueryParams{ProjectId: "sensors", DeviceId: "d1"},
+			wantStatus: 200,
+			wantBody:   []string{`"EpochTime":{"Value":"1"}`, `"EpochTime":{"Value":"2"}`},
+			avoidBody:  []string{"ProjectId#DeviceId"},
+		},
+		{
+			name:       "invalid parameters",
+			params:     QueryParams{ProjectId: "sensors", After: float(1), Start: float(1)},
+			wantStatus: 400,
+		},
+		{
+			name:       "index without the admin token",
+			params:     QueryParams{ProjectId: "sensors", Index: "x"},
+			wantStatus: 403,
+		},
+		{
+			name:       "stats summary",
+			query:      map[string]string{"stats": "EpochTime", "percentiles": "50"},
+			params:     QueryParams{ProjectId: "sensors", DeviceId: "d1"},
+			wantStatus: 200,
+			wantBody:   []string{`"count":2`, `"min":1`, `"max":2`, `"avg":1.5`, `"p50":1.5`},
+			avoidBody:  []string{"DeviceId"},
+		},
+		{
+			name:       "maximum as a single item",
+			query:      map[string]string{"maxOf": "EpochTime"},
+			params:     QueryParams{ProjectId: "sensors", DeviceId: "d1"},
+			wantStatus: 200,
+			wantBody:   []string{`{"DeviceId":{"Value":"d1"},"EpochTime":{"Value":"2"}}`},
+			avoidBody:  []string{"["},
+		},
+		{
+			name:       "minimum as a single item",
+			query:      map[string]string{"minOf": "EpochTime"},
+			params:     QueryParams{ProjectId: "sensors", DeviceId: "d1"},
+			wantStatus: 200,
+			wantBody:   []string{`"EpochTime":{"Value":"1"}`},
+			avoidBody:  []string{`"EpochTime":{"Value":"2"}`},
+		},
+		{
+			name:       "maximum of a missing field",
+			query:      map[string]string{"maxOf": "Temperature"},
+			params:     QueryParams{ProjectId: "sensors", DeviceId: "d1"},
+			wantStatus: 200,
+			avoidBody:  []string{"EpochTime"},
+		},
+		{
+			name:       "maximum with single",
+			query:      map[string]string{"maxOf": "EpochTime"},
+			params:     QueryParams{ProjectId: "sensors", DeviceId: "d1", Single: true},
+			wantStatus: 400,
+		},
+		{
+			name:       "paginated maximum",
+			query:      map[string]string{"maxOf": "EpochTime"},
+			params:     QueryParams{ProjectId: "sensors", DeviceId: "d1", Paginate: true},
+			wantStatus: 400,
+		},
+		{
+			name:       "scanned count",
+			query:      map[string]string{"includeScannedCount": "true"},
+			params:     QueryParams{ProjectId: "sensors", DeviceId: "d1"},
+			wantStatus: 200,
+			wantBody:   []string{`"items":[`, `"count":2`, `"scannedCount":2`},
+		},
+		{
+			name:       "paginated with the scanned count",
+			query:      map[string]string{"includeScannedCount": "true"},
+			params:     QueryParams{ProjectId: "sensors", DeviceId: "d1", Paginate: true},
+			wantStatus: 200,
+			wantBody:   []string{`"pageCount":2`, `"scannedCount":2`},
+		},
+		{
+			name:       "debug",
+			query:      map[string]string{"debug": "true"},
+			params:     QueryParams{ProjectId: "sensors", DeviceId: "d1"},
+			wantStatus: 200,
+			wantBody:   []string{`"items":[`, `"count":2`, `"consumedCapacity":`, `"elapsedMs":`},
+			avoidBody:  []string{"scannedCount"},
+		},
+		{
+			name:       "clamped limit",
+			params:     QueryParams{ProjectId: "sensors", DeviceId: "d1", Limit: 100, LimitClamped: true},
+			wantStatus: 200,
+			wantHeader: map[string]string{"X-Limit-Clamped": "100"},
+			avoidBody:  []string{"limitClamped"},
+		},
+		{
+			name:       "clamped limit in the envelope",
+			query:      map[string]string{"includeScannedCount": "true"},
+			params:     QueryParams{ProjectId: "sensors", DeviceId: "d1", Limit: 100, LimitClamped: true},
+			wantStatus: 200,
+			wantHeader: map[string]string{"X-Limit-Clamped": "100"},
+			wantBody:   []string{`"items":[`, `"limitClamped":true`},
+		},
+		{
+			name:       "paginated with a clamped limit",
+			params:     QueryParams{ProjectId: "sensors", DeviceId: "d1", Paginate: true, Limit: 100, LimitClamped: true},
+			wantStatus: 200,
+			wantHeader: map[string]string{"X-Limit-Clamped": "100"},
+			wantBody:   []string{`"pageCount":2`, `"limitClamped":true`},
+		},
+		{
+			name:       "sensitive fields redacted",
+			authorizer: restricted,
+			params:     QueryParams{ProjectId: "sensors", DeviceId: "d1"},
+			wantStatus: 200,
+			wantBody:   []string{`"EpochTime":{"Value":"1"}`},
+			avoidBody:  []string{"DeviceId"},
+		},
+		{
+			name:       "paginated with sensitive fields redacted",
+			authorizer: restricted,
+			params:     QueryParams{ProjectId: "sensors", DeviceId: "d1", Paginate: true},
+			wantStatus: 200,
+			wantBody:   []string{`"pageCount":2`},
+			avoidBody:  []string{"DeviceId"},
+		},
+		{
+			name:       "distinct values of a sensitive field",
+			query:      map[string]string{"distinct": "DeviceId"},
+			authorizer: restricted,
+			params:     QueryParams{ProjectId: "sensors", DeviceId: "d1"},
+			wantStatus: 403,
+		},
+		{
+			name:       "maximum of a sensitive field",
+			query:      map[string]string{"maxOf": "DeviceId"},
+			authorizer: restricted,
+			params:     QueryParams{ProjectId: "sensors", DeviceId: "d1"},
+			wantStatus: 403,
+		},
+		{
+			name:       "raw items",
+			query:      map[string]string{"raw": "true"},
+			params:     QueryParams{ProjectId: "sensors", DeviceId: "d1"},
+			wantStatus: 200,
+			wantBody:   []string{"ProjectId#DeviceId"},
+		},
+		{
+			name:       "paginated without composite keys",
+			params:     QueryParams{ProjectId: "sensors", DeviceId: "d1", Paginate: true},
+			wantStatus: 200,
+			wantBody:   []string{`"EpochTime":{"Value":"1"}`},
+			avoidBody:  []string{"ProjectId#DeviceId"},
+		},
+		{
+			name:       "settled history cached privately",
+			params:     QueryParams{ProjectId: "sensors", DeviceId: "d1", Start: float(1), End: float(2)},
+			wantStatus: 200,
+			wantHeader: map[string]string{"Cache-Control": "private, max-age=300", "Vary": "Accept, Authorization-Token"},
+		},
+		{
+			name:       "ages",
+			query:      map[string]string{"includeAge": "true"},
+			params:     QueryParams{ProjectId: "sensors", DeviceId: "d1"},
+			wantStatus: 200,
+			wantHeader: map[string]string{"Cache-Control": "no-cache"},
+			wantBody:   []string{`"ageSeconds":`},
+		},
+		{
+			name:       "paginated ages",
+			query:      map[string]string{"includeAge": "true"},
+			params:     QueryParams{ProjectId: "sensors", DeviceId: "d1", Paginate: true},
+			wantStatus: 200,
+			wantHeader: map[string]string{"Cache-Control": "no-cache"},
+			wantBody:   []string{`"ageSeconds":`},
+		},
+		{
+			name:       "changes only",
+			query:      map[string]string{"changesOnly": "DeviceId"},
+			params:     QueryParams{ProjectId: "sensors", DeviceId: "d1"},
+			wantStatus: 200,
+			wantBody:   []string{`"EpochTime":{"Value":"1"}`},
+			avoidBody:  []string{`"EpochTime":{"Value":"2"}`},
+		},
+		{
+			name:       "paginated changes only",
+			query:      map[string]string{"changesOnly": "DeviceId"},
+			params:     QueryParams{ProjectId: "sensors", DeviceId: "d1", Paginate: true},
+			wantStatus: 400,
+		},
+		{
+			name:       "changes only of a sensitive field",
+			query:      map[string]string{"changesOnly": "DeviceId"},
+			authorizer: restricted,
+			params:     QueryParams{ProjectId: "sensors", DeviceId: "d1"},
+			wantStatus: 403,
+		},
+		{
+			name:       "paginated raw items",
+			query:      map[string]string{"raw": "true"},
+			params:     QueryParams{ProjectId: "sensors", DeviceId: "d1", Paginate: true},
+			wantStatus: 200,
+			wantBody:   []string{"ProjectId#DeviceId"},
+		},
+		{
+			name:       "paginated with debug",
+			query:      map[string]string{"debug": "true"},
+			params:     QueryParams{ProjectId: "sensors", DeviceId: "d1", Paginate: true},
+			wantStatus: 200,
+			wantBody:   []string{`"pageCount":2`, `"consumedCapacity":`},
+		},
+		{
+			name:       "stats of several fields",
+			query:      map[string]string{"stats": "EpochTime, Missing"},
+			params:     QueryParams{ProjectId: "sensors", DeviceId: "d1"},
+			wantStatus: 200,
+			wantBody:   []string{`"EpochTime":{"avg":1.5,"count":2,"max":2,"min":1}`, `"Missing":{"avg":null,"count":0`},
+		},
+		{
+			name:       "stats of several fields including a sensitive one",
+			query:      map[string]string{"stats": "EpochTime,DeviceId"},
+			authorizer: restricted,
+			params:     QueryParams{ProjectId: "sensors", DeviceId: "d1"},
+			wantStatus: 403,
+		},
+		{
+			name:       "distinct values",
+			query:      map[string]string{"distinct": "DeviceId"},
+			params:     QueryParams{ProjectId: "sensors", DeviceId: "d1"},
+			wantStatus: 200,
+			wantBody:   []string{`["d1"]`},
+		},
+		{
+			name:       "paginated",
+			params:     QueryParams{ProjectId: "sensors", DeviceId: "d1", Paginate: true},
+			wantStatus: 200,
+			wantBody:   []string{`"items":[`, `"pageCount":2`, `"cumulativeCount":2`},
+			avoidBody:  []string{"nextCursor"},
+		},
+		{
+			name:       "single item as an object",
+			params:     QueryParams{ProjectId: "sensors", DeviceId: "d1", Single: true},
+			wantStatus: 200,
+			wantBody:   []string{`{"DeviceId":{"Value":"d1"}`},
+			avoidBody:  []string{"["},
+		},
+		{
+			name:       "first page only",
+			params:     QueryParams{ProjectId: "sensors", DeviceId: "d1", FirstPageOnly: true},
+			wantStatus: 200,
+			wantBody:   []string{`"items":[`, `"hasMore":false`},
+		},
+		{
+			name:       "first page only of stats",
+			query:      map[string]string{"stats": "EpochTime"},
+			params:     QueryParams{ProjectId: "sensors", DeviceId: "d1", FirstPageOnly: true},
+			wantStatus: 400,
+		},
+		{
+			name:       "delta",
+			query:      map[string]string{"delta": "EpochTime"},
+			params:     QueryParams{ProjectId: "sensors", DeviceId: "d1"},
+			wantStatus: 200,
+			wantBody:   []string{`"EpochTime_delta":{"Value":true}`, `"EpochTime_delta":{"Value":"1.000000"}`},
+		},
+		{
+			name:       "stats of a delta",
+			query:      map[string]string{"delta": "EpochTime", "stats": "EpochTime_delta"},
+			params:     QueryParams{ProjectId: "sensors", DeviceId: "d1"},
+			wantStatus: 200,
+			wantBody:   []string{`"count":1`, `"avg":1`},
+		},
+		{
+			name:       "paginated delta",
+			query:      map[string]string{"delta": "EpochTime"},
+			params:     QueryParams{ProjectId: "sensors", DeviceId: "d1", Paginate: true},
+			wantStatus: 400,
+		},
+		{
+			name:       "explained",
+			query:      map[string]string{"explain": "true"},
+			params:     QueryParams{ProjectId: "sensors", DeviceId: "d1"},
+			wantStatus: 200,
+			wantBody:   []string{`"keyConditionExpression":"#primaryName = :primaryValue"`, `":primaryValue":"sensors#d1"`},
+			avoidBody:  []string{"EpochTime"},
+		},
+		{
+			name:       "explained invalid parameters",
+			query:      map[string]string{"explain": "true"},
+			params:     QueryParams{ProjectId: "sensors", After: float(1), Start: float(1)},
+			wantStatus: 400,
+		},
+		{
+			name:       "invalid cursor",
+			params:     QueryParams{ProjectId: "sensors", DeviceId: "d1", Paginate: true, Cursor: "!!!"},
+			wantStatus: 400,
+		},
+		{
+			name:       "CSV export",
+			query:      map[string]string{"format": "csv"},
+			params:     QueryParams{ProjectId: "sensors", DeviceId: "d1"},
+			wantStatus: 200,
+			wantBody:   []string{"EpochTime,DeviceId\n1,d1\n2,d1\n"},
+		},
+		{
+			name:       "CSV by the Accept header",
+			accept:     "text/csv",
+			params:     QueryParams{ProjectId: "sensors", DeviceId: "d1"},
+			wantStatus: 200,
+			wantHeader: map[string]string{"Vary": "Accept, Authorization-Token"},
+			wantBody:   []string{"EpochTime,DeviceId\n1,d1\n"},
+		},
+		{
+			name:       "unacceptable Accept header",
+			accept:     "application/xml",
+			params:     QueryParams{ProjectId: "sensors", DeviceId: "d1"},
+			wantStatus: 406,
+			wantBody:   []string{"NOT_ACCEPTABLE"},
+		},
+		{
+			name:       "unknown format",
+			query:      map[string]string{"format": "xml"},
+			params:     QueryParams{ProjectId: "sensors", DeviceId: "d1"},
+			wantStatus: 406,
+		},
+		{
+			name:       "NDJSON export",
+			query:      map[string]string{"format": "ndjson"},
+			params:     QueryParams{ProjectId: "sensors", DeviceId: "d1"},
+			wantStatus: 200,
+			wantBody:   []string{"{\"DeviceId\":\"d1\",\"EpochTime\":1}\n{\"DeviceId\":\"d1\",\"EpochTime\":2}\n"},
+			avoidBody:  []string{"ProjectId#DeviceId"},
+		},
+		{
+			name:       "paginated NDJSON",
+			query:      map[string]string{"format": "ndjson"},
+			params:     QueryParams{ProjectId: "sensors", DeviceId: "d1", Paginate: true},
+			wantStatus: 400,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Setenv("REDACT_FIELDS_sensors", "DeviceId")
+			server := dynamotest.NewServer(t)
+			server.Respond("Query", items)
+			request := &Request{
+				Method:                "GET",
+				Headers:               map[string]string{"Accept": test.accept},
+				PathParameters:        map[string]string{"ProjectId": "sensors"},
+				QueryStringParameters: test.query,
+				Authorizer:            test.authorizer,
+			}
+
+			response, err := QueryResponse(context.Background(), server.Client(), request, test.params)
+			if err != nil {
+				t.Fatalf("QueryResponse() error = %v", err)
+			}
+			if response.StatusCode != test.wantStatus {
+				t.Fatalf("status = %d, want %d, body %s", response.StatusCode, test.wantStatus, response.Body)
+			}
+			for name, want := range test.wantHeader {
+				if got := response.Headers[name]; got != want {
+					t.Errorf("header %s = %q, want %q", name, got, want)
+				}
+			}
+			for _, want := range test.wantBody {
+				if !strings.Contains(response.Body, want) {
+					t.Errorf("body = %s, want %s in it", response.Body, want)
+				}
+			}
+			for _, avoid := range test.avoidBody {
+				if strings.Contains(response.Body, avoid) {
+					t.Errorf("body = %s, want no %s in it", response.Body, avoid)
+				}
+			}
+		})
+	}
+}
+
+func TestQueryResponseFirstPageOnly(t *testing.T) {
+	server := dynamotest.NewServer(t)
+	server.Respond("Query", `{"Count": 1, "Items": [{"EpochTime": {"N": "1"}}],
+		"LastEvaluatedKey": {"ProjectId#DeviceId": {"S": "sensors#d1"}, "EpochTime": {"N": "1"}}}`)
+	params := QueryParams{ProjectId: "sensors", DeviceId: "d1", FirstPageOnly: true}
+
+	response, err := QueryResponse(context.Background(), server.Client(), &Request{Method: "GET"}, params)
+	if err != nil {
+		t.Fatalf("QueryResponse() error = %v", err)
+	}
+	if !strings.Contains(response.Body, `"hasMore":true`) {
+		t.Errorf("body = %s, want more items reported", response.Body)
+	}
+	if queries := server.Calls("Query"); len(queries) != 1 {
+		t.Errorf("made %d queries, want only the first page", len(queries))
+	}
+}
+
+func TestQueryResponseStrict(t *testing.T) {
+	const reading = `{"Count": 1, "Items": [{"DeviceId": {"S": "d1"}, "EpochTime": {"N": "1"}}]}`
+	tests := []struct {
+		name       string
+		env        map[string]string
+		query      map[string]string
+		params     QueryParams
+		responses  []string
+		wantStatus int
+		wantBody   string
+		wantQuery  int
+	}{
+		{
+			name:       "device that never reported",
+			query:      map[string]string{"strict": "true"},
+			params:     QueryParams{ProjectId: "sensors", DeviceId: "d1"},
+			wantStatus: 404,
+			wantBody:   `Device \"d1\" has never reported`,
+			wantQuery:  1,
+		},
+		{
+			name:       "location that never reported",
+			query:      map[string]string{"strict": "true"},
+			params:     QueryParams{ProjectId: "sensors", LocationId: "l1"},
+			wantStatus: 404,
+			wantBody:   `Location \"l1\" has never reported`,
+			wantQuery:  1,
+		},
+		{
+			name:       "without strict",
+			params:     QueryParams{ProjectId: "sensors", DeviceId: "d1"},
+			wantStatus: 200,
+			wantBody:   "[]",
+			wantQuery:  1,
+		},
+		{
+			name:       "quiet window",
+			query:      map[string]string{"strict": "true"},
+			params:     QueryParams{ProjectId: "sensors", DeviceId: "d1", Start: float(5)},
+			wantStatus: 200,
+			wantBody:   "[]",
+			wantQuery:  1,
+		},
+		{
+			name:       "quiet default window",
+			env:        map[string]string{"DEFAULT_WINDOW_SECONDS": "60"},
+			query:      map[string]string{"strict": "true"},
+			params:     QueryParams{ProjectId: "sensors", DeviceId: "d1"},
+			responses:  []string{`{"Count": 0, "Items": []}`, reading},
+			wantStatus: 200,
+			wantBody:   "[]",
+			wantQuery:  2,
+		},
+		{
+			name:       "default window of a device that never reported",
+			env:        map[string]string{"DEFAULT_WINDOW_SECONDS": "60"},
+			query:      map[string]string{"strict": "true"},
+			params:     QueryParams{ProjectId: "sensors", DeviceId: "d1"},
+			wantStatus: 404,
+			wantQuery:  2,
+		},
+		{
+			name:       "project",
+			query:      map[string]string{"strict": "true"},
+			params:     QueryParams{ProjectId: "sensors"},
+			wantStatus: 200,
+			wantBody:   "[]",
+			wantQuery:  1,
+		},
+		{
+			name:       "filtered by exists",
+			query:      map[string]string{"strict": "true"},
+			params:     QueryParams{ProjectId: "sensors", DeviceId: "d1", Exists: []string{"Temperature"}},
+			wantStatus: 200,
+			wantBody:   "[]",
+			wantQuery:  1,
+		},
+		{
+			name:       "device with readings",
+			query:      map[string]string{"strict": "true"},
+			params:     QueryParams{ProjectId: "sensors", DeviceId: "d1"},
+			responses:  []string{reading},
+			wantStatus: 200,
+			wantBody:   `"EpochTime":{"Value":"1"}`,
+			wantQuery:  1,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			for name, value := range test.env {
+				t.Setenv(name, value)
+			}
+			server := dynamotest.NewServer(t)
+			for _, body := range test.responses {
+				server.Respond("Query", body)
+			}
+			request := &Request{Method: "GET", QueryStringParameters: test.query}
+
+			response, err := QueryResponse(context.Background(), server.Client(), request, test.params)
+			if err != nil {
+				t.Fatalf("QueryResponse() error = %v", err)
+			}
+			if response.StatusCode != test.wantStatus {
+				t.Fatalf("status = %d, want %d, body %s", response.StatusCode, test.wantStatus, response.Body)
+			}
+			if !strings.Contains(response.Body, test.wantBody) {
+				t.Errorf("body = %s, want %s in it", response.Body, test.wantBody)
+			}
+			if queries := server.Calls("Query"); len(queries) != test.wantQuery {
+				t.Errorf("made %d queries, want %d", len(queries), test.wantQuery)
+			}
+		})
+	}
+}
+
+func TestQueryResponseSizeBudget(t *testing.T) {
+	const items = `{"Count": 2, "Items": [
+		{"ProjectId#DeviceId": {"S": "sensors#d1"}, "EpochTime": {"N": "1"}},
+		{"ProjectId#DeviceId": {"S": "sensors#d1"}, "EpochTime": {"N": "2"}}
+	]}`
+	cursor, err := EncodeCursor(map[string]types.AttributeValue{
+		"ProjectId#DeviceId": stringAttr("sensors#d1"), "EpochTime": numberAttr("1"),
+	}, 1)
+	if err != nil {
+		t.Fatalf("EncodeCursor() error = %v", err)
+	}
+	tests := []struct {
+		name       string
+		query      map[string]string
+		params     QueryParams
+		wantHeader map[string]string
+		wantBody   []string
+		avoidBody  []string
+	}{
+		{
+			name:      "cut short with a cursor",
+			params:    QueryParams{ProjectId: "sensors", DeviceId: "d1"},
+			wantBody:  []string{`"items":[`, `"count":1`, `"truncatedBySize":true`, `"nextCursor":"` + cursor + `"`},
+			avoidBody: []string{`"EpochTime":{"Value":"2"}`},
+		},
+		{
+			name:       "CSV cut short",
+			query:      map[string]string{"format": "csv"},
+			params:     QueryParams{ProjectId: "sensors", DeviceId: "d1"},
+			wantHeader: map[string]string{"X-Truncated-By-Size": "true", "X-Next-Cursor": cursor},
+			wantBody:   []string{"EpochTime\n1\n"},
+		},
+		{
+			name:     "stats over every item",
+			query:    map[string]string{"stats": "EpochTime"},
+			params:   QueryParams{ProjectId: "sensors", DeviceId: "d1"},
+			wantBody: []string{`"count":2`},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Setenv("RESPONSE_SIZE_BUDGET_BYTES", "10")
+			server := dynamotest.NewServer(t)
+			server.Respond("Query", items)
+			request := &Request{Method: "GET", QueryStringParameters: test.query}
+
+			response, err := QueryResponse(context.Background(), server.Client(), request, test.params)
+			if err != nil {
+				t.Fatalf("QueryResponse() error = %v", err)
+			}
+			if response.StatusCode != 200 {
+				t.Fatalf("status = %d, want 200, body %s", response.StatusCode, response.Body)
+			}
+			for name, want := range test.wantHeader {
+				if got := response.Headers[name]; got != want {
+					t.Errorf("header %s = %q, want %q", name, got, want)
+				}
+			}
+			for _, want := range test.wantBody {
+				if !strings.Contains(response.Body, want) {
+					t.Errorf("body = %s, want %s in it", response.Body, want)
+				}
+			}
+			for _, avoid := range test.avoidBody {
+				if strings.Contains(response.Body, avoid) {
+					t.Errorf("body = %s, want no %s in it", response.Body, avoid)
+				}
+			}
+		})
+	}
+}
+
+func TestQueryResponseResumed(t *testing.T) {
+	cursor, err := EncodeCursor(map[string]types.AttributeValue{
+		"ProjectId#DeviceId": stringAttr("sensors#d1"), "EpochTime": numberAttr("1"),
+	}, 1)
+	if err != nil {
+		t.Fatalf("EncodeCursor() error = %v", err)
+	}
+	tests := []struct {
+		name      string
+		params    QueryParams
+		wantQuery int
+	}{
+		{name: "resumed", params: QueryParams{ProjectId: "sensors", DeviceId: "d1", Cursor: cursor}, wantQuery: 1},
+		{name: "limit already reached", params: QueryParams{ProjectId: "sensors", DeviceId: "d1", Cursor: cursor, Limit: 1}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := dynamotest.NewServer(t)
+			server.Respond("Query", `{"Count": 1, "Items": [{"EpochTime": {"N": "2"}}]}`)
+
+			response, err := QueryResponse(context.Background(), server.Client(), &Request{Method: "GET"}, test.params)
+			if err != nil || response.StatusCode != 200 {
+				t.Fatalf("QueryResponse() = %d %s, error %v", response.StatusCode, response.Body, err)
+			}
+			queries := server.Calls("Query")
+			if len(queries) != test.wantQuery {
+				t.Fatalf("made %d queries, want %d", len(queries), test.wantQuery)
+			}
+			if test.wantQuery > 0 && queries[0].Input["ExclusiveStartKey"] == nil {
+				t.Errorf("query = %v, want it resumed from the cursor's key", queries[0].Input)
+			}
+		})
+	}
+}
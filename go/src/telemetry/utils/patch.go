@@ -0,0 +1,101 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"telemetry/constants"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go/aws"
+)
+
+// KeyAttributes identify a reading and feed its composite keys, so they can't be patched.
+var KeyAttributes = []string{"ProjectId", "DeviceId", "LocationId", "EpochTime"}
+
+// ValidatePatch rejects patches of key attributes and server-managed attributes.
+func ValidatePatch(fields map[string]interface{}) error {
+	var rejected []string
+	for name := range fields {
+		if contains(KeyAttributes, name) || contains(ServerManagedFields, name) {
+			rejected = append(rejected, name)
+		}
+	}
+	if len(rejected) > 0 {
+		sort.Strings(rejected)
+		return fmt.Errorf("Key fields cannot be patched: %s", strings.Join(rejected, ", "))
+	}
+	return nil
+}
+
+// BuildUpdateExpression builds a SET expression covering only the given fields, along with its
+// attribute names and values, so that attributes not mentioned are left intact.
+// Patches failing ValidatePatch are rejected. An empty patch has an empty expression.
+func BuildUpdateExpression(
+	fields map[string]interface{},
+) (string, map[string]string, map[string]types.AttributeValue, error) {
+	if err := ValidatePatch(fields); err != nil {
+		return "", nil, nil, err
+	}
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	if len(names) == 0 {
+		return "", nil, nil, nil
+	}
+
+	// Fields are numbered in order, so the same patch always builds the same expression.
+	sort.Strings(names)
+	assignments := make([]string, 0, len(names))
+	attributeNames := make(map[string]string, len(names))
+	attributeValues := make(map[string]types.AttributeValue, len(names))
+	for i, name := range names {
+		suffix := strconv.Itoa(i)
+		assignments = append(assignments, "#field"+suffix+" = :field"+suffix)
+		attributeNames["#field"+suffix] = name
+		attributeValues[":field"+suffix] = toAttributeValue(fields[name])
+	}
+	return "SET " + strings.Join(assignments, ", "), attributeNames, attributeValues, nil
+}
+
+// PatchReading updates only the given fields of a device's reading, reporting whether the
+// reading existed. An empty patch is a no-op that writes nothing, and is reported as found.
+func PatchReading(
+	ctx context.Context,
+	api DynamoDbUpdateItemAPI,
+	tenant string,
+	project string,
+	deviceId string,
+	epochTime float64,
+	fields map[string]interface{},
+) (bool, error) {
+	expression, names, values, err := BuildUpdateExpression(fields)
+	if err != nil || expression == "" {
+		return err == nil, err
+	}
+	names["#sortKey"] = SortKeyAttribute()
+
+	_, err = api.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(constants.TABLE_NAME),
+		Key: map[string]types.AttributeValue{
+			"ProjectId#DeviceId": &types.AttributeValueMemberS{
+				Value: PartitionKey(tenant, project, deviceId),
+			},
+			SortKeyAttribute(): &types.AttributeValueMemberN{Value: formatNumber(epochTime)},
+		},
+		UpdateExpression:          aws.String(expression),
+		ConditionExpression:       aws.String("attribute_exists(#sortKey)"),
+		ExpressionAttributeNames:  names,
+		ExpressionAttributeValues: values,
+	})
+	var conditionFailed *types.ConditionalCheckFailedException
+	if errors.As(err, &conditionFailed) {
+		return false, nil
+	}
+	return err == nil, err
+}
@@ -0,0 +1,132 @@
+package utils
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+
+	"telemetry/utils/dynamotest"
+)
+
+func TestValidatePatch(t *testing.T) {
+	tests := []struct {
+		name    string
+		fields  map[string]interface{}
+		wantErr string
+	}{
+		{name: "fields", fields: map[string]interface{}{"Temperature": 22.0, "Label": "x"}},
+		{name: "no fields", fields: map[string]interface{}{}},
+		{
+			name:    "key fields",
+			fields:  map[string]interface{}{"EpochTime": 1.0, "DeviceId": "d2", "Temperature": 22.0},
+			wantErr: "Key fields cannot be patched: DeviceId, EpochTime",
+		},
+		{
+			name:    "server-managed fields",
+			fields:  map[string]interface{}{"ProjectId#DeviceId": "dogs#d1"},
+			wantErr: "Key fields cannot be patched: ProjectId#DeviceId",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := ValidatePatch(test.fields)
+			if (err == nil) != (test.wantErr == "") || (err != nil && err.Error() != test.wantErr) {
+				t.Errorf("ValidatePatch() error = %v, want %q", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestBuildUpdateExpression(t *testing.T) {
+	tests := []struct {
+		name           string
+		fields         map[string]interface{}
+		wantExpression string
+		wantNames      map[string]string
+		wantValues     map[string]types.AttributeValue
+		wantErr        bool
+	}{
+		{name: "no fields", fields: map[string]interface{}{}},
+		{
+			name:           "fields in order",
+			fields:         map[string]interface{}{"Temperature": 22.0, "Label": "x"},
+			wantExpression: "SET #field0 = :field0, #field1 = :field1",
+			wantNames:      map[string]string{"#field0": "Label", "#field1": "Temperature"},
+			wantValues: map[string]types.AttributeValue{
+				":field0": stringAttr("x"),
+				":field1": numberAttr("22.000000"),
+			},
+		},
+		{name: "key field", fields: map[string]interface{}{"DeviceId": "d2"}, wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			expression, names, values, err := BuildUpdateExpression(test.fields)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("BuildUpdateExpression() error = %v, wantErr %v", err, test.wantErr)
+			}
+			if expression != test.wantExpression {
+				t.Errorf("expression = %q, want %q", expression, test.wantExpression)
+			}
+			if !reflect.DeepEqual(names, test.wantNames) {
+				t.Errorf("names = %v, want %v", names, test.wantNames)
+			}
+			if !reflect.DeepEqual(values, test.wantValues) {
+				t.Errorf("values = %v, want %v", values, test.wantValues)
+			}
+		})
+	}
+}
+
+func TestPatchReading(t *testing.T) {
+	tests := []struct {
+		name        string
+		fields      map[string]interface{}
+		fail        string
+		wantFound   bool
+		wantErr     bool
+		wantUpdates int
+	}{
+		{name: "patched", fields: map[string]interface{}{"Temperature": 22.0}, wantFound: true, wantUpdates: 1},
+		{name: "empty patch writes nothing", fields: map[string]interface{}{}, wantFound: true},
+		{name: "key field", fields: map[string]interface{}{"EpochTime": 2.0}, wantErr: true},
+		{
+			name:        "missing reading",
+			fields:      map[string]interface{}{"Temperature": 22.0},
+			fail:        "ConditionalCheckFailedException",
+			wantUpdates: 1,
+		},
+		{
+			name:        "update failed",
+			fields:      map[string]interface{}{"Temperature": 22.0},
+			fail:        "InternalServerError",
+			wantErr:     true,
+			wantUpdates: 1,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := dynamotest.NewServer(t)
+			if test.fail != "" {
+				server.Fail("UpdateItem", test.fail)
+			}
+
+			found, err := PatchReading(context.Background(), server.Client(), "", "sensors", "d1", 1600000000, test.fields)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("PatchReading() error = %v, wantErr %v", err, test.wantErr)
+			}
+			if found != test.wantFound {
+				t.Errorf("PatchReading() = %v, want %v", found, test.wantFound)
+			}
+			updates := server.Calls("UpdateItem")
+			if len(updates) != test.wantUpdates {
+				t.Fatalf("made %d updates, want %d", len(updates), test.wantUpdates)
+			}
+			if len(updates) > 0 && partitionKeyOf(updates[0], "Key") != "sensors#d1" {
+				t.Errorf("partition key = %v, want sensors#d1", partitionKeyOf(updates[0], "Key"))
+			}
+		})
+	}
+}
@@ -0,0 +1,399 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"mime"
+	"strconv"
+	"strings"
+	"telemetry/constants"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go/aws"
+)
+
+// DynamoDbIngestAPI defines the functions needed to ingest readings: puts and the lookup of
+// idempotency markers, the updates that count rate limits and track sequences,
+// and the transactions of idempotent and status writes.
+type DynamoDbIngestAPI interface {
+	DynamoDbPutItemAPI
+	DynamoDbGetItemAPI
+	DynamoDbUpdateItemAPI
+	DynamoDbTransactWriteAPI
+}
+
+// ErrRateLimited is returned for a write by a device that has exceeded its project's rate limit.
+var ErrRateLimited = errors.New("Device has exceeded its rate limit")
+
+// checkContentType rejects POST bodies declared as anything other than JSON.
+// Older devices send no Content-Type at all, so a missing header is still accepted.
+func checkContentType(request *Request) error {
+	contentType := request.Header("Content-Type")
+	if contentType == "" {
+		log.Printf("POST to project %s has no Content-Type, assuming application/json",
+			request.PathParameters["ProjectId"])
+		return nil
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil || mediaType != "application/json" {
+		return fmt.Errorf("Content-Type must be application/json, got %q", contentType)
+	}
+	return nil
+}
+
+// decodePostData decodes the POST body, which may be compressed, and holds either a single reading or,
+// for batch ingestion, an array of readings. It reports whether the body was a batch.
+func decodePostData(request *Request) ([]interface{}, bool, error) {
+	itemBytes, err := DecodeRequestBody(request)
+	if err != nil {
+		return nil, false, err
+	}
+	var body interface{}
+
+	if err := json.Unmarshal(itemBytes, &body); err != nil {
+		return nil, false, errors.New("Could not decode data")
+	}
+	if batch, batchOk := body.([]interface{}); batchOk {
+		return batch, true, nil
+	}
+	return []interface{}{body}, false, nil
+}
+
+// validatePostData checks that a decoded reading is an object
+// with all of the fields that the project requires, under their canonical names.
+func validatePostData(value interface{}, project string) (map[string]interface{}, error) {
+	itemMap, itemOk := value.(map[string]interface{})
+	if !itemOk {
+		return nil, errors.New("Item must be a JSON object")
+	}
+	if err := ValidateAttributeCount(itemMap, MaxAttributes()); err != nil {
+		return nil, err
+	}
+	if err := ValidateNestedAttributeCount(itemMap, MaxNestedAttributes()); err != nil {
+		return nil, err
+	}
+	// A required field sent under one of its aliases is present, so aliases are applied first.
+	ApplyAliases(itemMap, AttributeAliases())
+	if missing := MissingFields(itemMap, RequiredFields(project)); len(missing) > 0 {
+		return nil, fmt.Errorf("Missing required fields: %s", strings.Join(missing, ", "))
+	}
+	return itemMap, nil
+}
+
+// NormalizeFields applies the project's ingest rules to the fields of a reading,
+// which are normalized in place: aliases are renamed, declared types enforced, coordinates
+// and non-finite numbers checked, values rounded, and the result checked semantically.
+func NormalizeFields(itemMap map[string]interface{}, project string) error {
+	// Firmware versions disagree on attribute names, so known aliases are
+	// normalized before anything is stored.
+	ApplyAliases(itemMap, AttributeAliases())
+
+	// Fields with a declared type are coerced to it, so that a number sent as a string
+	// is still stored as a number, and values that can't be coerced are rejected.
+	if err := EnforceFieldTypes(itemMap, FieldTypes(project)); err != nil {
+		return err
+	}
+
+	// GPS coordinates out of range are bad fixes, which are rejected rather than stored.
+	if err := ValidateCoordinates(itemMap, GeoFields()); err != nil {
+		return err
+	}
+
+	// NaN and infinite numbers can't be stored, so they are dropped or rejected, as configured.
+	if err := HandleNonFiniteNumbers(itemMap, DropNonFiniteNumbers()); err != nil {
+		return err
+	}
+
+	// High-precision values are rounded to the configured number of decimal places.
+	ApplyRounding(itemMap, FieldRounding())
+
+	// Well-formed readings can still be implausible, like a timestamp far in the future,
+	// so they are checked against the project's semantic rules.
+	return SemanticValidate(itemMap, ProjectSemanticRules(project))
+}
+
+func augmentPostData(itemMap map[string]interface{}, project string) error {
+	// Clients may not set the composite keys or other server-managed attributes.
+	if err := RemoveServerManagedFields(itemMap); err != nil {
+		return err
+	}
+	if err := NormalizeFields(itemMap, project); err != nil {
+		return err
+	}
+
+	itemMap["ProjectId"] = project
+	if RecordReceivedAt() {
+		itemMap["ReceivedAt"] = float64(Now().Unix())
+	}
+	return nil
+}
+
+// PrepareItem validates and augments a decoded reading for the project, then converts it for
+// DynamoDB. Items over the size limit are rejected with an *ItemSizeError, and readings that
+// break the project's semantic rules with a *SemanticError.
+func PrepareItem(value interface{}, project string, tenant string) (map[string]types.AttributeValue, error) {
+	itemMap, err := validatePostData(value, project)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := augmentPostData(itemMap, project); err != nil {
+		return nil, err
+	}
+
+	// The typed reading enforces the key constraints, and adds the composite keys.
+	reading, err := ReadingFromMap(itemMap)
+	if err != nil {
+		return nil, err
+	}
+	reading.TenantId = tenant
+	if err := reading.Validate(); err != nil {
+		return nil, err
+	}
+	item := reading.ToAttributeValues()
+	if _, _, err := SequenceNumber(item); err != nil {
+		return nil, err
+	}
+	if err := CheckItemSize(item); err != nil {
+		return nil, err
+	}
+	return item, nil
+}
+
+// tryPutItem writes the item. When the write carries an idempotency key,
+// a retried write with the same key is a no-op.
+func tryPutItem(
+	ctx context.Context,
+	api DynamoDbIngestAPI,
+	item map[string]types.AttributeValue,
+	project string,
+	idempotencyKey string,
+) error {
+	tenant, _ := StringAttribute(item, "TenantId")
+	input := &dynamodb.PutItemInput{
+		TableName: aws.String(constants.TABLE_NAME),
+		Item:      item,
+	}
+	if idempotencyKey == "" {
+		_, err := PutTableItem(ctx, api, input)
+		return err
+	}
+	_, err := PutIdempotent(ctx, api, input, tenant, project, idempotencyKey)
+	return err
+}
+
+// putReading writes the item like tryPutItem. When the item has a SequenceNum, the write is
+// rejected with ErrStaleSequence unless the sequence is newer than the device's latest,
+// so that stale readings replayed from a device's buffered queue aren't stored.
+// With withStatus, the reading and its device's LastSeen time are written in one transaction instead.
+func putReading(
+	ctx context.Context,
+	api DynamoDbIngestAPI,
+	item map[string]types.AttributeValue,
+	project string,
+	idempotencyKey string,
+	withStatus bool,
+) error {
+	if withStatus {
+		_, err := PutReadingWithStatus(ctx, api, item, project, idempotencyKey)
+		return err
+	}
+	put := func() error {
+		return tryPutItem(ctx, api, item, project, idempotencyKey)
+	}
+	sequence, sequenced, _ := SequenceNumber(item)
+	if !sequenced {
+		return put()
+	}
+	tenant, _ := StringAttribute(item, "TenantId")
+	deviceId, _ := StringAttribute(item, "DeviceId")
+	return PutSequenced(ctx, api, tenant, project, deviceId, sequence, put)
+}
+
+// WriteItem writes an item prepared by PrepareItem, once its device is within the project's
+// rate limit, failing with ErrRateLimited otherwise. If the limit can't be checked, the write is
+// allowed rather than losing data. An idempotency key makes a retried write a no-op: its marker
+// is looked up first, so that the retry succeeds again without counting against the rate limit,
+// nor failing the sequence check against its own recorded sequence. withStatus also records
+// the device's LastSeen time, atomically with the reading.
+func WriteItem(
+	ctx context.Context,
+	api DynamoDbIngestAPI,
+	item map[string]types.AttributeValue,
+	project string,
+	idempotencyKey string,
+	withStatus bool,
+) error {
+	tenant, _ := StringAttribute(item, "TenantId")
+	deviceId, _ := StringAttribute(item, "DeviceId")
+	if idempotencyKey != "" {
+		used, err := IdempotencyKeyUsed(ctx, api, tenant, project, idempotencyKey)
+		if err != nil {
+			return err
+		}
+		if used {
+			return nil
+		}
+	}
+	allowed, err := CheckRateLimit(ctx, api, tenant, project, deviceId)
+	if err != nil {
+		log.Printf("Failed to check rate limit, %v", err)
+	} else if !allowed {
+		return ErrRateLimited
+	}
+	return putReading(ctx, api, item, project, idempotencyKey, withStatus)
+}
+
+// emitWriteMetrics records ingestion volume and rejected writes for the project.
+func emitWriteMetrics(ctx context.Context, project string, written int, rejected int) {
+	EmitMetrics(
+		ctx,
+		map[string]string{"ProjectId": project},
+		Metric{Name: "ItemsWritten", Unit: "Count", Value: float64(written)},
+		Metric{Name: "WriteErrors", Unit: "Count", Value: float64(rejected)},
+	)
+}
+
+// itemCollectionFullMessage tells operators which partition has outgrown its item collection,
+// so its readings can be sharded or archived.
+func itemCollectionFullMessage(item map[string]types.AttributeValue) string {
+	partitionKey, _ := StringAttribute(item, "ProjectId#DeviceId")
+	return fmt.Sprintf(
+		"Item collection for partition key %q has reached its size limit; shard or archive its readings",
+		partitionKey,
+	)
+}
+
+// PostResponse ingests the readings in a POST body for the project in the path, and encodes
+// the outcome. In addition to the ProjectId gathered from the path, the EpochTime and DeviceId
+// fields are required in the body, along with any fields the project itself requires.
+// The body may instead hold an array of readings, which are validated and written independently.
+func PostResponse(
+	ctx context.Context,
+	api DynamoDbIngestAPI,
+	request *Request,
+) (events.APIGatewayProxyResponse, error) {
+	project := request.PathParameters["ProjectId"]
+	if err := request.CheckAuthorizedProject(); err != nil {
+		emitWriteMetrics(ctx, project, 0, 1)
+		return ForbiddenResponse(err.Error())
+	}
+	if err := checkContentType(request); err != nil {
+		emitWriteMetrics(ctx, project, 0, 1)
+		return UnsupportedMediaTypeResponse(err.Error())
+	}
+	values, batch, err := decodePostData(request)
+	if err != nil {
+		emitWriteMetrics(ctx, project, 0, 1)
+		if errors.Is(err, ErrBodyTooLarge) {
+			return PayloadTooLargeResponse(err.Error())
+		}
+		return BadRequestResponse(err.Error())
+	}
+	// A truthy 'withStatus' query string parameter also records the device's LastSeen time,
+	// atomically with the reading.
+	withStatus := false
+	if withStatusStr, withStatusOk := request.QueryStringParameters["withStatus"]; withStatusOk {
+		if withStatus, err = ParseBoolParam(withStatusStr); err != nil {
+			emitWriteMetrics(ctx, project, 0, 1)
+			return BadRequestResponse("withStatus: " + err.Error())
+		}
+	}
+	if batch {
+		return batchPostResponse(ctx, api, request, values, withStatus)
+	}
+
+	item, err := PrepareItem(values[0], project, request.TenantId)
+	if err != nil {
+		emitWriteMetrics(ctx, project, 0, 1)
+		var semanticErr *SemanticError
+		if errors.As(err, &semanticErr) {
+			return UnprocessableEntityResponse(semanticErr.Error(), semanticErr.Violations)
+		}
+		var sizeErr *ItemSizeError
+		if errors.As(err, &sizeErr) {
+			return PayloadTooLargeResponse(err.Error())
+		}
+		return BadRequestResponse(err.Error())
+	}
+
+	// Devices that retry after a timeout send the same 'Idempotency-Key' header,
+	// so that a write which actually succeeded isn't duplicated.
+	if err := WriteItem(ctx, api, item, project, request.Header("Idempotency-Key"), withStatus); err != nil {
+		emitWriteMetrics(ctx, project, 0, 1)
+		if errors.Is(err, ErrRateLimited) {
+			return TooManyRequestsResponse(err.Error(), RateLimitRetryAfter())
+		}
+		if errors.Is(err, ErrStaleSequence) {
+			return ConflictResponse(err.Error())
+		}
+		log.Printf("Failed to add to table, %v", err)
+		if IsItemCollectionFull(err) {
+			return InsufficientStorageResponse(itemCollectionFullMessage(item))
+		}
+		return TransactionErrorResponse(err, "Failed to add to table")
+	}
+	emitWriteMetrics(ctx, project, 1, 0)
+
+	return PostSuccessResponse(ReadingKeyOf(item))
+}
+
+// batchPostResponse writes every valid reading in a batch, and reports the index
+// and reason for each one that was rejected, so that devices only need to resend those.
+// The readings are written concurrently through the shared WriteLimiter, which rejects
+// those it sheds with ErrWriteQueueFull.
+func batchPostResponse(
+	ctx context.Context,
+	api DynamoDbIngestAPI,
+	request *Request,
+	values []interface{},
+	withStatus bool,
+) (events.APIGatewayProxyResponse, error) {
+	project := request.PathParameters["ProjectId"]
+	idempotencyKey := request.Header("Idempotency-Key")
+	errs := make([]error, len(values))
+	var items []map[string]types.AttributeValue
+	var indexes []int
+	for index, value := range values {
+		item, err := PrepareItem(value, project, request.TenantId)
+		if err != nil {
+			errs[index] = err
+			continue
+		}
+		items = append(items, item)
+		indexes = append(indexes, index)
+	}
+
+	writeErrs := SharedWriteLimiter().DoAll(ctx, len(items), func(i int) error {
+		// Each item of a batch gets its own key, derived from the request's key and its index.
+		itemKey := ""
+		if idempotencyKey != "" {
+			itemKey = CompositeKey(idempotencyKey, strconv.Itoa(indexes[i]))
+		}
+		err := WriteItem(ctx, api, items[i], project, itemKey, withStatus)
+		if IsItemCollectionFull(err) {
+			err = errors.New(itemCollectionFullMessage(items[i]))
+		}
+		return err
+	})
+	for i, err := range writeErrs {
+		errs[indexes[i]] = err
+	}
+
+	result := BatchWriteResult{Errors: []BatchItemError{}}
+	for index, err := range errs {
+		if err != nil {
+			result.Errors = append(result.Errors, BatchItemError{Index: index, Reason: err.Error()})
+			continue
+		}
+		result.Written++
+	}
+
+	emitWriteMetrics(ctx, project, result.Written, len(result.Errors))
+	return BatchWriteResponse(result)
+}
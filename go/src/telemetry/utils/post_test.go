@@ -0,0 +1,248 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"telemetry/utils/dynamotest"
+)
+
+func TestCheckContentType(t *testing.T) {
+	tests := []struct {
+		contentType string
+		wantErr     bool
+	}{
+		{contentType: ""},
+		{contentType: "application/json"},
+		{contentType: "application/json; charset=utf-8"},
+		{contentType: "text/plain", wantErr: true},
+		{contentType: "application/json;;", wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.contentType, func(t *testing.T) {
+			request := &Request{Headers: map[string]string{"content-type": test.contentType}}
+			if err := checkContentType(request); (err != nil) != test.wantErr {
+				t.Errorf("checkContentType() error = %v, wantErr %v", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestPrepareItem(t *testing.T) {
+	tests := []struct {
+		name       string
+		env        map[string]string
+		value      interface{}
+		tenant     string
+		wantErr    bool
+		wantSize   bool
+		wantFields map[string]interface{}
+	}{
+		{
+			name:  "reading",
+			value: map[string]interface{}{"DeviceId": "d1", "EpochTime": 1.0, "Temperature": 21.5},
+			wantFields: map[string]interface{}{
+				"ProjectId": "sensors", "DeviceId": "d1", "EpochTime": 1.0, "Temperature": 21.5,
+				"ProjectId#DeviceId": "sensors#d1",
+			},
+		},
+		{
+			name:   "tenant",
+			value:  map[string]interface{}{"DeviceId": "d1", "EpochTime": 1.0},
+			tenant: "acme",
+			wantFields: map[string]interface{}{
+				"TenantId": "acme", "ProjectId": "sensors", "DeviceId": "d1", "EpochTime": 1.0,
+				"ProjectId#DeviceId": "acme#sensors#d1",
+			},
+		},
+		{
+			name:  "spoofed composite key dropped",
+			value: map[string]interface{}{"DeviceId": "d1", "EpochTime": 1.0, "ProjectId#DeviceId": "dogs#d1"},
+			wantFields: map[string]interface{}{
+				"ProjectId": "sensors", "DeviceId": "d1", "EpochTime": 1.0,
+				"ProjectId#DeviceId": "sensors#d1",
+			},
+		},
+		{
+			name:  "received time recorded",
+			env:   map[string]string{"RECORD_RECEIVED_AT": "true"},
+			value: map[string]interface{}{"DeviceId": "d1", "EpochTime": 1.0},
+			wantFields: map[string]interface{}{
+				"ProjectId": "sensors", "DeviceId": "d1", "EpochTime": 1.0, "ReceivedAt": 1600000000.0,
+				"ProjectId#DeviceId": "sensors#d1",
+			},
+		},
+		{
+			name:  "client's received time replaced",
+			env:   map[string]string{"RECORD_RECEIVED_AT": "true"},
+			value: map[string]interface{}{"DeviceId": "d1", "EpochTime": 1.0, "ReceivedAt": 5.0},
+			wantFields: map[string]interface{}{
+				"ProjectId": "sensors", "DeviceId": "d1", "EpochTime": 1.0, "ReceivedAt": 1600000000.0,
+				"ProjectId#DeviceId": "sensors#d1",
+			},
+		},
+		{
+			name:  "client's received time dropped",
+			value: map[string]interface{}{"DeviceId": "d1", "EpochTime": 1.0, "ReceivedAt": 5.0},
+			wantFields: map[string]interface{}{
+				"ProjectId": "sensors", "DeviceId": "d1", "EpochTime": 1.0,
+				"ProjectId#DeviceId": "sensors#d1",
+			},
+		},
+		{
+			name:  "rounded",
+			env:   map[string]string{"ROUND_FIELDS": `{"Temperature": 1}`},
+			value: map[string]interface{}{"DeviceId": "d1", "EpochTime": 1.0, "Temperature": 21.46},
+			wantFields: map[string]interface{}{
+				"ProjectId": "sensors", "DeviceId": "d1", "EpochTime": 1.0, "Temperature": 21.5,
+				"ProjectId#DeviceId": "sensors#d1",
+			},
+		},
+		{name: "not an object", value: []interface{}{}, wantErr: true},
+		{name: "missing fields", value: map[string]interface{}{"DeviceId": "d1"}, wantErr: true},
+		{
+			name:    "project's required fields",
+			env:     map[string]string{"REQUIRED_FIELDS_sensors": "LocationId"},
+			value:   map[string]interface{}{"DeviceId": "d1", "EpochTime": 1.0},
+			wantErr: true,
+		},
+		{
+			name: "required field sent under an alias",
+			env: map[string]string{
+				"REQUIRED_FIELDS_sensors": "Temperature",
+				"ATTRIBUTE_ALIASES":       `{"temp": "Temperature"}`,
+			},
+			value: map[string]interface{}{"DeviceId": "d1", "EpochTime": 1.0, "temp": 21.5},
+			wantFields: map[string]interface{}{
+				"ProjectId": "sensors", "DeviceId": "d1", "EpochTime": 1.0, "Temperature": 21.5,
+				"ProjectId#DeviceId": "sensors#d1",
+			},
+		},
+		{
+			name:    "'#' in DeviceId",
+			value:   map[string]interface{}{"DeviceId": "a#b", "EpochTime": 1.0},
+			wantErr: true,
+		},
+		{
+			name:     "too large",
+			env:      map[string]string{"MAX_ITEM_SIZE_BYTES": "100"},
+			value:    map[string]interface{}{"DeviceId": "d1", "EpochTime": 1.0, "Notes": strings.Repeat("x", 100)},
+			wantErr:  true,
+			wantSize: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			stopClock(t)
+			for name, value := range test.env {
+				t.Setenv(name, value)
+			}
+			item, err := PrepareItem(test.value, "sensors", test.tenant)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("PrepareItem() error = %v, wantErr %v", err, test.wantErr)
+			}
+			var sizeErr *ItemSizeError
+			if errors.As(err, &sizeErr) != test.wantSize {
+				t.Errorf("PrepareItem() error = %v, want an ItemSizeError %v", err, test.wantSize)
+			}
+			if test.wantErr {
+				return
+			}
+			if got := AttributeValuesToMap(item); !reflect.DeepEqual(got, test.wantFields) {
+				t.Errorf("PrepareItem() = %v, want %v", got, test.wantFields)
+			}
+		})
+	}
+}
+
+func TestPostResponse(t *testing.T) {
+	const reading = `{"DeviceId": "d1", "EpochTime": 1600000000}`
+	tests := []struct {
+		name       string
+		env        map[string]string
+		body       string
+		query      map[string]string
+		setup      func(server *dynamotest.Server)
+		wantStatus int
+		wantCalls  map[string]int
+	}{
+		{
+			name:       "written",
+			body:       reading,
+			wantStatus: 200,
+			wantCalls:  map[string]int{"PutItem": 1},
+		},
+		{
+			name:       "written with status",
+			body:       reading,
+			query:      map[string]string{"withStatus": "true"},
+			wantStatus: 200,
+			wantCalls:  map[string]int{"PutItem": 0, "TransactWriteItems": 1},
+		},
+		{
+			name:       "malformed withStatus",
+			body:       reading,
+			query:      map[string]string{"withStatus": "maybe"},
+			wantStatus: 400,
+			wantCalls:  map[string]int{"PutItem": 0},
+		},
+		{
+			name:       "too large",
+			env:        map[string]string{"MAX_ITEM_SIZE_BYTES": "50"},
+			body:       `{"DeviceId": "d1", "EpochTime": 1600000000, "Notes": "` + strings.Repeat("x", 50) + `"}`,
+			wantStatus: 413,
+			wantCalls:  map[string]int{"PutItem": 0},
+		},
+		{
+			name:       "item collection full",
+			body:       reading,
+			setup:      func(server *dynamotest.Server) { server.Fail("PutItem", "ItemCollectionSizeLimitExceededException") },
+			wantStatus: 507,
+		},
+		{
+			name:       "throttled",
+			body:       reading,
+			setup:      func(server *dynamotest.Server) { server.Fail("PutItem", "ProvisionedThroughputExceededException") },
+			wantStatus: 503,
+		},
+		{
+			name:       "batch with nothing written",
+			body:       `[{"EpochTime": 1}]`,
+			wantStatus: 400,
+			wantCalls:  map[string]int{"PutItem": 0},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			for name, value := range test.env {
+				t.Setenv(name, value)
+			}
+			server := dynamotest.NewServer(t)
+			if test.setup != nil {
+				test.setup(server)
+			}
+			request := &Request{
+				Method:                "POST",
+				PathParameters:        map[string]string{"ProjectId": "sensors"},
+				QueryStringParameters: test.query,
+				Body:                  test.body,
+			}
+
+			response, err := PostResponse(context.Background(), server.Client(), request)
+			if err != nil {
+				t.Fatalf("PostResponse() error = %v", err)
+			}
+			if response.StatusCode != test.wantStatus {
+				t.Errorf("status = %d, want %d, body %s", response.StatusCode, test.wantStatus, response.Body)
+			}
+			for operation, want := range test.wantCalls {
+				if calls := len(server.Calls(operation)); calls != want {
+					t.Errorf("made %d %s calls, want %d", calls, operation, want)
+				}
+			}
+		})
+	}
+}
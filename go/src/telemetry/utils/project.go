@@ -0,0 +1,70 @@
+package utils
+
+import (
+	"os"
+	"sort"
+	"strings"
+)
+
+// NormalizeProjectId lowercases a ProjectId when the NORMALIZE_PROJECT_ID environment variable
+// is truthy, so that 'Sensors', 'sensors', and 'SENSORS' share one partition and one set of tokens.
+// Otherwise the ProjectId is returned as is.
+//
+// Readings already stored under a mixed-case ProjectId are not found by normalized queries,
+// so they must be migrated to the lowercase ProjectId before the flag is turned on.
+// Per-project configuration needs no migration, as ProjectEnvName matches it in any case.
+func NormalizeProjectId(project string) string {
+	if !normalizingProjectIds() {
+		return project
+	}
+	return strings.ToLower(project)
+}
+
+// normalizingProjectIds reports whether ProjectIds are lowercased, as set by NORMALIZE_PROJECT_ID.
+func normalizingProjectIds() bool {
+	normalize, err := ParseBoolParam(os.Getenv("NORMALIZE_PROJECT_ID"))
+	return err == nil && normalize
+}
+
+// ProjectEnvName returns the name of a per-project environment variable, the prefix followed by
+// the ProjectId, as in RATE_LIMIT_<ProjectId>. While ProjectIds are normalized, a variable
+// named for the project in another case, like RATE_LIMIT_Sensors for 'sensors', is found too,
+// so configuration written before the flag was turned on still applies. An exact match wins,
+// and otherwise the first matching name in sorted order.
+func ProjectEnvName(prefix string, project string) string {
+	name := prefix + project
+	if _, ok := os.LookupEnv(name); ok || !normalizingProjectIds() {
+		return name
+	}
+	var names []string
+	for _, entry := range os.Environ() {
+		candidate := strings.SplitN(entry, "=", 2)[0]
+		if strings.HasPrefix(candidate, prefix) && strings.EqualFold(candidate[len(prefix):], project) {
+			names = append(names, candidate)
+		}
+	}
+	if len(names) == 0 {
+		return name
+	}
+	sort.Strings(names)
+	return names[0]
+}
+
+// projectKey returns the key of a map keyed by ProjectId that holds the project's entry,
+// matched regardless of case while ProjectIds are normalized, like ProjectEnvName.
+func projectKey(keys []string, project string) (string, bool) {
+	sort.Strings(keys)
+	for _, key := range keys {
+		if key == project {
+			return key, true
+		}
+	}
+	if normalizingProjectIds() {
+		for _, key := range keys {
+			if strings.EqualFold(key, project) {
+				return key, true
+			}
+		}
+	}
+	return "", false
+}
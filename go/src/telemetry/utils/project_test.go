@@ -0,0 +1,59 @@
+package utils
+
+import "testing"
+
+func TestNormalizeProjectId(t *testing.T) {
+	tests := []struct {
+		name      string
+		normalize string
+		project   string
+		want      string
+	}{
+		{name: "unset", project: "Sensors", want: "Sensors"},
+		{name: "disabled", normalize: "false", project: "Sensors", want: "Sensors"},
+		{name: "malformed flag", normalize: "maybe", project: "Sensors", want: "Sensors"},
+		{name: "enabled", normalize: "true", project: "SENSORS", want: "sensors"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Setenv("NORMALIZE_PROJECT_ID", test.normalize)
+			if got := NormalizeProjectId(test.project); got != test.want {
+				t.Errorf("NormalizeProjectId() = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestProjectEnvName(t *testing.T) {
+	tests := []struct {
+		name      string
+		normalize string
+		env       map[string]string
+		project   string
+		want      string
+	}{
+		{name: "unset", normalize: "true", project: "sensors", want: "RATE_LIMIT_sensors"},
+		{name: "exact", normalize: "true", env: map[string]string{"RATE_LIMIT_sensors": "1"}, project: "sensors", want: "RATE_LIMIT_sensors"},
+		{name: "mixed case", normalize: "true", env: map[string]string{"RATE_LIMIT_Sensors": "1"}, project: "sensors", want: "RATE_LIMIT_Sensors"},
+		{
+			name:      "exact preferred",
+			normalize: "true",
+			env:       map[string]string{"RATE_LIMIT_Sensors": "1", "RATE_LIMIT_sensors": "2"},
+			project:   "sensors",
+			want:      "RATE_LIMIT_sensors",
+		},
+		{name: "not normalized", env: map[string]string{"RATE_LIMIT_Sensors": "1"}, project: "sensors", want: "RATE_LIMIT_sensors"},
+		{name: "other prefix", normalize: "true", env: map[string]string{"RATE_LIMITS_Sensors": "1"}, project: "sensors", want: "RATE_LIMIT_sensors"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Setenv("NORMALIZE_PROJECT_ID", test.normalize)
+			for name, value := range test.env {
+				t.Setenv(name, value)
+			}
+			if got := ProjectEnvName("RATE_LIMIT_", test.project); got != test.want {
+				t.Errorf("ProjectEnvName() = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
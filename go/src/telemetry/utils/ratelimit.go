@@ -0,0 +1,72 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"telemetry/constants"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go/aws"
+)
+
+// DynamoDbUpdateItemAPI defines interface for UpdateItem function.
+type DynamoDbUpdateItemAPI interface {
+	UpdateItem(
+		ctx context.Context,
+		params *dynamodb.UpdateItemInput,
+		optFns ...func(*dynamodb.Options),
+	) (*dynamodb.UpdateItemOutput, error)
+}
+
+// RateLimit returns the number of writes per minute allowed for each device in the project,
+// from the RATE_LIMIT_<ProjectId> environment variable. Zero means unlimited.
+func RateLimit(project string) int {
+	return envInt(ProjectEnvName("RATE_LIMIT_", project), 0)
+}
+
+// CheckRateLimit counts a write by the device against its project's per-minute limit,
+// reporting whether the write is allowed. Each device has a counter item per minute,
+// incremented atomically only while it is under the limit, and expired through the ExpiresAt
+// TTL attribute shortly after its minute ends.
+func CheckRateLimit(
+	ctx context.Context,
+	api DynamoDbUpdateItemAPI,
+	tenant string,
+	project string,
+	deviceId string,
+) (bool, error) {
+	limit := RateLimit(project)
+	if limit <= 0 {
+		return true, nil
+	}
+
+	window := Now().Truncate(time.Minute)
+	_, err := api.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(constants.TABLE_NAME),
+		Key: map[string]types.AttributeValue{
+			"ProjectId#DeviceId": &types.AttributeValueMemberS{
+				Value: bookkeepingKey("ratelimit", tenant, project, deviceId),
+			},
+			SortKeyAttribute(): &types.AttributeValueMemberN{
+				Value: strconv.FormatInt(window.Unix(), 10),
+			},
+		},
+		UpdateExpression:    aws.String("ADD RequestCount :one SET ExpiresAt = :expiresAt"),
+		ConditionExpression: aws.String("attribute_not_exists(RequestCount) OR RequestCount < :limit"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":one":   &types.AttributeValueMemberN{Value: "1"},
+			":limit": &types.AttributeValueMemberN{Value: strconv.Itoa(limit)},
+			":expiresAt": &types.AttributeValueMemberN{
+				Value: strconv.FormatInt(window.Add(2*time.Minute).Unix(), 10),
+			},
+		},
+	})
+	var conditionFailed *types.ConditionalCheckFailedException
+	if errors.As(err, &conditionFailed) {
+		return false, nil
+	}
+	return err == nil, err
+}
@@ -0,0 +1,69 @@
+package utils
+
+import (
+	"context"
+	"testing"
+
+	"telemetry/utils/dynamotest"
+)
+
+func TestCheckRateLimit(t *testing.T) {
+	tests := []struct {
+		name        string
+		limit       string
+		setup       func(server *dynamotest.Server)
+		want        bool
+		wantErr     bool
+		wantUpdates int
+	}{
+		{name: "unlimited", want: true},
+		{name: "under the limit", limit: "10", want: true, wantUpdates: 1},
+		{
+			name:        "over the limit",
+			limit:       "10",
+			setup:       func(server *dynamotest.Server) { server.Fail("UpdateItem", "ConditionalCheckFailedException") },
+			wantUpdates: 1,
+		},
+		{
+			name:        "counter failed",
+			limit:       "10",
+			setup:       func(server *dynamotest.Server) { server.Fail("UpdateItem", "InternalServerError") },
+			wantErr:     true,
+			wantUpdates: 1,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			stopClock(t)
+			t.Setenv("RATE_LIMIT_sensors", test.limit)
+			server := dynamotest.NewServer(t)
+			if test.setup != nil {
+				test.setup(server)
+			}
+
+			allowed, err := CheckRateLimit(context.Background(), server.Client(), "", "sensors", "d1")
+			if (err != nil) != test.wantErr {
+				t.Fatalf("CheckRateLimit() error = %v, wantErr %v", err, test.wantErr)
+			}
+			if allowed != test.want {
+				t.Errorf("CheckRateLimit() = %v, want %v", allowed, test.want)
+			}
+			updates := server.Calls("UpdateItem")
+			if len(updates) != test.wantUpdates {
+				t.Fatalf("made %d updates, want %d", len(updates), test.wantUpdates)
+			}
+			if len(updates) == 0 {
+				return
+			}
+			if key := partitionKeyOf(updates[0], "Key"); key != "ratelimit#sensors#d1" {
+				t.Errorf("counter = %v, want ratelimit#sensors#d1", key)
+			}
+			// The counter is for the minute the clock is in.
+			key, _ := updates[0].Input["Key"].(map[string]interface{})
+			window, _ := key["EpochTime"].(map[string]interface{})
+			if window["N"] != "1599999960" {
+				t.Errorf("window = %v, want 1599999960", window["N"])
+			}
+		})
+	}
+}
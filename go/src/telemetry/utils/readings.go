@@ -0,0 +1,575 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"telemetry/constants"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go/aws"
+)
+
+// Reading is a single telemetry record. Fields holds every attribute besides the identifiers.
+type Reading struct {
+	TenantId   string
+	ProjectId  string
+	DeviceId   string
+	LocationId string
+	EpochTime  float64
+	Fields     map[string]interface{}
+}
+
+// QueryParams describes a query for readings, independent of how the request arrived.
+// Setting DeviceId queries a single device, setting LocationId queries a single location,
+// and leaving both empty queries the whole project.
+// TenantId, when set, confines the query to the tenant's partitions.
+type QueryParams struct {
+	TenantId   string
+	ProjectId  string
+	DeviceId   string
+	LocationId string
+
+	// Start and End are bounds on EpochTime, while After is an exclusive lower bound
+	// that can't be combined with either of them. All are optional.
+	Start *float64
+	End   *float64
+	After *float64
+
+	// StartExclusive and EndExclusive leave out readings exactly at Start or End,
+	// which are otherwise included.
+	StartExclusive bool
+	EndExclusive   bool
+
+	// SeqStart and SeqEnd are inclusive bounds on SequenceNum, in place of the time bounds,
+	// for device queries served by the sequence index. Either is optional.
+	SeqStart *int64
+	SeqEnd   *int64
+
+	// Single fetches only one item, chosen by the bounds given:
+	//
+	//	no bounds            the latest item
+	//	start only           the earliest item at or after start
+	//	after                the earliest item after after
+	//	end only             the latest item at or before end
+	//	start and end        the latest item in the range
+	//
+	// with seqStart and seqEnd choosing by SequenceNum the way start and end choose by EpochTime.
+	// Otherwise, a positive Limit caps the number of items,
+	// which are in ascending EpochTime order unless Descending is set.
+	Single     bool
+	Limit      int
+	Descending bool
+
+	// Recent fetches the Recent newest items, which are newest first unless the query asks
+	// for ascending order. Unlike Limit, which takes the earliest items of the range,
+	// it can't be combined with Single or Limit. When its size budget cuts it short,
+	// its cursor resumes with the next older items.
+	Recent int
+
+	// LimitClamped notes that the requested Limit was reduced to the maximum allowed.
+	LimitClamped bool
+
+	// Consistent requests a strongly consistent read, which is only possible for device queries.
+	Consistent bool
+
+	// Exists keeps only items that have all of the listed attributes.
+	Exists []string
+
+	// Sentinels leaves out items where a field holds the value a device reports when it fails.
+	Sentinels []Sentinel
+
+	// Stride keeps only every Nth item of the results.
+	Stride int
+
+	// Unclamped skips the maximum time span guard.
+	Unclamped bool
+
+	// Paginate returns a single page of items, along with a cursor to the next page.
+	// Cursor, when set, resumes a paginated query where the previous page ended,
+	// or any other query where its size budget cut it short.
+	Paginate bool
+	Cursor   string
+
+	// SizeBudget, when positive, stops retrieving items before they take more than that many bytes
+	// of JSON, so that a response carrying them fits API Gateway's response size limit.
+	SizeBudget int
+
+	// Index, KeyName, and KeyValue query an additional global secondary index by its partition key,
+	// for administrative use. The index must be one of QueryableIndexes, and must be sorted by
+	// EpochTime. Only the project's items are returned.
+	Index    string
+	KeyName  string
+	KeyValue string
+
+	// IncludeDeleted also returns readings that have been soft-deleted, which are otherwise skipped.
+	IncludeDeleted bool
+
+	// FirstPageOnly returns only what DynamoDB returns for the first request, without following
+	// further pages or offering a cursor, for callers that prefer a cheap, partial answer.
+	FirstPageOnly bool
+
+	// Filters and Fields are a QuerySpec's filters and field selection.
+	Filters []FilterSpec
+	Fields  []string
+}
+
+// Validate checks for combinations of parameters that can't be expressed as a single query.
+func (params QueryParams) Validate() error {
+	// The sort key accepts only one condition, so 'after' can't be combined with the inclusive bounds.
+	if params.After != nil && (params.Start != nil || params.End != nil) {
+		return errors.New("after cannot be combined with start or end")
+	}
+	if params.StartExclusive && params.Start == nil {
+		return errors.New("startInclusive requires start")
+	}
+	if params.EndExclusive && params.End == nil {
+		return errors.New("endInclusive requires end")
+	}
+	if params.sequenceRange() {
+		if params.Start != nil || params.End != nil || params.After != nil {
+			return errors.New("seqStart and seqEnd cannot be combined with start, end, or after")
+		}
+		if params.DeviceId == "" || params.Index != "" {
+			return errors.New("seqStart and seqEnd require a device")
+		}
+		if params.SeqStart != nil && params.SeqEnd != nil && *params.SeqStart > *params.SeqEnd {
+			return errors.New("seqStart cannot be greater than seqEnd")
+		}
+	}
+	// DynamoDB only supports consistent reads on the base table and its local secondary indexes,
+	// not on global secondary indexes.
+	if index := params.indexName(); params.Consistent && index != "" && index != constants.SEQUENCE_INDEX {
+		return fmt.Errorf("consistent reads are not supported on the %s index", index)
+	}
+	if params.Recent > 0 {
+		if params.Single || params.Limit > 0 {
+			return errors.New("recent cannot be combined with single or limit")
+		}
+		if params.Paginate || params.FirstPageOnly {
+			return errors.New("recent cannot be combined with paginate or firstPageOnly")
+		}
+	}
+	if params.Cursor != "" && (params.Single || params.FirstPageOnly) {
+		return errors.New("cursor cannot be combined with single or firstPageOnly")
+	}
+	if params.Index != "" {
+		if !contains(QueryableIndexes(), params.Index) {
+			return fmt.Errorf("index %q is not queryable", params.Index)
+		}
+		if params.KeyName == "" || params.KeyValue == "" {
+			return errors.New("index requires keyName and keyValue")
+		}
+		if params.DeviceId != "" || params.LocationId != "" {
+			return errors.New("index cannot be combined with a device or location")
+		}
+	}
+	if params.FirstPageOnly && params.Paginate {
+		return errors.New("firstPageOnly cannot be combined with paginate")
+	}
+	return nil
+}
+
+// maxItems is the most items the query returns, or zero when it isn't limited.
+func (params QueryParams) maxItems() int {
+	switch {
+	case params.Single:
+		return 1
+	case params.Recent > 0:
+		return params.Recent
+	default:
+		return params.Limit
+	}
+}
+
+// indexName returns the global secondary index that serves the query,
+// or an empty string for queries against the base table.
+func (params QueryParams) indexName() string {
+	switch {
+	case params.Index != "":
+		return params.Index
+	case params.DeviceId != "" && params.sequenceRange():
+		return constants.SEQUENCE_INDEX
+	case params.DeviceId != "":
+		return ""
+	case params.LocationId != "":
+		return constants.LOCATION_INDEX
+	default:
+		return constants.PROJECT_INDEX
+	}
+}
+
+// QueryableIndexes lists the additional global secondary indexes that may be queried by name,
+// from the comma-separated QUERYABLE_INDEXES environment variable.
+func QueryableIndexes() []string {
+	return splitList(os.Getenv("QUERYABLE_INDEXES"))
+}
+
+// sequenceRange reports whether the query is bounded by SequenceNum rather than EpochTime.
+func (params QueryParams) sequenceRange() bool {
+	return params.SeqStart != nil || params.SeqEnd != nil
+}
+
+// lowerBoundOnly reports whether the query's range is open-ended towards the present.
+func (params QueryParams) lowerBoundOnly() bool {
+	if params.sequenceRange() {
+		return params.SeqEnd == nil
+	}
+	return params.End == nil && (params.Start != nil || params.After != nil)
+}
+
+// BuildQueryInput translates query parameters into a DynamoDB query
+// against the base table or the index that serves them.
+func BuildQueryInput(params QueryParams) (*dynamodb.QueryInput, error) {
+	if err := params.Validate(); err != nil {
+		return nil, err
+	}
+	params.ProjectId = NormalizeProjectId(params.ProjectId)
+	if TenantIsolation() && params.TenantId == "" {
+		return nil, ErrTenantRequired
+	}
+
+	var input *dynamodb.QueryInput
+	switch {
+	case params.Index != "":
+		// Other indexes aren't keyed by project, so other projects' items are filtered out.
+		input = CreateIndexQueryInput(params.Index, params.KeyName, params.KeyValue)
+		input.ExpressionAttributeNames["#project"] = "ProjectId"
+		input.ExpressionAttributeValues[":project"] = &types.AttributeValueMemberS{Value: params.ProjectId}
+		addFilter(input, "#project = :project")
+	case params.DeviceId != "":
+		// The primary key is a composite key of the ProjectId and DeviceId
+		input = CreateQueryInput(
+			"ProjectId#DeviceId",
+			PartitionKey(params.TenantId, params.ProjectId, params.DeviceId),
+		)
+	case params.LocationId != "":
+		input = CreateQueryInput(
+			"ProjectId#LocationId",
+			PartitionKey(params.TenantId, params.ProjectId, params.LocationId),
+		)
+	default:
+		input = CreateQueryInput("ProjectId", params.ProjectId)
+	}
+	// Indexes keyed on the ProjectId alone can't be prefixed by tenant, so they're filtered instead.
+	if params.TenantId != "" && (params.Index != "" || (params.DeviceId == "" && params.LocationId == "")) {
+		input.ExpressionAttributeNames["#tenant"] = "TenantId"
+		input.ExpressionAttributeValues[":tenant"] = &types.AttributeValueMemberS{Value: params.TenantId}
+		addFilter(input, "#tenant = :tenant")
+	}
+	if index := params.indexName(); index != "" {
+		input.IndexName = aws.String(index)
+	}
+
+	if params.Consistent {
+		input.ConsistentRead = aws.Bool(true)
+	}
+
+	// A single item is the latest one, unless only a lower bound is given,
+	// in which case it's the earliest one from that bound on.
+	if params.Single {
+		input.Limit = aws.Int32(1)
+		input.ScanIndexForward = aws.Bool(params.lowerBoundOnly())
+	} else {
+		if limit := params.maxItems(); limit > 0 && limit <= math.MaxInt32 {
+			input.Limit = aws.Int32(int32(limit))
+		}
+		// The indexes and the base table are each sorted by EpochTime or SequenceNum,
+		// so DynamoDB can return the items in either order. The most recent items
+		// are read newest first, and put in ascending order afterwards if asked.
+		input.ScanIndexForward = aws.Bool(!params.Descending && params.Recent == 0)
+	}
+
+	setTimeBounds(input, params)
+	ApplyExistsFilter(input, params.Exists)
+	ApplySentinelFilter(input, params.Sentinels)
+	if !params.IncludeDeleted {
+		excludeDeleted(input)
+	}
+	applyFilterSpecs(input, params.Filters)
+	applyFieldSelection(input, params.Fields)
+	return input, nil
+}
+
+func setTimeBounds(input *dynamodb.QueryInput, params QueryParams) {
+	switch {
+	case params.sequenceRange():
+		setSequenceBounds(input, params.SeqStart, params.SeqEnd)
+	case params.After != nil:
+		setExclusiveLowerTimeBound(input, formatNumber(*params.After))
+	case params.Start != nil && params.End != nil:
+		setTimeRange(
+			input,
+			formatNumber(*params.Start),
+			formatNumber(*params.End),
+			!params.StartExclusive,
+			!params.EndExclusive,
+		)
+	case params.Start != nil:
+		setLowerTimeBound(input, formatNumber(*params.Start), !params.StartExclusive)
+	case params.End != nil:
+		setUpperTimeBound(input, formatNumber(*params.End), !params.EndExclusive)
+	default:
+		input.KeyConditionExpression = aws.String("#primaryName = :primaryValue")
+	}
+}
+
+// setSequenceBounds sets the key condition of a query on the sequence index,
+// bounding SequenceNum from either or both ends.
+func setSequenceBounds(input *dynamodb.QueryInput, start *int64, end *int64) {
+	condition := "#primaryName = :primaryValue AND #sequence "
+	switch {
+	case start != nil && end != nil:
+		condition += "BETWEEN :seqStart AND :seqEnd"
+	case start != nil:
+		condition += ">= :seqStart"
+	default:
+		condition += "<= :seqEnd"
+	}
+	input.KeyConditionExpression = aws.String(condition)
+	input.ExpressionAttributeNames["#sequence"] = "SequenceNum"
+	if start != nil {
+		input.ExpressionAttributeValues[":seqStart"] = &types.AttributeValueMemberN{
+			Value: strconv.FormatInt(*start, 10),
+		}
+	}
+	if end != nil {
+		input.ExpressionAttributeValues[":seqEnd"] = &types.AttributeValueMemberN{
+			Value: strconv.FormatInt(*end, 10),
+		}
+	}
+}
+
+func formatNumber(value float64) string {
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
+
+// QueryItems retrieves the raw DynamoDB items that match the query parameters.
+func QueryItems(
+	ctx context.Context,
+	api DynamoDbQueryAPI,
+	params QueryParams,
+) ([]map[string]types.AttributeValue, error) {
+	items, _, err := QueryItemsWithStats(ctx, api, params)
+	return items, err
+}
+
+// QueryItemsWithStats retrieves items like QueryItems, also reporting the work DynamoDB did.
+func QueryItemsWithStats(
+	ctx context.Context,
+	api DynamoDbQueryAPI,
+	params QueryParams,
+) ([]map[string]types.AttributeValue, QueryStats, error) {
+	input, err := BuildQueryInput(params)
+	if err != nil {
+		return nil, QueryStats{}, err
+	}
+
+	limit := params.maxItems()
+
+	// A query cut short by its size budget resumes where it stopped, returning what's left of its limit.
+	previousCount := 0
+	if params.Cursor != "" {
+		if input.ExclusiveStartKey, previousCount, err = DecodeCursor(params.Cursor); err != nil {
+			return nil, QueryStats{}, err
+		}
+		if limit > 0 {
+			if limit -= previousCount; limit <= 0 {
+				return nil, QueryStats{}, nil
+			}
+		}
+	}
+
+	// A query that timed out still returns the items it retrieved, along with ErrQueryTimeout.
+	items, stats, err := GetDataWithinBudget(ctx, api, input, limit, params.SizeBudget)
+	if err != nil && !errors.Is(err, ErrQueryTimeout) {
+		return nil, stats, err
+	}
+	// The cursor counts the items retrieved, which the limit applies to, rather than those kept
+	// by the stride, and a resumed query keeps striding from where the previous part left off.
+	retrieved := len(items)
+	if params.Stride > 1 && previousCount%params.Stride != 0 {
+		skip := params.Stride - previousCount%params.Stride
+		if skip > len(items) {
+			skip = len(items)
+		}
+		items = items[skip:]
+	}
+	items = Stride(items, params.Stride)
+	if params.Recent > 0 && !params.Descending {
+		reverseItems(items)
+	}
+	if stats.TruncatedBySize {
+		if stats.NextCursor, err = EncodeCursor(stats.ResumeKey, previousCount+retrieved); err != nil {
+			return nil, stats, err
+		}
+	}
+	return items, stats, err
+}
+
+// QueryReadings retrieves the readings that match the query parameters.
+func QueryReadings(
+	ctx context.Context,
+	api DynamoDbQueryAPI,
+	params QueryParams,
+) ([]Reading, error) {
+	items, err := QueryItems(ctx, api, params)
+	if err != nil {
+		return nil, err
+	}
+	readings := make([]Reading, 0, len(items))
+	for _, item := range items {
+		var reading Reading
+		reading.FromAttributeValues(item)
+		readings = append(readings, reading)
+	}
+	return readings, nil
+}
+
+// IngestReading writes a single reading, along with the composite keys that index it.
+// It goes through the same validation, normalization, and write path as POSTed readings.
+func IngestReading(
+	ctx context.Context,
+	api DynamoDbIngestAPI,
+	reading Reading,
+) error {
+	itemMap := make(map[string]interface{}, len(reading.Fields)+3)
+	for key, value := range reading.Fields {
+		itemMap[key] = value
+	}
+	itemMap["DeviceId"] = reading.DeviceId
+	itemMap["EpochTime"] = reading.EpochTime
+	if reading.LocationId != "" {
+		itemMap["LocationId"] = reading.LocationId
+	}
+	item, err := PrepareItem(itemMap, reading.ProjectId, reading.TenantId)
+	if err != nil {
+		return err
+	}
+	return WriteItem(ctx, api, item, reading.ProjectId, "", false)
+}
+
+// identifierAttributes are stored alongside a reading's fields, but are held
+// in dedicated Reading fields rather than in Fields.
+var identifierAttributes = []string{
+	"TenantId", "ProjectId", "DeviceId", "LocationId", "EpochTime",
+	"ProjectId#DeviceId", "ProjectId#LocationId",
+}
+
+// ReadingFromMap builds a reading from a decoded POST body. The identifiers must be strings,
+// though some firmware sends them as numbers, which are converted to their canonical string form.
+// EpochTime must be a number. Every other attribute becomes one of the reading's fields.
+func ReadingFromMap(itemMap map[string]interface{}) (Reading, error) {
+	var reading Reading
+	var ok bool
+	var err error
+	if reading.ProjectId, err = identifierString(itemMap, "ProjectId"); err != nil {
+		return reading, err
+	}
+	if reading.DeviceId, err = identifierString(itemMap, "DeviceId"); err != nil {
+		return reading, err
+	}
+	if _, locationIDOk := itemMap["LocationId"]; locationIDOk {
+		if reading.LocationId, err = identifierString(itemMap, "LocationId"); err != nil {
+			return reading, err
+		}
+	}
+	// A TenantId is only ever present on stored items, since clients can't set it.
+	reading.TenantId, _ = itemMap["TenantId"].(string)
+	if reading.EpochTime, ok = itemMap["EpochTime"].(float64); !ok {
+		return reading, errors.New("EpochTime must be a number")
+	}
+
+	reading.Fields = make(map[string]interface{}, len(itemMap))
+	for key, value := range itemMap {
+		reading.Fields[key] = value
+	}
+	for _, key := range identifierAttributes {
+		delete(reading.Fields, key)
+	}
+	return reading, nil
+}
+
+// identifierString returns an identifier as a string. Numbers are formatted without exponents or
+// trailing zeros, so a DeviceId sent as 42 is the same device as one sent as "42".
+func identifierString(itemMap map[string]interface{}, name string) (string, error) {
+	switch value := itemMap[name].(type) {
+	case string:
+		return value, nil
+	case float64:
+		return formatNumber(value), nil
+	default:
+		return "", fmt.Errorf("%s must be a string or number", name)
+	}
+}
+
+// Validate enforces the required identifiers and the constraints on the keys built from them.
+func (reading Reading) Validate() error {
+	if reading.ProjectId == "" {
+		return errors.New("ProjectId is required")
+	}
+	if reading.DeviceId == "" {
+		return errors.New("DeviceId is required")
+	}
+	if TenantIsolation() && reading.TenantId == "" {
+		return ErrTenantRequired
+	}
+	// The identifiers are joined with '#' into composite keys, so they can't contain it themselves.
+	for name, value := range map[string]string{
+		"ProjectId":  reading.ProjectId,
+		"DeviceId":   reading.DeviceId,
+		"LocationId": reading.LocationId,
+	} {
+		if strings.Contains(value, "#") {
+			return fmt.Errorf("%s cannot contain '#'", name)
+		}
+	}
+	if math.IsNaN(reading.EpochTime) || math.IsInf(reading.EpochTime, 0) || reading.EpochTime < 0 {
+		return errors.New("EpochTime must be a non-negative, finite number")
+	}
+	return nil
+}
+
+// ItemMap flattens the reading into a single map of attributes, including its composite keys.
+func (reading Reading) ItemMap() map[string]interface{} {
+	itemMap := make(map[string]interface{}, len(reading.Fields)+6)
+	for key, value := range reading.Fields {
+		itemMap[key] = value
+	}
+	if reading.TenantId != "" {
+		itemMap["TenantId"] = reading.TenantId
+	}
+	itemMap["ProjectId"] = NormalizeProjectId(reading.ProjectId)
+	itemMap["DeviceId"] = reading.DeviceId
+	itemMap["EpochTime"] = reading.EpochTime
+	if reading.LocationId != "" {
+		itemMap["LocationId"] = reading.LocationId
+	}
+	AddCompositeKeys(itemMap)
+	return itemMap
+}
+
+// ToAttributeValues converts the reading into a DynamoDB item.
+func (reading Reading) ToAttributeValues() map[string]types.AttributeValue {
+	return MapToAttributeValues(reading.ItemMap())
+}
+
+// FromAttributeValues decodes a DynamoDB item into the reading.
+// The composite key attributes are dropped, since they only duplicate the identifiers.
+func (reading *Reading) FromAttributeValues(item map[string]types.AttributeValue) {
+	fields := AttributeValuesToMap(item)
+	reading.TenantId, _ = fields["TenantId"].(string)
+	reading.ProjectId, _ = fields["ProjectId"].(string)
+	reading.DeviceId, _ = fields["DeviceId"].(string)
+	reading.LocationId, _ = fields["LocationId"].(string)
+	reading.EpochTime, _ = fields["EpochTime"].(float64)
+	for _, key := range identifierAttributes {
+		delete(fields, key)
+	}
+	reading.Fields = fields
+}
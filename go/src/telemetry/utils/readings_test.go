@@ -0,0 +1,579 @@
+package utils
+
+import (
+	"context"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+
+	"telemetry/constants"
+	"telemetry/utils/dynamotest"
+)
+
+func TestQueryParamsValidate(t *testing.T) {
+	seq := func(value int64) *int64 { return &value }
+	tests := []struct {
+		name    string
+		env     map[string]string
+		params  QueryParams
+		wantErr bool
+	}{
+		{name: "no bounds", params: QueryParams{}},
+		{name: "range", params: QueryParams{Start: float(1), End: float(2)}},
+		{name: "after with start", params: QueryParams{After: float(1), Start: float(0)}, wantErr: true},
+		{name: "exclusive start without start", params: QueryParams{StartExclusive: true}, wantErr: true},
+		{name: "exclusive end without end", params: QueryParams{EndExclusive: true}, wantErr: true},
+		{name: "sequence range", params: QueryParams{DeviceId: "d1", SeqStart: seq(1), SeqEnd: seq(2)}},
+		{name: "sequence range without a device", params: QueryParams{SeqStart: seq(1)}, wantErr: true},
+		{name: "sequence range with time", params: QueryParams{DeviceId: "d1", SeqEnd: seq(1), End: float(1)}, wantErr: true},
+		{name: "sequence range reversed", params: QueryParams{DeviceId: "d1", SeqStart: seq(2), SeqEnd: seq(1)}, wantErr: true},
+		{name: "consistent device", params: QueryParams{DeviceId: "d1", Consistent: true}},
+		{name: "consistent sequence range", params: QueryParams{DeviceId: "d1", SeqStart: seq(1), Consistent: true}},
+		{name: "consistent project", params: QueryParams{Consistent: true}, wantErr: true},
+		{name: "recent with limit", params: QueryParams{Recent: 5, Limit: 5}, wantErr: true},
+		{name: "recent with paginate", params: QueryParams{Recent: 5, Paginate: true}, wantErr: true},
+		{name: "cursor with single", params: QueryParams{Cursor: "x", Single: true}, wantErr: true},
+		{name: "cursor with firstPageOnly", params: QueryParams{Cursor: "x", FirstPageOnly: true}, wantErr: true},
+		{name: "recent with single", params: QueryParams{Recent: 5, Single: true}, wantErr: true},
+		{name: "recent resuming a truncated query", params: QueryParams{Recent: 5, Cursor: "x"}},
+		{name: "cursor resuming a truncated query", params: QueryParams{Cursor: "x"}},
+		{name: "first page with paginate", params: QueryParams{FirstPageOnly: true, Paginate: true}, wantErr: true},
+		{
+			name:   "queryable index",
+			env:    map[string]string{"QUERYABLE_INDEXES": "Battery-index"},
+			params: QueryParams{Index: "Battery-index", KeyName: "k", KeyValue: "v"},
+		},
+		{name: "unqueryable index", params: QueryParams{Index: "Battery-index", KeyName: "k", KeyValue: "v"}, wantErr: true},
+		{
+			name:    "index without a key",
+			env:     map[string]string{"QUERYABLE_INDEXES": "Battery-index"},
+			params:  QueryParams{Index: "Battery-index"},
+			wantErr: true,
+		},
+		{
+			name:    "index with a device",
+			env:     map[string]string{"QUERYABLE_INDEXES": "Battery-index"},
+			params:  QueryParams{Index: "Battery-index", KeyName: "k", KeyValue: "v", DeviceId: "d1"},
+			wantErr: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			for name, value := range test.env {
+				t.Setenv(name, value)
+			}
+			if err := test.params.Validate(); (err != nil) != test.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestBuildQueryInput(t *testing.T) {
+	seq := func(value int64) *int64 { return &value }
+	tests := []struct {
+		name          string
+		env           map[string]string
+		params        QueryParams
+		wantIndex     string
+		wantCondition string
+		wantKey       string
+		wantLimit     int32
+		wantForward   bool
+		wantFilter    string
+		wantSortKey   string
+	}{
+		{
+			name:          "project",
+			params:        QueryParams{ProjectId: "sensors"},
+			wantIndex:     constants.PROJECT_INDEX,
+			wantCondition: "#primaryName = :primaryValue",
+			wantKey:       "sensors",
+			wantForward:   true,
+		},
+		{
+			name:          "device range",
+			params:        QueryParams{ProjectId: "sensors", DeviceId: "d1", Start: float(1), End: float(2)},
+			wantCondition: "#primaryName = :primaryValue AND #sortKey BETWEEN :start AND :end",
+			wantKey:       "sensors#d1",
+			wantForward:   true,
+			wantSortKey:   "EpochTime",
+		},
+		{
+			name:          "range of another sort key",
+			env:           map[string]string{"SORT_KEY_ATTR": "Offset"},
+			params:        QueryParams{ProjectId: "sensors", DeviceId: "d1", Start: float(100), End: float(200)},
+			wantCondition: "#primaryName = :primaryValue AND #sortKey BETWEEN :start AND :end",
+			wantKey:       "sensors#d1",
+			wantForward:   true,
+			wantSortKey:   "Offset",
+		},
+		{
+			name:          "location after",
+			params:        QueryParams{ProjectId: "sensors", LocationId: "roof", After: float(1)},
+			wantIndex:     constants.LOCATION_INDEX,
+			wantCondition: "#primaryName = :primaryValue AND #sortKey > :after",
+			wantKey:       "sensors#roof",
+			wantForward:   true,
+		},
+		{
+			name:          "single latest",
+			params:        QueryParams{ProjectId: "sensors", DeviceId: "d1", Single: true},
+			wantCondition: "#primaryName = :primaryValue",
+			wantKey:       "sensors#d1",
+			wantLimit:     1,
+		},
+		{
+			name:          "single earliest from start",
+			params:        QueryParams{ProjectId: "sensors", DeviceId: "d1", Single: true, Start: float(5)},
+			wantCondition: "#primaryName = :primaryValue AND #sortKey >= :start",
+			wantKey:       "sensors#d1",
+			wantLimit:     1,
+			wantForward:   true,
+		},
+		{
+			name:          "single earliest after",
+			params:        QueryParams{ProjectId: "sensors", DeviceId: "d1", Single: true, After: float(5)},
+			wantCondition: "#primaryName = :primaryValue AND #sortKey > :after",
+			wantKey:       "sensors#d1",
+			wantLimit:     1,
+			wantForward:   true,
+		},
+		{
+			name:          "single latest before end",
+			params:        QueryParams{ProjectId: "sensors", DeviceId: "d1", Single: true, End: float(9)},
+			wantCondition: "#primaryName = :primaryValue AND #sortKey <= :end",
+			wantKey:       "sensors#d1",
+			wantLimit:     1,
+		},
+		{
+			name:          "single latest in a range",
+			params:        QueryParams{ProjectId: "sensors", DeviceId: "d1", Single: true, Start: float(5), End: float(9)},
+			wantCondition: "#primaryName = :primaryValue AND #sortKey BETWEEN :start AND :end",
+			wantKey:       "sensors#d1",
+			wantLimit:     1,
+		},
+		{
+			name:          "recent, newest first",
+			params:        QueryParams{ProjectId: "sensors", DeviceId: "d1", Recent: 3},
+			wantCondition: "#primaryName = :primaryValue",
+			wantKey:       "sensors#d1",
+			wantLimit:     3,
+		},
+		{
+			name:          "sequence range",
+			params:        QueryParams{ProjectId: "sensors", DeviceId: "d1", SeqStart: seq(3), SeqEnd: seq(7)},
+			wantIndex:     constants.SEQUENCE_INDEX,
+			wantCondition: "#primaryName = :primaryValue AND #sequence BETWEEN :seqStart AND :seqEnd",
+			wantKey:       "sensors#d1",
+			wantForward:   true,
+		},
+		{
+			name:          "recent in descending order",
+			params:        QueryParams{ProjectId: "sensors", DeviceId: "d1", Recent: 3, Descending: true},
+			wantCondition: "#primaryName = :primaryValue",
+			wantKey:       "sensors#d1",
+			wantLimit:     3,
+		},
+		{
+			name:          "after an exclusive start",
+			params:        QueryParams{ProjectId: "sensors", DeviceId: "d1", Start: float(5), StartExclusive: true},
+			wantCondition: "#primaryName = :primaryValue AND #sortKey > :start",
+			wantKey:       "sensors#d1",
+			wantForward:   true,
+		},
+		{
+			name:          "range without its start",
+			params:        QueryParams{ProjectId: "sensors", DeviceId: "d1", Start: float(5), End: float(9), StartExclusive: true},
+			wantCondition: "#primaryName = :primaryValue AND #sortKey BETWEEN :start AND :end",
+			wantKey:       "sensors#d1",
+			wantForward:   true,
+			wantFilter:    "#sortKey <> :start",
+		},
+		{
+			name:          "range without its end",
+			params:        QueryParams{ProjectId: "sensors", DeviceId: "d1", Start: float(5), End: float(9), EndExclusive: true},
+			wantCondition: "#primaryName = :primaryValue AND #sortKey BETWEEN :start AND :end",
+			wantKey:       "sensors#d1",
+			wantForward:   true,
+			wantFilter:    "#sortKey <> :end",
+		},
+		{
+			name:          "descending before end",
+			params:        QueryParams{ProjectId: "sensors", DeviceId: "d1", End: float(9), EndExclusive: true, Descending: true},
+			wantCondition: "#primaryName = :primaryValue AND #sortKey < :end",
+			wantKey:       "sensors#d1",
+		},
+		{
+			name:          "sequence from a start",
+			params:        QueryParams{ProjectId: "sensors", DeviceId: "d1", SeqStart: seq(3)},
+			wantIndex:     constants.SEQUENCE_INDEX,
+			wantCondition: "#primaryName = :primaryValue AND #sequence >= :seqStart",
+			wantKey:       "sensors#d1",
+			wantForward:   true,
+		},
+		{
+			name:          "single latest sequence up to an end",
+			params:        QueryParams{ProjectId: "sensors", DeviceId: "d1", SeqEnd: seq(7), Single: true},
+			wantIndex:     constants.SEQUENCE_INDEX,
+			wantCondition: "#primaryName = :primaryValue AND #sequence <= :seqEnd",
+			wantKey:       "sensors#d1",
+			wantLimit:     1,
+		},
+		{
+			name:          "tenant's device",
+			params:        QueryParams{TenantId: "acme", ProjectId: "sensors", DeviceId: "d1"},
+			wantCondition: "#primaryName = :primaryValue",
+			wantKey:       "acme#sensors#d1",
+			wantForward:   true,
+		},
+		{
+			name:          "tenant's project",
+			params:        QueryParams{TenantId: "acme", ProjectId: "sensors"},
+			wantIndex:     constants.PROJECT_INDEX,
+			wantCondition: "#primaryName = :primaryValue",
+			wantKey:       "sensors",
+			wantForward:   true,
+			wantFilter:    "#tenant = :tenant",
+		},
+		{
+			name:          "allow-listed index",
+			env:           map[string]string{"QUERYABLE_INDEXES": "Battery-index"},
+			params:        QueryParams{ProjectId: "sensors", Index: "Battery-index", KeyName: "Battery", KeyValue: "low"},
+			wantIndex:     "Battery-index",
+			wantCondition: "#primaryName = :primaryValue",
+			wantKey:       "low",
+			wantForward:   true,
+			wantFilter:    "#project = :project",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			for name, value := range test.env {
+				t.Setenv(name, value)
+			}
+			input, err := BuildQueryInput(test.params)
+			if err != nil {
+				t.Fatalf("BuildQueryInput() error = %v", err)
+			}
+			if index := aws.ToString(input.IndexName); index != test.wantIndex {
+				t.Errorf("IndexName = %q, want %q", index, test.wantIndex)
+			}
+			if condition := aws.ToString(input.KeyConditionExpression); condition != test.wantCondition {
+				t.Errorf("KeyConditionExpression = %q, want %q", condition, test.wantCondition)
+			}
+			if key := input.ExpressionAttributeValues[":primaryValue"]; !reflect.DeepEqual(key, stringAttr(test.wantKey)) {
+				t.Errorf(":primaryValue = %v, want %q", key, test.wantKey)
+			}
+			if sortKey := input.ExpressionAttributeNames["#sortKey"]; test.wantSortKey != "" && sortKey != test.wantSortKey {
+				t.Errorf("#sortKey = %q, want %q", sortKey, test.wantSortKey)
+			}
+			if limit := aws.ToInt32(input.Limit); limit != test.wantLimit {
+				t.Errorf("Limit = %d, want %d", limit, test.wantLimit)
+			}
+			if forward := aws.ToBool(input.ScanIndexForward); forward != test.wantForward {
+				t.Errorf("ScanIndexForward = %v, want %v", forward, test.wantForward)
+			}
+			if filter := aws.ToString(input.FilterExpression); filter == "" {
+				t.Error("FilterExpression is empty, want soft-deleted readings filtered out")
+			} else if !strings.Contains(filter, test.wantFilter) {
+				t.Errorf("FilterExpression = %q, want %q in it", filter, test.wantFilter)
+			}
+		})
+	}
+}
+
+func TestIdentifierString(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   interface{}
+		want    string
+		wantErr bool
+	}{
+		{name: "string", value: "d1", want: "d1"},
+		{name: "whole number", value: 42.0, want: "42"},
+		{name: "large number without an exponent", value: 12345678901.0, want: "12345678901"},
+		{name: "fraction", value: 4.5, want: "4.5"},
+		{name: "bool", value: true, wantErr: true},
+		{name: "missing", wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			itemMap := map[string]interface{}{}
+			if test.value != nil {
+				itemMap["DeviceId"] = test.value
+			}
+			got, err := identifierString(itemMap, "DeviceId")
+			if (err != nil) != test.wantErr {
+				t.Fatalf("identifierString() error = %v, wantErr %v", err, test.wantErr)
+			}
+			if got != test.want {
+				t.Errorf("identifierString() = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestReadingFromMap(t *testing.T) {
+	tests := []struct {
+		name    string
+		item    map[string]interface{}
+		want    Reading
+		wantErr bool
+	}{
+		{
+			name: "fields separated from identifiers",
+			item: map[string]interface{}{
+				"ProjectId": "sensors", "DeviceId": "d1", "LocationId": "roof",
+				"EpochTime": 1600000000.0, "Temperature": 21.5,
+			},
+			want: Reading{
+				ProjectId: "sensors", DeviceId: "d1", LocationId: "roof", EpochTime: 1600000000,
+				Fields: map[string]interface{}{"Temperature": 21.5},
+			},
+		},
+		{
+			name: "numeric identifiers",
+			item: map[string]interface{}{"ProjectId": "sensors", "DeviceId": 42.0, "EpochTime": 1.0},
+			want: Reading{ProjectId: "sensors", DeviceId: "42", EpochTime: 1, Fields: map[string]interface{}{}},
+		},
+		{
+			name:    "DeviceId of another type",
+			item:    map[string]interface{}{"ProjectId": "sensors", "DeviceId": true, "EpochTime": 1.0},
+			wantErr: true,
+		},
+		{
+			name: "numeric LocationId",
+			item: map[string]interface{}{"ProjectId": "sensors", "DeviceId": "d1", "LocationId": 7.0, "EpochTime": 1.0},
+			want: Reading{ProjectId: "sensors", DeviceId: "d1", LocationId: "7", EpochTime: 1, Fields: map[string]interface{}{}},
+		},
+		{
+			name:    "EpochTime as a string",
+			item:    map[string]interface{}{"ProjectId": "sensors", "DeviceId": "d1", "EpochTime": "1"},
+			wantErr: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := ReadingFromMap(test.item)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("ReadingFromMap() error = %v, wantErr %v", err, test.wantErr)
+			}
+			if !test.wantErr && !reflect.DeepEqual(got, test.want) {
+				t.Errorf("ReadingFromMap() = %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestReadingValidate(t *testing.T) {
+	valid := Reading{ProjectId: "sensors", DeviceId: "d1", EpochTime: 1}
+	tests := []struct {
+		name    string
+		modify  func(reading *Reading)
+		wantErr bool
+	}{
+		{name: "valid", modify: func(reading *Reading) {}},
+		{name: "no ProjectId", modify: func(reading *Reading) { reading.ProjectId = "" }, wantErr: true},
+		{name: "no DeviceId", modify: func(reading *Reading) { reading.DeviceId = "" }, wantErr: true},
+		{name: "'#' in LocationId", modify: func(reading *Reading) { reading.LocationId = "a#b" }, wantErr: true},
+		{name: "negative EpochTime", modify: func(reading *Reading) { reading.EpochTime = -1 }, wantErr: true},
+		{name: "infinite EpochTime", modify: func(reading *Reading) { reading.EpochTime = math.Inf(1) }, wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			reading := valid
+			test.modify(&reading)
+			if err := reading.Validate(); (err != nil) != test.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestReadingAttributeValues(t *testing.T) {
+	reading := Reading{
+		ProjectId:  "sensors",
+		DeviceId:   "d1",
+		LocationId: "roof",
+		EpochTime:  1600000000,
+		Fields:     map[string]interface{}{"Temperature": 21.5, "Label": "north"},
+	}
+	item := reading.ToAttributeValues()
+	wantKeys := map[string]types.AttributeValue{
+		"ProjectId#DeviceId":   stringAttr("sensors#d1"),
+		"ProjectId#LocationId": stringAttr("sensors#roof"),
+		"EpochTime":            numberAttr("1600000000.000000"),
+	}
+	for name, want := range wantKeys {
+		if !reflect.DeepEqual(item[name], want) {
+			t.Errorf("%s = %v, want %v", name, item[name], want)
+		}
+	}
+
+	var decoded Reading
+	decoded.FromAttributeValues(item)
+	if !reflect.DeepEqual(decoded, reading) {
+		t.Errorf("FromAttributeValues() = %+v, want %+v", decoded, reading)
+	}
+}
+
+func TestQueryItemsRecent(t *testing.T) {
+	// The newest readings are read newest first, whichever order they're returned in.
+	tests := []struct {
+		name       string
+		descending bool
+		want       []string
+	}{
+		{name: "ascending", want: []string{"2", "3"}},
+		{name: "descending", descending: true, want: []string{"3", "2"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			captureMetrics(t)
+			server := dynamotest.NewServer(t)
+			server.Respond("Query", `{"Count": 3, "ScannedCount": 3, "Items": [
+				{"EpochTime": {"N": "3"}}, {"EpochTime": {"N": "2"}}, {"EpochTime": {"N": "1"}}
+			]}`)
+			params := QueryParams{ProjectId: "sensors", DeviceId: "d1", Recent: 2, Descending: test.descending}
+
+			items, err := QueryItems(context.Background(), server.Client(), params)
+			if err != nil {
+				t.Fatalf("QueryItems() error = %v", err)
+			}
+			if got := epochTimes(items); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("QueryItems() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestQueryItemsRecentFollowsCursor(t *testing.T) {
+	// Each part fits two items, so the three newest come in two parts, the older one last.
+	itemSize := serializedSize(map[string]types.AttributeValue{"EpochTime": numberAttr("1")})
+	captureMetrics(t)
+	server := dynamotest.NewServer(t)
+	server.Respond("Query", `{"Count": 3, "Items": [{"EpochTime": {"N": "5"}}, {"EpochTime": {"N": "4"}}, {"EpochTime": {"N": "3"}}]}`)
+	server.Respond("Query", `{"Count": 1, "Items": [{"EpochTime": {"N": "3"}}]}`)
+	params := QueryParams{ProjectId: "sensors", DeviceId: "d1", Recent: 3, SizeBudget: 2 * itemSize}
+
+	var parts [][]string
+	for part := 0; part < 3; part++ {
+		items, stats, err := QueryItemsWithStats(context.Background(), server.Client(), params)
+		if err != nil {
+			t.Fatalf("QueryItemsWithStats() error = %v", err)
+		}
+		parts = append(parts, epochTimes(items))
+		if stats.NextCursor == "" {
+			break
+		}
+		params.Cursor = stats.NextCursor
+	}
+	if want := [][]string{{"4", "5"}, {"3"}}; !reflect.DeepEqual(parts, want) {
+		t.Errorf("parts = %v, want %v", parts, want)
+	}
+
+	queries := server.Calls("Query")
+	if len(queries) != 2 {
+		t.Fatalf("made %d queries, want 2", len(queries))
+	}
+	resumed := queries[1].Input
+	if resumed["ScanIndexForward"] != false || resumed["ExclusiveStartKey"] == nil {
+		t.Errorf("resumed query = %v, want it newest first, after the cursor", resumed)
+	}
+}
+
+func TestQueryItemsFollowsCursor(t *testing.T) {
+	// Each part fits two items, and every third item is kept, wherever the parts are cut.
+	itemSize := serializedSize(map[string]types.AttributeValue{"EpochTime": numberAttr("1")})
+	captureMetrics(t)
+	server := dynamotest.NewServer(t)
+	server.Respond("Query", `{"Count": 5, "Items": [
+		{"EpochTime": {"N": "1"}}, {"EpochTime": {"N": "2"}}, {"EpochTime": {"N": "3"}},
+		{"EpochTime": {"N": "4"}}, {"EpochTime": {"N": "5"}}
+	]}`)
+	server.Respond("Query", `{"Count": 3, "Items": [{"EpochTime": {"N": "3"}}, {"EpochTime": {"N": "4"}}, {"EpochTime": {"N": "5"}}]}`)
+	server.Respond("Query", `{"Count": 1, "Items": [{"EpochTime": {"N": "5"}}]}`)
+	params := QueryParams{ProjectId: "sensors", DeviceId: "d1", Stride: 3, SizeBudget: 2 * itemSize}
+
+	var got []string
+	for part := 0; part < 3; part++ {
+		items, stats, err := QueryItemsWithStats(context.Background(), server.Client(), params)
+		if err != nil {
+			t.Fatalf("QueryItemsWithStats() error = %v", err)
+		}
+		got = append(got, epochTimes(items)...)
+		if stats.NextCursor == "" {
+			break
+		}
+		params.Cursor = stats.NextCursor
+	}
+	if want := []string{"1", "4"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("items = %v, want %v", got, want)
+	}
+	if queries := server.Calls("Query"); len(queries) != 3 {
+		t.Errorf("made %d queries, want 3", len(queries))
+	}
+}
+
+func TestIngestReading(t *testing.T) {
+	tests := []struct {
+		name     string
+		env      map[string]string
+		reading  Reading
+		setup    func(server *dynamotest.Server)
+		wantErr  bool
+		wantPuts int
+	}{
+		{
+			name:     "written",
+			reading:  Reading{ProjectId: "sensors", DeviceId: "d1", EpochTime: 1, Fields: map[string]interface{}{"Temperature": 21.5}},
+			wantPuts: 1,
+		},
+		{
+			name:    "invalid",
+			reading: Reading{ProjectId: "sensors", EpochTime: 1},
+			wantErr: true,
+		},
+		{
+			name:    "NaN rejected",
+			reading: Reading{ProjectId: "sensors", DeviceId: "d1", EpochTime: 1, Fields: map[string]interface{}{"Temperature": math.NaN()}},
+			wantErr: true,
+		},
+		{
+			name:     "NaN dropped",
+			env:      map[string]string{"NON_FINITE_NUMBERS": "drop"},
+			reading:  Reading{ProjectId: "sensors", DeviceId: "d1", EpochTime: 1, Fields: map[string]interface{}{"Temperature": math.NaN()}},
+			wantPuts: 1,
+		},
+		{
+			name:     "write failed",
+			reading:  Reading{ProjectId: "sensors", DeviceId: "d1", EpochTime: 1},
+			setup:    func(server *dynamotest.Server) { server.Fail("PutItem", "InternalServerError") },
+			wantErr:  true,
+			wantPuts: 1,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			for name, value := range test.env {
+				t.Setenv(name, value)
+			}
+			server := dynamotest.NewServer(t)
+			if test.setup != nil {
+				test.setup(server)
+			}
+			err := IngestReading(context.Background(), server.Client(), test.reading)
+			if (err != nil) != test.wantErr {
+				t.Errorf("IngestReading() error = %v, wantErr %v", err, test.wantErr)
+			}
+			if puts := len(server.Calls("PutItem")); puts != test.wantPuts {
+				t.Errorf("made %d puts, want %d", puts, test.wantPuts)
+			}
+		})
+	}
+}
@@ -0,0 +1,23 @@
+package utils
+
+import (
+	"log"
+	"runtime/debug"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// Recover turns a panic in a handler into a logged stack trace and a 500 response,
+// rather than a crashed invocation that API Gateway reports as a 502.
+func Recover(handler Handler) Handler {
+	return func(request *Request) (response events.APIGatewayProxyResponse, err error) {
+		defer func() {
+			if recovered := recover(); recovered != nil {
+				log.Printf("Recovered from panic handling %s %s, %v\n%s",
+					request.Method, request.Path, recovered, debug.Stack())
+				response, err = InternalErrorResponse("Internal server error")
+			}
+		}()
+		return handler(request)
+	}
+}
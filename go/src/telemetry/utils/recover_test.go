@@ -0,0 +1,63 @@
+package utils
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+func TestRecover(t *testing.T) {
+	failed := errors.New("failed")
+	tests := []struct {
+		name       string
+		handler    Handler
+		wantStatus int
+		wantErr    error
+		wantCode   string
+	}{
+		{
+			name: "returns",
+			handler: func(request *Request) (events.APIGatewayProxyResponse, error) {
+				return events.APIGatewayProxyResponse{StatusCode: 200}, nil
+			},
+			wantStatus: 200,
+		},
+		{
+			name: "fails",
+			handler: func(request *Request) (events.APIGatewayProxyResponse, error) {
+				return events.APIGatewayProxyResponse{}, failed
+			},
+			wantErr: failed,
+		},
+		{
+			name: "panics",
+			handler: func(request *Request) (events.APIGatewayProxyResponse, error) {
+				var item map[string]interface{}
+				item["DeviceId"] = "d1"
+				return events.APIGatewayProxyResponse{StatusCode: 200}, nil
+			},
+			wantStatus: 500,
+			wantCode:   "INTERNAL_ERROR",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			response, err := Recover(test.handler)(&Request{Method: "POST", Path: "/sensors"})
+			if !errors.Is(err, test.wantErr) {
+				t.Fatalf("Recover() error = %v, want %v", err, test.wantErr)
+			}
+			if response.StatusCode != test.wantStatus {
+				t.Errorf("status = %d, want %d", response.StatusCode, test.wantStatus)
+			}
+			if test.wantCode == "" {
+				return
+			}
+			var body ErrorBody
+			if err := json.Unmarshal([]byte(response.Body), &body); err != nil || body.Error.Code != test.wantCode {
+				t.Errorf("body = %s, want the %s code", response.Body, test.wantCode)
+			}
+		})
+	}
+}
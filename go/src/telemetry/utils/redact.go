@@ -0,0 +1,61 @@
+package utils
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// RestrictedPrivilege is the privilege level the authorizer gives tokens that may not read
+// a project's sensitive fields, in the 'privilege' context key.
+const RestrictedPrivilege = "restricted"
+
+// RedactedFields lists a project's sensitive fields, which are removed from the items
+// returned to restricted tokens, from the comma-separated REDACT_FIELDS_<ProjectId>
+// environment variable, e.g. REDACT_FIELDS_dogs=Latitude,Longitude.
+func RedactedFields(project string) []string {
+	return splitList(os.Getenv(ProjectEnvName("REDACT_FIELDS_", project)))
+}
+
+// Restricted reports whether the request's token may not read the project's sensitive fields.
+func (request *Request) Restricted() bool {
+	privilege, _ := request.Authorizer["privilege"].(string)
+	return privilege == RestrictedPrivilege
+}
+
+// RequestRedactions returns the fields to remove from the items returned for the request,
+// which are none unless its token is restricted.
+func RequestRedactions(request *Request) []string {
+	if !request.Restricted() {
+		return nil
+	}
+	return RedactedFields(request.PathParameters["ProjectId"])
+}
+
+// RedactFields removes the fields from each of the items, in place.
+func RedactFields(items []map[string]types.AttributeValue, fields []string) {
+	for _, item := range items {
+		for _, field := range fields {
+			delete(item, field)
+		}
+	}
+}
+
+// RedactKeyedFields removes the fields from each of the items keyed by an identifier,
+// as reduced by LatestPerLocation or EarliestPerDevice, in place.
+func RedactKeyedFields(keyed map[string]map[string]types.AttributeValue, fields []string) {
+	for _, item := range keyed {
+		for _, field := range fields {
+			delete(item, field)
+		}
+	}
+}
+
+// CheckRedactedField rejects reading a redacted field indirectly, as through stats or distinct.
+func CheckRedactedField(field string, redacted []string) error {
+	if field != "" && contains(redacted, field) {
+		return fmt.Errorf("%s is not readable with this token", field)
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package utils
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+func TestRequestRedactions(t *testing.T) {
+	tests := []struct {
+		name      string
+		privilege interface{}
+		project   string
+		want      []string
+	}{
+		{name: "restricted token", privilege: RestrictedPrivilege, project: "sensors", want: []string{"Latitude", "Longitude"}},
+		{name: "full token", privilege: "full", project: "sensors"},
+		{name: "no privilege", project: "sensors"},
+		{name: "project without sensitive fields", privilege: RestrictedPrivilege, project: "dogs"},
+		{name: "mixed-case project", privilege: RestrictedPrivilege, project: "SENSORS", want: []string{"Latitude", "Longitude"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Setenv("NORMALIZE_PROJECT_ID", "true")
+			t.Setenv("REDACT_FIELDS_sensors", "Latitude, Longitude")
+			request := &Request{
+				PathParameters: map[string]string{"ProjectId": test.project},
+				Authorizer:     map[string]interface{}{"privilege": test.privilege},
+			}
+			if got := RequestRedactions(request); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("RequestRedactions() = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestRedactFields(t *testing.T) {
+	items := []map[string]types.AttributeValue{
+		{"EpochTime": numberAttr("1"), "Latitude": numberAttr("52.1"), "Longitude": numberAttr("4.3")},
+		{"EpochTime": numberAttr("2"), "Temperature": numberAttr("20")},
+	}
+	want := []map[string]types.AttributeValue{
+		{"EpochTime": numberAttr("1")},
+		{"EpochTime": numberAttr("2"), "Temperature": numberAttr("20")},
+	}
+
+	RedactFields(items, []string{"Latitude", "Longitude"})
+	if !reflect.DeepEqual(items, want) {
+		t.Errorf("RedactFields() = %v, want %v", items, want)
+	}
+}
+
+func TestRedactKeyedFields(t *testing.T) {
+	keyed := map[string]map[string]types.AttributeValue{
+		"roof": {"EpochTime": numberAttr("1"), "Latitude": numberAttr("52.1")},
+		"lab":  {"EpochTime": numberAttr("2"), "Temperature": numberAttr("20")},
+	}
+	want := map[string]map[string]types.AttributeValue{
+		"roof": {"EpochTime": numberAttr("1")},
+		"lab":  {"EpochTime": numberAttr("2"), "Temperature": numberAttr("20")},
+	}
+
+	RedactKeyedFields(keyed, []string{"Latitude", "Longitude"})
+	if !reflect.DeepEqual(keyed, want) {
+		t.Errorf("RedactKeyedFields() = %v, want %v", keyed, want)
+	}
+}
+
+func TestCheckRedactedField(t *testing.T) {
+	tests := []struct {
+		name    string
+		field   string
+		wantErr bool
+	}{
+		{name: "redacted field", field: "Latitude", wantErr: true},
+		{name: "other field", field: "Temperature"},
+		{name: "no field", field: ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := CheckRedactedField(test.field, []string{"Latitude", "Longitude"})
+			if (err != nil) != test.wantErr {
+				t.Errorf("CheckRedactedField() error = %v, wantErr %v", err, test.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,234 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// Request holds the parts of an API Gateway event that the handlers use,
+// independent of whether it arrived from a REST API (v1) or an HTTP API (v2).
+type Request struct {
+	Method                          string
+	Path                            string
+	Headers                         map[string]string
+	PathParameters                  map[string]string
+	QueryStringParameters           map[string]string
+	MultiValueQueryStringParameters map[string][]string
+	Body                            string
+	IsBase64Encoded                 bool
+
+	// Authorizer is the context the request authorizer attached to the request, if any.
+	Authorizer map[string]interface{}
+
+	// TenantId is the tenant the request belongs to, taken from the authorizer context
+	// while tenants are isolated, and otherwise empty.
+	TenantId string
+
+	// ctx is the context the request is served in, as returned by Context.
+	ctx context.Context
+}
+
+// Context returns the context the request is served in, which carries per-request state
+// such as its buffered metrics. Requests built without one use the background context.
+func (request *Request) Context() context.Context {
+	if request.ctx != nil {
+		return request.ctx
+	}
+	return context.Background()
+}
+
+// WithContext returns a shallow copy of the request served in the given context.
+func (request *Request) WithContext(ctx context.Context) *Request {
+	copied := *request
+	copied.ctx = ctx
+	return &copied
+}
+
+// Header looks up a request header by name, ignoring case,
+// since v2 events lowercase header names while v1 events preserve them.
+func (request *Request) Header(name string) string {
+	if value, ok := request.Headers[name]; ok {
+		return value
+	}
+	for key, value := range request.Headers {
+		if strings.EqualFold(key, name) {
+			return value
+		}
+	}
+	return ""
+}
+
+// CheckAuthorizedProject guards against a request reaching a project other than the one its token
+// was authorized for, should the API's mapping of authorizers to routes ever change.
+// The authorizer records the project in the 'projectId' context key, or '*' for admin tokens.
+// Requests without an authorizer context are let through, as when running without an authorizer.
+func (request *Request) CheckAuthorizedProject() error {
+	if request.Authorizer == nil {
+		return nil
+	}
+	authorized, _ := request.Authorizer["projectId"].(string)
+	project := request.PathParameters["ProjectId"]
+	if authorized == "*" || (authorized != "" && authorized == project) {
+		return nil
+	}
+	return fmt.Errorf("token is not authorized for project %q", project)
+}
+
+// IsAdmin reports whether the request was authorized with the admin token,
+// for which the authorizer records the project as '*'.
+func (request *Request) IsAdmin() bool {
+	authorized, _ := request.Authorizer["projectId"].(string)
+	return authorized == "*"
+}
+
+// CheckIndexAccess returns an error unless the request may query the named index.
+// Additional indexes are for administrative use, so only the admin token may name one.
+func (request *Request) CheckIndexAccess(index string) error {
+	if index != "" && !request.IsAdmin() {
+		return fmt.Errorf("querying index %q requires the admin token", index)
+	}
+	return nil
+}
+
+// Handler is the business logic of an endpoint, written against the normalized request.
+type Handler func(request *Request) (events.APIGatewayProxyResponse, error)
+
+// NormalizeRequest extracts the method, path parameters, and query parameters
+// from either a v1 or a v2 API Gateway proxy event.
+func NormalizeRequest(event interface{}) (*Request, error) {
+	var request *Request
+	var err error
+	switch e := event.(type) {
+	case events.APIGatewayProxyRequest:
+		request = fromV1(&e)
+	case *events.APIGatewayProxyRequest:
+		request = fromV1(e)
+	case events.APIGatewayV2HTTPRequest:
+		request, err = fromV2(&e)
+	case *events.APIGatewayV2HTTPRequest:
+		request, err = fromV2(e)
+	default:
+		return nil, fmt.Errorf("unsupported event type %T", event)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Handlers only ever see the normalized ProjectId, for queries, writes, and bookkeeping alike.
+	if project, projectOk := request.PathParameters["ProjectId"]; projectOk {
+		request.PathParameters["ProjectId"] = NormalizeProjectId(project)
+	}
+	return request, nil
+}
+
+func fromV1(event *events.APIGatewayProxyRequest) *Request {
+	return &Request{
+		Method:                          event.HTTPMethod,
+		Path:                            event.Path,
+		Headers:                         event.Headers,
+		PathParameters:                  event.PathParameters,
+		QueryStringParameters:           event.QueryStringParameters,
+		MultiValueQueryStringParameters: event.MultiValueQueryStringParameters,
+		Body:                            event.Body,
+		IsBase64Encoded:                 event.IsBase64Encoded,
+		Authorizer:                      event.RequestContext.Authorizer,
+	}
+}
+
+func fromV2(event *events.APIGatewayV2HTTPRequest) (*Request, error) {
+	// The v2 format joins repeated query parameters with commas,
+	// so the individual values are recovered from the raw query string.
+	multiValues, err := url.ParseQuery(event.RawQueryString)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse query string, %v", err)
+	}
+	params := event.QueryStringParameters
+	if params == nil {
+		params = make(map[string]string, len(multiValues))
+		for key, values := range multiValues {
+			params[key] = values[len(values)-1]
+		}
+	}
+	var authorizer map[string]interface{}
+	if event.RequestContext.Authorizer != nil {
+		authorizer = event.RequestContext.Authorizer.Lambda
+	}
+	return &Request{
+		Method:                          event.RequestContext.HTTP.Method,
+		Path:                            event.RawPath,
+		Headers:                         event.Headers,
+		PathParameters:                  event.PathParameters,
+		QueryStringParameters:           params,
+		MultiValueQueryStringParameters: multiValues,
+		Body:                            event.Body,
+		IsBase64Encoded:                 event.IsBase64Encoded,
+		Authorizer:                      authorizer,
+	}, nil
+}
+
+// Adapt wraps a Handler as a Lambda function that accepts either payload format,
+// and answers in the same format that the request arrived in.
+// Warmup pings are answered straight away, without reaching the handler.
+func Adapt(handler Handler) func(context.Context, json.RawMessage) (interface{}, error) {
+	return func(ctx context.Context, payload json.RawMessage) (interface{}, error) {
+		if IsWarmup(payload) {
+			return WarmupResponse()
+		}
+
+		var header struct {
+			Version string `json:"version"`
+		}
+		if err := json.Unmarshal(payload, &header); err != nil {
+			return nil, err
+		}
+
+		if header.Version == "2.0" {
+			var event events.APIGatewayV2HTTPRequest
+			if err := json.Unmarshal(payload, &event); err != nil {
+				return nil, err
+			}
+			request, err := NormalizeRequest(&event)
+			if err != nil {
+				return nil, err
+			}
+			response, err := serve(handler, request.WithContext(ctx))
+			return events.APIGatewayV2HTTPResponse{
+				StatusCode:        response.StatusCode,
+				Headers:           response.Headers,
+				MultiValueHeaders: response.MultiValueHeaders,
+				Body:              response.Body,
+				IsBase64Encoded:   response.IsBase64Encoded,
+			}, err
+		}
+
+		var event events.APIGatewayProxyRequest
+		if err := json.Unmarshal(payload, &event); err != nil {
+			return nil, err
+		}
+		request, err := NormalizeRequest(&event)
+		if err != nil {
+			return nil, err
+		}
+		return serve(handler, request.WithContext(ctx))
+	}
+}
+
+// serve runs the handler on a normalized request. While tenants are isolated, a request
+// without a tenant is refused before any handler can read or write on its behalf.
+// The one exception is an admin request without a ProjectId in its path, to a cross-project
+// endpoint, which spans tenants: it is served without a tenant, and each project it reads
+// is confined to the project's own tenant, as QueryProjects does.
+func serve(handler Handler, request *Request) (events.APIGatewayProxyResponse, error) {
+	tenant, err := tenantFromAuthorizer(request.Authorizer)
+	crossProject := request.IsAdmin() && request.PathParameters["ProjectId"] == ""
+	if err != nil && !crossProject {
+		return ForbiddenResponse(err.Error())
+	}
+	request.TenantId = tenant
+	return handler(request)
+}
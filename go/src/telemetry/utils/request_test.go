@@ -0,0 +1,214 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+func TestNormalizeRequest(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		event   interface{}
+		want    *Request
+		wantErr bool
+	}{
+		{
+			name: "v1",
+			event: events.APIGatewayProxyRequest{
+				HTTPMethod:            "GET",
+				Path:                  "/sensors/d1",
+				PathParameters:        map[string]string{"ProjectId": "sensors", "DeviceId": "d1"},
+				QueryStringParameters: map[string]string{"limit": "5"},
+				RequestContext: events.APIGatewayProxyRequestContext{
+					Authorizer: map[string]interface{}{"projectId": "sensors"},
+				},
+			},
+			want: &Request{
+				Method:                "GET",
+				Path:                  "/sensors/d1",
+				PathParameters:        map[string]string{"ProjectId": "sensors", "DeviceId": "d1"},
+				QueryStringParameters: map[string]string{"limit": "5"},
+				Authorizer:            map[string]interface{}{"projectId": "sensors"},
+			},
+		},
+		{
+			name: "v2 recovers repeated query parameters",
+			event: &events.APIGatewayV2HTTPRequest{
+				RawPath:        "/sensors",
+				RawQueryString: "fields=a&fields=b",
+				PathParameters: map[string]string{"ProjectId": "sensors"},
+				RequestContext: events.APIGatewayV2HTTPRequestContext{
+					HTTP: events.APIGatewayV2HTTPRequestContextHTTPDescription{Method: "POST"},
+					Authorizer: &events.APIGatewayV2HTTPRequestContextAuthorizerDescription{
+						Lambda: map[string]interface{}{"projectId": "*"},
+					},
+				},
+			},
+			want: &Request{
+				Method:                          "POST",
+				Path:                            "/sensors",
+				PathParameters:                  map[string]string{"ProjectId": "sensors"},
+				QueryStringParameters:           map[string]string{"fields": "b"},
+				MultiValueQueryStringParameters: map[string][]string{"fields": {"a", "b"}},
+				Authorizer:                      map[string]interface{}{"projectId": "*"},
+			},
+		},
+		{
+			name: "normalized ProjectId",
+			env:  map[string]string{"NORMALIZE_PROJECT_ID": "true"},
+			event: &events.APIGatewayProxyRequest{
+				HTTPMethod:     "GET",
+				PathParameters: map[string]string{"ProjectId": "Sensors"},
+			},
+			want: &Request{
+				Method:         "GET",
+				PathParameters: map[string]string{"ProjectId": "sensors"},
+			},
+		},
+		{
+			name: "v2 malformed query string",
+			event: &events.APIGatewayV2HTTPRequest{
+				RawQueryString: "limit=%zz",
+			},
+			wantErr: true,
+		},
+		{
+			name:    "unsupported event",
+			event:   events.S3Event{},
+			wantErr: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			for name, value := range test.env {
+				t.Setenv(name, value)
+			}
+			got, err := NormalizeRequest(test.event)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("NormalizeRequest() error = %v, wantErr %v", err, test.wantErr)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("NormalizeRequest() = %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestRequestHeader(t *testing.T) {
+	request := &Request{Headers: map[string]string{
+		"Content-Type":    "application/json",
+		"idempotency-key": "k",
+	}}
+	tests := []struct {
+		name string
+		want string
+	}{
+		{name: "Content-Type", want: "application/json"},
+		{name: "content-type", want: "application/json"},
+		{name: "Idempotency-Key", want: "k"},
+		{name: "Accept", want: ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := request.Header(test.name); got != test.want {
+				t.Errorf("Header(%q) = %q, want %q", test.name, got, test.want)
+			}
+		})
+	}
+}
+
+func TestCheckAuthorizedProject(t *testing.T) {
+	tests := []struct {
+		name       string
+		authorizer map[string]interface{}
+		wantErr    bool
+		wantAdmin  bool
+	}{
+		{name: "no authorizer"},
+		{name: "same project", authorizer: map[string]interface{}{"projectId": "sensors"}},
+		{name: "admin", authorizer: map[string]interface{}{"projectId": "*"}, wantAdmin: true},
+		{name: "another project", authorizer: map[string]interface{}{"projectId": "dogs"}, wantErr: true},
+		{name: "no project", authorizer: map[string]interface{}{}, wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			request := &Request{
+				PathParameters: map[string]string{"ProjectId": "sensors"},
+				Authorizer:     test.authorizer,
+			}
+			if err := request.CheckAuthorizedProject(); (err != nil) != test.wantErr {
+				t.Errorf("CheckAuthorizedProject() error = %v, wantErr %v", err, test.wantErr)
+			}
+			if got := request.IsAdmin(); got != test.wantAdmin {
+				t.Errorf("IsAdmin() = %v, want %v", got, test.wantAdmin)
+			}
+			if err := request.CheckIndexAccess("x"); (err != nil) == test.wantAdmin {
+				t.Errorf("CheckIndexAccess() error = %v, admin %v", err, test.wantAdmin)
+			}
+			if err := request.CheckIndexAccess(""); err != nil {
+				t.Errorf("CheckIndexAccess() of no index error = %v", err)
+			}
+		})
+	}
+}
+
+func TestAdapt(t *testing.T) {
+	type contextKey struct{}
+	ctx := context.WithValue(context.Background(), contextKey{}, "lambda")
+
+	var served *Request
+	handler := Adapt(func(request *Request) (events.APIGatewayProxyResponse, error) {
+		served = request
+		return events.APIGatewayProxyResponse{StatusCode: 201, Body: request.Method}, nil
+	})
+
+	tests := []struct {
+		name       string
+		payload    string
+		wantV2     bool
+		wantMethod string
+	}{
+		{
+			name:       "v1",
+			payload:    `{"httpMethod": "GET", "pathParameters": {"ProjectId": "sensors"}}`,
+			wantMethod: "GET",
+		},
+		{
+			name:       "v2",
+			payload:    `{"version": "2.0", "requestContext": {"http": {"method": "POST"}}}`,
+			wantV2:     true,
+			wantMethod: "POST",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			served = nil
+			response, err := handler(ctx, json.RawMessage(test.payload))
+			if err != nil {
+				t.Fatalf("Adapt() error = %v", err)
+			}
+			if served == nil {
+				t.Fatal("Adapt() did not reach the handler")
+			}
+			if served.Context().Value(contextKey{}) != "lambda" {
+				t.Error("Adapt() did not serve the request in the Lambda context")
+			}
+			if test.wantV2 {
+				v2, ok := response.(events.APIGatewayV2HTTPResponse)
+				if !ok || v2.StatusCode != 201 || v2.Body != test.wantMethod {
+					t.Errorf("Adapt() = %#v, want a v2 response to %s", response, test.wantMethod)
+				}
+				return
+			}
+			v1, ok := response.(events.APIGatewayProxyResponse)
+			if !ok || v1.StatusCode != 201 || v1.Body != test.wantMethod {
+				t.Errorf("Adapt() = %#v, want a v1 response to %s", response, test.wantMethod)
+			}
+		})
+	}
+}
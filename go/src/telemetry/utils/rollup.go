@@ -0,0 +1,145 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"telemetry/constants"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go/aws"
+)
+
+// RollupPeriod is the span of time, in seconds, summarized by each rollup item.
+const RollupPeriod = 60 * 60
+
+// rollupExcluded are numeric attributes of a reading that aren't measurements,
+// including the bookkeeping times the server records.
+var rollupExcluded = []string{"EpochTime", "SequenceNum", "ExpiresAt", "ReceivedAt", "LastSeen"}
+
+// RollupKey returns the key of the rollup item summarizing a device's readings
+// in the hour containing the epoch time. Rollup items share the table with readings,
+// under a 'rollup#' partition key that no reading can have.
+func RollupKey(
+	tenant string,
+	project string,
+	deviceId string,
+	epochTime float64,
+) map[string]types.AttributeValue {
+	hour := math.Floor(epochTime/RollupPeriod) * RollupPeriod
+	return map[string]types.AttributeValue{
+		"ProjectId#DeviceId": &types.AttributeValueMemberS{
+			Value: bookkeepingKey("rollup", tenant, project, deviceId),
+		},
+		SortKeyAttribute(): &types.AttributeValueMemberN{Value: formatNumber(hour)},
+	}
+}
+
+// RollupFields returns the numeric measurements of a reading, sorted by name.
+func RollupFields(item map[string]types.AttributeValue) []string {
+	var fields []string
+	for name, value := range item {
+		if _, ok := value.(*types.AttributeValueMemberN); ok && !contains(rollupExcluded, name) {
+			fields = append(fields, name)
+		}
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+// BuildRollupUpdate builds the update that adds a reading to its hourly rollup,
+// incrementing the count and sum of each of its measurements as '<field>#count' and '<field>#sum'.
+// The rollup records the EpochTime of every reading it includes in its Readings set,
+// and the update is conditional on the reading not already being among them,
+// so that a redelivered stream record isn't counted twice.
+func BuildRollupUpdate(reading Reading, item map[string]types.AttributeValue) *dynamodb.UpdateItemInput {
+	key := RollupKey(reading.TenantId, reading.ProjectId, reading.DeviceId, reading.EpochTime)
+	input := &dynamodb.UpdateItemInput{
+		TableName:                aws.String(constants.TABLE_NAME),
+		Key:                      key,
+		ConditionExpression:      aws.String("NOT contains(Readings, :reading)"),
+		ExpressionAttributeNames: map[string]string{},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":reading":  &types.AttributeValueMemberN{Value: formatNumber(reading.EpochTime)},
+			":readings": &types.AttributeValueMemberNS{Value: []string{formatNumber(reading.EpochTime)}},
+			":one":      &types.AttributeValueMemberN{Value: "1"},
+		},
+	}
+
+	update := "ADD Readings :readings, ReadingCount :one"
+	for i, field := range RollupFields(item) {
+		count, sum, value := fmt.Sprintf("#count%d", i), fmt.Sprintf("#sum%d", i), fmt.Sprintf(":value%d", i)
+		input.ExpressionAttributeNames[count] = field + "#count"
+		input.ExpressionAttributeNames[sum] = field + "#sum"
+		input.ExpressionAttributeValues[value] = item[field]
+		update += fmt.Sprintf(", %s :one, %s %s", count, sum, value)
+	}
+	input.UpdateExpression = aws.String(update)
+	return input
+}
+
+// BuildExtremeUpdate builds the update that lowers a rollup's '<field>#min', or raises its
+// '<field>#max', to the value, conditional on the value being a new extreme.
+// Applying it more than once has no further effect.
+func BuildExtremeUpdate(
+	key map[string]types.AttributeValue,
+	field string,
+	value types.AttributeValue,
+	max bool,
+) *dynamodb.UpdateItemInput {
+	name, comparison := field+"#min", ">"
+	if max {
+		name, comparison = field+"#max", "<"
+	}
+	return &dynamodb.UpdateItemInput{
+		TableName:        aws.String(constants.TABLE_NAME),
+		Key:              key,
+		UpdateExpression: aws.String("SET #extreme = :value"),
+		ConditionExpression: aws.String(
+			fmt.Sprintf("attribute_not_exists(#extreme) OR #extreme %s :value", comparison),
+		),
+		ExpressionAttributeNames:  map[string]string{"#extreme": name},
+		ExpressionAttributeValues: map[string]types.AttributeValue{":value": value},
+	}
+}
+
+// ApplyRollup adds a newly inserted reading to its device's hourly rollup.
+// Items that aren't valid readings are ignored.
+func ApplyRollup(
+	ctx context.Context,
+	api DynamoDbUpdateItemAPI,
+	item map[string]types.AttributeValue,
+) error {
+	reading, err := ReadingFromMap(AttributeValuesToMap(item))
+	if err != nil || reading.Validate() != nil {
+		return nil
+	}
+
+	// Only readings themselves are rolled up, not the bookkeeping items sharing the table.
+	partitionKey, _ := StringAttribute(item, "ProjectId#DeviceId")
+	if partitionKey != PartitionKey(reading.TenantId, reading.ProjectId, reading.DeviceId) {
+		return nil
+	}
+
+	// If the condition fails, the reading was already counted by an earlier delivery of the record,
+	// but the extremes are still updated, in case that delivery failed before it could.
+	var conditionFailed *types.ConditionalCheckFailedException
+	_, err = api.UpdateItem(ctx, BuildRollupUpdate(reading, item))
+	if err != nil && !errors.As(err, &conditionFailed) {
+		return fmt.Errorf("failed to update rollup, %v", err)
+	}
+
+	key := RollupKey(reading.TenantId, reading.ProjectId, reading.DeviceId, reading.EpochTime)
+	for _, field := range RollupFields(item) {
+		for _, max := range []bool{false, true} {
+			_, err := api.UpdateItem(ctx, BuildExtremeUpdate(key, field, item[field], max))
+			if err != nil && !errors.As(err, &conditionFailed) {
+				return fmt.Errorf("failed to update rollup %s, %v", field, err)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,188 @@
+package utils
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+
+	"telemetry/utils/dynamotest"
+)
+
+// rollupReading returns a stored reading with Temperature and Humidity measurements.
+func rollupReading() map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{
+		"ProjectId#DeviceId": stringAttr("sensors#d1"),
+		"ProjectId":          stringAttr("sensors"),
+		"DeviceId":           stringAttr("d1"),
+		"EpochTime":          numberAttr("1600000000"),
+		"SequenceNum":        numberAttr("4"),
+		"Temperature":        numberAttr("21.5"),
+		"Humidity":           numberAttr("40"),
+		"Label":              stringAttr("roof"),
+	}
+}
+
+func TestRollupKey(t *testing.T) {
+	tests := []struct {
+		name      string
+		tenant    string
+		epochTime float64
+		want      map[string]types.AttributeValue
+	}{
+		{
+			name:      "within the hour",
+			epochTime: 1600000000,
+			want: map[string]types.AttributeValue{
+				"ProjectId#DeviceId": stringAttr("rollup#sensors#d1"),
+				"EpochTime":          numberAttr("1599998400"),
+			},
+		},
+		{
+			name:      "on the hour",
+			epochTime: 1599998400,
+			want: map[string]types.AttributeValue{
+				"ProjectId#DeviceId": stringAttr("rollup#sensors#d1"),
+				"EpochTime":          numberAttr("1599998400"),
+			},
+		},
+		{
+			name:      "tenant",
+			tenant:    "acme",
+			epochTime: 1600000000,
+			want: map[string]types.AttributeValue{
+				"ProjectId#DeviceId": stringAttr("rollup#acme#sensors#d1"),
+				"EpochTime":          numberAttr("1599998400"),
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := RollupKey(test.tenant, "sensors", "d1", test.epochTime); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("RollupKey() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestRollupFields(t *testing.T) {
+	want := []string{"Humidity", "Temperature"}
+	if got := RollupFields(rollupReading()); !reflect.DeepEqual(got, want) {
+		t.Errorf("RollupFields() = %v, want %v", got, want)
+	}
+
+	// Server-recorded times aren't measurements.
+	item := rollupReading()
+	item["ReceivedAt"] = numberAttr("1600000002")
+	item["ExpiresAt"] = numberAttr("1700000000")
+	if got := RollupFields(item); !reflect.DeepEqual(got, want) {
+		t.Errorf("RollupFields() with server times = %v, want %v", got, want)
+	}
+}
+
+func TestBuildRollupUpdate(t *testing.T) {
+	reading := Reading{ProjectId: "sensors", DeviceId: "d1", EpochTime: 1600000000}
+	input := BuildRollupUpdate(reading, rollupReading())
+
+	wantUpdate := "ADD Readings :readings, ReadingCount :one, #count0 :one, #sum0 :value0, #count1 :one, #sum1 :value1"
+	if update := aws.ToString(input.UpdateExpression); update != wantUpdate {
+		t.Errorf("UpdateExpression = %q, want %q", update, wantUpdate)
+	}
+	wantNames := map[string]string{
+		"#count0": "Humidity#count", "#sum0": "Humidity#sum",
+		"#count1": "Temperature#count", "#sum1": "Temperature#sum",
+	}
+	if !reflect.DeepEqual(input.ExpressionAttributeNames, wantNames) {
+		t.Errorf("ExpressionAttributeNames = %v, want %v", input.ExpressionAttributeNames, wantNames)
+	}
+	// A redelivered record doesn't count the reading again.
+	if condition := aws.ToString(input.ConditionExpression); condition != "NOT contains(Readings, :reading)" {
+		t.Errorf("ConditionExpression = %q, want the reading not yet included", condition)
+	}
+	if value := input.ExpressionAttributeValues[":reading"]; !reflect.DeepEqual(value, numberAttr("1600000000")) {
+		t.Errorf(":reading = %v, want the reading's EpochTime", value)
+	}
+}
+
+func TestBuildExtremeUpdate(t *testing.T) {
+	tests := []struct {
+		name          string
+		max           bool
+		wantName      string
+		wantCondition string
+	}{
+		{name: "minimum", wantName: "Temperature#min", wantCondition: "attribute_not_exists(#extreme) OR #extreme > :value"},
+		{name: "maximum", max: true, wantName: "Temperature#max", wantCondition: "attribute_not_exists(#extreme) OR #extreme < :value"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			input := BuildExtremeUpdate(nil, "Temperature", numberAttr("21.5"), test.max)
+			if name := input.ExpressionAttributeNames["#extreme"]; name != test.wantName {
+				t.Errorf("#extreme = %q, want %q", name, test.wantName)
+			}
+			if condition := aws.ToString(input.ConditionExpression); condition != test.wantCondition {
+				t.Errorf("ConditionExpression = %q, want %q", condition, test.wantCondition)
+			}
+		})
+	}
+}
+
+func TestApplyRollup(t *testing.T) {
+	tests := []struct {
+		name        string
+		item        map[string]types.AttributeValue
+		setup       func(server *dynamotest.Server)
+		wantErr     bool
+		wantUpdates int
+	}{
+		{
+			name: "counted with its extremes",
+			item: rollupReading(),
+			// One update of the counts and sums, and a minimum and maximum for each field.
+			wantUpdates: 5,
+		},
+		{
+			name:        "already counted still updates its extremes",
+			item:        rollupReading(),
+			setup:       func(server *dynamotest.Server) { server.Fail("UpdateItem", "ConditionalCheckFailedException") },
+			wantUpdates: 5,
+		},
+		{
+			name:        "failed",
+			item:        rollupReading(),
+			setup:       func(server *dynamotest.Server) { server.Fail("UpdateItem", "InternalServerError") },
+			wantErr:     true,
+			wantUpdates: 1,
+		},
+		{
+			name: "bookkeeping item ignored",
+			item: func() map[string]types.AttributeValue {
+				item := rollupReading()
+				item["ProjectId#DeviceId"] = stringAttr("ratelimit#sensors#d1")
+				return item
+			}(),
+		},
+		{
+			name: "not a reading",
+			item: map[string]types.AttributeValue{"ProjectId#DeviceId": stringAttr("sensors#d1")},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := dynamotest.NewServer(t)
+			if test.setup != nil {
+				test.setup(server)
+			}
+
+			err := ApplyRollup(context.Background(), server.Client(), test.item)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("ApplyRollup() error = %v, wantErr %v", err, test.wantErr)
+			}
+			if updates := server.Calls("UpdateItem"); len(updates) != test.wantUpdates {
+				t.Errorf("made %d updates, want %d", len(updates), test.wantUpdates)
+			}
+		})
+	}
+}
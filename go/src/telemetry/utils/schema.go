@@ -0,0 +1,137 @@
+package utils
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// FieldTypes returns the types a project requires of its fields, from a comma-separated
+// FIELD_TYPES_<ProjectId> environment variable of field:type pairs,
+// e.g. FIELD_TYPES_sensors=Temperature:number,Humidity:number,Label:string.
+// The types are number, string, and bool.
+func FieldTypes(project string) map[string]string {
+	fieldTypes := make(map[string]string)
+	for _, pair := range splitList(os.Getenv(ProjectEnvName("FIELD_TYPES_", project))) {
+		parts := strings.SplitN(pair, ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		fieldTypes[strings.TrimSpace(parts[0])] = strings.ToLower(strings.TrimSpace(parts[1]))
+	}
+	return fieldTypes
+}
+
+// EnforceFieldTypes checks the fields of a POST body against their required types,
+// coercing values that unambiguously represent the type, like the string "22.5" for a number.
+// Fields missing from the body are left for the required field check.
+func EnforceFieldTypes(itemMap map[string]interface{}, fieldTypes map[string]string) error {
+	for field, fieldType := range fieldTypes {
+		value, ok := itemMap[field]
+		if !ok {
+			continue
+		}
+		coerced, err := coerceField(value, fieldType)
+		if err != nil {
+			return fmt.Errorf("%s must be a %s, %v", field, fieldType, err)
+		}
+		itemMap[field] = coerced
+	}
+	return nil
+}
+
+func coerceField(value interface{}, fieldType string) (interface{}, error) {
+	switch fieldType {
+	case "number":
+		switch v := value.(type) {
+		case float64:
+			return v, nil
+		case string:
+			number, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+			if err != nil {
+				return nil, fmt.Errorf("got %q", v)
+			}
+			return number, nil
+		}
+	case "string":
+		switch v := value.(type) {
+		case string:
+			return v, nil
+		case float64:
+			return formatNumber(v), nil
+		}
+	case "bool":
+		switch v := value.(type) {
+		case bool:
+			return v, nil
+		case string:
+			parsed, err := strconv.ParseBool(strings.TrimSpace(v))
+			if err != nil {
+				return nil, fmt.Errorf("got %q", v)
+			}
+			return parsed, nil
+		}
+	default:
+		return value, nil
+	}
+	return nil, fmt.Errorf("got %T", value)
+}
+
+// InferSchema describes the attributes found across a sample of items, mapping each name to
+// its type: number, string, bool, null, list, map, binary, or set. An attribute whose type
+// differs between items is "mixed". Server-managed attributes are left out.
+// It only reflects the items given, so attributes a device reports rarely may be missing.
+func InferSchema(items []map[string]types.AttributeValue) map[string]string {
+	schema := make(map[string]string)
+	for _, item := range items {
+		for name, value := range item {
+			if contains(ServerManagedFields, name) {
+				continue
+			}
+			valueType := attributeType(value)
+			if existing, ok := schema[name]; ok && existing != valueType {
+				schema[name] = "mixed"
+				continue
+			}
+			schema[name] = valueType
+		}
+	}
+	return schema
+}
+
+// attributeType names the type of an attribute value, using the names FieldTypes accepts
+// where they apply.
+func attributeType(value types.AttributeValue) string {
+	switch value.(type) {
+	case *types.AttributeValueMemberN:
+		return "number"
+	case *types.AttributeValueMemberS:
+		return "string"
+	case *types.AttributeValueMemberBOOL:
+		return "bool"
+	case *types.AttributeValueMemberNULL:
+		return "null"
+	case *types.AttributeValueMemberL:
+		return "list"
+	case *types.AttributeValueMemberM:
+		return "map"
+	case *types.AttributeValueMemberB:
+		return "binary"
+	case *types.AttributeValueMemberSS, *types.AttributeValueMemberNS, *types.AttributeValueMemberBS:
+		return "set"
+	default:
+		return "unknown"
+	}
+}
+
+// SchemaSampleSize is the number of recent readings sampled to describe a device's attributes,
+// from the FIELDS_SAMPLE_SIZE environment variable, 50 by default.
+func SchemaSampleSize() int {
+	if size := envInt("FIELDS_SAMPLE_SIZE", 50); size > 0 {
+		return size
+	}
+	return 50
+}
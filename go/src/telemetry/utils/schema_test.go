@@ -0,0 +1,149 @@
+package utils
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+func TestFieldTypes(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  map[string]string
+	}{
+		{name: "unset", want: map[string]string{}},
+		{
+			name:  "pairs",
+			value: "Temperature:number, Label : STRING,Charging:bool",
+			want:  map[string]string{"Temperature": "number", "Label": "string", "Charging": "bool"},
+		},
+		{name: "malformed pair skipped", value: "Temperature,Label:string", want: map[string]string{"Label": "string"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Setenv("FIELD_TYPES_sensors", test.value)
+			if got := FieldTypes("sensors"); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("FieldTypes() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestEnforceFieldTypes(t *testing.T) {
+	fieldTypes := map[string]string{"Temperature": "number", "Label": "string", "Charging": "bool", "Note": "other"}
+	tests := []struct {
+		name    string
+		item    map[string]interface{}
+		want    map[string]interface{}
+		wantErr bool
+	}{
+		{
+			name: "already typed",
+			item: map[string]interface{}{"Temperature": 21.5, "Label": "roof", "Charging": true},
+			want: map[string]interface{}{"Temperature": 21.5, "Label": "roof", "Charging": true},
+		},
+		{
+			name: "coerced",
+			item: map[string]interface{}{"Temperature": " 22.5 ", "Label": 7.0, "Charging": "false"},
+			want: map[string]interface{}{"Temperature": 22.5, "Label": "7", "Charging": false},
+		},
+		{
+			name: "missing fields and unknown types left alone",
+			item: map[string]interface{}{"Note": []interface{}{1.0}},
+			want: map[string]interface{}{"Note": []interface{}{1.0}},
+		},
+		{name: "not a number", item: map[string]interface{}{"Temperature": "warm"}, wantErr: true},
+		{name: "not a bool", item: map[string]interface{}{"Charging": "sometimes"}, wantErr: true},
+		{name: "not a string", item: map[string]interface{}{"Label": true}, wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := EnforceFieldTypes(test.item, fieldTypes)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("EnforceFieldTypes() error = %v, wantErr %v", err, test.wantErr)
+			}
+			if !test.wantErr && !reflect.DeepEqual(test.item, test.want) {
+				t.Errorf("EnforceFieldTypes() = %v, want %v", test.item, test.want)
+			}
+		})
+	}
+}
+
+func TestInferSchema(t *testing.T) {
+	tests := []struct {
+		name  string
+		items []map[string]types.AttributeValue
+		want  map[string]string
+	}{
+		{name: "no items", want: map[string]string{}},
+		{
+			name: "types",
+			items: []map[string]types.AttributeValue{{
+				"Temperature": numberAttr("21.5"),
+				"DeviceId":    stringAttr("d1"),
+				"Online":      &types.AttributeValueMemberBOOL{Value: true},
+				"Error":       &types.AttributeValueMemberNULL{Value: true},
+				"Samples":     &types.AttributeValueMemberL{},
+				"Config":      &types.AttributeValueMemberM{},
+				"Tags":        &types.AttributeValueMemberSS{Value: []string{"a"}},
+			}},
+			want: map[string]string{
+				"Temperature": "number", "DeviceId": "string", "Online": "bool", "Error": "null",
+				"Samples": "list", "Config": "map", "Tags": "set",
+			},
+		},
+		{
+			name: "attributes across items",
+			items: []map[string]types.AttributeValue{
+				{"Temperature": numberAttr("21.5")},
+				{"Humidity": numberAttr("40")},
+			},
+			want: map[string]string{"Temperature": "number", "Humidity": "number"},
+		},
+		{
+			name: "mixed types",
+			items: []map[string]types.AttributeValue{
+				{"Status": numberAttr("1")},
+				{"Status": stringAttr("ok")},
+				{"Status": numberAttr("2")},
+			},
+			want: map[string]string{"Status": "mixed"},
+		},
+		{
+			name: "server-managed attributes left out",
+			items: []map[string]types.AttributeValue{
+				{"ProjectId#DeviceId": stringAttr("sensors#d1"), "ExpiresAt": numberAttr("1"), "Temperature": numberAttr("1")},
+			},
+			want: map[string]string{"Temperature": "number"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := InferSchema(test.items); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("InferSchema() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestSchemaSampleSize(t *testing.T) {
+	tests := []struct {
+		value string
+		want  int
+	}{
+		{value: "", want: 50},
+		{value: "10", want: 10},
+		{value: "0", want: 50},
+		{value: "many", want: 50},
+	}
+	for _, test := range tests {
+		t.Run(test.value, func(t *testing.T) {
+			t.Setenv("FIELDS_SAMPLE_SIZE", test.value)
+			if got := SchemaSampleSize(); got != test.want {
+				t.Errorf("SchemaSampleSize() = %d, want %d", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,87 @@
+package utils
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// FieldRange bounds a numeric field's value, inclusively, from either or both ends.
+type FieldRange struct {
+	Min *float64 `json:"min"`
+	Max *float64 `json:"max"`
+}
+
+// SemanticRules are the checks a well-formed reading must also pass to be written.
+// FutureToleranceSeconds is how far past the current time a reading's EpochTime may be,
+// which is unchecked when unset, and Ranges bounds the values of numeric fields.
+type SemanticRules struct {
+	FutureToleranceSeconds *float64              `json:"futureToleranceSeconds"`
+	Ranges                 map[string]FieldRange `json:"ranges"`
+}
+
+// ProjectSemanticRules returns the semantic checks for the project's readings, read from the
+// SEMANTIC_RULES_<ProjectId> environment variable, e.g.
+// {"futureToleranceSeconds": 300, "ranges": {"BatteryPct": {"min": 0, "max": 100}}}.
+// Readings are not checked when it is unset.
+func ProjectSemanticRules(project string) SemanticRules {
+	var rules SemanticRules
+	envJSON(ProjectEnvName("SEMANTIC_RULES_", project), &rules)
+	return rules
+}
+
+// SemanticError lists every semantic rule a reading violates.
+type SemanticError struct {
+	Violations []string
+}
+
+func (err *SemanticError) Error() string {
+	return "Reading is invalid: " + strings.Join(err.Violations, "; ")
+}
+
+// SemanticValidate checks a decoded reading against the rules, returning a *SemanticError
+// that lists every violation, or nil if there are none.
+// Fields that are absent, or aren't numbers, are left to the other validations.
+func SemanticValidate(itemMap map[string]interface{}, rules SemanticRules) error {
+	var violations []string
+	if rules.FutureToleranceSeconds != nil {
+		if epoch, ok := itemMap["EpochTime"].(float64); ok {
+			latest := float64(Now().Unix()) + *rules.FutureToleranceSeconds
+			if epoch > latest {
+				violations = append(violations, fmt.Sprintf(
+					"EpochTime %s is more than %s seconds in the future",
+					formatNumber(epoch), formatNumber(*rules.FutureToleranceSeconds),
+				))
+			}
+		}
+	}
+
+	// Fields are checked in order, so the violations are listed consistently.
+	fields := make([]string, 0, len(rules.Ranges))
+	for field := range rules.Ranges {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	for _, field := range fields {
+		value, ok := itemMap[field].(float64)
+		if !ok {
+			continue
+		}
+		bounds := rules.Ranges[field]
+		if bounds.Min != nil && value < *bounds.Min {
+			violations = append(violations, fmt.Sprintf(
+				"%s %s is less than the minimum of %s", field, formatNumber(value), formatNumber(*bounds.Min),
+			))
+		}
+		if bounds.Max != nil && value > *bounds.Max {
+			violations = append(violations, fmt.Sprintf(
+				"%s %s is greater than the maximum of %s", field, formatNumber(value), formatNumber(*bounds.Max),
+			))
+		}
+	}
+
+	if len(violations) > 0 {
+		return &SemanticError{Violations: violations}
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+package utils
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestProjectSemanticRules(t *testing.T) {
+	t.Setenv("SEMANTIC_RULES_sensors", `{"futureToleranceSeconds": 300, "ranges": {"BatteryPct": {"min": 0, "max": 100}}}`)
+
+	rules := ProjectSemanticRules("sensors")
+	if rules.FutureToleranceSeconds == nil || *rules.FutureToleranceSeconds != 300 {
+		t.Errorf("FutureToleranceSeconds = %v, want 300", rules.FutureToleranceSeconds)
+	}
+	battery, ok := rules.Ranges["BatteryPct"]
+	if !ok || bound(battery.Min) != "0" || bound(battery.Max) != "100" {
+		t.Errorf("Ranges = %v, want BatteryPct bounded by 0 and 100", rules.Ranges)
+	}
+	if rules := ProjectSemanticRules("dogs"); rules.FutureToleranceSeconds != nil || rules.Ranges != nil {
+		t.Errorf("ProjectSemanticRules() of an unconfigured project = %+v, want no rules", rules)
+	}
+}
+
+func TestSemanticValidate(t *testing.T) {
+	rules := SemanticRules{
+		FutureToleranceSeconds: float(300),
+		Ranges: map[string]FieldRange{
+			"BatteryPct":  {Min: float(0), Max: float(100)},
+			"Temperature": {Min: float(-40)},
+		},
+	}
+	tests := []struct {
+		name           string
+		item           map[string]interface{}
+		rules          SemanticRules
+		wantViolations []string
+	}{
+		{
+			name:  "valid",
+			item:  map[string]interface{}{"EpochTime": 1600000300.0, "BatteryPct": 100.0, "Temperature": -40.0},
+			rules: rules,
+		},
+		{
+			name:           "too far in the future",
+			item:           map[string]interface{}{"EpochTime": 1600000301.0},
+			rules:          rules,
+			wantViolations: []string{"EpochTime 1600000301 is more than 300 seconds in the future"},
+		},
+		{
+			name:  "every violation listed in order",
+			item:  map[string]interface{}{"EpochTime": 1600000000.0, "Temperature": -41.5, "BatteryPct": 120.0},
+			rules: rules,
+			wantViolations: []string{
+				"BatteryPct 120 is greater than the maximum of 100",
+				"Temperature -41.5 is less than the minimum of -40",
+			},
+		},
+		{
+			name:  "absent and non-numeric fields left to other validations",
+			item:  map[string]interface{}{"EpochTime": "soon", "BatteryPct": "full"},
+			rules: rules,
+		},
+		{
+			name: "no rules",
+			item: map[string]interface{}{"EpochTime": 1700000000.0, "BatteryPct": 120.0},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			stopClock(t)
+			err := SemanticValidate(test.item, test.rules)
+			if test.wantViolations == nil {
+				if err != nil {
+					t.Errorf("SemanticValidate() error = %v, want none", err)
+				}
+				return
+			}
+			var semanticErr *SemanticError
+			if !errors.As(err, &semanticErr) {
+				t.Fatalf("SemanticValidate() error = %v, want a *SemanticError", err)
+			}
+			if !reflect.DeepEqual(semanticErr.Violations, test.wantViolations) {
+				t.Errorf("Violations = %q, want %q", semanticErr.Violations, test.wantViolations)
+			}
+		})
+	}
+}
+
+func TestUnprocessableEntityResponse(t *testing.T) {
+	violations := []string{"BatteryPct 120 is greater than the maximum of 100"}
+	response, err := UnprocessableEntityResponse("Reading is invalid", violations)
+	if err != nil {
+		t.Fatalf("UnprocessableEntityResponse() error = %v", err)
+	}
+	if response.StatusCode != 422 {
+		t.Errorf("status = %d, want 422", response.StatusCode)
+	}
+	var body ErrorBody
+	if err := json.Unmarshal([]byte(response.Body), &body); err != nil {
+		t.Fatalf("body %s isn't an error body, %v", response.Body, err)
+	}
+	if body.Error.Code != "UNPROCESSABLE_ENTITY" || !reflect.DeepEqual(body.Error.Violations, violations) {
+		t.Errorf("error = %+v, want UNPROCESSABLE_ENTITY with the violations", body.Error)
+	}
+}
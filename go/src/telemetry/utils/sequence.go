@@ -0,0 +1,117 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"telemetry/constants"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go/aws"
+)
+
+// ErrStaleSequence is returned for a write whose SequenceNum is not greater than the
+// latest one stored for its device, such as a reading replayed from a device's buffered queue.
+var ErrStaleSequence = errors.New("SequenceNum is not greater than the device's latest")
+
+// SequenceNumber returns the optional SequenceNum of an item, which must be a whole number.
+func SequenceNumber(item map[string]types.AttributeValue) (int64, bool, error) {
+	value, ok := item["SequenceNum"]
+	if !ok {
+		return 0, false, nil
+	}
+	number, isNumber := value.(*types.AttributeValueMemberN)
+	if !isNumber {
+		return 0, false, errors.New("SequenceNum must be a whole number")
+	}
+	// Numbers are formatted with six decimal places, which must all be zero.
+	parts := strings.SplitN(number.Value, ".", 2)
+	sequence, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil || (len(parts) == 2 && strings.Trim(parts[1], "0") != "") {
+		return 0, false, fmt.Errorf("SequenceNum must be a whole number, got %s", number.Value)
+	}
+	return sequence, true, nil
+}
+
+// BuildSequenceUpdate builds the update that advances a device's LatestSequence, tracked on its
+// status item, to the given sequence. The condition fails unless the sequence is greater than
+// the stored one, and the previous value is returned so that the update can be undone.
+func BuildSequenceUpdate(
+	tenant string,
+	project string,
+	deviceId string,
+	sequence int64,
+) *dynamodb.UpdateItemInput {
+	return &dynamodb.UpdateItemInput{
+		TableName:           aws.String(constants.TABLE_NAME),
+		Key:                 StatusKey(tenant, project, deviceId),
+		UpdateExpression:    aws.String("SET LatestSequence = :sequence"),
+		ConditionExpression: aws.String("attribute_not_exists(LatestSequence) OR LatestSequence < :sequence"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":sequence": &types.AttributeValueMemberN{Value: strconv.FormatInt(sequence, 10)},
+		},
+		ReturnValues: types.ReturnValueUpdatedOld,
+	}
+}
+
+// BuildSequenceRestore builds the update that undoes BuildSequenceUpdate, putting back the
+// previous LatestSequence, or removing it when there was none. It only applies while the
+// sequence is still the one that was set, so that a newer write isn't undone.
+func BuildSequenceRestore(
+	tenant string,
+	project string,
+	deviceId string,
+	sequence int64,
+	previous types.AttributeValue,
+) *dynamodb.UpdateItemInput {
+	input := &dynamodb.UpdateItemInput{
+		TableName:           aws.String(constants.TABLE_NAME),
+		Key:                 StatusKey(tenant, project, deviceId),
+		UpdateExpression:    aws.String("REMOVE LatestSequence"),
+		ConditionExpression: aws.String("LatestSequence = :sequence"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":sequence": &types.AttributeValueMemberN{Value: strconv.FormatInt(sequence, 10)},
+		},
+	}
+	if previous != nil {
+		input.UpdateExpression = aws.String("SET LatestSequence = :previous")
+		input.ExpressionAttributeValues[":previous"] = previous
+	}
+	return input
+}
+
+// PutSequenced performs a write only when its sequence is newer than the device's latest,
+// returning ErrStaleSequence otherwise. The device's LatestSequence is advanced first,
+// and put back if the write fails, so that the device can retry it.
+func PutSequenced(
+	ctx context.Context,
+	api DynamoDbUpdateItemAPI,
+	tenant string,
+	project string,
+	deviceId string,
+	sequence int64,
+	put func() error,
+) error {
+	output, err := api.UpdateItem(ctx, BuildSequenceUpdate(tenant, project, deviceId, sequence))
+	var conditionFailed *types.ConditionalCheckFailedException
+	if errors.As(err, &conditionFailed) {
+		return ErrStaleSequence
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := put(); err != nil {
+		previous := output.Attributes["LatestSequence"]
+		_, restoreErr := api.UpdateItem(ctx, BuildSequenceRestore(tenant, project, deviceId, sequence, previous))
+		if restoreErr != nil && !errors.As(restoreErr, &conditionFailed) {
+			log.Printf("Failed to restore sequence of device %s, %v", deviceId, restoreErr)
+		}
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,130 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+
+	"telemetry/utils/dynamotest"
+)
+
+func TestSequenceNumber(t *testing.T) {
+	tests := []struct {
+		name          string
+		item          map[string]types.AttributeValue
+		want          int64
+		wantSequenced bool
+		wantErr       bool
+	}{
+		{name: "no sequence", item: map[string]types.AttributeValue{}},
+		{name: "whole number", item: map[string]types.AttributeValue{"SequenceNum": numberAttr("42")}, want: 42, wantSequenced: true},
+		{name: "formatted", item: map[string]types.AttributeValue{"SequenceNum": numberAttr("42.000000")}, want: 42, wantSequenced: true},
+		{name: "fractional", item: map[string]types.AttributeValue{"SequenceNum": numberAttr("42.500000")}, wantErr: true},
+		{name: "string", item: map[string]types.AttributeValue{"SequenceNum": stringAttr("42")}, wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, sequenced, err := SequenceNumber(test.item)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("SequenceNumber() error = %v, wantErr %v", err, test.wantErr)
+			}
+			if got != test.want || sequenced != test.wantSequenced {
+				t.Errorf("SequenceNumber() = %d, %v, want %d, %v", got, sequenced, test.want, test.wantSequenced)
+			}
+		})
+	}
+}
+
+func TestBuildSequenceRestore(t *testing.T) {
+	tests := []struct {
+		name           string
+		previous       types.AttributeValue
+		wantExpression string
+	}{
+		{name: "no previous sequence", wantExpression: "REMOVE LatestSequence"},
+		{name: "previous sequence", previous: numberAttr("3"), wantExpression: "SET LatestSequence = :previous"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			input := BuildSequenceRestore("", "sensors", "d1", 4, test.previous)
+			if expression := *input.UpdateExpression; expression != test.wantExpression {
+				t.Errorf("UpdateExpression = %q, want %q", expression, test.wantExpression)
+			}
+			if sequence := input.ExpressionAttributeValues[":sequence"]; !reflect.DeepEqual(sequence, numberAttr("4")) {
+				t.Errorf(":sequence = %v, want 4", sequence)
+			}
+		})
+	}
+}
+
+func TestPutSequenced(t *testing.T) {
+	failed := errors.New("put failed")
+	tests := []struct {
+		name            string
+		setup           func(server *dynamotest.Server)
+		putErr          error
+		wantErr         error
+		wantPut         bool
+		wantRestoreWith string
+	}{
+		{
+			name:    "newer sequence",
+			wantPut: true,
+		},
+		{
+			name:    "stale sequence",
+			setup:   func(server *dynamotest.Server) { server.Fail("UpdateItem", "ConditionalCheckFailedException") },
+			wantErr: ErrStaleSequence,
+		},
+		{
+			name: "failed put restores the previous sequence",
+			setup: func(server *dynamotest.Server) {
+				server.Respond("UpdateItem", `{"Attributes": {"LatestSequence": {"N": "3"}}}`)
+			},
+			putErr:          failed,
+			wantErr:         failed,
+			wantPut:         true,
+			wantRestoreWith: "SET LatestSequence = :previous",
+		},
+		{
+			name:            "failed first put removes the sequence",
+			putErr:          failed,
+			wantErr:         failed,
+			wantPut:         true,
+			wantRestoreWith: "REMOVE LatestSequence",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := dynamotest.NewServer(t)
+			if test.setup != nil {
+				test.setup(server)
+			}
+
+			put := false
+			err := PutSequenced(context.Background(), server.Client(), "", "sensors", "d1", 4, func() error {
+				put = true
+				return test.putErr
+			})
+			if !errors.Is(err, test.wantErr) {
+				t.Fatalf("PutSequenced() error = %v, want %v", err, test.wantErr)
+			}
+			if put != test.wantPut {
+				t.Errorf("put = %v, want %v", put, test.wantPut)
+			}
+			updates := server.Calls("UpdateItem")
+			if test.wantRestoreWith == "" {
+				if len(updates) != 1 {
+					t.Errorf("made %d updates, want 1", len(updates))
+				}
+				return
+			}
+			if len(updates) != 2 || updates[1].Input["UpdateExpression"] != test.wantRestoreWith {
+				t.Errorf("updates = %v, want the sequence restored with %q", updates, test.wantRestoreWith)
+			}
+		})
+	}
+}
@@ -0,0 +1,108 @@
+package utils
+
+import (
+	"fmt"
+	"strings"
+	"telemetry/constants"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// MaxItemSize returns the largest item, in bytes, that the handlers will try to write.
+// The MAX_ITEM_SIZE_BYTES environment variable can lower the threshold,
+// but never raise it above the DynamoDB limit.
+func MaxItemSize() int {
+	limit := envInt("MAX_ITEM_SIZE_BYTES", constants.MAX_ITEM_SIZE)
+	if limit <= 0 || limit > constants.MAX_ITEM_SIZE {
+		return constants.MAX_ITEM_SIZE
+	}
+	return limit
+}
+
+// ItemSizeError is returned for an item larger than MaxItemSize.
+type ItemSizeError struct {
+	Size  int
+	Limit int
+}
+
+func (err *ItemSizeError) Error() string {
+	return fmt.Sprintf("Item is approximately %d bytes, which exceeds the %d byte limit", err.Size, err.Limit)
+}
+
+// CheckItemSize rejects oversized items up front, rather than letting DynamoDB
+// fail the write with an opaque ValidationException.
+func CheckItemSize(item map[string]types.AttributeValue) error {
+	if size, limit := EstimateItemSize(item), MaxItemSize(); size > limit {
+		return &ItemSizeError{Size: size, Limit: limit}
+	}
+	return nil
+}
+
+// EstimateItemSize approximates the size DynamoDB will count against its item limit,
+// following the sizing rules in the DynamoDB developer guide.
+func EstimateItemSize(item map[string]types.AttributeValue) int {
+	size := 0
+	for name, value := range item {
+		size += len(name) + attributeValueSize(value)
+	}
+	return size
+}
+
+func attributeValueSize(value types.AttributeValue) int {
+	switch v := value.(type) {
+	case *types.AttributeValueMemberS:
+		return len(v.Value)
+	case *types.AttributeValueMemberN:
+		return numberSize(v.Value)
+	case *types.AttributeValueMemberB:
+		return len(v.Value)
+	case *types.AttributeValueMemberBOOL, *types.AttributeValueMemberNULL:
+		return 1
+	case *types.AttributeValueMemberSS:
+		size := 0
+		for _, s := range v.Value {
+			size += len(s)
+		}
+		return size
+	case *types.AttributeValueMemberNS:
+		size := 0
+		for _, n := range v.Value {
+			size += numberSize(n)
+		}
+		return size
+	case *types.AttributeValueMemberBS:
+		size := 0
+		for _, b := range v.Value {
+			size += len(b)
+		}
+		return size
+	case *types.AttributeValueMemberL:
+		// Lists and maps carry 3 bytes of overhead plus 1 byte per element.
+		size := 3
+		for _, child := range v.Value {
+			size += 1 + attributeValueSize(child)
+		}
+		return size
+	case *types.AttributeValueMemberM:
+		size := 3
+		for name, child := range v.Value {
+			size += 1 + len(name) + attributeValueSize(child)
+		}
+		return size
+	default:
+		return 0
+	}
+}
+
+// numberSize approximates the stored size of a number: one byte per two
+// significant digits, plus one byte.
+func numberSize(number string) int {
+	digits := strings.TrimLeft(strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return r
+		}
+		return -1
+	}, number), "0")
+	digits = strings.TrimRight(digits, "0")
+	return (len(digits)+1)/2 + 1
+}
@@ -0,0 +1,120 @@
+package utils
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+func TestEstimateItemSize(t *testing.T) {
+	tests := []struct {
+		name string
+		item map[string]types.AttributeValue
+		want int
+	}{
+		{name: "empty", item: map[string]types.AttributeValue{}, want: 0},
+		{
+			name: "string",
+			item: map[string]types.AttributeValue{"Name": &types.AttributeValueMemberS{Value: "abc"}},
+			want: 4 + 3,
+		},
+		{
+			// Five significant digits take three bytes, plus one.
+			name: "number",
+			item: map[string]types.AttributeValue{"N": &types.AttributeValueMemberN{Value: "123.45"}},
+			want: 1 + 4,
+		},
+		{
+			name: "number with zeros",
+			item: map[string]types.AttributeValue{"N": &types.AttributeValueMemberN{Value: "1000.000000"}},
+			want: 1 + 2,
+		},
+		{
+			name: "bool and null",
+			item: map[string]types.AttributeValue{
+				"B": &types.AttributeValueMemberBOOL{Value: true},
+				"Z": &types.AttributeValueMemberNULL{Value: true},
+			},
+			want: 1 + 1 + 1 + 1,
+		},
+		{
+			name: "list",
+			item: map[string]types.AttributeValue{"L": &types.AttributeValueMemberL{Value: []types.AttributeValue{
+				&types.AttributeValueMemberS{Value: "ab"},
+				&types.AttributeValueMemberS{Value: "c"},
+			}}},
+			want: 1 + 3 + (1 + 2) + (1 + 1),
+		},
+		{
+			name: "map",
+			item: map[string]types.AttributeValue{"M": &types.AttributeValueMemberM{Value: map[string]types.AttributeValue{
+				"key": &types.AttributeValueMemberS{Value: "value"},
+			}}},
+			want: 1 + 3 + (1 + 3 + 5),
+		},
+		{
+			name: "sets",
+			item: map[string]types.AttributeValue{
+				"SS": &types.AttributeValueMemberSS{Value: []string{"a", "bc"}},
+				"BS": &types.AttributeValueMemberBS{Value: [][]byte{{1, 2}, {3}}},
+			},
+			want: 2 + 3 + 2 + 3,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := EstimateItemSize(test.item); got != test.want {
+				t.Errorf("EstimateItemSize() = %d, want %d", got, test.want)
+			}
+		})
+	}
+}
+
+func TestMaxItemSize(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  int
+	}{
+		{name: "default", value: "", want: 400 * 1024},
+		{name: "lowered", value: "1000", want: 1000},
+		{name: "above the DynamoDB limit", value: "999999999", want: 400 * 1024},
+		{name: "zero", value: "0", want: 400 * 1024},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Setenv("MAX_ITEM_SIZE_BYTES", test.value)
+			if got := MaxItemSize(); got != test.want {
+				t.Errorf("MaxItemSize() = %d, want %d", got, test.want)
+			}
+		})
+	}
+}
+
+func TestCheckItemSize(t *testing.T) {
+	t.Setenv("MAX_ITEM_SIZE_BYTES", "100")
+	tests := []struct {
+		name    string
+		value   string
+		wantErr bool
+	}{
+		{name: "under the limit", value: strings.Repeat("x", 50)},
+		{name: "at the limit", value: strings.Repeat("x", 96)},
+		{name: "over the limit", value: strings.Repeat("x", 97), wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			item := map[string]types.AttributeValue{"Data": &types.AttributeValueMemberS{Value: test.value}}
+			err := CheckItemSize(item)
+			var sizeErr *ItemSizeError
+			if got := errors.As(err, &sizeErr); got != test.wantErr {
+				t.Fatalf("CheckItemSize() = %v, want an *ItemSizeError: %v", err, test.wantErr)
+			}
+			if test.wantErr && (sizeErr.Size != 4+len(test.value) || sizeErr.Limit != 100) {
+				t.Errorf("CheckItemSize() = %+v", sizeErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,53 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"telemetry/constants"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go/aws"
+)
+
+// SoftDeleteReading marks a device's reading as deleted by setting its IsDeleted attribute,
+// leaving the item in place for auditing. Queries skip deleted readings unless they include them.
+// It reports whether the reading existed.
+func SoftDeleteReading(
+	ctx context.Context,
+	api DynamoDbUpdateItemAPI,
+	tenant string,
+	project string,
+	deviceId string,
+	epochTime float64,
+) (bool, error) {
+	_, err := api.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(constants.TABLE_NAME),
+		Key: map[string]types.AttributeValue{
+			"ProjectId#DeviceId": &types.AttributeValueMemberS{
+				Value: PartitionKey(tenant, project, deviceId),
+			},
+			SortKeyAttribute(): &types.AttributeValueMemberN{Value: formatNumber(epochTime)},
+		},
+		UpdateExpression:    aws.String("SET IsDeleted = :true"),
+		ConditionExpression: aws.String("attribute_exists(#sortKey)"),
+		ExpressionAttributeNames: map[string]string{
+			"#sortKey": SortKeyAttribute(),
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":true": &types.AttributeValueMemberBOOL{Value: true},
+		},
+	})
+	var conditionFailed *types.ConditionalCheckFailedException
+	if errors.As(err, &conditionFailed) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// excludeDeleted filters soft-deleted readings out of a query.
+func excludeDeleted(input *dynamodb.QueryInput) {
+	input.ExpressionAttributeNames["#deleted"] = "IsDeleted"
+	input.ExpressionAttributeValues[":notDeleted"] = &types.AttributeValueMemberBOOL{Value: false}
+	addFilter(input, "attribute_not_exists(#deleted) OR #deleted = :notDeleted")
+}
@@ -0,0 +1,76 @@
+package utils
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+
+	"telemetry/utils/dynamotest"
+)
+
+func TestSoftDeleteReading(t *testing.T) {
+	tests := []struct {
+		name      string
+		fail      string
+		wantFound bool
+		wantErr   bool
+	}{
+		{name: "deleted", wantFound: true},
+		{name: "missing reading", fail: "ConditionalCheckFailedException"},
+		{name: "update failed", fail: "InternalServerError", wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := dynamotest.NewServer(t)
+			if test.fail != "" {
+				server.Fail("UpdateItem", test.fail)
+			}
+
+			found, err := SoftDeleteReading(context.Background(), server.Client(), "", "sensors", "d1", 1600000000)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("SoftDeleteReading() error = %v, wantErr %v", err, test.wantErr)
+			}
+			if found != test.wantFound {
+				t.Errorf("SoftDeleteReading() = %v, want %v", found, test.wantFound)
+			}
+			updates := server.Calls("UpdateItem")
+			if len(updates) != 1 {
+				t.Fatalf("made %d updates, want 1", len(updates))
+			}
+			if key := partitionKeyOf(updates[0], "Key"); key != "sensors#d1" {
+				t.Errorf("partition key = %v, want sensors#d1", key)
+			}
+			if expression := updates[0].Input["UpdateExpression"]; expression != "SET IsDeleted = :true" {
+				t.Errorf("UpdateExpression = %v, want IsDeleted set", expression)
+			}
+		})
+	}
+}
+
+func TestExcludeDeleted(t *testing.T) {
+	tests := []struct {
+		name           string
+		includeDeleted bool
+		wantFiltered   bool
+	}{
+		{name: "deleted readings skipped", wantFiltered: true},
+		{name: "deleted readings included", includeDeleted: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			input, err := BuildQueryInput(QueryParams{ProjectId: "sensors", DeviceId: "d1", IncludeDeleted: test.includeDeleted})
+			if err != nil {
+				t.Fatalf("BuildQueryInput() error = %v", err)
+			}
+			filter := aws.ToString(input.FilterExpression)
+			if filtered := strings.Contains(filter, "#deleted"); filtered != test.wantFiltered {
+				t.Errorf("FilterExpression = %q, want deleted readings filtered %v", filter, test.wantFiltered)
+			}
+			if _, named := input.ExpressionAttributeNames["#deleted"]; named != test.wantFiltered {
+				t.Errorf("#deleted named %v, want %v", named, test.wantFiltered)
+			}
+		})
+	}
+}
@@ -0,0 +1,211 @@
+package utils
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go/aws"
+)
+
+// QuerySpec is a structured query, as POSTed to a project's query endpoint
+// by clients whose queries don't fit comfortably in a query string.
+type QuerySpec struct {
+	// TenantId and ProjectId come from the request, never from the body.
+	TenantId  string `json:"-"`
+	ProjectId string `json:"-"`
+
+	DeviceId   string   `json:"deviceId"`
+	LocationId string   `json:"locationId"`
+	Start      *float64 `json:"start"`
+	End        *float64 `json:"end"`
+
+	// Fields, when set, limits the attributes returned. The attributes readings are ordered by,
+	// and the keys a query resumes from, are always included.
+	Fields []string `json:"fields"`
+
+	// Filters keep only the items that satisfy all of them.
+	Filters []FilterSpec `json:"filters"`
+
+	Limit int    `json:"limit"`
+	Order string `json:"order"`
+
+	// Cursor resumes a query where its size budget cut it short, from the nextCursor returned.
+	Cursor string `json:"cursor"`
+
+	// Aggregate, when set, replaces the items with a summary of one numeric field.
+	Aggregate *AggregateSpec `json:"aggregate"`
+}
+
+// FilterSpec compares a field to a value. Op is one of =, <>, <, <=, >, >=, exists, and not_exists,
+// the last two of which take no value.
+type FilterSpec struct {
+	Field string      `json:"field"`
+	Op    string      `json:"op"`
+	Value interface{} `json:"value"`
+}
+
+// AggregateSpec summarizes a numeric field like the 'stats' and 'percentiles' query parameters.
+type AggregateSpec struct {
+	Field       string    `json:"field"`
+	Percentiles []float64 `json:"percentiles"`
+}
+
+// filterComparisons are the comparison operators a FilterSpec accepts.
+var filterComparisons = []string{"=", "<>", "<", "<=", ">", ">="}
+
+// DecodeQuerySpec decodes a query spec from a request body, rejecting unknown fields.
+func DecodeQuerySpec(body string) (QuerySpec, error) {
+	var spec QuerySpec
+	decoder := json.NewDecoder(strings.NewReader(body))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&spec); err != nil {
+		return spec, fmt.Errorf("Could not decode query, %v", err)
+	}
+	if decoder.More() {
+		return spec, errors.New("Could not decode query, unexpected data after the query")
+	}
+	return spec, nil
+}
+
+// QueryParams translates the spec into query parameters, clamping its limit to MaxLimit
+// like the 'limit' query string parameter.
+func (spec QuerySpec) QueryParams() (QueryParams, error) {
+	params := QueryParams{
+		TenantId:   spec.TenantId,
+		ProjectId:  spec.ProjectId,
+		DeviceId:   spec.DeviceId,
+		LocationId: spec.LocationId,
+		Start:      spec.Start,
+		End:        spec.End,
+		Limit:      spec.Limit,
+		Cursor:     spec.Cursor,
+		Filters:    spec.Filters,
+		Fields:     spec.Fields,
+	}
+	if max := MaxLimit(); spec.Limit > max {
+		params.Limit, params.LimitClamped = max, true
+	}
+	switch spec.Order {
+	case "", "asc":
+	case "desc":
+		params.Descending = true
+	default:
+		return params, fmt.Errorf("order must be asc or desc, got %q", spec.Order)
+	}
+	if spec.Limit < 0 {
+		return params, fmt.Errorf("limit must not be negative, got %d", spec.Limit)
+	}
+	if spec.DeviceId != "" && spec.LocationId != "" {
+		return params, errors.New("deviceId cannot be combined with locationId")
+	}
+	return params, params.Validate()
+}
+
+// Validate checks the parts of the spec that don't translate into query parameters.
+func (spec QuerySpec) Validate() error {
+	if _, err := spec.QueryParams(); err != nil {
+		return err
+	}
+	for _, field := range spec.Fields {
+		if field == "" {
+			return errors.New("fields must not be empty")
+		}
+	}
+	for _, filter := range spec.Filters {
+		if filter.Field == "" {
+			return errors.New("filters must name a field")
+		}
+		switch {
+		case filter.Op == "exists" || filter.Op == "not_exists":
+		case contains(filterComparisons, filter.Op):
+			switch filter.Value.(type) {
+			case string, float64, bool:
+			default:
+				return fmt.Errorf("filter on %s must compare to a string, number, or boolean", filter.Field)
+			}
+		default:
+			return fmt.Errorf("unknown filter op %q", filter.Op)
+		}
+	}
+	if spec.Aggregate != nil {
+		if spec.Aggregate.Field == "" {
+			return errors.New("aggregate must name a field")
+		}
+		for _, percentile := range spec.Aggregate.Percentiles {
+			if percentile < 0 || percentile > 100 {
+				return fmt.Errorf("percentiles must be numbers between 0 and 100, got %v", percentile)
+			}
+		}
+	}
+	return nil
+}
+
+// BuildQueryFromSpec translates a query spec into a DynamoDB query,
+// with its filters and field selection added by BuildQueryInput.
+func BuildQueryFromSpec(spec QuerySpec) (*dynamodb.QueryInput, error) {
+	if err := spec.Validate(); err != nil {
+		return nil, err
+	}
+	params, _ := spec.QueryParams()
+	return BuildQueryInput(params)
+}
+
+// CheckRedactedFilters rejects filters on redacted fields, whose matches would reveal
+// the values that redaction hides.
+func (spec QuerySpec) CheckRedactedFilters(redacted []string) error {
+	for _, filter := range spec.Filters {
+		if err := CheckRedactedField(filter.Field, redacted); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// applyFilterSpecs keeps only the items that satisfy all of the filters.
+func applyFilterSpecs(input *dynamodb.QueryInput, filters []FilterSpec) {
+	for i, filter := range filters {
+		name := fmt.Sprintf("#filter%d", i)
+		input.ExpressionAttributeNames[name] = filter.Field
+		switch filter.Op {
+		case "exists":
+			addFilter(input, fmt.Sprintf("attribute_exists(%s)", name))
+		case "not_exists":
+			addFilter(input, fmt.Sprintf("attribute_not_exists(%s)", name))
+		default:
+			value := fmt.Sprintf(":filter%d", i)
+			input.ExpressionAttributeValues[value] = toAttributeValue(filter.Value)
+			addFilter(input, fmt.Sprintf("%s %s %s", name, filter.Op, value))
+		}
+	}
+}
+
+// applyFieldSelection limits the attributes the query returns to the fields, along with
+// the attributes its items are ordered by, and the keys of the table and the index it reads,
+// which a query cut short by its size budget resumes from.
+func applyFieldSelection(input *dynamodb.QueryInput, selected []string) {
+	if len(selected) == 0 {
+		return
+	}
+	always := []string{
+		"EpochTime",
+		SortKeyAttribute(),
+		"SequenceNum",
+		"ProjectId#DeviceId",
+		input.ExpressionAttributeNames["#primaryName"],
+	}
+	// DynamoDB rejects a projection that names the same attribute twice.
+	var fields, names []string
+	for _, field := range append(always, selected...) {
+		if contains(fields, field) {
+			continue
+		}
+		name := fmt.Sprintf("#field%d", len(names))
+		input.ExpressionAttributeNames[name] = field
+		fields = append(fields, field)
+		names = append(names, name)
+	}
+	input.ProjectionExpression = aws.String(strings.Join(names, ", "))
+}
@@ -0,0 +1,147 @@
+package utils
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+func TestDecodeQuerySpec(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		want    QuerySpec
+		wantErr bool
+	}{
+		{
+			name: "query",
+			body: `{"deviceId": "d1", "start": 1, "fields": ["Temperature"], "limit": 5, "order": "desc",
+				"filters": [{"field": "Temperature", "op": ">", "value": 20}],
+				"aggregate": {"field": "Temperature", "percentiles": [50]}}`,
+			want: QuerySpec{
+				DeviceId: "d1", Start: float(1), Fields: []string{"Temperature"}, Limit: 5, Order: "desc",
+				Filters:   []FilterSpec{{Field: "Temperature", Op: ">", Value: 20.0}},
+				Aggregate: &AggregateSpec{Field: "Temperature", Percentiles: []float64{50}},
+			},
+		},
+		{name: "project from the body ignored", body: `{"ProjectId": "dogs"}`, wantErr: true},
+		{name: "unknown field", body: `{"device": "d1"}`, wantErr: true},
+		{name: "trailing data", body: `{} {}`, wantErr: true},
+		{name: "malformed", body: `{"deviceId": `, wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := DecodeQuerySpec(test.body)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("DecodeQuerySpec() error = %v, wantErr %v", err, test.wantErr)
+			}
+			if !test.wantErr && !reflect.DeepEqual(got, test.want) {
+				t.Errorf("DecodeQuerySpec() = %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestQuerySpecValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		spec    QuerySpec
+		wantErr bool
+	}{
+		{name: "empty", spec: QuerySpec{}},
+		{
+			name: "filters",
+			spec: QuerySpec{Filters: []FilterSpec{
+				{Field: "Temperature", Op: ">=", Value: 20.0},
+				{Field: "Label", Op: "=", Value: "roof"},
+				{Field: "Charging", Op: "<>", Value: true},
+				{Field: "Error", Op: "not_exists"},
+			}},
+		},
+		{name: "unknown order", spec: QuerySpec{Order: "up"}, wantErr: true},
+		{name: "negative limit", spec: QuerySpec{Limit: -1}, wantErr: true},
+		{name: "device and location", spec: QuerySpec{DeviceId: "d1", LocationId: "roof"}, wantErr: true},
+		{name: "empty field", spec: QuerySpec{Fields: []string{""}}, wantErr: true},
+		{name: "unnamed filter", spec: QuerySpec{Filters: []FilterSpec{{Op: "exists"}}}, wantErr: true},
+		{name: "unknown op", spec: QuerySpec{Filters: []FilterSpec{{Field: "a", Op: "like", Value: "x"}}}, wantErr: true},
+		{
+			name:    "comparison to a list",
+			spec:    QuerySpec{Filters: []FilterSpec{{Field: "a", Op: "=", Value: []interface{}{1.0}}}},
+			wantErr: true,
+		},
+		{name: "unnamed aggregate", spec: QuerySpec{Aggregate: &AggregateSpec{}}, wantErr: true},
+		{
+			name:    "percentile out of range",
+			spec:    QuerySpec{Aggregate: &AggregateSpec{Field: "a", Percentiles: []float64{101}}},
+			wantErr: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			test.spec.ProjectId = "sensors"
+			if err := test.spec.Validate(); (err != nil) != test.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestBuildQueryFromSpec(t *testing.T) {
+	tests := []struct {
+		name           string
+		spec           QuerySpec
+		wantFilter     string // a suffix, following the soft delete filter
+		wantProjection string
+		wantNames      map[string]string
+	}{
+		{
+			name: "filters",
+			spec: QuerySpec{DeviceId: "d1", Filters: []FilterSpec{
+				{Field: "Temperature", Op: ">", Value: 20.0},
+				{Field: "Error", Op: "not_exists"},
+			}},
+			wantFilter: " AND (#filter0 > :filter0)) AND (attribute_not_exists(#filter1))",
+			wantNames:  map[string]string{"#filter0": "Temperature", "#filter1": "Error"},
+		},
+		{
+			name:           "fields, sort and key attributes always included once",
+			spec:           QuerySpec{DeviceId: "d1", Fields: []string{"Temperature", "EpochTime", "Temperature"}},
+			wantProjection: "#field0, #field1, #field2, #field3",
+			wantNames: map[string]string{
+				"#field0": "EpochTime", "#field1": "SequenceNum", "#field2": "ProjectId#DeviceId", "#field3": "Temperature",
+			},
+		},
+		{
+			name:           "fields of a project",
+			spec:           QuerySpec{Fields: []string{"Temperature"}},
+			wantProjection: "#field0, #field1, #field2, #field3, #field4",
+			wantNames:      map[string]string{"#field3": "ProjectId", "#field4": "Temperature"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			test.spec.ProjectId = "sensors"
+			input, err := BuildQueryFromSpec(test.spec)
+			if err != nil {
+				t.Fatalf("BuildQueryFromSpec() error = %v", err)
+			}
+			if filter := aws.ToString(input.FilterExpression); !strings.HasSuffix(filter, test.wantFilter) {
+				t.Errorf("FilterExpression = %q, want it to end %q", filter, test.wantFilter)
+			}
+			if projection := aws.ToString(input.ProjectionExpression); projection != test.wantProjection {
+				t.Errorf("ProjectionExpression = %q, want %q", projection, test.wantProjection)
+			}
+			for name, field := range test.wantNames {
+				if input.ExpressionAttributeNames[name] != field {
+					t.Errorf("ExpressionAttributeNames[%s] = %q, want %q", name, input.ExpressionAttributeNames[name], field)
+				}
+			}
+		})
+	}
+
+	if _, err := BuildQueryFromSpec(QuerySpec{ProjectId: "sensors", Order: "up"}); err == nil {
+		t.Error("BuildQueryFromSpec() of an invalid spec succeeded")
+	}
+}
@@ -0,0 +1,158 @@
+package utils
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// Stats summarizes the values of a numeric field. The summary values are null when
+// no item has the field.
+type Stats struct {
+	Count       int                `json:"count"`
+	Min         *float64           `json:"min"`
+	Max         *float64           `json:"max"`
+	Avg         *float64           `json:"avg"`
+	Percentiles map[string]float64 `json:"percentiles,omitempty"`
+}
+
+// numericValues collects the field's values, skipping items where it is missing or not a number.
+func numericValues(items []map[string]types.AttributeValue, field string) []float64 {
+	values := make([]float64, 0, len(items))
+	for _, item := range items {
+		if value, ok := NumberAttribute(item, field); ok {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// ComputeStats finds the count, minimum, maximum, and average of a numeric field,
+// along with the requested percentiles.
+func ComputeStats(
+	items []map[string]types.AttributeValue,
+	field string,
+	percentiles []float64,
+) Stats {
+	return summarize(numericValues(items, field), percentiles)
+}
+
+// ComputeFieldStats summarizes each of several numeric fields like ComputeStats, in a single pass
+// over the items, keyed by field name. Each field's summary skips the items where it is missing
+// or not a number.
+func ComputeFieldStats(
+	items []map[string]types.AttributeValue,
+	fields []string,
+	percentiles []float64,
+) map[string]Stats {
+	values := make(map[string][]float64, len(fields))
+	for _, item := range items {
+		for _, field := range fields {
+			if value, ok := NumberAttribute(item, field); ok {
+				values[field] = append(values[field], value)
+			}
+		}
+	}
+	stats := make(map[string]Stats, len(fields))
+	for _, field := range fields {
+		stats[field] = summarize(values[field], percentiles)
+	}
+	return stats
+}
+
+// summarize finds the count, minimum, maximum, and average of the values,
+// along with the requested percentiles.
+func summarize(values []float64, percentiles []float64) Stats {
+	stats := Stats{Count: len(values)}
+	if len(values) == 0 {
+		return stats
+	}
+
+	min, max, sum := math.Inf(1), math.Inf(-1), 0.0
+	for _, value := range values {
+		min = math.Min(min, value)
+		max = math.Max(max, value)
+		sum += value
+	}
+	avg := sum / float64(len(values))
+	stats.Min, stats.Max, stats.Avg = &min, &max, &avg
+
+	if len(percentiles) > 0 {
+		stats.Percentiles = percentilesOf(values, percentiles)
+	}
+	return stats
+}
+
+// ComputePercentiles finds the requested percentiles of a numeric field, keyed like "p95".
+// Missing and non-numeric values are skipped, and the result is empty when none remain.
+func ComputePercentiles(
+	items []map[string]types.AttributeValue,
+	field string,
+	percentiles []float64,
+) map[string]float64 {
+	values := numericValues(items, field)
+	if len(values) == 0 {
+		return map[string]float64{}
+	}
+	return percentilesOf(values, percentiles)
+}
+
+// percentilesOf sorts the values and interpolates linearly between the closest ranks,
+// so that even a handful of data points gives a sensible answer for any percentile.
+func percentilesOf(values []float64, percentiles []float64) map[string]float64 {
+	sorted := append([]float64{}, values...)
+	sort.Float64s(sorted)
+
+	result := make(map[string]float64, len(percentiles))
+	for _, percentile := range percentiles {
+		rank := percentile / 100 * float64(len(sorted)-1)
+		lower := int(math.Floor(rank))
+		upper := int(math.Ceil(rank))
+		value := sorted[lower] + (sorted[upper]-sorted[lower])*(rank-float64(lower))
+		result["p"+strconv.FormatFloat(percentile, 'f', -1, 64)] = value
+	}
+	return result
+}
+
+// ParsePercentiles parses a comma-separated list of percentiles between 0 and 100.
+func ParsePercentiles(list string) ([]float64, error) {
+	var percentiles []float64
+	for _, entry := range splitList(list) {
+		percentile, err := strconv.ParseFloat(entry, 64)
+		if err != nil || percentile < 0 || percentile > 100 {
+			return nil, fmt.Errorf("percentiles must be numbers between 0 and 100, got %q", entry)
+		}
+		percentiles = append(percentiles, percentile)
+	}
+	return percentiles, nil
+}
+
+// ExtremeBy returns the item with the largest value of a numeric field, or the smallest when max
+// is false, skipping items where the field is missing or not a number. Ties go to the latest
+// reading, as with single item queries. It reports false when no item has the field.
+func ExtremeBy(
+	items []map[string]types.AttributeValue,
+	field string,
+	max bool,
+) (map[string]types.AttributeValue, bool) {
+	var extreme map[string]types.AttributeValue
+	var extremeValue, extremeTime float64
+	for _, item := range items {
+		value, ok := NumberAttribute(item, field)
+		if !ok {
+			continue
+		}
+		epochTime, _ := NumberAttribute(item, "EpochTime")
+		better := extreme == nil ||
+			(max && value > extremeValue) ||
+			(!max && value < extremeValue) ||
+			(value == extremeValue && epochTime > extremeTime)
+		if better {
+			extreme, extremeValue, extremeTime = item, value, epochTime
+		}
+	}
+	return extreme, extreme != nil
+}
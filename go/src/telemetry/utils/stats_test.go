@@ -0,0 +1,188 @@
+package utils
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// temperatures returns items with the given Temperature values.
+func temperatures(values ...string) []map[string]types.AttributeValue {
+	items := make([]map[string]types.AttributeValue, len(values))
+	for i, value := range values {
+		items[i] = map[string]types.AttributeValue{"Temperature": numberAttr(value)}
+	}
+	return items
+}
+
+func TestComputeStats(t *testing.T) {
+	tests := []struct {
+		name        string
+		items       []map[string]types.AttributeValue
+		percentiles []float64
+		want        Stats
+	}{
+		{
+			name: "no items",
+			want: Stats{},
+		},
+		{
+			name:  "summary",
+			items: temperatures("1", "4", "2", "3"),
+			want:  Stats{Count: 4, Min: float(1), Max: float(4), Avg: float(2.5)},
+		},
+		{
+			name:        "interpolated percentiles",
+			items:       temperatures("1", "4", "2", "3"),
+			percentiles: []float64{0, 50, 100, 12.5},
+			want: Stats{
+				Count: 4, Min: float(1), Max: float(4), Avg: float(2.5),
+				Percentiles: map[string]float64{"p0": 1, "p50": 2.5, "p100": 4, "p12.5": 1.375},
+			},
+		},
+		{
+			name: "missing and non-numeric values skipped",
+			items: append(temperatures("10"),
+				map[string]types.AttributeValue{"Humidity": numberAttr("50")},
+				map[string]types.AttributeValue{"Temperature": stringAttr("hot")},
+			),
+			percentiles: []float64{50},
+			want: Stats{
+				Count: 1, Min: float(10), Max: float(10), Avg: float(10),
+				Percentiles: map[string]float64{"p50": 10},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := ComputeStats(test.items, "Temperature", test.percentiles); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("ComputeStats() = %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestComputePercentiles(t *testing.T) {
+	tests := []struct {
+		name  string
+		items []map[string]types.AttributeValue
+		want  map[string]float64
+	}{
+		{name: "no values", want: map[string]float64{}},
+		{name: "one value", items: temperatures("7"), want: map[string]float64{"p25": 7, "p90": 7}},
+		{name: "interpolated", items: temperatures("0", "10"), want: map[string]float64{"p25": 2.5, "p90": 9}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := ComputePercentiles(test.items, "Temperature", []float64{25, 90})
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("ComputePercentiles() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestParsePercentiles(t *testing.T) {
+	tests := []struct {
+		list    string
+		want    []float64
+		wantErr bool
+	}{
+		{list: "50", want: []float64{50}},
+		{list: " 0, 99.9 ,100", want: []float64{0, 99.9, 100}},
+		{list: "101", wantErr: true},
+		{list: "-1", wantErr: true},
+		{list: "median", wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.list, func(t *testing.T) {
+			got, err := ParsePercentiles(test.list)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("ParsePercentiles() error = %v, wantErr %v", err, test.wantErr)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("ParsePercentiles() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestExtremeBy(t *testing.T) {
+	reading := func(epochTime, temperature string) map[string]types.AttributeValue {
+		return map[string]types.AttributeValue{"EpochTime": numberAttr(epochTime), "Temperature": numberAttr(temperature)}
+	}
+	tests := []struct {
+		name      string
+		items     []map[string]types.AttributeValue
+		max       bool
+		wantTime  string
+		wantFound bool
+	}{
+		{name: "no items", max: true},
+		{
+			name:      "maximum",
+			items:     []map[string]types.AttributeValue{reading("1", "20"), reading("2", "25"), reading("3", "21")},
+			max:       true,
+			wantTime:  "2",
+			wantFound: true,
+		},
+		{
+			name:      "minimum",
+			items:     []map[string]types.AttributeValue{reading("1", "20"), reading("2", "25"), reading("3", "-4")},
+			wantTime:  "3",
+			wantFound: true,
+		},
+		{
+			name:      "ties go to the latest reading",
+			items:     []map[string]types.AttributeValue{reading("3", "25"), reading("1", "25"), reading("2", "20")},
+			max:       true,
+			wantTime:  "3",
+			wantFound: true,
+		},
+		{
+			name: "missing and non-numeric values skipped",
+			items: []map[string]types.AttributeValue{
+				{"EpochTime": numberAttr("1"), "Temperature": stringAttr("hot")},
+				{"EpochTime": numberAttr("2")},
+				reading("3", "18"),
+			},
+			max:       true,
+			wantTime:  "3",
+			wantFound: true,
+		},
+		{
+			name:  "no item has the field",
+			items: []map[string]types.AttributeValue{{"EpochTime": numberAttr("1")}},
+			max:   true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, found := ExtremeBy(test.items, "Temperature", test.max)
+			if found != test.wantFound {
+				t.Fatalf("ExtremeBy() found = %v, want %v", found, test.wantFound)
+			}
+			if found && epochTimes([]map[string]types.AttributeValue{got})[0] != test.wantTime {
+				t.Errorf("ExtremeBy() = %v, want the reading at %s", got, test.wantTime)
+			}
+		})
+	}
+}
+
+func TestComputeFieldStats(t *testing.T) {
+	items := []map[string]types.AttributeValue{
+		{"Temperature": numberAttr("20"), "Humidity": numberAttr("40")},
+		{"Temperature": numberAttr("22")},
+		{"Humidity": stringAttr("damp")},
+	}
+	want := map[string]Stats{
+		"Temperature": {Count: 2, Min: float(20), Max: float(22), Avg: float(21), Percentiles: map[string]float64{"p50": 21}},
+		"Humidity":    {Count: 1, Min: float(40), Max: float(40), Avg: float(40), Percentiles: map[string]float64{"p50": 40}},
+		"Pressure":    {},
+	}
+	got := ComputeFieldStats(items, []string{"Temperature", "Humidity", "Pressure"}, []float64{50})
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ComputeFieldStats() = %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,47 @@
+package utils
+
+import (
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// StreamImageToAttributeValues converts an item image from a DynamoDB stream record
+// into the AttributeValues the DynamoDB client works with.
+func StreamImageToAttributeValues(
+	image map[string]events.DynamoDBAttributeValue,
+) map[string]types.AttributeValue {
+	item := make(map[string]types.AttributeValue, len(image))
+	for name, value := range image {
+		item[name] = streamAttributeValue(value)
+	}
+	return item
+}
+
+func streamAttributeValue(value events.DynamoDBAttributeValue) types.AttributeValue {
+	switch value.DataType() {
+	case events.DataTypeString:
+		return &types.AttributeValueMemberS{Value: value.String()}
+	case events.DataTypeNumber:
+		return &types.AttributeValueMemberN{Value: value.Number()}
+	case events.DataTypeBoolean:
+		return &types.AttributeValueMemberBOOL{Value: value.Boolean()}
+	case events.DataTypeBinary:
+		return &types.AttributeValueMemberB{Value: value.Binary()}
+	case events.DataTypeStringSet:
+		return &types.AttributeValueMemberSS{Value: value.StringSet()}
+	case events.DataTypeNumberSet:
+		return &types.AttributeValueMemberNS{Value: value.NumberSet()}
+	case events.DataTypeBinarySet:
+		return &types.AttributeValueMemberBS{Value: value.BinarySet()}
+	case events.DataTypeList:
+		list := make([]types.AttributeValue, 0, len(value.List()))
+		for _, child := range value.List() {
+			list = append(list, streamAttributeValue(child))
+		}
+		return &types.AttributeValueMemberL{Value: list}
+	case events.DataTypeMap:
+		return &types.AttributeValueMemberM{Value: StreamImageToAttributeValues(value.Map())}
+	default:
+		return &types.AttributeValueMemberNULL{Value: true}
+	}
+}
@@ -0,0 +1,39 @@
+package utils
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+func TestStreamImageToAttributeValues(t *testing.T) {
+	image := map[string]events.DynamoDBAttributeValue{
+		"DeviceId":  events.NewStringAttribute("d1"),
+		"EpochTime": events.NewNumberAttribute("1600000000"),
+		"Charging":  events.NewBooleanAttribute(true),
+		"Tags":      events.NewStringSetAttribute([]string{"a"}),
+		"Readings":  events.NewNumberSetAttribute([]string{"1"}),
+		"Error":     events.NewNullAttribute(),
+		"Samples":   events.NewListAttribute([]events.DynamoDBAttributeValue{events.NewNumberAttribute("2")}),
+		"Config": events.NewMapAttribute(map[string]events.DynamoDBAttributeValue{
+			"gain": events.NewNumberAttribute("3"),
+		}),
+	}
+	want := map[string]types.AttributeValue{
+		"DeviceId":  stringAttr("d1"),
+		"EpochTime": numberAttr("1600000000"),
+		"Charging":  &types.AttributeValueMemberBOOL{Value: true},
+		"Tags":      &types.AttributeValueMemberSS{Value: []string{"a"}},
+		"Readings":  &types.AttributeValueMemberNS{Value: []string{"1"}},
+		"Error":     &types.AttributeValueMemberNULL{Value: true},
+		"Samples":   &types.AttributeValueMemberL{Value: []types.AttributeValue{numberAttr("2")}},
+		"Config": &types.AttributeValueMemberM{Value: map[string]types.AttributeValue{
+			"gain": numberAttr("3"),
+		}},
+	}
+	if got := StreamImageToAttributeValues(image); !reflect.DeepEqual(got, want) {
+		t.Errorf("StreamImageToAttributeValues() = %v, want %v", got, want)
+	}
+}
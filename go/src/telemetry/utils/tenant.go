@@ -0,0 +1,66 @@
+package utils
+
+import (
+	"errors"
+	"os"
+	"strings"
+)
+
+// ErrTenantRequired is returned for a request without a tenant while tenants are isolated.
+var ErrTenantRequired = errors.New("request has no tenant")
+
+// TenantIsolation reports whether readings are partitioned by tenant, as set by TENANT_ISOLATION.
+// The tenant comes from the authorizer context, and prefixes every partition key a request
+// reads or writes, as in Tenant#Project#Device, so that one tenant can never address
+// another tenant's partitions. Project-wide queries, whose index is keyed on ProjectId alone,
+// are filtered on the TenantId attribute instead.
+func TenantIsolation() bool {
+	isolated, _ := ParseBoolParam(os.Getenv("TENANT_ISOLATION"))
+	return isolated
+}
+
+// ProjectTenant returns the tenant that owns a project, from the PROJECT_TENANTS environment
+// variable, a JSON object mapping each ProjectId to its TenantId, e.g. {"sensors":"acme"}.
+// Like per-project environment variables, the ProjectId is matched regardless of case
+// while ProjectIds are normalized.
+func ProjectTenant(project string) string {
+	var tenants map[string]string
+	envJSON("PROJECT_TENANTS", &tenants)
+	keys := make([]string, 0, len(tenants))
+	for key := range tenants {
+		keys = append(keys, key)
+	}
+	if key, ok := projectKey(keys, project); ok {
+		return tenants[key]
+	}
+	return ""
+}
+
+// tenantFromAuthorizer returns the tenant the authorizer recorded in the 'tenantId' context key,
+// which is required while tenants are isolated, and otherwise ignored.
+func tenantFromAuthorizer(authorizer map[string]interface{}) (string, error) {
+	if !TenantIsolation() {
+		return "", nil
+	}
+	tenant, _ := authorizer["tenantId"].(string)
+	if tenant == "" || strings.Contains(tenant, "#") {
+		return "", ErrTenantRequired
+	}
+	return tenant, nil
+}
+
+// PartitionKey builds the composite partition key of a project's device or location,
+// prefixed by the tenant when there is one. Every key of a reading is built here.
+func PartitionKey(tenant string, project string, id string) string {
+	if tenant != "" {
+		return CompositeKey(tenant, NormalizeProjectId(project), id)
+	}
+	return CompositeKey(NormalizeProjectId(project), id)
+}
+
+// bookkeepingKey builds the partition key of an item the service keeps alongside readings,
+// such as a device's status, from a kind prefix that no reading's key can have and the
+// tenant-aware PartitionKey, so that tenants' bookkeeping is kept apart like their readings.
+func bookkeepingKey(kind string, tenant string, project string, id string) string {
+	return CompositeKey(kind, PartitionKey(tenant, project, id))
+}
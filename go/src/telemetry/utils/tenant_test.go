@@ -0,0 +1,133 @@
+package utils
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+func TestProjectTenant(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		project string
+		want    string
+	}{
+		{name: "unset", project: "sensors"},
+		{name: "owned", value: `{"sensors": "acme"}`, project: "sensors", want: "acme"},
+		{name: "unowned", value: `{"sensors": "acme"}`, project: "dogs"},
+		{name: "mixed case", value: `{"Sensors": "acme"}`, project: "sensors", want: "acme"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Setenv("NORMALIZE_PROJECT_ID", "true")
+			t.Setenv("PROJECT_TENANTS", test.value)
+			if got := ProjectTenant(test.project); got != test.want {
+				t.Errorf("ProjectTenant() = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestTenantFromAuthorizer(t *testing.T) {
+	tests := []struct {
+		name       string
+		isolation  string
+		authorizer map[string]interface{}
+		want       string
+		wantErr    bool
+	}{
+		{name: "not isolated", authorizer: map[string]interface{}{"tenantId": "acme"}},
+		{name: "tenant", isolation: "true", authorizer: map[string]interface{}{"tenantId": "acme"}, want: "acme"},
+		{name: "no tenant", isolation: "true", authorizer: map[string]interface{}{"projectId": "sensors"}, wantErr: true},
+		{name: "no authorizer", isolation: "true", wantErr: true},
+		{name: "'#' in the tenant", isolation: "true", authorizer: map[string]interface{}{"tenantId": "a#b"}, wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Setenv("TENANT_ISOLATION", test.isolation)
+			got, err := tenantFromAuthorizer(test.authorizer)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("tenantFromAuthorizer() error = %v, wantErr %v", err, test.wantErr)
+			}
+			if got != test.want {
+				t.Errorf("tenantFromAuthorizer() = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestPartitionKey(t *testing.T) {
+	tests := []struct {
+		name   string
+		tenant string
+		want   string
+	}{
+		{name: "no tenant", want: "sensors#d1"},
+		{name: "tenant", tenant: "acme", want: "acme#sensors#d1"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := PartitionKey(test.tenant, "sensors", "d1"); got != test.want {
+				t.Errorf("PartitionKey() = %q, want %q", got, test.want)
+			}
+			if got := bookkeepingKey("status", test.tenant, "sensors", "d1"); got != "status#"+test.want {
+				t.Errorf("bookkeepingKey() = %q, want status#%s", got, test.want)
+			}
+		})
+	}
+}
+
+func TestTenantRequired(t *testing.T) {
+	t.Setenv("TENANT_ISOLATION", "true")
+	if _, err := BuildQueryInput(QueryParams{ProjectId: "sensors", DeviceId: "d1"}); !errors.Is(err, ErrTenantRequired) {
+		t.Errorf("BuildQueryInput() error = %v, want %v", err, ErrTenantRequired)
+	}
+
+	tests := []struct {
+		name       string
+		authorizer map[string]interface{}
+		project    string
+		wantStatus int
+		wantTenant string
+	}{
+		{name: "tenant", authorizer: map[string]interface{}{"tenantId": "acme"}, wantStatus: 200, wantTenant: "acme"},
+		{name: "no tenant", authorizer: map[string]interface{}{"projectId": "sensors"}, project: "sensors", wantStatus: 403},
+		{
+			name:       "admin with the project's tenant",
+			authorizer: map[string]interface{}{"projectId": "*", "tenantId": "acme"},
+			project:    "sensors",
+			wantStatus: 200,
+			wantTenant: "acme",
+		},
+		{name: "admin without a tenant", authorizer: map[string]interface{}{"projectId": "*"}, project: "sensors", wantStatus: 403},
+		{name: "admin across projects", authorizer: map[string]interface{}{"projectId": "*"}, wantStatus: 200},
+		{name: "no tenant across projects", authorizer: map[string]interface{}{"projectId": "sensors"}, wantStatus: 403},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var served *Request
+			request := &Request{Authorizer: test.authorizer}
+			if test.project != "" {
+				request.PathParameters = map[string]string{"ProjectId": test.project}
+			}
+			response, err := serve(func(request *Request) (events.APIGatewayProxyResponse, error) {
+				served = request
+				return events.APIGatewayProxyResponse{StatusCode: 200}, nil
+			}, request)
+			if err != nil || response.StatusCode != test.wantStatus {
+				t.Fatalf("serve() = %d, %v, want %d", response.StatusCode, err, test.wantStatus)
+			}
+			if test.wantStatus != 200 {
+				if served != nil {
+					t.Error("handler served a request without a tenant")
+				}
+				return
+			}
+			if served == nil || served.TenantId != test.wantTenant {
+				t.Errorf("handler served %+v, want tenant %q", served, test.wantTenant)
+			}
+		})
+	}
+}
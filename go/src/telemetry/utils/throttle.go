@@ -0,0 +1,81 @@
+package utils
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/smithy-go"
+)
+
+// IsThrottled reports whether DynamoDB rejected a request for exceeding the table's
+// provisioned throughput or the account's request limits.
+func IsThrottled(err error) bool {
+	var throughputExceeded *types.ProvisionedThroughputExceededException
+	var requestLimitExceeded *types.RequestLimitExceeded
+	if errors.As(err, &throughputExceeded) || errors.As(err, &requestLimitExceeded) {
+		return true
+	}
+	var apiErr smithy.APIError
+	return errors.As(err, &apiErr) && apiErr.ErrorCode() == "ThrottlingException"
+}
+
+// ThrottleRetryAfter is the number of seconds clients are asked to wait after DynamoDB throttles
+// their request, from the THROTTLE_RETRY_AFTER_SECONDS environment variable, 2 by default.
+func ThrottleRetryAfter() int {
+	if seconds := envInt("THROTTLE_RETRY_AFTER_SECONDS", 2); seconds > 0 {
+		return seconds
+	}
+	return 2
+}
+
+// BackfillRetryAfter is the number of seconds clients are asked to wait while an index is
+// backfilling, from the BACKFILL_RETRY_AFTER_SECONDS environment variable, 60 by default.
+func BackfillRetryAfter() int {
+	if seconds := envInt("BACKFILL_RETRY_AFTER_SECONDS", 60); seconds > 0 {
+		return seconds
+	}
+	return 60
+}
+
+// RateLimitRetryAfter is the number of seconds until the current rate limit window ends,
+// and the device's count starts over.
+func RateLimitRetryAfter() int {
+	now := Now()
+	remaining := now.Truncate(time.Minute).Add(time.Minute).Sub(now)
+	return int(math.Ceil(remaining.Seconds()))
+}
+
+// StorageErrorResponse responds to a failed DynamoDB request. Throttled requests, and queries
+// on an index that is still backfilling, get a 503 asking the client to retry later,
+// queries that ran past their QueryTimeout a 504, and anything else a 500 with the given message.
+func StorageErrorResponse(err error, message string) (events.APIGatewayProxyResponse, error) {
+	if errors.Is(err, ErrQueryTimeout) {
+		return GatewayTimeoutResponse("Query timed out, narrow the time range or retry later")
+	}
+	if IsThrottled(err) {
+		return ServiceUnavailableResponse("Request was throttled, retry later", ThrottleRetryAfter())
+	}
+	if IsIndexBackfilling(err) {
+		return ServiceUnavailableResponse("Index is still being built, retry later", BackfillRetryAfter())
+	}
+	return InternalErrorResponse(message)
+}
+
+// retryAfterResponse builds an error response with a Retry-After header, in seconds,
+// alongside the CORS headers every response has. Browsers only let scripts read the header
+// once it is exposed.
+func retryAfterResponse(
+	status int,
+	code string,
+	message string,
+	seconds int,
+) (events.APIGatewayProxyResponse, error) {
+	response, err := ErrorResponse(status, code, message)
+	response.Headers["Retry-After"] = strconv.Itoa(seconds)
+	response.Headers["Access-Control-Expose-Headers"] = "Retry-After"
+	return response, err
+}
@@ -0,0 +1,126 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/smithy-go"
+)
+
+func TestIsThrottled(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "no error"},
+		{name: "other error", err: errors.New("failed")},
+		{name: "throughput exceeded", err: &types.ProvisionedThroughputExceededException{}, want: true},
+		{name: "request limit exceeded", err: &types.RequestLimitExceeded{}, want: true},
+		{name: "throttling", err: &smithy.GenericAPIError{Code: "ThrottlingException"}, want: true},
+		{name: "other API error", err: &smithy.GenericAPIError{Code: "ValidationException"}},
+		{
+			name: "wrapped",
+			err:  fmt.Errorf("failed to query table, %w", &types.ProvisionedThroughputExceededException{}),
+			want: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := IsThrottled(test.err); got != test.want {
+				t.Errorf("IsThrottled() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestThrottleRetryAfter(t *testing.T) {
+	tests := []struct {
+		value string
+		want  int
+	}{
+		{value: "", want: 2},
+		{value: "5", want: 5},
+		{value: "0", want: 2},
+		{value: "-1", want: 2},
+	}
+	for _, test := range tests {
+		t.Run(test.value, func(t *testing.T) {
+			t.Setenv("THROTTLE_RETRY_AFTER_SECONDS", test.value)
+			if got := ThrottleRetryAfter(); got != test.want {
+				t.Errorf("ThrottleRetryAfter() = %d, want %d", got, test.want)
+			}
+		})
+	}
+}
+
+func TestBackfillRetryAfter(t *testing.T) {
+	tests := []struct {
+		value string
+		want  int
+	}{
+		{value: "", want: 60},
+		{value: "300", want: 300},
+		{value: "0", want: 60},
+	}
+	for _, test := range tests {
+		t.Run(test.value, func(t *testing.T) {
+			t.Setenv("BACKFILL_RETRY_AFTER_SECONDS", test.value)
+			if got := BackfillRetryAfter(); got != test.want {
+				t.Errorf("BackfillRetryAfter() = %d, want %d", got, test.want)
+			}
+		})
+	}
+}
+
+func TestRateLimitRetryAfter(t *testing.T) {
+	// testNow is 40 seconds into its minute.
+	stopClock(t)
+	if got := RateLimitRetryAfter(); got != 20 {
+		t.Errorf("RateLimitRetryAfter() = %d, want 20", got)
+	}
+}
+
+func TestStorageErrorResponse(t *testing.T) {
+	tests := []struct {
+		name           string
+		err            error
+		wantStatus     int
+		wantRetryAfter string
+	}{
+		{name: "failed", err: errors.New("failed"), wantStatus: 500},
+		{name: "throttled", err: &types.ProvisionedThroughputExceededException{}, wantStatus: 503, wantRetryAfter: "2"},
+		{name: "timed out", err: fmt.Errorf("failed to query table, %w", ErrQueryTimeout), wantStatus: 504},
+		{
+			name:           "index backfilling",
+			err:            &smithy.GenericAPIError{Code: "ValidationException", Message: "Cannot read from backfilling global secondary index"},
+			wantStatus:     503,
+			wantRetryAfter: "60",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			response, err := StorageErrorResponse(test.err, "Failed to query table")
+			if err != nil {
+				t.Fatalf("StorageErrorResponse() error = %v", err)
+			}
+			if response.StatusCode != test.wantStatus {
+				t.Errorf("status = %d, want %d", response.StatusCode, test.wantStatus)
+			}
+			if retryAfter := response.Headers["Retry-After"]; retryAfter != test.wantRetryAfter {
+				t.Errorf("Retry-After = %q, want %q", retryAfter, test.wantRetryAfter)
+			}
+		})
+	}
+}
+
+func TestTooManyRequestsResponse(t *testing.T) {
+	response, _ := TooManyRequestsResponse("Device has exceeded its rate limit", 20)
+	if response.StatusCode != 429 || response.Headers["Retry-After"] != "20" ||
+		response.Headers["Access-Control-Expose-Headers"] != "Retry-After" {
+		t.Errorf("TooManyRequestsResponse() = %d %v, want 429 with an exposed Retry-After",
+			response.StatusCode, response.Headers)
+	}
+}
@@ -0,0 +1,35 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrQueryTimeout is returned when a query runs past its QueryTimeout,
+// along with whatever items it retrieved before then.
+var ErrQueryTimeout = errors.New("query timed out")
+
+// QueryTimeout is how long a single query may run, from the QUERY_TIMEOUT_SECONDS environment
+// variable, 8 by default. It is kept well under the Lambda timeout, so that a slow query still
+// leaves time to respond and flush metrics. Zero or less lets queries run until the Lambda deadline.
+func QueryTimeout() time.Duration {
+	return time.Duration(envInt("QUERY_TIMEOUT_SECONDS", 8)) * time.Second
+}
+
+// withQueryTimeout bounds the context by the QueryTimeout, when there is one.
+func withQueryTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if timeout := QueryTimeout(); timeout > 0 {
+		return context.WithTimeout(ctx, timeout)
+	}
+	return context.WithCancel(ctx)
+}
+
+// queryTimeoutError reports a failed query as ErrQueryTimeout when its context's deadline passed.
+func queryTimeoutError(ctx context.Context, err error) error {
+	if err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("%w after %s", ErrQueryTimeout, QueryTimeout())
+	}
+	return err
+}
@@ -0,0 +1,174 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// stalledTable answers its first query with a page of readings that has more to come,
+// and holds every later query until its context is done.
+type stalledTable struct {
+	queries int
+}
+
+func (table *stalledTable) Query(
+	ctx context.Context,
+	params *dynamodb.QueryInput,
+	optFns ...func(*dynamodb.Options),
+) (*dynamodb.QueryOutput, error) {
+	table.queries++
+	if table.queries == 1 {
+		return &dynamodb.QueryOutput{
+			Items:            readingsAt("1", "2"),
+			Count:            2,
+			ScannedCount:     2,
+			LastEvaluatedKey: map[string]types.AttributeValue{"EpochTime": numberAttr("2")},
+		}, nil
+	}
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func TestQueryTimeout(t *testing.T) {
+	tests := []struct {
+		value string
+		want  time.Duration
+	}{
+		{value: "", want: 8 * time.Second},
+		{value: "3", want: 3 * time.Second},
+		{value: "0", want: 0},
+	}
+	for _, test := range tests {
+		t.Run(test.value, func(t *testing.T) {
+			t.Setenv("QUERY_TIMEOUT_SECONDS", test.value)
+			if got := QueryTimeout(); got != test.want {
+				t.Errorf("QueryTimeout() = %v, want %v", got, test.want)
+			}
+			ctx, cancel := withQueryTimeout(context.Background())
+			defer cancel()
+			if _, bounded := ctx.Deadline(); bounded != (test.want > 0) {
+				t.Errorf("withQueryTimeout() bounded %v, want %v", bounded, test.want > 0)
+			}
+		})
+	}
+}
+
+func TestQueryTimeoutError(t *testing.T) {
+	failed := errors.New("failed")
+	expired, cancel := context.WithDeadline(context.Background(), time.Unix(0, 0))
+	defer cancel()
+	tests := []struct {
+		name        string
+		ctx         context.Context
+		err         error
+		wantTimeout bool
+		wantErr     error
+	}{
+		{name: "no error", ctx: expired},
+		{name: "failed in time", ctx: context.Background(), err: failed, wantErr: failed},
+		{name: "failed past the deadline", ctx: expired, err: context.DeadlineExceeded, wantTimeout: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := queryTimeoutError(test.ctx, test.err)
+			if errors.Is(err, ErrQueryTimeout) != test.wantTimeout {
+				t.Errorf("queryTimeoutError() = %v, want timeout %v", err, test.wantTimeout)
+			}
+			if !test.wantTimeout && err != test.wantErr {
+				t.Errorf("queryTimeoutError() = %v, want %v", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestGetDataWithinBudgetTimeout(t *testing.T) {
+	captureMetrics(t)
+	t.Setenv("QUERY_TIMEOUT_SECONDS", "1")
+
+	items, stats, err := GetDataWithinBudget(context.Background(), &stalledTable{}, CreateQueryInput("ProjectId", "sensors"), 0, 0)
+	if !errors.Is(err, ErrQueryTimeout) {
+		t.Fatalf("GetDataWithinBudget() error = %v, want ErrQueryTimeout", err)
+	}
+	if !stats.TimedOut {
+		t.Errorf("TimedOut = false, want the timeout noted")
+	}
+	if len(items) != 2 {
+		t.Errorf("GetDataWithinBudget() = %v, want the first page's items", epochTimes(items))
+	}
+}
+
+func TestQueryResponseTimeout(t *testing.T) {
+	tests := []struct {
+		name       string
+		query      map[string]string
+		params     QueryParams
+		wantHeader map[string]string
+		wantBody   []string
+		avoidBody  []string
+	}{
+		{
+			name:   "items retrieved in time",
+			params: QueryParams{ProjectId: "sensors", DeviceId: "d1"},
+			// Partial results must not be cached.
+			wantHeader: map[string]string{"Cache-Control": "no-cache"},
+			wantBody:   []string{`"timedOut":true`, `"count":2`},
+		},
+		{
+			name:      "stats of some items",
+			query:     map[string]string{"stats": "Temperature"},
+			params:    QueryParams{ProjectId: "sensors", DeviceId: "d1"},
+			wantBody:  []string{"QUERY_TIMEOUT"},
+			avoidBody: []string{"items"},
+		},
+		{
+			name:     "paginated",
+			params:   QueryParams{ProjectId: "sensors", DeviceId: "d1", Paginate: true},
+			wantBody: []string{"QUERY_TIMEOUT"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			captureMetrics(t)
+			t.Setenv("QUERY_TIMEOUT_SECONDS", "1")
+			table := &stalledTable{}
+			// A page of its own is held from the start.
+			if test.params.Paginate {
+				table.queries = 1
+			}
+			request := &Request{
+				Method:                "GET",
+				PathParameters:        map[string]string{"ProjectId": "sensors"},
+				QueryStringParameters: test.query,
+			}
+
+			response, err := QueryResponse(context.Background(), table, request, test.params)
+			if err != nil {
+				t.Fatalf("QueryResponse() error = %v", err)
+			}
+			if response.StatusCode != 504 {
+				t.Fatalf("status = %d, want 504, body %s", response.StatusCode, response.Body)
+			}
+			for name, want := range test.wantHeader {
+				if got := response.Headers[name]; got != want {
+					t.Errorf("header %s = %q, want %q", name, got, want)
+				}
+			}
+			for _, want := range test.wantBody {
+				if !strings.Contains(response.Body, want) {
+					t.Errorf("body = %s, want %s in it", response.Body, want)
+				}
+			}
+			for _, avoid := range test.avoidBody {
+				if strings.Contains(response.Body, avoid) {
+					t.Errorf("body = %s, want no %s in it", response.Body, avoid)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,53 @@
+package utils
+
+import (
+	"fmt"
+)
+
+// ApplyDefaultWindow gives a query with no time bounds a lower bound of the current time minus
+// the DEFAULT_WINDOW_SECONDS environment variable, so that naive clients get recent readings
+// rather than the full history. When the variable is unset, unbounded queries are left alone.
+// Single item queries are also left alone, since their latest item may be older than the window,
+// as are queries bounded by SequenceNum, which can't also have time bounds.
+func ApplyDefaultWindow(params *QueryParams) {
+	window := envInt("DEFAULT_WINDOW_SECONDS", 0)
+	if window <= 0 || params.Single || params.sequenceRange() ||
+		params.Start != nil || params.End != nil || params.After != nil {
+		return
+	}
+	start := float64(Now().Unix() - int64(window))
+	params.Start = &start
+}
+
+// ClampTimeRange guards against accidental full-history pulls. When the
+// MAX_QUERY_SPAN_SECONDS environment variable is set, a query with no lower bound
+// or a span longer than the maximum has its lower bound moved to the end minus the span,
+// where the end defaults to the current time of the configured Clock. Unclamped queries skip
+// the guard, for administrative use, as do single item queries, which read only one item and
+// would otherwise have their bounds, and so the item they select, changed, and queries bounded
+// by SequenceNum, whose range limits them instead.
+// The returned note describes the adjusted bound, or is empty when nothing changed.
+func ClampTimeRange(params *QueryParams) string {
+	maxSpan := envInt("MAX_QUERY_SPAN_SECONDS", 0)
+	if maxSpan <= 0 || params.Unclamped || params.Single || params.sequenceRange() {
+		return ""
+	}
+
+	end := float64(Now().Unix())
+	if params.End != nil {
+		end = *params.End
+	}
+	earliest := end - float64(maxSpan)
+
+	// A polling 'after' cursor is the lower bound when present.
+	lower, lowerName := &params.Start, "start"
+	if params.After != nil {
+		lower, lowerName = &params.After, "after"
+	}
+	if *lower != nil && **lower >= earliest {
+		return ""
+	}
+
+	*lower = &earliest
+	return fmt.Sprintf("%s=%s", lowerName, formatNumber(earliest))
+}
@@ -0,0 +1,120 @@
+package utils
+
+import (
+	"testing"
+	"time"
+)
+
+// testNow is the instant tests stop the clock at.
+var testNow = time.Unix(1600000000, 0)
+
+// stopClock stops the clock at testNow until the test finishes.
+func stopClock(t *testing.T) {
+	t.Helper()
+	SetClock(FixedClock(testNow))
+	t.Cleanup(func() { SetClock(SystemClock{}) })
+}
+
+func float(value float64) *float64 {
+	return &value
+}
+
+// bound formats an optional bound for test failures.
+func bound(value *float64) string {
+	if value == nil {
+		return "nil"
+	}
+	return formatNumber(*value)
+}
+
+func TestApplyDefaultWindow(t *testing.T) {
+	seq := int64(1)
+	tests := []struct {
+		name      string
+		window    string
+		params    QueryParams
+		wantStart *float64
+	}{
+		{name: "unset", params: QueryParams{}},
+		{name: "unbounded", window: "3600", params: QueryParams{}, wantStart: float(1600000000 - 3600)},
+		{name: "bounded", window: "3600", params: QueryParams{End: float(5)}},
+		{name: "polling", window: "3600", params: QueryParams{After: float(5)}},
+		{name: "single", window: "3600", params: QueryParams{Single: true}},
+		{name: "sequence range", window: "3600", params: QueryParams{SeqStart: &seq}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			stopClock(t)
+			t.Setenv("DEFAULT_WINDOW_SECONDS", test.window)
+			params := test.params
+			ApplyDefaultWindow(&params)
+			if bound(params.Start) != bound(test.wantStart) {
+				t.Errorf("Start = %s, want %s", bound(params.Start), bound(test.wantStart))
+			}
+		})
+	}
+}
+
+func TestClampTimeRange(t *testing.T) {
+	tests := []struct {
+		name      string
+		maxSpan   string
+		params    QueryParams
+		wantStart *float64
+		wantAfter *float64
+		wantNote  string
+	}{
+		{name: "unset", params: QueryParams{}},
+		{
+			name:      "no lower bound",
+			maxSpan:   "100",
+			params:    QueryParams{},
+			wantStart: float(1599999900),
+			wantNote:  "start=1599999900",
+		},
+		{
+			name:      "span too long",
+			maxSpan:   "100",
+			params:    QueryParams{Start: float(0), End: float(1000)},
+			wantStart: float(900),
+			wantNote:  "start=900",
+		},
+		{
+			name:      "span within the limit",
+			maxSpan:   "100",
+			params:    QueryParams{Start: float(950), End: float(1000)},
+			wantStart: float(950),
+		},
+		{
+			name:      "polling cursor too old",
+			maxSpan:   "100",
+			params:    QueryParams{After: float(0)},
+			wantAfter: float(1599999900),
+			wantNote:  "after=1599999900",
+		},
+		{name: "unclamped", maxSpan: "100", params: QueryParams{Unclamped: true}},
+		{name: "single", maxSpan: "100", params: QueryParams{Single: true}},
+		{
+			name:      "single from an old start",
+			maxSpan:   "100",
+			params:    QueryParams{Single: true, Start: float(0)},
+			wantStart: float(0),
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			stopClock(t)
+			t.Setenv("MAX_QUERY_SPAN_SECONDS", test.maxSpan)
+			params := test.params
+			if note := ClampTimeRange(&params); note != test.wantNote {
+				t.Errorf("ClampTimeRange() = %q, want %q", note, test.wantNote)
+			}
+			if bound(params.Start) != bound(test.wantStart) {
+				t.Errorf("Start = %s, want %s", bound(params.Start), bound(test.wantStart))
+			}
+			if bound(params.After) != bound(test.wantAfter) {
+				t.Errorf("After = %s, want %s", bound(params.After), bound(test.wantAfter))
+			}
+		})
+	}
+}
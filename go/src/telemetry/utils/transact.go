@@ -0,0 +1,159 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go/aws"
+)
+
+// DynamoDbTransactWriteAPI defines interface for TransactWriteItems function.
+type DynamoDbTransactWriteAPI interface {
+	TransactWriteItems(
+		ctx context.Context,
+		params *dynamodb.TransactWriteItemsInput,
+		optFns ...func(*dynamodb.Options),
+	) (*dynamodb.TransactWriteItemsOutput, error)
+}
+
+// TransactionCanceledError reports why a transaction was cancelled,
+// with a reason for each of its items, in order.
+type TransactionCanceledError struct {
+	Reasons []types.CancellationReason
+}
+
+func (err *TransactionCanceledError) Error() string {
+	var codes []string
+	for index := range err.Reasons {
+		if code := err.Code(index); code != "" && code != "None" {
+			codes = append(codes, fmt.Sprintf("item %d: %s", index, code))
+		}
+	}
+	return "transaction cancelled, " + strings.Join(codes, ", ")
+}
+
+// Code returns the cancellation code of the transaction's item at the index,
+// which is 'None' for items that played no part in the cancellation.
+func (err *TransactionCanceledError) Code(index int) string {
+	if index >= len(err.Reasons) || err.Reasons[index].Code == nil {
+		return ""
+	}
+	return *err.Reasons[index].Code
+}
+
+// hasCode reports whether any of the transaction's items was cancelled with the code.
+func (err *TransactionCanceledError) hasCode(code string) bool {
+	for index := range err.Reasons {
+		if err.Code(index) == code {
+			return true
+		}
+	}
+	return false
+}
+
+// TransactWriteItems writes the items in a single transaction, so that either all or none of them
+// are written. A cancelled transaction is returned as a *TransactionCanceledError.
+func TransactWriteItems(
+	ctx context.Context,
+	api DynamoDbTransactWriteAPI,
+	items []types.TransactWriteItem,
+) error {
+	_, err := api.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{TransactItems: items})
+	var canceled *types.TransactionCanceledException
+	if errors.As(err, &canceled) {
+		return &TransactionCanceledError{Reasons: canceled.CancellationReasons}
+	}
+	return err
+}
+
+// BuildReadingWithStatus builds a transaction that writes a reading along with its device's
+// LastSeen time. When the reading has a SequenceNum, the device's LatestSequence is advanced
+// in the same update, which fails unless the sequence is newer. When an idempotency key is given,
+// its marker is written too, which fails if the key was already used.
+func BuildReadingWithStatus(
+	item map[string]types.AttributeValue,
+	project string,
+	idempotencyKey string,
+) []types.TransactWriteItem {
+	tenant, _ := StringAttribute(item, "TenantId")
+	deviceId, _ := StringAttribute(item, "DeviceId")
+	heartbeat := BuildHeartbeatUpdate(tenant, project, deviceId, Now())
+	status := &types.Update{
+		TableName:                 heartbeat.TableName,
+		Key:                       heartbeat.Key,
+		UpdateExpression:          heartbeat.UpdateExpression,
+		ExpressionAttributeValues: heartbeat.ExpressionAttributeValues,
+	}
+	if sequence, sequenced, _ := SequenceNumber(item); sequenced {
+		update := BuildSequenceUpdate(tenant, project, deviceId, sequence)
+		status.UpdateExpression = aws.String(*status.UpdateExpression + ", LatestSequence = :sequence")
+		status.ConditionExpression = update.ConditionExpression
+		status.ExpressionAttributeValues[":sequence"] = &types.AttributeValueMemberN{
+			Value: strconv.FormatInt(sequence, 10),
+		}
+	}
+
+	items := []types.TransactWriteItem{
+		{Put: &types.Put{TableName: heartbeat.TableName, Item: item}},
+		{Update: status},
+	}
+	if idempotencyKey != "" {
+		items = append(items, types.TransactWriteItem{
+			Put: buildIdempotencyMarkerPut(tenant, project, idempotencyKey),
+		})
+	}
+	return items
+}
+
+// PutReadingWithStatus writes a reading and updates its device's status in one transaction,
+// built by BuildReadingWithStatus. It reports whether the write was a duplicate of an earlier one
+// with the same idempotency key, in which case nothing was written, and returns ErrStaleSequence
+// when the reading's sequence isn't newer than the device's latest.
+func PutReadingWithStatus(
+	ctx context.Context,
+	api DynamoDbTransactWriteAPI,
+	item map[string]types.AttributeValue,
+	project string,
+	idempotencyKey string,
+) (bool, error) {
+	err := TransactWriteItems(ctx, api, BuildReadingWithStatus(item, project, idempotencyKey))
+	var canceled *TransactionCanceledError
+	if !errors.As(err, &canceled) {
+		return false, err
+	}
+	const conditionFailed = "ConditionalCheckFailed"
+	if idempotencyKey != "" && canceled.Code(2) == conditionFailed {
+		return true, nil
+	}
+	if canceled.Code(1) == conditionFailed {
+		return false, ErrStaleSequence
+	}
+	return false, err
+}
+
+// TransactionErrorResponse maps a failed transaction to the response for its cancellation reasons:
+// a 409 for conflicting writes, a 503 with Retry-After when throttled, a 507 when an item collection
+// is full, and a 400 for an invalid item. Other errors are handled as by StorageErrorResponse.
+func TransactionErrorResponse(err error, message string) (events.APIGatewayProxyResponse, error) {
+	var canceled *TransactionCanceledError
+	if !errors.As(err, &canceled) {
+		return StorageErrorResponse(err, message)
+	}
+	switch {
+	case canceled.hasCode("ConditionalCheckFailed"), canceled.hasCode("TransactionConflict"):
+		return ConflictResponse("Conflicting write to the same items, retry the request")
+	case canceled.hasCode("ThrottlingError"), canceled.hasCode("ProvisionedThroughputExceeded"):
+		return ServiceUnavailableResponse("Table is throttling requests, retry later", ThrottleRetryAfter())
+	case canceled.hasCode("ItemCollectionSizeLimitExceeded"):
+		return InsufficientStorageResponse("Item collection has reached its size limit")
+	case canceled.hasCode("ValidationError"):
+		return BadRequestResponse(err.Error())
+	}
+	return InternalErrorResponse(message)
+}
@@ -0,0 +1,159 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// fakeTransactor answers TransactWriteItems with a fixed error, recording the transactions.
+type fakeTransactor struct {
+	err    error
+	inputs []*dynamodb.TransactWriteItemsInput
+}
+
+func (f *fakeTransactor) TransactWriteItems(
+	ctx context.Context,
+	input *dynamodb.TransactWriteItemsInput,
+	optFns ...func(*dynamodb.Options),
+) (*dynamodb.TransactWriteItemsOutput, error) {
+	f.inputs = append(f.inputs, input)
+	return &dynamodb.TransactWriteItemsOutput{}, f.err
+}
+
+// canceled builds a cancelled transaction's error with a reason code for each of its items.
+func canceled(codes ...string) error {
+	reasons := make([]types.CancellationReason, len(codes))
+	for i, code := range codes {
+		reasons[i].Code = aws.String(code)
+	}
+	return &types.TransactionCanceledException{CancellationReasons: reasons}
+}
+
+func TestBuildReadingWithStatus(t *testing.T) {
+	tests := []struct {
+		name           string
+		item           map[string]types.AttributeValue
+		idempotencyKey string
+		wantItems      int
+		wantCondition  bool
+	}{
+		{
+			name:      "reading and status",
+			item:      map[string]types.AttributeValue{"DeviceId": stringAttr("d1"), "EpochTime": numberAttr("1")},
+			wantItems: 2,
+		},
+		{
+			name: "sequenced reading",
+			item: map[string]types.AttributeValue{
+				"DeviceId": stringAttr("d1"), "EpochTime": numberAttr("1"), "SequenceNum": numberAttr("7"),
+			},
+			wantItems:     2,
+			wantCondition: true,
+		},
+		{
+			name:           "idempotency marker",
+			item:           map[string]types.AttributeValue{"DeviceId": stringAttr("d1"), "EpochTime": numberAttr("1")},
+			idempotencyKey: "k1",
+			wantItems:      3,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			stopClock(t)
+			items := BuildReadingWithStatus(test.item, "sensors", test.idempotencyKey)
+			if len(items) != test.wantItems {
+				t.Fatalf("BuildReadingWithStatus() = %d items, want %d", len(items), test.wantItems)
+			}
+			if items[0].Put == nil || items[0].Put.ConditionExpression != nil {
+				t.Errorf("first item = %+v, want the reading's unconditional put", items[0])
+			}
+			status := items[1].Update
+			if status == nil {
+				t.Fatalf("second item = %+v, want the device's status update", items[1])
+			}
+			if key := status.Key["ProjectId#DeviceId"]; !reflect.DeepEqual(key, stringAttr("status#sensors#d1")) {
+				t.Errorf("status key = %v, want status#sensors#d1", key)
+			}
+			if (status.ConditionExpression != nil) != test.wantCondition {
+				t.Errorf("status condition = %v, want a condition %v", aws.ToString(status.ConditionExpression), test.wantCondition)
+			}
+			if test.wantCondition && status.ExpressionAttributeValues[":sequence"] == nil {
+				t.Errorf("status values = %v, want the sequence", status.ExpressionAttributeValues)
+			}
+			if test.idempotencyKey != "" && items[2].Put.ConditionExpression == nil {
+				t.Errorf("marker = %+v, want a conditional put", items[2].Put)
+			}
+		})
+	}
+}
+
+func TestPutReadingWithStatus(t *testing.T) {
+	failure := errors.New("network")
+	tests := []struct {
+		name          string
+		err           error
+		wantDuplicate bool
+		wantErr       error
+		wantCanceled  bool
+	}{
+		{name: "written"},
+		{name: "duplicate", err: canceled("None", "None", "ConditionalCheckFailed"), wantDuplicate: true},
+		{name: "stale sequence", err: canceled("None", "ConditionalCheckFailed", "None"), wantErr: ErrStaleSequence},
+		{name: "conflict", err: canceled("TransactionConflict", "None", "None"), wantCanceled: true},
+		{name: "other error", err: failure, wantErr: failure},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			api := &fakeTransactor{err: test.err}
+			item := map[string]types.AttributeValue{"DeviceId": stringAttr("d1"), "EpochTime": numberAttr("1")}
+
+			duplicate, err := PutReadingWithStatus(context.Background(), api, item, "sensors", "k1")
+			if duplicate != test.wantDuplicate {
+				t.Errorf("PutReadingWithStatus() duplicate = %v, want %v", duplicate, test.wantDuplicate)
+			}
+			var canceledErr *TransactionCanceledError
+			switch {
+			case test.wantCanceled:
+				if !errors.As(err, &canceledErr) {
+					t.Errorf("PutReadingWithStatus() error = %v, want a cancelled transaction", err)
+				}
+			case !errors.Is(err, test.wantErr):
+				t.Errorf("PutReadingWithStatus() error = %v, want %v", err, test.wantErr)
+			}
+			if len(api.inputs) != 1 || len(api.inputs[0].TransactItems) != 3 {
+				t.Errorf("transactions = %v, want one of 3 items", api.inputs)
+			}
+		})
+	}
+}
+
+func TestTransactionErrorResponse(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus int
+	}{
+		{name: "condition failed", err: canceled("None", "ConditionalCheckFailed"), wantStatus: 409},
+		{name: "conflict", err: canceled("TransactionConflict", "None"), wantStatus: 409},
+		{name: "throttled", err: canceled("ThrottlingError", "None"), wantStatus: 503},
+		{name: "item collection full", err: canceled("ItemCollectionSizeLimitExceeded", "None"), wantStatus: 507},
+		{name: "invalid item", err: canceled("ValidationError", "None"), wantStatus: 400},
+		{name: "unknown reason", err: canceled("None", "None"), wantStatus: 500},
+		{name: "not a transaction", err: errors.New("network"), wantStatus: 500},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := TransactWriteItems(context.Background(), &fakeTransactor{err: test.err}, nil)
+			response, _ := TransactionErrorResponse(err, "Failed to add to table")
+			if response.StatusCode != test.wantStatus {
+				t.Errorf("TransactionErrorResponse() = %d, want %d, body %s", response.StatusCode, test.wantStatus, response.Body)
+			}
+		})
+	}
+}
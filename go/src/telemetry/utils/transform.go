@@ -0,0 +1,154 @@
+package utils
+
+import (
+	"reflect"
+	"sort"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// Stride thins a series of items by keeping only those at indices 0, n, 2n, ...
+// Items should already be in their final order, so the kept points are evenly spaced.
+func Stride(
+	items []map[string]types.AttributeValue,
+	n int,
+) []map[string]types.AttributeValue {
+	if n <= 1 {
+		return items
+	}
+	strided := make([]map[string]types.AttributeValue, 0, (len(items)+n-1)/n)
+	for i := 0; i < len(items); i += n {
+		strided = append(strided, items[i])
+	}
+	return strided
+}
+
+// StableSortReadings orders items by their sort key, as named by SortKeyAttribute, breaking ties
+// with the optional SequenceNum attribute, so readings recorded within the same second keep the
+// order they were generated in.
+// Items without a SequenceNum sort before those with one, and otherwise keep their relative order.
+func StableSortReadings(items []map[string]types.AttributeValue) {
+	sortKey := SortKeyAttribute()
+	sort.SliceStable(items, func(i, j int) bool {
+		return readingBefore(items[i], items[j], sortKey)
+	})
+}
+
+// readingBefore reports whether reading a comes before reading b, in the order of StableSortReadings.
+func readingBefore(a map[string]types.AttributeValue, b map[string]types.AttributeValue, sortKey string) bool {
+	aTime, _ := NumberAttribute(a, sortKey)
+	bTime, _ := NumberAttribute(b, sortKey)
+	if aTime != bTime {
+		return aTime < bTime
+	}
+	aSeq, aSeqOk := NumberAttribute(a, "SequenceNum")
+	bSeq, bSeqOk := NumberAttribute(b, "SequenceNum")
+	if aSeqOk != bSeqOk {
+		return bSeqOk
+	}
+	return aSeq < bSeq
+}
+
+// ChangesOnly drops the items whose field holds the same value as the previous kept item's,
+// keeping only the readings where the value changed, for sensors that report the same value
+// for long stretches. Readings are compared in the order of StableSortReadings, whatever the order
+// of the items, and the kept items stay in their original order. The first reading with the field
+// is always kept, as are readings without it, which are otherwise skipped over.
+func ChangesOnly(
+	items []map[string]types.AttributeValue,
+	field string,
+) []map[string]types.AttributeValue {
+	sortKey := SortKeyAttribute()
+	order := make([]int, len(items))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return readingBefore(items[order[i]], items[order[j]], sortKey)
+	})
+
+	unchanged := make([]bool, len(items))
+	var previous types.AttributeValue
+	for _, i := range order {
+		value, ok := items[i][field]
+		if !ok {
+			continue
+		}
+		if previous != nil && sameAttributeValue(previous, value) {
+			unchanged[i] = true
+			continue
+		}
+		previous = value
+	}
+
+	changes := make([]map[string]types.AttributeValue, 0, len(items))
+	for i, item := range items {
+		if !unchanged[i] {
+			changes = append(changes, item)
+		}
+	}
+	return changes
+}
+
+// sameAttributeValue reports whether two attribute values are equal,
+// comparing numbers by value rather than by how they are written.
+func sameAttributeValue(a types.AttributeValue, b types.AttributeValue) bool {
+	aNumber, aOk := a.(*types.AttributeValueMemberN)
+	bNumber, bOk := b.(*types.AttributeValueMemberN)
+	if aOk && bOk {
+		aValue, aErr := strconv.ParseFloat(aNumber.Value, 64)
+		bValue, bErr := strconv.ParseFloat(bNumber.Value, 64)
+		if aErr == nil && bErr == nil {
+			return aValue == bValue
+		}
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// compositeKeyAttributes are the internal key attributes built from a reading's identifiers,
+// which clients don't need, since the identifiers themselves are stored too.
+var compositeKeyAttributes = []string{"ProjectId#DeviceId", "ProjectId#LocationId"}
+
+// CleanItem returns a copy of the item without its composite key attributes,
+// leaving the plain ProjectId, DeviceId, and LocationId.
+func CleanItem(item map[string]types.AttributeValue) map[string]types.AttributeValue {
+	clean := make(map[string]types.AttributeValue, len(item))
+	for name, value := range item {
+		if !contains(compositeKeyAttributes, name) {
+			clean[name] = value
+		}
+	}
+	return clean
+}
+
+// CleanItems cleans each of the items with CleanItem.
+func CleanItems(items []map[string]types.AttributeValue) []map[string]types.AttributeValue {
+	if items == nil {
+		return nil
+	}
+	clean := make([]map[string]types.AttributeValue, len(items))
+	for i, item := range items {
+		clean[i] = CleanItem(item)
+	}
+	return clean
+}
+
+// CleanKeyedItems cleans each of the items keyed by an identifier, as reduced by
+// LatestPerLocation or EarliestPerDevice, with CleanItem.
+func CleanKeyedItems(
+	keyed map[string]map[string]types.AttributeValue,
+) map[string]map[string]types.AttributeValue {
+	clean := make(map[string]map[string]types.AttributeValue, len(keyed))
+	for key, item := range keyed {
+		clean[key] = CleanItem(item)
+	}
+	return clean
+}
+
+// reverseItems reverses the order of items in place.
+func reverseItems(items []map[string]types.AttributeValue) {
+	for i, j := 0, len(items)-1; i < j; i, j = i+1, j-1 {
+		items[i], items[j] = items[j], items[i]
+	}
+}
@@ -0,0 +1,220 @@
+package utils
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// numberAttr and stringAttr build attribute values for test items.
+func numberAttr(value string) types.AttributeValue {
+	return &types.AttributeValueMemberN{Value: value}
+}
+
+func stringAttr(value string) types.AttributeValue {
+	return &types.AttributeValueMemberS{Value: value}
+}
+
+// epochTimes lists the EpochTime of each item, to compare the items' order.
+func epochTimes(items []map[string]types.AttributeValue) []string {
+	times := make([]string, len(items))
+	for i, item := range items {
+		if number, ok := item["EpochTime"].(*types.AttributeValueMemberN); ok {
+			times[i] = number.Value
+		}
+	}
+	return times
+}
+
+// readingsAt builds a reading at each of the EpochTimes.
+func readingsAt(times ...string) []map[string]types.AttributeValue {
+	items := make([]map[string]types.AttributeValue, len(times))
+	for i, epochTime := range times {
+		items[i] = map[string]types.AttributeValue{"EpochTime": numberAttr(epochTime)}
+	}
+	return items
+}
+
+func TestStride(t *testing.T) {
+	tests := []struct {
+		name  string
+		items []map[string]types.AttributeValue
+		n     int
+		want  []string
+	}{
+		{name: "every item", items: readingsAt("1", "2", "3"), n: 1, want: []string{"1", "2", "3"}},
+		{name: "nonpositive", items: readingsAt("1", "2", "3"), n: 0, want: []string{"1", "2", "3"}},
+		{name: "every other item", items: readingsAt("1", "2", "3", "4", "5"), n: 2, want: []string{"1", "3", "5"}},
+		{name: "more than the items", items: readingsAt("1", "2"), n: 5, want: []string{"1"}},
+		{name: "no items", items: readingsAt(), n: 3, want: []string{}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := epochTimes(Stride(test.items, test.n)); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("Stride() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestStableSortReadings(t *testing.T) {
+	sequenced := func(epochTime string, sequence string, id string) map[string]types.AttributeValue {
+		item := map[string]types.AttributeValue{"EpochTime": numberAttr(epochTime), "Id": stringAttr(id)}
+		if sequence != "" {
+			item["SequenceNum"] = numberAttr(sequence)
+		}
+		return item
+	}
+	offset := func(offset string, id string) map[string]types.AttributeValue {
+		return map[string]types.AttributeValue{"EpochTime": numberAttr("1"), "Offset": numberAttr(offset), "Id": stringAttr(id)}
+	}
+	tests := []struct {
+		name    string
+		sortKey string
+		items   []map[string]types.AttributeValue
+		want    []string
+	}{
+		{
+			name:  "by EpochTime",
+			items: []map[string]types.AttributeValue{sequenced("3", "", "a"), sequenced("1", "", "b"), sequenced("2", "", "c")},
+			want:  []string{"b", "c", "a"},
+		},
+		{
+			name:  "ties by SequenceNum",
+			items: []map[string]types.AttributeValue{sequenced("1", "2", "a"), sequenced("1", "1", "b")},
+			want:  []string{"b", "a"},
+		},
+		{
+			name:  "unsequenced first, in their order",
+			items: []map[string]types.AttributeValue{sequenced("1", "1", "a"), sequenced("1", "", "b"), sequenced("1", "", "c")},
+			want:  []string{"b", "c", "a"},
+		},
+		{
+			name:    "by the configured sort key",
+			sortKey: "Offset",
+			items:   []map[string]types.AttributeValue{offset("30", "a"), offset("10", "b"), offset("20", "c")},
+			want:    []string{"b", "c", "a"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Setenv("SORT_KEY_ATTR", test.sortKey)
+			StableSortReadings(test.items)
+			got := make([]string, len(test.items))
+			for i, item := range test.items {
+				got[i] = item["Id"].(*types.AttributeValueMemberS).Value
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("StableSortReadings() order = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestChangesOnly(t *testing.T) {
+	reading := func(epochTime string, value types.AttributeValue) map[string]types.AttributeValue {
+		item := map[string]types.AttributeValue{"EpochTime": numberAttr(epochTime)}
+		if value != nil {
+			item["Status"] = value
+		}
+		return item
+	}
+	tests := []struct {
+		name  string
+		items []map[string]types.AttributeValue
+		want  []string
+	}{
+		{name: "no items", want: []string{}},
+		{
+			name: "repeats dropped",
+			items: []map[string]types.AttributeValue{
+				reading("1", stringAttr("ok")), reading("2", stringAttr("ok")),
+				reading("3", stringAttr("low")), reading("4", stringAttr("ok")),
+			},
+			want: []string{"1", "3", "4"},
+		},
+		{
+			name: "numbers compared by value",
+			items: []map[string]types.AttributeValue{
+				reading("1", numberAttr("20")), reading("2", numberAttr("20.0")), reading("3", numberAttr("2e1")),
+			},
+			want: []string{"1"},
+		},
+		{
+			name: "compared in reading order, kept in their own",
+			items: []map[string]types.AttributeValue{
+				reading("3", stringAttr("low")), reading("2", stringAttr("ok")), reading("1", stringAttr("ok")),
+			},
+			want: []string{"3", "1"},
+		},
+		{
+			name: "readings without the field kept and skipped over",
+			items: []map[string]types.AttributeValue{
+				reading("1", stringAttr("ok")), reading("2", nil), reading("3", stringAttr("ok")),
+			},
+			want: []string{"1", "2"},
+		},
+		{
+			name:  "number and string of the same text differ",
+			items: []map[string]types.AttributeValue{reading("1", numberAttr("1")), reading("2", stringAttr("1"))},
+			want:  []string{"1", "2"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := epochTimes(ChangesOnly(test.items, "Status")); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("ChangesOnly() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestCleanItems(t *testing.T) {
+	tests := []struct {
+		name  string
+		items []map[string]types.AttributeValue
+		want  []map[string]types.AttributeValue
+	}{
+		{name: "nil", items: nil, want: nil},
+		{
+			name: "composite keys dropped",
+			items: []map[string]types.AttributeValue{{
+				"ProjectId#DeviceId":   stringAttr("sensors#d1"),
+				"ProjectId#LocationId": stringAttr("sensors#roof"),
+				"DeviceId":             stringAttr("d1"),
+				"EpochTime":            numberAttr("1"),
+			}},
+			want: []map[string]types.AttributeValue{{
+				"DeviceId":  stringAttr("d1"),
+				"EpochTime": numberAttr("1"),
+			}},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := CleanItems(test.items); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("CleanItems() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestCleanKeyedItems(t *testing.T) {
+	keyed := map[string]map[string]types.AttributeValue{
+		"roof": {
+			"ProjectId#LocationId": stringAttr("sensors#roof"),
+			"LocationId":           stringAttr("roof"),
+			"EpochTime":            numberAttr("1"),
+		},
+	}
+	want := map[string]map[string]types.AttributeValue{
+		"roof": {
+			"LocationId": stringAttr("roof"),
+			"EpochTime":  numberAttr("1"),
+		},
+	}
+	if got := CleanKeyedItems(keyed); !reflect.DeepEqual(got, want) {
+		t.Errorf("CleanKeyedItems() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,111 @@
+package utils
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// defaultMaxAttributes is the most top-level attributes a POST body may have
+// when MAX_ATTRIBUTES is unset.
+const defaultMaxAttributes = 100
+
+// defaultRequiredFields must be present in every POST body, regardless of project.
+var defaultRequiredFields = []string{"EpochTime", "DeviceId"}
+
+// RequiredFields returns the fields that a POST body must contain for the project.
+// Projects can require additional fields through a comma-separated
+// REQUIRED_FIELDS_<ProjectId> environment variable, e.g. REQUIRED_FIELDS_scitizen=LocationId.
+func RequiredFields(project string) []string {
+	required := append([]string{}, defaultRequiredFields...)
+	for _, field := range splitList(os.Getenv(ProjectEnvName("REQUIRED_FIELDS_", project))) {
+		if !contains(required, field) {
+			required = append(required, field)
+		}
+	}
+	return required
+}
+
+// MissingFields lists the required fields that are absent from the item, in the order required.
+func MissingFields(itemMap map[string]interface{}, required []string) []string {
+	var missing []string
+	for _, field := range required {
+		if _, ok := itemMap[field]; !ok {
+			missing = append(missing, field)
+		}
+	}
+	return missing
+}
+
+// MaxAttributes returns the most top-level attributes a POST body may have,
+// from the MAX_ATTRIBUTES environment variable.
+func MaxAttributes() int {
+	return envInt("MAX_ATTRIBUTES", defaultMaxAttributes)
+}
+
+// MaxNestedAttributes returns the most attributes a POST body may have in its nested objects
+// and lists, from the MAX_NESTED_ATTRIBUTES environment variable. Zero means unlimited.
+func MaxNestedAttributes() int {
+	return envInt("MAX_NESTED_ATTRIBUTES", 0)
+}
+
+// ValidateAttributeCount rejects an item with more than max top-level attributes,
+// which usually means buggy firmware has flattened a large object into the body.
+// A max of zero or less disables the check.
+func ValidateAttributeCount(itemMap map[string]interface{}, max int) error {
+	if max > 0 && len(itemMap) > max {
+		return fmt.Errorf("Item has %d attributes, more than the limit of %d", len(itemMap), max)
+	}
+	return nil
+}
+
+// ValidateNestedAttributeCount rejects an item whose nested objects and lists hold more than
+// max attributes and elements in total. A max of zero or less disables the check.
+func ValidateNestedAttributeCount(itemMap map[string]interface{}, max int) error {
+	if max <= 0 {
+		return nil
+	}
+	nested := 0
+	for _, value := range itemMap {
+		nested += countNested(value)
+	}
+	if nested > max {
+		return fmt.Errorf("Item has %d nested attributes, more than the limit of %d", nested, max)
+	}
+	return nil
+}
+
+func countNested(value interface{}) int {
+	count := 0
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for _, child := range v {
+			count += 1 + countNested(child)
+		}
+	case []interface{}:
+		for _, child := range v {
+			count += 1 + countNested(child)
+		}
+	}
+	return count
+}
+
+// splitList splits a comma-separated list, dropping blank entries.
+func splitList(list string) []string {
+	var values []string
+	for _, value := range strings.Split(list, ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+func contains(values []string, target string) bool {
+	for _, value := range values {
+		if value == target {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,117 @@
+package utils
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRequiredFields(t *testing.T) {
+	tests := []struct {
+		name     string
+		required string
+		want     []string
+	}{
+		{name: "default", want: []string{"EpochTime", "DeviceId"}},
+		{name: "additional", required: "LocationId, Battery", want: []string{"EpochTime", "DeviceId", "LocationId", "Battery"}},
+		{name: "repeated default", required: "DeviceId,,LocationId", want: []string{"EpochTime", "DeviceId", "LocationId"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Setenv("REQUIRED_FIELDS_sensors", test.required)
+			if got := RequiredFields("sensors"); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("RequiredFields() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestMissingFields(t *testing.T) {
+	required := []string{"EpochTime", "DeviceId", "LocationId"}
+	tests := []struct {
+		name string
+		item map[string]interface{}
+		want []string
+	}{
+		{name: "complete", item: map[string]interface{}{"EpochTime": 1.0, "DeviceId": "d1", "LocationId": "roof"}},
+		{name: "missing in order", item: map[string]interface{}{"DeviceId": "d1"}, want: []string{"EpochTime", "LocationId"}},
+		{name: "null counts as present", item: map[string]interface{}{"EpochTime": 1.0, "DeviceId": nil, "LocationId": ""}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := MissingFields(test.item, required); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("MissingFields() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestValidateAttributeCount(t *testing.T) {
+	item := map[string]interface{}{"a": 1.0, "b": 2.0, "c": 3.0}
+	tests := []struct {
+		name    string
+		max     int
+		wantErr bool
+	}{
+		{name: "under", max: 4},
+		{name: "at", max: 3},
+		{name: "over", max: 2, wantErr: true},
+		{name: "disabled", max: 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := ValidateAttributeCount(item, test.max); (err != nil) != test.wantErr {
+				t.Errorf("ValidateAttributeCount() error = %v, wantErr %v", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateNestedAttributeCount(t *testing.T) {
+	// The nested object and list hold five attributes and elements between them.
+	item := map[string]interface{}{
+		"DeviceId": "d1",
+		"Config":   map[string]interface{}{"a": 1.0, "b": map[string]interface{}{"c": 2.0}},
+		"Samples":  []interface{}{1.0, 2.0},
+	}
+	tests := []struct {
+		name    string
+		max     int
+		wantErr bool
+	}{
+		{name: "at", max: 5},
+		{name: "over", max: 4, wantErr: true},
+		{name: "disabled", max: 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := ValidateNestedAttributeCount(item, test.max); (err != nil) != test.wantErr {
+				t.Errorf("ValidateNestedAttributeCount() error = %v, wantErr %v", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestMaxAttributes(t *testing.T) {
+	tests := []struct {
+		name       string
+		max        string
+		nested     string
+		want       int
+		wantNested int
+	}{
+		{name: "defaults", want: defaultMaxAttributes},
+		{name: "configured", max: "10", nested: "50", want: 10, wantNested: 50},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Setenv("MAX_ATTRIBUTES", test.max)
+			t.Setenv("MAX_NESTED_ATTRIBUTES", test.nested)
+			if got := MaxAttributes(); got != test.want {
+				t.Errorf("MaxAttributes() = %d, want %d", got, test.want)
+			}
+			if got := MaxNestedAttributes(); got != test.wantNested {
+				t.Errorf("MaxNestedAttributes() = %d, want %d", got, test.wantNested)
+			}
+		})
+	}
+}
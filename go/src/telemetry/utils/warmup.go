@@ -0,0 +1,29 @@
+package utils
+
+import (
+	"encoding/json"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// IsWarmup reports whether a Lambda payload is a scheduled warmup ping, sent to keep the function
+// warm, rather than an API Gateway request. Warmup events carry a 'source' field, as in
+// {"source": "aws.events"}, and no request context.
+func IsWarmup(payload json.RawMessage) bool {
+	var event struct {
+		Source         string          `json:"source"`
+		RequestContext json.RawMessage `json:"requestContext"`
+	}
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return false
+	}
+	return event.Source != "" && len(event.RequestContext) == 0
+}
+
+// WarmupResponse answers a warmup ping, without doing any work.
+func WarmupResponse() (events.APIGatewayProxyResponse, error) {
+	return events.APIGatewayProxyResponse{
+		StatusCode: 200,
+		Headers:    BaseHeaders(),
+	}, nil
+}
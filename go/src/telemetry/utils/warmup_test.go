@@ -0,0 +1,50 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+func TestIsWarmup(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload string
+		want    bool
+	}{
+		{name: "scheduled event", payload: `{"source": "aws.events", "detail-type": "Scheduled Event"}`, want: true},
+		{name: "custom warmer", payload: `{"source": "warmer"}`, want: true},
+		{name: "v1 request", payload: `{"httpMethod": "GET", "requestContext": {"stage": "prod"}}`},
+		{name: "request with a source", payload: `{"source": "x", "requestContext": {"stage": "prod"}}`},
+		{name: "no source", payload: `{}`},
+		{name: "not an object", payload: `[1]`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := IsWarmup(json.RawMessage(test.payload)); got != test.want {
+				t.Errorf("IsWarmup() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestAdaptWarmup(t *testing.T) {
+	served := false
+	handler := Adapt(func(request *Request) (events.APIGatewayProxyResponse, error) {
+		served = true
+		return events.APIGatewayProxyResponse{StatusCode: 500}, nil
+	})
+
+	response, err := handler(context.Background(), json.RawMessage(`{"source": "aws.events"}`))
+	if err != nil {
+		t.Fatalf("Adapt() error = %v", err)
+	}
+	if served {
+		t.Error("Adapt() passed the warmup ping to the handler")
+	}
+	if proxy, ok := response.(events.APIGatewayProxyResponse); !ok || proxy.StatusCode != 200 {
+		t.Errorf("Adapt() = %#v, want a 200 response", response)
+	}
+}
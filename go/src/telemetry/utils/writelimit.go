@@ -0,0 +1,95 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// ErrWriteQueueFull is returned when a write is shed because too many are already waiting.
+var ErrWriteQueueFull = errors.New("too many writes in progress, retry later")
+
+// WriteLimiter caps how many of a batch's writes run at once, so that a burst of readings
+// buffered by devices reconnecting together doesn't exceed the table's write capacity.
+// Writes beyond the concurrency wait their turn, up to a bounded queue, and any more are shed
+// with ErrWriteQueueFull. A nil WriteLimiter runs writes one at a time instead.
+type WriteLimiter struct {
+	slots    chan struct{}
+	admitted chan struct{}
+}
+
+// NewWriteLimiter returns a WriteLimiter that runs at most concurrency writes at once,
+// with at most queueSize more waiting. It returns nil, which runs writes one at a time,
+// when concurrency isn't positive.
+func NewWriteLimiter(concurrency int, queueSize int) *WriteLimiter {
+	if concurrency <= 0 {
+		return nil
+	}
+	if queueSize < 0 {
+		queueSize = 0
+	}
+	return &WriteLimiter{
+		slots:    make(chan struct{}, concurrency),
+		admitted: make(chan struct{}, concurrency+queueSize),
+	}
+}
+
+var (
+	sharedWriteLimiter     *WriteLimiter
+	sharedWriteLimiterOnce sync.Once
+)
+
+// SharedWriteLimiter returns the WriteLimiter shared by the writes of a warm Lambda,
+// configured by the WRITE_CONCURRENCY and WRITE_QUEUE_SIZE environment variables.
+// Writes run one at a time when WRITE_CONCURRENCY is unset.
+func SharedWriteLimiter() *WriteLimiter {
+	sharedWriteLimiterOnce.Do(func() {
+		sharedWriteLimiter = NewWriteLimiter(envInt("WRITE_CONCURRENCY", 0), envInt("WRITE_QUEUE_SIZE", 0))
+	})
+	return sharedWriteLimiter
+}
+
+// DoAll runs count writes, each given its index, and returns their errors by index.
+// The writes run concurrently through Do, or one after another for a nil WriteLimiter.
+func (limiter *WriteLimiter) DoAll(ctx context.Context, count int, write func(index int) error) []error {
+	errs := make([]error, count)
+	if limiter == nil {
+		for index := range errs {
+			errs[index] = write(index)
+		}
+		return errs
+	}
+	var wait sync.WaitGroup
+	for index := range errs {
+		wait.Add(1)
+		go func(index int) {
+			defer wait.Done()
+			errs[index] = limiter.Do(ctx, func() error { return write(index) })
+		}(index)
+	}
+	wait.Wait()
+	return errs
+}
+
+// Do runs the write once there is room for it, returning its error. It returns
+// ErrWriteQueueFull without running the write when the queue is full, and the context's error
+// if the context is done while the write waits. A nil WriteLimiter runs the write straight away.
+func (limiter *WriteLimiter) Do(ctx context.Context, write func() error) error {
+	if limiter == nil {
+		return write()
+	}
+	select {
+	case limiter.admitted <- struct{}{}:
+	default:
+		return ErrWriteQueueFull
+	}
+	defer func() { <-limiter.admitted }()
+
+	select {
+	case limiter.slots <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	defer func() { <-limiter.slots }()
+	return write()
+}
@@ -0,0 +1,142 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"testing"
+)
+
+func TestNewWriteLimiter(t *testing.T) {
+	tests := []struct {
+		name        string
+		concurrency int
+		queueSize   int
+		wantNil     bool
+		wantAdmit   int
+	}{
+		{name: "unlimited", wantNil: true},
+		{name: "negative concurrency", concurrency: -1, queueSize: 5, wantNil: true},
+		{name: "with a queue", concurrency: 2, queueSize: 3, wantAdmit: 5},
+		{name: "negative queue", concurrency: 2, queueSize: -1, wantAdmit: 2},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			limiter := NewWriteLimiter(test.concurrency, test.queueSize)
+			if (limiter == nil) != test.wantNil {
+				t.Fatalf("NewWriteLimiter() = %v, want nil %v", limiter, test.wantNil)
+			}
+			if limiter != nil && cap(limiter.admitted) != test.wantAdmit {
+				t.Errorf("admits %d writes, want %d", cap(limiter.admitted), test.wantAdmit)
+			}
+		})
+	}
+}
+
+func TestWriteLimiterDo(t *testing.T) {
+	failed := errors.New("failed")
+
+	var unlimited *WriteLimiter
+	if err := unlimited.Do(context.Background(), func() error { return failed }); err != failed {
+		t.Errorf("Do() of a nil limiter error = %v, want the write's", err)
+	}
+
+	// One write runs and one waits, so a third is shed.
+	limiter := NewWriteLimiter(1, 1)
+	running := make(chan struct{})
+	release := make(chan struct{})
+	done := make(chan error, 2)
+	go func() {
+		done <- limiter.Do(context.Background(), func() error {
+			close(running)
+			<-release
+			return nil
+		})
+	}()
+	<-running
+	waiting := make(chan struct{})
+	go func() {
+		done <- limiter.Do(context.Background(), func() error {
+			close(waiting)
+			return failed
+		})
+	}()
+	// The waiting write holds its place in the queue before the third arrives.
+	for len(limiter.admitted) < 2 {
+		runtime.Gosched()
+	}
+	if err := limiter.Do(context.Background(), func() error { return nil }); !errors.Is(err, ErrWriteQueueFull) {
+		t.Errorf("Do() of a shed write error = %v, want ErrWriteQueueFull", err)
+	}
+	select {
+	case <-waiting:
+		t.Fatalf("queued write ran while another was running")
+	default:
+	}
+	close(release)
+	if err := <-done; err != nil {
+		t.Errorf("Do() of the running write error = %v", err)
+	}
+	if err := <-done; err != failed {
+		t.Errorf("Do() of the queued write error = %v, want the write's", err)
+	}
+
+	// A write that gives up waiting doesn't run.
+	busy := NewWriteLimiter(1, 1)
+	busy.slots <- struct{}{}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	ran := false
+	if err := busy.Do(ctx, func() error { ran = true; return nil }); !errors.Is(err, context.Canceled) || ran {
+		t.Errorf("Do() of a canceled write error = %v, ran %v, want context.Canceled without running", err, ran)
+	}
+	if len(busy.admitted) != 0 {
+		t.Errorf("canceled write still holds its place in the queue")
+	}
+}
+
+func TestWriteLimiterDoAll(t *testing.T) {
+	failed := errors.New("failed")
+	write := func(index int) error {
+		if index == 1 {
+			return failed
+		}
+		return nil
+	}
+
+	var sequential *WriteLimiter
+	if errs := sequential.DoAll(context.Background(), 3, write); errs[0] != nil || errs[1] != failed || errs[2] != nil {
+		t.Errorf("DoAll() of a nil limiter = %v, want the writes' errors by index", errs)
+	}
+
+	limiter := NewWriteLimiter(2, 5)
+	if errs := limiter.DoAll(context.Background(), 3, write); errs[0] != nil || errs[1] != failed || errs[2] != nil {
+		t.Errorf("DoAll() = %v, want the writes' errors by index", errs)
+	}
+
+	// A burst bigger than the concurrency and queue together has the rest shed.
+	burst := NewWriteLimiter(1, 1)
+	release := make(chan struct{})
+	done := make(chan []error)
+	go func() {
+		done <- burst.DoAll(context.Background(), 4, func(index int) error {
+			<-release
+			return nil
+		})
+	}()
+	for len(burst.admitted) < 2 {
+		runtime.Gosched()
+	}
+	close(release)
+	shed := 0
+	for _, err := range <-done {
+		if errors.Is(err, ErrWriteQueueFull) {
+			shed++
+		} else if err != nil {
+			t.Errorf("DoAll() of the burst error = %v", err)
+		}
+	}
+	if shed != 2 {
+		t.Errorf("shed %d writes of the burst, want 2", shed)
+	}
+}